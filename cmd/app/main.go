@@ -3,8 +3,10 @@ package main
 import (
 	"context"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/gorilla/sessions"
@@ -12,7 +14,11 @@ import (
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"github.com/ranjankuldeep/fakeNumber/internal/database"
+	"github.com/ranjankuldeep/fakeNumber/internal/idempotency"
 	"github.com/ranjankuldeep/fakeNumber/internal/lib"
+	"github.com/ranjankuldeep/fakeNumber/internal/mail"
+	"github.com/ranjankuldeep/fakeNumber/internal/notify"
+	"github.com/ranjankuldeep/fakeNumber/internal/providers"
 	"github.com/ranjankuldeep/fakeNumber/internal/routes"
 	"github.com/ranjankuldeep/fakeNumber/internal/runner"
 	"go.mongodb.org/mongo-driver/bson"
@@ -29,14 +35,28 @@ func main() {
 		log.Fatalf("Error loading .env file: %v", err)
 	}
 	e := echo.New()
+	e.IPExtractor, err = ipExtractor(os.Getenv("TRUSTED_PROXIES"))
+	if err != nil {
+		log.Fatalf("Error parsing TRUSTED_PROXIES: %v", err)
+	}
 	databaseName := os.Getenv("MONGODB_DATABASE")
 	uri := os.Getenv("MONGODB_URI")
 	log.Println(uri)
 
+	// MOCK_PROVIDER_URL points every upstream vendor call at cmd/mockprovider.
+	if mockURL := os.Getenv("MOCK_PROVIDER_URL"); mockURL != "" {
+		if err := providers.SetUpstreamOverride(mockURL); err != nil {
+			log.Fatalf("Error configuring mock provider: %v", err)
+		}
+		log.Printf("Upstream providers redirected to %s", mockURL)
+	}
+
+	e.Use(middleware.RequestID())
 	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
 		AllowOrigins:     []string{"http://localhost:5173", "http://localhost:5174", "https://paidsms.in", "https://makapyar.paidsms.in"},
 		AllowMethods:     []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodOptions},
-		AllowHeaders:     []string{"Authorization", "Content-Type"},
+		AllowHeaders:     []string{"Authorization", "Content-Type", idempotency.HeaderKey},
+		ExposeHeaders:    []string{echo.HeaderXRequestID},
 		AllowCredentials: true,
 	}))
 	client, err := database.ConnectDB(databaseName, uri)
@@ -50,6 +70,33 @@ func main() {
 	} else {
 		log.Printf("Database stats: %v", stats)
 	}
+	if err := runner.MigrateMoney(db); err != nil {
+		log.Fatalf("Error migrating amounts to paise: %v", err)
+	}
+	if err := runner.MigrateAPIKeys(db); err != nil {
+		log.Fatalf("Error migrating api keys: %v", err)
+	}
+	if err := runner.MigrateRechargeHistory(db); err != nil {
+		log.Fatalf("Error migrating recharge history: %v", err)
+	}
+	if err := runner.EnsureIndexes(db); err != nil {
+		log.Fatalf("Error ensuring indexes: %v", err)
+	}
+	if err := runner.MigrateAdminRoles(db); err != nil {
+		log.Fatalf("Error migrating admin roles: %v", err)
+	}
+	if err := runner.BootstrapSuperAdmin(db); err != nil {
+		log.Fatalf("Error bootstrapping super-admin: %v", err)
+	}
+	mailer, err := mail.FromEnv()
+	if err != nil {
+		log.Fatalf("Error configuring mail: %v", err)
+	}
+	mail.SetMailer(mailer)
+	if err := runner.MigrateNotificationChannels(db); err != nil {
+		log.Fatalf("Error migrating notification channels: %v", err)
+	}
+	notify.SetNotifier(notify.NewRouter(db))
 	go func() {
 		for {
 			err := lib.UpdateServerToken(db)
@@ -78,7 +125,11 @@ func main() {
 	routes.RegisterServiceDiscountRoutes(e)
 	routes.RegisterServerDiscountRoutes(e)
 	routes.RegisterBlockUsersRoutes(e)
-	go runner.MonitorOrders(db)
+	routes.RegisterAuditRoutes(e)
+	routes.RegisterNotificationRoutes(e)
+	go runner.StartOrderScheduler(db)
+	go runner.StartHoldSweeper(db)
+	go runner.StartMailOutbox(db)
 	go func() {
 		for {
 			runner.CheckAndBlockUsers(db)
@@ -89,6 +140,32 @@ func main() {
 	e.Logger.Fatal(e.Start(":8000"))
 }
 
+// ipExtractor decides where c.RealIP() comes from. Forwarding headers are
+// only honoured when the connection comes from one of the comma separated
+// CIDRs in trustedProxies; without any, the peer address is used as is.
+func ipExtractor(trustedProxies string) (echo.IPExtractor, error) {
+	options := []echo.TrustOption{
+		echo.TrustLoopback(false),
+		echo.TrustLinkLocal(false),
+		echo.TrustPrivateNet(false),
+	}
+	for _, entry := range strings.Split(trustedProxies, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, echo.TrustIPRange(ipNet))
+	}
+	if len(options) == 3 {
+		return echo.ExtractIPDirect(), nil
+	}
+	return echo.ExtractIPFromXFFHeader(options...), nil
+}
+
 func fetchDatabaseStats(db *mongo.Database) (bson.M, error) {
 	var result bson.M
 	err := db.RunCommand(context.TODO(), bson.D{{Key: "dbStats", Value: 1}}).Decode(&result)
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/mockprovider"
+)
+
+func main() {
+	addr := flag.String("addr", ":9000", "listen address")
+	stock := flag.Int("stock", -1, "numbers available per service code, negative for unlimited")
+	smsDelay := flag.Duration("sms-delay", 10*time.Second, "delay before an SMS is delivered")
+	code := flag.String("code", "", "OTP delivered, random when empty")
+	balance := flag.Float64("balance", 1000, "balance reported by every vendor")
+	price := flag.Float64("price", 10, "upstream price reported for every service code")
+	flag.Parse()
+
+	mock := mockprovider.New(mockprovider.Config{
+		DefaultStock: *stock,
+		SMSDelay:     *smsDelay,
+		SMSCode:      *code,
+		Balance:      *balance,
+		Price:        *price,
+	})
+	log.Printf("Mock provider listening on %s, start the API with MOCK_PROVIDER_URL=http://localhost%s", *addr, *addr)
+	log.Fatal(http.ListenAndServe(*addr, mock))
+}
@@ -0,0 +1,256 @@
+// Package apikeys manages the API keys users call the public API with. A user
+// may hold several named keys, each limited to a set of scopes and optionally
+// to an expiry time and a list of client IPs. Keys are shown once when they
+// are created and stored only as a hash.
+package apikeys
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/logs"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// ScopeBuy allows buying, polling and cancelling numbers. It implies
+	// ScopeRead, since buying needs the service list.
+	ScopeBuy = "buy"
+	// ScopeRead allows reading services and prices.
+	ScopeRead = "read"
+	// ScopeBalance allows reading the wallet balance.
+	ScopeBalance = "balance"
+)
+
+const (
+	keyPrefix = "fn_"
+	// prefixLength is how much of a key is kept in clear for display.
+	prefixLength = 8
+	// maxKeysPerUser bounds the active keys a user can hold.
+	maxKeysPerUser = 20
+	// touchInterval limits how often lastUsedAt is written for a busy key.
+	touchInterval = time.Minute
+)
+
+var (
+	ErrInvalidKey      = errors.New("invalid api key")
+	ErrExpired         = errors.New("api key expired")
+	ErrIPNotAllowed    = errors.New("ip not allowed for this api key")
+	ErrScopeNotAllowed = errors.New("api key does not allow this action")
+	ErrNotFound        = errors.New("api key not found")
+	ErrTooManyKeys     = errors.New("too many api keys")
+)
+
+func collection(db *mongo.Database) *mongo.Collection {
+	return models.InitializeAPIKeyCollection(db)
+}
+
+// Scopes lists every scope a key can be granted.
+func Scopes() []string {
+	return []string{ScopeBuy, ScopeRead, ScopeBalance}
+}
+
+// Hash is how a key is stored and looked up. Keys are long random strings, so
+// a plain SHA-256 is enough.
+func Hash(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// DisplayPrefix is the part of raw kept in clear.
+func DisplayPrefix(raw string) string {
+	if len(raw) > prefixLength {
+		return raw[:prefixLength]
+	}
+	return raw
+}
+
+// Options describe a new key. Scopes must be non-empty; AllowedIPs holds IPs
+// or CIDR ranges and may be empty to allow any client.
+type Options struct {
+	Name       string
+	Scopes     []string
+	AllowedIPs []string
+	ExpiresAt  *time.Time
+}
+
+// Validate checks the options and normalizes the scopes.
+func (o *Options) Validate() error {
+	o.Name = strings.TrimSpace(o.Name)
+	if o.Name == "" {
+		return errors.New("name is required")
+	}
+	if len(o.Scopes) == 0 {
+		return errors.New("at least one scope is required")
+	}
+	seen := map[string]bool{}
+	scopes := o.Scopes[:0]
+	for _, scope := range o.Scopes {
+		if scope != ScopeBuy && scope != ScopeRead && scope != ScopeBalance {
+			return errors.New("unknown scope " + scope)
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	o.Scopes = scopes
+	for _, entry := range o.AllowedIPs {
+		if net.ParseIP(entry) == nil {
+			if _, _, err := net.ParseCIDR(entry); err != nil {
+				return errors.New("invalid ip " + entry)
+			}
+		}
+	}
+	if o.ExpiresAt != nil && !o.ExpiresAt.After(time.Now()) {
+		return errors.New("expiry must be in the future")
+	}
+	return nil
+}
+
+// Create issues a new key for userID. The returned string is the key itself;
+// it cannot be recovered later.
+func Create(ctx context.Context, db *mongo.Database, userID primitive.ObjectID, opts Options) (string, models.APIKey, error) {
+	if err := opts.Validate(); err != nil {
+		return "", models.APIKey{}, err
+	}
+	col := collection(db)
+	active, err := col.CountDocuments(ctx, bson.M{"userId": userID, "revokedAt": bson.M{"$exists": false}})
+	if err != nil {
+		return "", models.APIKey{}, err
+	}
+	if active >= maxKeysPerUser {
+		return "", models.APIKey{}, ErrTooManyKeys
+	}
+
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", models.APIKey{}, err
+	}
+	raw := keyPrefix + hex.EncodeToString(buf)
+	key := models.APIKey{
+		ID:         primitive.NewObjectID(),
+		UserID:     userID,
+		Name:       opts.Name,
+		Prefix:     DisplayPrefix(raw),
+		Hash:       Hash(raw),
+		Scopes:     opts.Scopes,
+		AllowedIPs: opts.AllowedIPs,
+		ExpiresAt:  opts.ExpiresAt,
+		CreatedAt:  time.Now(),
+	}
+	if _, err := col.InsertOne(ctx, key); err != nil {
+		return "", models.APIKey{}, err
+	}
+	return raw, key, nil
+}
+
+// Authenticate resolves raw to its key and checks that the key may be used
+// from ip for scope. On success the key's lastUsedAt is updated.
+func Authenticate(ctx context.Context, db *mongo.Database, raw, ip, scope string) (models.APIKey, error) {
+	var key models.APIKey
+	if raw == "" {
+		return key, ErrInvalidKey
+	}
+	col := collection(db)
+	err := col.FindOne(ctx, bson.M{"hash": Hash(raw)}).Decode(&key)
+	if err == mongo.ErrNoDocuments {
+		return key, ErrInvalidKey
+	} else if err != nil {
+		return key, err
+	}
+	now := time.Now()
+	if key.RevokedAt != nil {
+		return key, ErrInvalidKey
+	}
+	if key.ExpiresAt != nil && !now.Before(*key.ExpiresAt) {
+		return key, ErrExpired
+	}
+	if !ipAllowed(key.AllowedIPs, ip) {
+		return key, ErrIPNotAllowed
+	}
+	if !hasScope(key.Scopes, scope) {
+		return key, ErrScopeNotAllowed
+	}
+
+	_, err = col.UpdateOne(ctx,
+		bson.M{"_id": key.ID, "$or": bson.A{
+			bson.M{"lastUsedAt": bson.M{"$exists": false}},
+			bson.M{"lastUsedAt": bson.M{"$lt": now.Add(-touchInterval)}},
+		}},
+		bson.M{"$set": bson.M{"lastUsedAt": now}},
+	)
+	if err != nil {
+		// Usage tracking must not fail the request.
+		logs.Logger.Errorf("failed to record use of api key %s: %v", key.ID.Hex(), err)
+	}
+	return key, nil
+}
+
+// List returns userID's keys, newest first, including revoked ones.
+func List(ctx context.Context, db *mongo.Database, userID primitive.ObjectID) ([]models.APIKey, error) {
+	cursor, err := collection(db).Find(ctx, bson.M{"userId": userID},
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	keys := []models.APIKey{}
+	if err := cursor.All(ctx, &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// Revoke disables one of userID's keys. Other keys keep working.
+func Revoke(ctx context.Context, db *mongo.Database, userID, keyID primitive.ObjectID) error {
+	res, err := collection(db).UpdateOne(ctx,
+		bson.M{"_id": keyID, "userId": userID, "revokedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revokedAt": time.Now()}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func hasScope(scopes []string, want string) bool {
+	for _, scope := range scopes {
+		if scope == want || (scope == ScopeBuy && want == ScopeRead) {
+			return true
+		}
+	}
+	return false
+}
+
+func ipAllowed(allowed []string, ip string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	client := net.ParseIP(ip)
+	if client == nil {
+		return false
+	}
+	for _, entry := range allowed {
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			if network.Contains(client) {
+				return true
+			}
+		} else if allowedIP := net.ParseIP(entry); allowedIP != nil && allowedIP.Equal(client) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,239 @@
+// Package audit keeps an append-only trail of administrative writes: who
+// did what to which record, with the fields that changed. Routes opt in with
+// Log; handlers describe the record they touched with SetTarget, SetBefore and
+// SetAfter.
+package audit
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/ranjankuldeep/fakeNumber/internal/auth"
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/logs"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	recordKey = "audit"
+	// maxRequestSize caps how much of a request body is kept.
+	maxRequestSize = 8 << 10
+)
+
+// redactedFields are substrings of field names whose values are never
+// written to the log.
+var redactedFields = []string{"password", "token", "key", "secret"}
+
+func collection(db *mongo.Database) *mongo.Collection {
+	return models.InitializeAuditCollection(db)
+}
+
+type record struct {
+	targetType string
+	targetID   string
+	before     interface{}
+	after      interface{}
+}
+
+// Log records every request to the route as action once the handler has run,
+// whatever the outcome. It goes after the auth middleware so that the actor
+// is known.
+func Log(action string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			request := readRequest(c)
+			rec := &record{}
+			c.Set(recordKey, rec)
+			if err := next(c); err != nil {
+				c.Error(err)
+			}
+
+			claims := auth.CurrentClaims(c)
+			entry := models.AuditEntry{
+				ID:         primitive.NewObjectID(),
+				Action:     action,
+				TargetType: rec.targetType,
+				TargetID:   rec.targetID,
+				Changes:    diff(rec.before, rec.after),
+				Request:    request,
+				Status:     c.Response().Status,
+				IP:         c.RealIP(),
+				RequestID:  c.Response().Header().Get(echo.HeaderXRequestID),
+				CreatedAt:  time.Now(),
+			}
+			if claims != nil {
+				entry.ActorID, _ = primitive.ObjectIDFromHex(claims.UserID)
+				entry.ActorEmail = claims.Email
+			}
+			entry.ActorRole, _ = auth.CallerRole(c)
+
+			// Write the entry even if the client has gone away.
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			db := c.Get("db").(*mongo.Database)
+			if _, err := collection(db).InsertOne(ctx, entry); err != nil {
+				logs.Logger.Errorf("failed to write audit entry for %s: %v", action, err)
+			}
+			return nil
+		}
+	}
+}
+
+func current(c echo.Context) *record {
+	rec, _ := c.Get(recordKey).(*record)
+	if rec == nil {
+		return &record{}
+	}
+	return rec
+}
+
+// SetTarget names the record the request acts on, e.g. ("user", id).
+func SetTarget(c echo.Context, targetType, targetID string) {
+	rec := current(c)
+	rec.targetType, rec.targetID = targetType, targetID
+}
+
+// SetBefore snapshots the target before the write. v must marshal to a BSON
+// document; nil means the target did not exist.
+func SetBefore(c echo.Context, v interface{}) {
+	current(c).before = v
+}
+
+// SetAfter snapshots the target after the write; nil means it was deleted.
+func SetAfter(c echo.Context, v interface{}) {
+	current(c).after = v
+}
+
+// diff lists the top-level fields that differ between the snapshots.
+func diff(before, after interface{}) []models.AuditChange {
+	if before == nil && after == nil {
+		return nil
+	}
+	b, a := toDocument(before), toDocument(after)
+	fields := make([]string, 0, len(b)+len(a))
+	for field := range b {
+		fields = append(fields, field)
+	}
+	for field := range a {
+		if _, ok := b[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+
+	var changes []models.AuditChange
+	for _, field := range fields {
+		if !reflect.DeepEqual(b[field], a[field]) {
+			changes = append(changes, models.AuditChange{Field: field, Before: b[field], After: a[field]})
+		}
+	}
+	return changes
+}
+
+func toDocument(v interface{}) bson.M {
+	doc := bson.M{}
+	if v == nil {
+		return doc
+	}
+	data, err := bson.Marshal(v)
+	if err == nil {
+		err = bson.Unmarshal(data, &doc)
+	}
+	if err != nil {
+		logs.Logger.Errorf("failed to snapshot audit target: %v", err)
+	}
+	redact(doc)
+	return doc
+}
+
+// redact replaces fields whose names suggest a secret with a short
+// fingerprint, so that the log shows a secret changed without storing it.
+func redact(fields map[string]interface{}) {
+	for name, value := range fields {
+		lower := strings.ToLower(name)
+		for _, secret := range redactedFields {
+			if strings.Contains(lower, secret) {
+				sum := sha256.Sum256([]byte(fmt.Sprint(value)))
+				fields[name] = "redacted:" + hex.EncodeToString(sum[:4])
+				break
+			}
+		}
+	}
+}
+
+// readRequest returns the JSON body, with secrets redacted, or the query
+// string, and leaves the body in place for the handler.
+func readRequest(c echo.Context) string {
+	req := c.Request()
+	if req.Body == nil || req.ContentLength == 0 {
+		return req.URL.RawQuery
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return req.URL.RawQuery
+	}
+	var fields map[string]interface{}
+	if json.Unmarshal(body, &fields) != nil {
+		return req.URL.RawQuery
+	}
+	redact(fields)
+	redacted, _ := json.Marshal(fields)
+	if len(redacted) > maxRequestSize {
+		redacted = redacted[:maxRequestSize]
+	}
+	return string(redacted)
+}
+
+// Filter selects audit entries. Zero values match everything.
+type Filter struct {
+	ActorID  primitive.ObjectID
+	Action   string
+	TargetID string
+	From     time.Time
+	To       time.Time
+	Skip     int64
+	Limit    int64
+}
+
+// Find returns a cursor over the matching entries, newest first.
+func Find(ctx context.Context, db *mongo.Database, f Filter) (*mongo.Cursor, error) {
+	filter := bson.M{}
+	if !f.ActorID.IsZero() {
+		filter["actorId"] = f.ActorID
+	}
+	if f.Action != "" {
+		filter["action"] = f.Action
+	}
+	if f.TargetID != "" {
+		filter["targetId"] = f.TargetID
+	}
+	createdAt := bson.M{}
+	if !f.From.IsZero() {
+		createdAt["$gte"] = f.From
+	}
+	if !f.To.IsZero() {
+		createdAt["$lt"] = f.To
+	}
+	if len(createdAt) > 0 {
+		filter["createdAt"] = createdAt
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}).SetSkip(f.Skip)
+	if f.Limit > 0 {
+		opts.SetLimit(f.Limit)
+	}
+	return collection(db).Find(ctx, filter, opts)
+}
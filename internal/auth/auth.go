@@ -0,0 +1,259 @@
+// Package auth issues and verifies the JWTs used by the web app, and provides
+// the Echo middleware that guards user and admin routes.
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/labstack/echo/v4"
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/logs"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// tokenTTL is how long a login lasts.
+	tokenTTL = 7 * 24 * time.Hour
+	// challengeTTL is how long the second login step may take.
+	challengeTTL = 5 * time.Minute
+	// challengeAudience marks tokens that only prove the password step.
+	challengeAudience = "login-2fa"
+)
+
+// Context keys set by the middleware.
+const (
+	claimsKey = "claims"
+	roleKey   = "role"
+)
+
+var (
+	ErrNoSecret     = errors.New("JWT_SECRET_KEY is not set")
+	ErrInvalidToken = errors.New("invalid token")
+	ErrForbidden    = errors.New("not allowed to access another user")
+)
+
+// Claims is the payload of every token the server issues. TwoFactor is set
+// when the login passed a TOTP or recovery code.
+type Claims struct {
+	Email      string `json:"email"`
+	UserID     string `json:"userId"`
+	LoginType  string `json:"logintype,omitempty"`
+	TRXAddress string `json:"trxAddress"`
+	TwoFactor  bool   `json:"twoFactor,omitempty"`
+	jwt.StandardClaims
+}
+
+func secret() ([]byte, error) {
+	key := os.Getenv("JWT_SECRET_KEY")
+	if key == "" {
+		return nil, ErrNoSecret
+	}
+	return []byte(key), nil
+}
+
+// IssueToken signs a token for the user.
+func IssueToken(user models.User, loginType, trxAddress string) (string, error) {
+	return sign(newClaims(user, loginType, trxAddress), tokenTTL)
+}
+
+// IssueTwoFactorToken signs a token for a user who has also passed the second
+// factor. Only these tokens open admin routes.
+func IssueTwoFactorToken(user models.User, loginType, trxAddress string) (string, error) {
+	claims := newClaims(user, loginType, trxAddress)
+	claims.TwoFactor = true
+	return sign(claims, tokenTTL)
+}
+
+// IssueChallenge signs a short-lived token proving the user passed the first
+// login step. It is exchanged for a real token once the second factor is
+// verified and is rejected everywhere else.
+func IssueChallenge(user models.User, loginType string) (string, error) {
+	claims := newClaims(user, loginType, "")
+	claims.Audience = challengeAudience
+	return sign(claims, challengeTTL)
+}
+
+func newClaims(user models.User, loginType, trxAddress string) Claims {
+	return Claims{
+		Email:      user.Email,
+		UserID:     user.ID.Hex(),
+		LoginType:  loginType,
+		TRXAddress: trxAddress,
+		StandardClaims: jwt.StandardClaims{
+			Subject: user.ID.Hex(),
+		},
+	}
+}
+
+func sign(claims Claims, ttl time.Duration) (string, error) {
+	key, err := secret()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	claims.IssuedAt = now.Unix()
+	claims.ExpiresAt = now.Add(ttl).Unix()
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(key)
+}
+
+// ParseToken verifies the signature and expiry of a token and returns its
+// claims.
+func ParseToken(tokenString string) (*Claims, error) {
+	return parse(tokenString, "")
+}
+
+// ParseChallenge is ParseToken for tokens from IssueChallenge.
+func ParseChallenge(tokenString string) (*Claims, error) {
+	return parse(tokenString, challengeAudience)
+}
+
+func parse(tokenString, audience string) (*Claims, error) {
+	key, err := secret()
+	if err != nil {
+		return nil, err
+	}
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
+		if t.Method != jwt.SigningMethodHS256 {
+			return nil, ErrInvalidToken
+		}
+		return key, nil
+	})
+	if err != nil || !token.Valid || claims.Audience != audience {
+		return nil, ErrInvalidToken
+	}
+	if _, err := primitive.ObjectIDFromHex(claims.UserID); err != nil {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+// RequireUser rejects requests without a valid bearer token and stores the
+// token's claims in the context.
+func RequireUser() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			header := c.Request().Header.Get(echo.HeaderAuthorization)
+			tokenString, ok := strings.CutPrefix(header, "Bearer ")
+			if !ok || tokenString == "" {
+				return c.JSON(http.StatusUnauthorized, echo.Map{"error": "missing token"})
+			}
+			claims, err := ParseToken(tokenString)
+			if err != nil {
+				if errors.Is(err, ErrNoSecret) {
+					logs.Logger.Error(err)
+					return c.JSON(http.StatusInternalServerError, echo.Map{"error": "internal server error"})
+				}
+				return c.JSON(http.StatusUnauthorized, echo.Map{"error": "invalid token"})
+			}
+			c.Set(claimsKey, claims)
+			return next(c)
+		}
+	}
+}
+
+// OptionalUser stores the claims of a valid bearer token when there is one,
+// for public routes that personalise their response.
+func OptionalUser() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			header := c.Request().Header.Get(echo.HeaderAuthorization)
+			if tokenString, ok := strings.CutPrefix(header, "Bearer "); ok {
+				if claims, err := ParseToken(tokenString); err == nil {
+					c.Set(claimsKey, claims)
+				}
+			}
+			return next(c)
+		}
+	}
+}
+
+// RequireAdmin is RequireUser for admin routes: the caller must hold one of
+// the staff roles and have logged in with a second factor. The role is read
+// from the database on every request so that revoking it takes effect
+// immediately.
+func RequireAdmin() echo.MiddlewareFunc {
+	requireUser := RequireUser()
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return requireUser(func(c echo.Context) error {
+			role, err := CallerRole(c)
+			if err != nil {
+				logs.Logger.Error(err)
+				return c.JSON(http.StatusInternalServerError, echo.Map{"error": "internal server error"})
+			}
+			if !ValidRole(role) {
+				return c.JSON(http.StatusForbidden, echo.Map{"error": "admin access required"})
+			}
+			if !CurrentClaims(c).TwoFactor {
+				return c.JSON(http.StatusForbidden, echo.Map{"error": "two-factor authentication required"})
+			}
+			return next(c)
+		})
+	}
+}
+
+// CallerRole looks up the caller's current staff role, "" for customers and
+// blocked users. The answer is cached on the context for the rest of the
+// request.
+func CallerRole(c echo.Context) (string, error) {
+	if role, ok := c.Get(roleKey).(string); ok {
+		return role, nil
+	}
+	userID, err := primitive.ObjectIDFromHex(UserID(c))
+	if err != nil {
+		return "", nil
+	}
+	db := c.Get("db").(*mongo.Database)
+	var user models.User
+	err = models.InitializeUserCollection(db).FindOne(c.Request().Context(), bson.M{"_id": userID}).Decode(&user)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return "", err
+	}
+	role := ""
+	if err == nil && !user.Blocked {
+		role = user.Role
+	}
+	c.Set(roleKey, role)
+	return role, nil
+}
+
+// CurrentClaims returns the claims of the authenticated caller, or nil on a
+// route without auth middleware.
+func CurrentClaims(c echo.Context) *Claims {
+	claims, _ := c.Get(claimsKey).(*Claims)
+	return claims
+}
+
+// UserID returns the authenticated caller's id.
+func UserID(c echo.Context) string {
+	if claims := CurrentClaims(c); claims != nil {
+		return claims.UserID
+	}
+	return ""
+}
+
+// SubjectID returns the user a request is about: the caller, or the userId
+// parameter when staff with PermUsersRead, logged in with a second factor,
+// ask about someone else. Anyone else naming another user gets ErrForbidden.
+func SubjectID(c echo.Context) (string, error) {
+	caller := UserID(c)
+	requested := c.QueryParam("userId")
+	if requested == "" || requested == caller {
+		return caller, nil
+	}
+	role, err := CallerRole(c)
+	if err != nil {
+		return "", err
+	}
+	if !HasPermission(role, PermUsersRead) || !CurrentClaims(c).TwoFactor {
+		return "", ErrForbidden
+	}
+	return requested, nil
+}
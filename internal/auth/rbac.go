@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/logs"
+)
+
+// Permission is an admin capability granted through a role.
+type Permission string
+
+const (
+	PermUsersRead     Permission = "users:read"
+	PermUsersBlock    Permission = "users:block"
+	PermFraudManage   Permission = "fraud:manage"
+	PermFinanceRead   Permission = "finance:read"
+	PermBalanceEdit   Permission = "balance:edit"
+	PermRechargeAdmin Permission = "recharge:manage"
+	PermCatalogRead   Permission = "catalog:read"
+	PermCatalogManage Permission = "catalog:manage"
+	PermRolesManage   Permission = "roles:manage"
+	PermAuditRead     Permission = "audit:read"
+	PermNotifyManage  Permission = "notifications:manage"
+)
+
+var rolePermissions = map[string][]Permission{
+	models.RoleSuperAdmin: {
+		PermUsersRead, PermUsersBlock, PermFraudManage, PermFinanceRead, PermBalanceEdit,
+		PermRechargeAdmin, PermCatalogRead, PermCatalogManage, PermRolesManage, PermAuditRead,
+		PermNotifyManage,
+	},
+	models.RoleFinance: {
+		PermUsersRead, PermFinanceRead, PermBalanceEdit, PermRechargeAdmin, PermCatalogRead,
+	},
+	models.RoleSupport: {
+		PermUsersRead, PermUsersBlock, PermFraudManage, PermCatalogRead,
+	},
+	models.RoleCatalogManager: {
+		PermCatalogRead, PermCatalogManage,
+	},
+	models.RoleReadOnly: {
+		PermUsersRead, PermFinanceRead, PermCatalogRead, PermAuditRead,
+	},
+}
+
+// ValidRole reports whether role is one of the staff roles.
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// Roles lists the staff roles and what each may do.
+func Roles() map[string][]Permission {
+	return rolePermissions
+}
+
+// HasPermission reports whether role grants perm.
+func HasPermission(role string, perm Permission) bool {
+	for _, p := range rolePermissions[role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// Require rejects callers whose role does not grant perm. It goes after
+// RequireAdmin, usually on the individual route.
+func Require(perm Permission) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			role, err := CallerRole(c)
+			if err != nil {
+				logs.Logger.Error(err)
+				return c.JSON(http.StatusInternalServerError, echo.Map{"error": "internal server error"})
+			}
+			if !HasPermission(role, perm) {
+				return c.JSON(http.StatusForbidden, echo.Map{"error": "permission denied"})
+			}
+			return next(c)
+		}
+	}
+}
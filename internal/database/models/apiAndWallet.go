@@ -4,24 +4,52 @@ import (
 	"context"
 	"time"
 
+	"github.com/ranjankuldeep/fakeNumber/internal/money"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-// ApiWalletUser represents the schema in Go
+// ApiWalletUser represents the schema in Go. BalancePaise is the exact
+// balance; Balance mirrors it in rupees for older readers. HeldPaise is the
+// part of the balance reserved by in-flight purchases.
 type ApiWalletUser struct {
 	ID            primitive.ObjectID `bson:"_id,omitempty"`
 	UserID        primitive.ObjectID `bson:"userId,omitempty"`
-	APIKey        string             `bson:"api_key"`
 	Balance       float64            `bson:"balance"`
+	BalancePaise  money.Paise        `bson:"balancePaise"`
+	HeldPaise     money.Paise        `bson:"heldPaise,omitempty"`
 	TRXAddress    string             `bson:"trxAddress,omitempty"`
 	TRXPrivateKey string             `bson:"trxPrivateKey,omitempty"`
 	CreatedAt     time.Time          `bson:"createdAt,omitempty"`
 	UpdatedAt     time.Time          `bson:"updatedAt,omitempty"`
 }
 
+// Amount is the wallet balance, falling back to the rupee field for
+// documents written before balancePaise existed.
+func (w ApiWalletUser) Amount() money.Paise {
+	if w.BalancePaise == 0 && w.Balance != 0 {
+		return money.FromFloat(w.Balance)
+	}
+	return w.BalancePaise
+}
+
+// AddressCreatedAt is when the wallet's TRX deposit address was issued. The
+// address is created with the wallet, so older documents without createdAt
+// fall back to the time in their id.
+func (w ApiWalletUser) AddressCreatedAt() time.Time {
+	if !w.CreatedAt.IsZero() {
+		return w.CreatedAt
+	}
+	return w.ID.Timestamp()
+}
+
+// Available is the balance that is not held.
+func (w ApiWalletUser) Available() money.Paise {
+	return w.Amount() - w.HeldPaise
+}
+
 func EnsureIndexesApi(ctx context.Context, db *mongo.Database, collectionName string) error {
 	// Define validation schema
 	validator := bson.M{
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// AuditEntry records one administrative write. Entries are only ever
+// inserted.
+type AuditEntry struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	ActorID    primitive.ObjectID `bson:"actorId" json:"actorId"`
+	ActorEmail string             `bson:"actorEmail" json:"actorEmail"`
+	ActorRole  string             `bson:"actorRole" json:"actorRole"`
+	Action     string             `bson:"action" json:"action"`
+	TargetType string             `bson:"targetType,omitempty" json:"targetType,omitempty"`
+	TargetID   string             `bson:"targetId,omitempty" json:"targetId,omitempty"`
+	Changes    []AuditChange      `bson:"changes,omitempty" json:"changes,omitempty"`
+	Request    string             `bson:"request,omitempty" json:"request,omitempty"`
+	Status     int                `bson:"status" json:"status"`
+	IP         string             `bson:"ip" json:"ip"`
+	RequestID  string             `bson:"requestId" json:"requestId"`
+	CreatedAt  time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+// AuditChange is one field that differs between the before and after
+// snapshots of the target.
+type AuditChange struct {
+	Field  string      `bson:"field" json:"field"`
+	Before interface{} `bson:"before" json:"before"`
+	After  interface{} `bson:"after" json:"after"`
+}
+
+func InitializeAuditCollection(db *mongo.Database) *mongo.Collection {
+	return db.Collection("audit_log")
+}
+
+// EnsureAuditIndexes indexes the log by time and by each filter of the query
+// endpoint.
+func EnsureAuditIndexes(ctx context.Context, collection *mongo.Collection) error {
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "createdAt", Value: -1}}},
+		{Keys: bson.D{{Key: "actorId", Value: 1}, {Key: "createdAt", Value: -1}}},
+		{Keys: bson.D{{Key: "action", Value: 1}, {Key: "createdAt", Value: -1}}},
+		{Keys: bson.D{{Key: "targetId", Value: 1}, {Key: "createdAt", Value: -1}}},
+	})
+	return err
+}
@@ -1,10 +1,13 @@
 package models
 
 import (
+	"context"
 	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // RechargeHistory represents the recharge history document structure
@@ -20,7 +23,9 @@ type RechargeHistory struct {
 	UpdatedAt     time.Time          `bson:"updatedAt,omitempty" json:"updatedAt"`
 }
 
-// TransactionHistory represents the transaction history document structure
+// TransactionHistory represents the transaction history document structure.
+// State and Transitions are owned by the orderstate package; Status is kept
+// in sync for older readers.
 type TransactionHistory struct {
 	ID            primitive.ObjectID `bson:"_id,omitempty"`
 	UserID        string             `bson:"userId" json:"userId"`
@@ -32,15 +37,46 @@ type TransactionHistory struct {
 	Server        string             `bson:"server" json:"server"`
 	Price         string             `bson:"price" json:"price"`
 	Status        string             `bson:"status" json:"status"`
+	Attempts      []PurchaseAttempt  `bson:"attempts,omitempty" json:"attempts,omitempty"`
+	State         string             `bson:"state,omitempty" json:"state,omitempty"`
+	Transitions   []OrderTransition  `bson:"transitions,omitempty" json:"transitions,omitempty"`
 	CreatedAt     time.Time          `bson:"createdAt,omitempty" json:"createdAt"`
 	UpdatedAt     time.Time          `bson:"updatedAt,omitempty" json:"updatedAt"`
 }
 
+// PurchaseAttempt records one server tried while buying a number in
+// failover mode.
+type PurchaseAttempt struct {
+	Server int       `bson:"server" json:"server"`
+	Price  string    `bson:"price" json:"price"`
+	Error  string    `bson:"error,omitempty" json:"error,omitempty"`
+	At     time.Time `bson:"at" json:"at"`
+}
+
+// OrderTransition records one order state change.
+type OrderTransition struct {
+	From   string    `bson:"from" json:"from"`
+	To     string    `bson:"to" json:"to"`
+	Actor  string    `bson:"actor" json:"actor"`
+	Reason string    `bson:"reason,omitempty" json:"reason,omitempty"`
+	At     time.Time `bson:"at" json:"at"`
+}
+
 // InitializeRechargeHistoryCollection initializes the recharge history collection
 func InitializeRechargeHistoryCollection(db *mongo.Database) *mongo.Collection {
 	return db.Collection("rechargehistories")
 }
 
+// EnsureRechargeHistoryIndexes makes transaction ids unique, so that a
+// payment can only be credited once.
+func EnsureRechargeHistoryIndexes(ctx context.Context, collection *mongo.Collection) error {
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "transaction_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
 // InitializeTransactionHistoryCollection initializes the transaction history collection
 func InitializeTransactionHistoryCollection(db *mongo.Database) *mongo.Collection {
 	return db.Collection("transactionhistories")
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/money"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// BalanceHold reserves part of a wallet while a purchase is in flight. The
+// wallet's heldPaise is the sum of its holds in the "held" status.
+type BalanceHold struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID    primitive.ObjectID `bson:"userId" json:"userId"`
+	Amount    money.Paise        `bson:"amount" json:"amount"`
+	Status    string             `bson:"status" json:"status"`
+	Note      string             `bson:"note,omitempty" json:"note,omitempty"`
+	Reason    string             `bson:"reason,omitempty" json:"reason,omitempty"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+	ExpiresAt time.Time          `bson:"expiresAt" json:"expiresAt"`
+	SettledAt time.Time          `bson:"settledAt,omitempty" json:"settledAt,omitempty"`
+}
+
+func InitializeBalanceHoldCollection(db *mongo.Database) *mongo.Collection {
+	return db.Collection("balance_holds")
+}
+
+// EnsureBalanceHoldIndexes indexes open holds by expiry for the sweeper.
+func EnsureBalanceHoldIndexes(ctx context.Context, collection *mongo.Collection) error {
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "status", Value: 1}, {Key: "expiresAt", Value: 1}},
+	})
+	return err
+}
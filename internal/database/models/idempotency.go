@@ -0,0 +1,37 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// IdempotencyRecord is the stored outcome of a request made with an
+// Idempotency-Key, replayed when the same request is retried.
+type IdempotencyRecord struct {
+	ID          string    `bson:"_id"`
+	Fingerprint string    `bson:"fingerprint"`
+	Status      string    `bson:"status"`
+	LockedUntil time.Time `bson:"lockedUntil,omitempty"`
+	StatusCode  int       `bson:"statusCode,omitempty"`
+	ContentType string    `bson:"contentType,omitempty"`
+	Body        []byte    `bson:"body,omitempty"`
+	CreatedAt   time.Time `bson:"createdAt"`
+	ExpiresAt   time.Time `bson:"expiresAt"`
+}
+
+func InitializeIdempotencyCollection(db *mongo.Database) *mongo.Collection {
+	return db.Collection("idempotency_keys")
+}
+
+// EnsureIdempotencyIndexes lets Mongo drop records once they expire.
+func EnsureIdempotencyIndexes(ctx context.Context, collection *mongo.Collection) error {
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/money"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// LedgerEntry is one side of a wallet posting. Every posting writes a
+// wallet entry and an opposite system entry sharing the same PostingID, so
+// the entries of a posting always sum to zero. Amount is in paise and
+// positive for a credit to the account.
+type LedgerEntry struct {
+	ID               primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	PostingID        primitive.ObjectID `bson:"postingId" json:"postingId"`
+	Account          string             `bson:"account" json:"account"`
+	UserID           primitive.ObjectID `bson:"userId,omitempty" json:"userId,omitempty"`
+	Kind             string             `bson:"kind" json:"kind"`
+	Amount           money.Paise        `bson:"amount" json:"amount"`
+	BalanceAfter     money.Paise        `bson:"balanceAfter,omitempty" json:"balanceAfter,omitempty"`
+	SourceCollection string             `bson:"sourceCollection" json:"sourceCollection"`
+	SourceID         string             `bson:"sourceId" json:"sourceId"`
+	Note             string             `bson:"note,omitempty" json:"note,omitempty"`
+	CreatedAt        time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+// InitializeLedgerCollection initializes the append-only "ledger_entries" collection
+func InitializeLedgerCollection(db *mongo.Database) *mongo.Collection {
+	return db.Collection("ledger_entries")
+}
+
+// EnsureLedgerIndexes indexes statements by account and time, and makes a
+// source document post at most once per account and kind.
+func EnsureLedgerIndexes(ctx context.Context, collection *mongo.Collection) error {
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "account", Value: 1}, {Key: "createdAt", Value: 1}}},
+		{
+			Keys: bson.D{
+				{Key: "account", Value: 1},
+				{Key: "kind", Value: 1},
+				{Key: "sourceCollection", Value: 1},
+				{Key: "sourceId", Value: 1},
+			},
+			Options: options.Index().SetUnique(true),
+		},
+	})
+	return err
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Outbox statuses.
+const (
+	OutboxPending = "pending"
+	OutboxSent    = "sent"
+	OutboxFailed  = "failed"
+)
+
+// OutboxEmail is a rendered email waiting to be retried after a failed send.
+type OutboxEmail struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty"`
+	To            string             `bson:"to"`
+	Template      string             `bson:"template"`
+	Subject       string             `bson:"subject"`
+	Text          string             `bson:"text"`
+	HTML          string             `bson:"html"`
+	Status        string             `bson:"status"`
+	Attempts      int                `bson:"attempts"`
+	LastError     string             `bson:"lastError,omitempty"`
+	NextAttemptAt time.Time          `bson:"nextAttemptAt"`
+	SentAt        *time.Time         `bson:"sentAt,omitempty"`
+	CreatedAt     time.Time          `bson:"createdAt"`
+}
+
+func InitializeMailOutboxCollection(db *mongo.Database) *mongo.Collection {
+	return db.Collection("mail_outbox")
+}
+
+// OutboxSentRetention is how long a sent message is kept before Mongo
+// removes it.
+const OutboxSentRetention = 24 * time.Hour
+
+// EnsureMailOutboxIndexes indexes the outbox for the retry scan, and expires
+// messages once they have been sent.
+func EnsureMailOutboxIndexes(ctx context.Context, collection *mongo.Collection) error {
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "nextAttemptAt", Value: 1}}},
+		{
+			Keys:    bson.D{{Key: "sentAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(OutboxSentRetention / time.Second)),
+		},
+	})
+	return err
+}
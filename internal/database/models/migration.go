@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Migration records a one-time data migration that has been applied.
+type Migration struct {
+	Name      string    `bson:"_id"`
+	AppliedAt time.Time `bson:"appliedAt"`
+}
+
+func InitializeMigrationCollection(db *mongo.Database) *mongo.Collection {
+	return db.Collection("migrations")
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Notification channel kinds.
+const (
+	ChannelTelegram = "telegram"
+	ChannelWebhook  = "webhook"
+	ChannelChat     = "chat"
+	ChannelLog      = "log"
+)
+
+// NotificationChannel is somewhere staff notifications are sent. Events lists
+// the event types routed to the channel; an empty list means every event.
+// Token holds the Telegram bot token and Secret the webhook signing key.
+type NotificationChannel struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name      string             `bson:"name" json:"name"`
+	Kind      string             `bson:"kind" json:"kind"`
+	Token     string             `bson:"token,omitempty" json:"token,omitempty"`
+	ChatID    string             `bson:"chatId,omitempty" json:"chatId,omitempty"`
+	URL       string             `bson:"url,omitempty" json:"url,omitempty"`
+	Secret    string             `bson:"secret,omitempty" json:"secret,omitempty"`
+	Events    []string           `bson:"events,omitempty" json:"events"`
+	Enabled   bool               `bson:"enabled" json:"enabled"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+	UpdatedAt time.Time          `bson:"updatedAt" json:"updatedAt"`
+}
+
+func InitializeNotificationChannelCollection(db *mongo.Database) *mongo.Collection {
+	return db.Collection("notification_channels")
+}
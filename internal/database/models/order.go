@@ -1,6 +1,7 @@
 package models
 
 import (
+	"context"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -20,6 +21,10 @@ type Order struct {
 	OrderTime      time.Time          `bson:"orderTime" json:"orderTime"`
 	ExpirationTime time.Time          `bson:"expirationTime" json:"expirationTime" validate:"required"`
 	Status         string             `bson:"status" json:"status" validate:"required,oneof=ACTIVE EXPIRED"`
+	// ClaimedBy and LeaseUntil are set by the expiry scheduler while it
+	// processes the order, so that only one worker refunds it.
+	ClaimedBy  string    `bson:"claimedBy,omitempty" json:"-"`
+	LeaseUntil time.Time `bson:"leaseUntil,omitempty" json:"-"`
 }
 
 // NewOrderCollection initializes and returns the orders collection with indexes if needed
@@ -31,3 +36,11 @@ func InitializeOrderCollection(db *mongo.Database) *mongo.Collection {
 
 	return collection
 }
+
+// EnsureOrderIndexes indexes the fields the expiry scheduler queries by.
+func EnsureOrderIndexes(ctx context.Context, collection *mongo.Collection) error {
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: map[string]interface{}{"expirationTime": 1},
+	})
+	return err
+}
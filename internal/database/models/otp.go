@@ -4,44 +4,41 @@ import (
 	"context"
 	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-// OTP represents the structure of an OTP document
+// OTP is an emailed one-time code. There is at most one per email and
+// purpose; Mongo deletes it once ExpiresAt passes.
 type OTP struct {
 	ID        primitive.ObjectID `bson:"_id,omitempty"`
-	Email     string             `bson:"email" json:"email" validate:"required,email"`
-	OTP       string             `bson:"otp" json:"otp" validate:"required"`
-	CreatedAt time.Time          `bson:"createdAt,omitempty" json:"createdAt"`
-	UpdatedAt time.Time          `bson:"updatedAt,omitempty" json:"updatedAt"`
+	Email     string             `bson:"email"`
+	Purpose   string             `bson:"purpose"`
+	Hash      string             `bson:"hash"`
+	Attempts  int                `bson:"attempts"`
+	Verified  bool               `bson:"verified"`
+	SentAt    time.Time          `bson:"sentAt"`
+	ExpiresAt time.Time          `bson:"expiresAt"`
 }
 
-// InitializeVerifyOTPCollection initializes the collection for "verifyOtp"
 func InitializeOTPCollection(db *mongo.Database) *mongo.Collection {
-	collection := db.Collection("otp")
-	return collection
+	return db.Collection("email_otps")
 }
 
-// InitializeVerifyOTPCollection initializes the collection for "verifyOtp"
-func InitializeVerifyOTPCollection(db *mongo.Database) *mongo.Collection {
-	collection := db.Collection("verifyOtp")
-	return collection
-}
-
-// InitializeForgotOTPCollection initializes the collection for "forgotOtp"
-func InitializeForgotOTPCollection(db *mongo.Database) *mongo.Collection {
-	collection := db.Collection("forgototps")
-	return collection
-}
-
-// EnsureIndexes ensures the necessary indexes are created on the collection
-func EnsureIndexes(ctx context.Context, collection *mongo.Collection) error {
-	indexModel := mongo.IndexModel{
-		Keys:    map[string]interface{}{"userId": 1},
-		Options: options.Index().SetUnique(true),
-	}
-	_, err := collection.Indexes().CreateOne(ctx, indexModel)
+// EnsureOTPIndexes keeps one code per email and purpose and expires codes
+// with a TTL index.
+func EnsureOTPIndexes(ctx context.Context, collection *mongo.Collection) error {
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "email", Value: 1}, {Key: "purpose", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
 	return err
 }
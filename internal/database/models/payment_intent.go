@@ -0,0 +1,50 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/money"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Payment intent statuses. An open intent past ExpiresAt is expired even
+// though its stored status is still open.
+const (
+	IntentOpen    = "open"
+	IntentPaid    = "paid"
+	IntentExpired = "expired"
+)
+
+// PaymentIntent is a recharge a user has started: they are asked to pay
+// exactly Amount to PayeeVPA with Reference as the payment note. Only a
+// payment matching an open intent is credited.
+type PaymentIntent struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID        primitive.ObjectID `bson:"userId" json:"userId"`
+	Reference     string             `bson:"reference" json:"reference"`
+	Amount        money.Paise        `bson:"amount" json:"amount"`
+	PayeeVPA      string             `bson:"payeeVpa" json:"payeeVpa"`
+	Status        string             `bson:"status" json:"status"`
+	TransactionID string             `bson:"transactionId,omitempty" json:"transactionId,omitempty"`
+	ExpiresAt     time.Time          `bson:"expiresAt" json:"expiresAt"`
+	PaidAt        *time.Time         `bson:"paidAt,omitempty" json:"paidAt,omitempty"`
+	CreatedAt     time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+func InitializePaymentIntentCollection(db *mongo.Database) *mongo.Collection {
+	return db.Collection("payment_intents")
+}
+
+// EnsurePaymentIntentIndexes makes references unique and indexes intents by
+// owner.
+func EnsurePaymentIntentIndexes(ctx context.Context, collection *mongo.Collection) error {
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "reference", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "createdAt", Value: -1}}},
+	})
+	return err
+}
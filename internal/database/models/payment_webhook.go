@@ -0,0 +1,54 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Payment webhook statuses.
+const (
+	WebhookReceived  = "received"
+	WebhookCredited  = "credited"
+	WebhookDuplicate = "duplicate"
+	WebhookIgnored   = "ignored"
+	WebhookUnmatched = "unmatched"
+	WebhookRejected  = "rejected"
+	WebhookFailed    = "failed"
+)
+
+// PaymentWebhook is a signed notification pushed by a payment provider. The
+// raw payload is kept for replay and disputes.
+type PaymentWebhook struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Provider      string             `bson:"provider" json:"provider"`
+	Payload       string             `bson:"payload" json:"payload"`
+	Signature     string             `bson:"signature" json:"signature"`
+	Status        string             `bson:"status" json:"status"`
+	Error         string             `bson:"error,omitempty" json:"error,omitempty"`
+	TransactionID string             `bson:"transactionId,omitempty" json:"transactionId,omitempty"`
+	Reference     string             `bson:"reference,omitempty" json:"reference,omitempty"`
+	UserID        primitive.ObjectID `bson:"userId,omitempty" json:"userId,omitempty"`
+	IntentID      primitive.ObjectID `bson:"intentId,omitempty" json:"intentId,omitempty"`
+	Attempts      int                `bson:"attempts" json:"attempts"`
+	ReceivedAt    time.Time          `bson:"receivedAt" json:"receivedAt"`
+	ProcessedAt   *time.Time         `bson:"processedAt,omitempty" json:"processedAt,omitempty"`
+}
+
+func InitializePaymentWebhookCollection(db *mongo.Database) *mongo.Collection {
+	return db.Collection("payment_webhooks")
+}
+
+// EnsurePaymentWebhookIndexes indexes webhooks for the admin listing and for
+// finding the notifications of a transaction.
+func EnsurePaymentWebhookIndexes(ctx context.Context, collection *mongo.Collection) error {
+	_, err := collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "provider", Value: 1}, {Key: "receivedAt", Value: -1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "receivedAt", Value: -1}}},
+		{Keys: bson.D{{Key: "transactionId", Value: 1}}},
+	})
+	return err
+}
@@ -7,14 +7,21 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
-// RechargeAPI represents the structure of a recharge API document
+// RechargeAPI represents the structure of a recharge API document.
+// Verifier names the payments verifier for the recharge type and VerifierURL
+// optionally points it at another endpoint; for trx it is the
+// TronGrid-compatible node deposits are checked against. WebhookSecret signs the payment
+// webhooks the provider pushes; webhooks are refused while it is empty.
 type RechargeAPI struct {
-	ID           primitive.ObjectID `bson:"_id,omitempty"`
-	RechargeType string             `bson:"recharge_type" json:"recharge_type" validate:"required"`
-	APIKey       string             `bson:"api_key,omitempty" json:"api_key"`
-	Maintenance  bool               `bson:"maintenance" json:"maintenance" default:"false"`
-	CreatedAt    time.Time          `bson:"createdAt,omitempty" json:"createdAt"`
-	UpdatedAt    time.Time          `bson:"updatedAt,omitempty" json:"updatedAt"`
+	ID            primitive.ObjectID `bson:"_id,omitempty"`
+	RechargeType  string             `bson:"recharge_type" json:"recharge_type" validate:"required"`
+	APIKey        string             `bson:"api_key,omitempty" json:"api_key"`
+	Maintenance   bool               `bson:"maintenance" json:"maintenance" default:"false"`
+	Verifier      string             `bson:"verifier,omitempty" json:"verifier,omitempty"`
+	VerifierURL   string             `bson:"verifier_url,omitempty" json:"verifier_url,omitempty"`
+	WebhookSecret string             `bson:"webhook_secret,omitempty" json:"-"`
+	CreatedAt     time.Time          `bson:"createdAt,omitempty" json:"createdAt"`
+	UpdatedAt     time.Time          `bson:"updatedAt,omitempty" json:"updatedAt"`
 }
 
 // InitializeRechargeAPICollection initializes the collection for "recharge-apis"
@@ -17,10 +17,30 @@ type Server struct {
 	Token        string             `bson:"token,omitempty" json:"token"`
 	ExchangeRate float64            `bson:"exchangeRate,omitempty" json:"exchangeRate" default:"0.0"`
 	Margin       float64            `bson:"margin,omitempty" json:"margin" default:"0.0"`
+	Activation   *ActivationConfig  `bson:"activation,omitempty" json:"activation,omitempty"`
 	CreatedAt    time.Time          `bson:"createdAt,omitempty" json:"createdAt"`
 	UpdatedAt    time.Time          `bson:"updatedAt,omitempty" json:"updatedAt"`
 }
 
+// ActivationConfig describes an upstream that speaks the SMS-Activate
+// handler_api dialect. When present on a server document it takes precedence
+// over the built-in provider for that server number.
+type ActivationConfig struct {
+	BaseURL     string `bson:"baseUrl" json:"baseUrl"`
+	NextBaseURL string `bson:"nextBaseUrl,omitempty" json:"nextBaseUrl"`
+	Country     string `bson:"country" json:"country"`
+	Operator    string `bson:"operator,omitempty" json:"operator"`
+	MaxPrice    bool   `bson:"maxPrice" json:"maxPrice"`
+	// NextSMS is "waiting", "retry" or empty when the upstream cannot resend.
+	NextSMS string `bson:"nextSms,omitempty" json:"nextSms"`
+	// StatusMap maps getStatus reply prefixes to OTP, WAIT or CANCEL and is
+	// merged over the default SMS-Activate mapping.
+	StatusMap     map[string]string `bson:"statusMap,omitempty" json:"statusMap"`
+	CancelOK      []string          `bson:"cancelOk,omitempty" json:"cancelOk"`
+	CancelErrors  []string          `bson:"cancelErrors,omitempty" json:"cancelErrors"`
+	BalanceSymbol string            `bson:"balanceSymbol,omitempty" json:"balanceSymbol"`
+}
+
 // InitializeServerCollection initializes the collection for "servers"
 func InitializeServerCollection(db *mongo.Database) *mongo.Collection {
 	collection := db.Collection("servers")
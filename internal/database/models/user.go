@@ -7,6 +7,16 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
+// Staff roles. A user without a role is a customer. Roles are assigned by a
+// super-admin; the first one is named by SUPER_ADMIN_EMAIL at startup.
+const (
+	RoleSuperAdmin     = "super-admin"
+	RoleFinance        = "finance"
+	RoleSupport        = "support"
+	RoleCatalogManager = "catalog-manager"
+	RoleReadOnly       = "read-only"
+)
+
 // User represents the structure of a user document
 type User struct {
 	ID            primitive.ObjectID `bson:"_id,omitempty"`
@@ -17,8 +27,19 @@ type User struct {
 	ProfileImg    string             `bson:"profileImg,omitempty" json:"profileImg"`
 	Blocked       bool               `bson:"blocked" json:"blocked" default:"false"`
 	BlockedReason *string            `bson:"blocked_reason,omitempty" json:"blocked_reason" default:"null"`
-	CreatedAt     time.Time          `bson:"createdAt,omitempty" json:"createdAt"`
-	UpdatedAt     time.Time          `bson:"updatedAt,omitempty" json:"updatedAt"`
+	Role          string             `bson:"role,omitempty" json:"role,omitempty"`
+	FailedLogins  int                `bson:"failedLogins,omitempty" json:"-"`
+	LockedUntil   time.Time          `bson:"lockedUntil,omitempty" json:"-"`
+	// Two-factor authentication. TOTPPendingSecret holds a secret that has
+	// been shown to the user but not yet confirmed with a code; recovery codes
+	// are stored hashed and removed as they are used.
+	TOTPEnabled       bool      `bson:"totpEnabled,omitempty" json:"totpEnabled"`
+	TOTPSecret        string    `bson:"totpSecret,omitempty" json:"-"`
+	TOTPPendingSecret string    `bson:"totpPendingSecret,omitempty" json:"-"`
+	TOTPLastStep      int64     `bson:"totpLastStep,omitempty" json:"-"`
+	RecoveryCodes     []string  `bson:"recoveryCodes,omitempty" json:"-"`
+	CreatedAt         time.Time `bson:"createdAt,omitempty" json:"createdAt"`
+	UpdatedAt         time.Time `bson:"updatedAt,omitempty" json:"updatedAt"`
 }
 
 // InitializeUserCollection initializes the collection for "users"
@@ -0,0 +1,258 @@
+package expiry
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/logs"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// leaseDuration is how long a claimed order is reserved for one worker.
+	leaseDuration = 2 * time.Minute
+	// sweepInterval is how often overdue orders are reloaded from Mongo, to
+	// pick up orders inserted elsewhere and leases left by a crashed worker.
+	sweepInterval = time.Minute
+)
+
+// Scheduler keeps pending order expirations in a min-heap and hands each
+// order to process exactly once, after claiming it in Mongo.
+type Scheduler struct {
+	orders  *mongo.Collection
+	process func(models.Order)
+	owner   string
+
+	mu     sync.Mutex
+	queue  expiryHeap
+	queued map[primitive.ObjectID]time.Time
+	wake   chan struct{}
+}
+
+func NewScheduler(db *mongo.Database, process func(models.Order)) *Scheduler {
+	host, _ := os.Hostname()
+	return &Scheduler{
+		orders:  models.InitializeOrderCollection(db),
+		process: process,
+		owner:   fmt.Sprintf("%s-%d", host, os.Getpid()),
+		queued:  make(map[primitive.ObjectID]time.Time),
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+var (
+	defaultMu        sync.RWMutex
+	defaultScheduler *Scheduler
+)
+
+// SetDefault makes s the scheduler used by Schedule.
+func SetDefault(s *Scheduler) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultScheduler = s
+}
+
+// Schedule queues a newly created order on the default scheduler. Orders
+// created before the scheduler starts are picked up when it loads.
+func Schedule(order models.Order) {
+	defaultMu.RLock()
+	s := defaultScheduler
+	defaultMu.RUnlock()
+	if s != nil {
+		s.Schedule(order)
+	}
+}
+
+// Schedule queues the order to fire at its ExpirationTime. Scheduling an
+// order again replaces its previous expiry.
+func (s *Scheduler) Schedule(order models.Order) {
+	s.push(order.ID, order.ExpirationTime)
+}
+
+func (s *Scheduler) push(id primitive.ObjectID, at time.Time) {
+	s.mu.Lock()
+	s.queued[id] = at
+	heap.Push(&s.queue, expiryEntry{id: id, at: at})
+	s.mu.Unlock()
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run loads every pending order and fires expirations until ctx is done.
+func (s *Scheduler) Run(ctx context.Context) error {
+	if err := models.EnsureOrderIndexes(ctx, s.orders); err != nil {
+		logs.Logger.Error(err)
+	}
+	if err := s.load(ctx, bson.M{}); err != nil {
+		return err
+	}
+
+	sweep := time.NewTicker(sweepInterval)
+	defer sweep.Stop()
+	timer := time.NewTimer(s.untilNext())
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.wake:
+		case <-timer.C:
+			s.fireDue()
+		case <-sweep.C:
+			now := time.Now()
+			err := s.load(ctx, bson.M{
+				"expirationTime": bson.M{"$lte": now},
+				"$or": []bson.M{
+					{"leaseUntil": bson.M{"$exists": false}},
+					{"leaseUntil": bson.M{"$lt": now}},
+				},
+			})
+			if err != nil {
+				logs.Logger.Error(err)
+			}
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(s.untilNext())
+	}
+}
+
+// load queues every order matching filter.
+func (s *Scheduler) load(ctx context.Context, filter bson.M) error {
+	findCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	cursor, err := s.orders.Find(findCtx, filter, options.Find().SetProjection(bson.M{"_id": 1, "expirationTime": 1}))
+	if err != nil {
+		return fmt.Errorf("failed to load orders: %w", err)
+	}
+	defer cursor.Close(findCtx)
+
+	for cursor.Next(findCtx) {
+		var order models.Order
+		if err := cursor.Decode(&order); err != nil {
+			logs.Logger.Error(err)
+			continue
+		}
+		s.push(order.ID, order.ExpirationTime)
+	}
+	return cursor.Err()
+}
+
+func (s *Scheduler) untilNext() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.queue.Len() == 0 {
+		return sweepInterval
+	}
+	wait := time.Until(s.queue[0].at)
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+// fireDue pops every expired entry and processes it in its own goroutine.
+// Entries replaced by a later Schedule call are dropped.
+func (s *Scheduler) fireDue() {
+	now := time.Now()
+	var due []primitive.ObjectID
+	s.mu.Lock()
+	for s.queue.Len() > 0 && !s.queue[0].at.After(now) {
+		entry := heap.Pop(&s.queue).(expiryEntry)
+		if at, ok := s.queued[entry.id]; !ok || !at.Equal(entry.at) {
+			continue
+		}
+		delete(s.queued, entry.id)
+		due = append(due, entry.id)
+	}
+	s.mu.Unlock()
+
+	for _, id := range due {
+		go s.fire(id)
+	}
+}
+
+func (s *Scheduler) fire(id primitive.ObjectID) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Recovered from panic while expiring order %s: %v", id.Hex(), r)
+		}
+	}()
+
+	order, claimed, err := s.claim(id)
+	if err != nil {
+		logs.Logger.Error(err)
+		return
+	}
+	if !claimed {
+		return
+	}
+	s.process(order)
+}
+
+// claim leases an expired order to this scheduler. An order whose expiry
+// was pushed back is rescheduled; one that is gone or leased elsewhere is
+// dropped.
+func (s *Scheduler) claim(id primitive.ObjectID) (models.Order, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	filter := bson.M{
+		"_id":            id,
+		"expirationTime": bson.M{"$lte": now},
+		"$or": []bson.M{
+			{"leaseUntil": bson.M{"$exists": false}},
+			{"leaseUntil": bson.M{"$lt": now}},
+		},
+	}
+	update := bson.M{"$set": bson.M{"claimedBy": s.owner, "leaseUntil": now.Add(leaseDuration)}}
+	var order models.Order
+	err := s.orders.FindOneAndUpdate(ctx, filter, update, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&order)
+	if err == nil {
+		return order, true, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return models.Order{}, false, fmt.Errorf("failed to claim order %s: %w", id.Hex(), err)
+	}
+
+	err = s.orders.FindOne(ctx, bson.M{"_id": id}).Decode(&order)
+	if err == nil && order.ExpirationTime.After(now) {
+		s.Schedule(order)
+	}
+	return models.Order{}, false, nil
+}
+
+type expiryEntry struct {
+	id primitive.ObjectID
+	at time.Time
+}
+
+type expiryHeap []expiryEntry
+
+func (h expiryHeap) Len() int            { return len(h) }
+func (h expiryHeap) Less(i, j int) bool  { return h[i].at.Before(h[j].at) }
+func (h expiryHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *expiryHeap) Push(x interface{}) { *h = append(*h, x.(expiryEntry)) }
+func (h *expiryHeap) Pop() interface{} {
+	old := *h
+	entry := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return entry
+}
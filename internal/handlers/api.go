@@ -2,16 +2,21 @@ package handlers
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"log"
-	"math"
 	"net/http"
 	"sort"
 	"strconv"
 	"time"
 
 	"github.com/labstack/echo/v4"
+	"github.com/ranjankuldeep/fakeNumber/internal/apikeys"
 	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/internal/expiry"
+	"github.com/ranjankuldeep/fakeNumber/internal/ledger"
+	"github.com/ranjankuldeep/fakeNumber/internal/money"
+	"github.com/ranjankuldeep/fakeNumber/internal/orderstate"
+	"github.com/ranjankuldeep/fakeNumber/internal/providers"
 	"github.com/ranjankuldeep/fakeNumber/internal/services"
 	"github.com/ranjankuldeep/fakeNumber/internal/utils"
 	"github.com/ranjankuldeep/fakeNumber/logs"
@@ -54,15 +59,9 @@ func GetNumberHandlerApi(c echo.Context) error {
 		return c.JSON(http.StatusOK, map[string]string{"error": "site is under maintenance"})
 	}
 
-	var apiWalletUser models.ApiWalletUser
-	apiWalletCollection := models.InitializeApiWalletuserCollection(db)
-	err = apiWalletCollection.FindOne(ctx, bson.M{"api_key": apiKey}).Decode(&apiWalletUser)
+	apiWalletUser, err := walletForKey(ctx, c, db, apiKey, apikeys.ScopeBuy)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid api key"})
-		}
-		logs.Logger.Error(err)
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "internal server error"})
+		return apiKeyError(c, err)
 	}
 
 	userCollection := models.InitializeUserCollection(db)
@@ -126,47 +125,54 @@ func GetNumberHandlerApi(c echo.Context) error {
 		}
 	}
 
-	price, _ := strconv.ParseFloat(serverData.Price, 64)
+	price, err := money.Parse(serverData.Price)
+	if err != nil {
+		logs.Logger.Errorf("invalid price %q for %s on server %d: %v", serverData.Price, serviceName, serverNumber, err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "invalid service price"})
+	}
 	discount, err := FetchDiscount(ctx, db, user.ID.Hex(), serviceName, serverNumber)
 	price += discount
 
-	if apiWalletUser.Balance < price {
+	hold, err := ledger.Hold(ctx, db, user.ID, price, "number on server "+server)
+	if errors.Is(err, ledger.ErrInsufficientBalance) {
 		return c.JSON(http.StatusBadRequest, echo.Map{"error": "low balance"})
 	}
-
-	apiURLRequest, err := constructApiUrl(db, server, serverInfo.APIKey, serverInfo.Token, serverData, isMultiple)
 	if err != nil {
-		logs.Logger.Error("failed to construct API URL")
+		logs.Logger.Error(err)
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "internal server error"})
 	}
-	numData, err := ExtractNumber(server, apiURLRequest)
+
+	candidate := purchaseCandidate{Info: serverInfo, Data: serverData, Price: price, Discount: discount}
+	numData, err := buyWithHold(ctx, db, hold, candidate, isMultiple)
 	if err != nil {
 		logs.Logger.Error(err)
 		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
 	}
-	newBalance := math.Round((apiWalletUser.Balance-price)*100) / 100
-	_, err = apiWalletCollection.UpdateOne(ctx, bson.M{"userId": user.ID}, bson.M{"$set": bson.M{"balance": newBalance}})
-	if err != nil {
-		logs.Logger.Error("failed to update user balance")
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "internal server error"})
-	}
-
 	transactionHistoryCollection := models.InitializeTransactionHistoryCollection(db)
+	state, transitions := orderstate.Opened(orderstate.ActorAPI, "number assigned by server "+server)
 	transaction := models.TransactionHistory{
 		UserID:        apiWalletUser.UserID.Hex(),
 		Service:       serviceName,
 		TransactionID: numData.Id,
-		Price:         fmt.Sprintf("%.2f", price),
+		Price:         price.String(),
 		Server:        server,
 		OTP:           []string{},
 		ID:            primitive.NewObjectID(),
 		Number:        numData.Number,
-		Status:        "PENDING",
+		Status:        orderstate.WaitingSMS.Status(),
+		State:         state,
+		Transitions:   transitions,
 		DateTime:      time.Now().In(time.FixedZone("IST", 5*3600+30*60)).Format("2006-01-02T15:04:05"),
 	}
 	_, err = transactionHistoryCollection.InsertOne(ctx, transaction)
 	if err != nil {
 		logs.Logger.Error("failed to save transaction history")
+		releaseHold(db, hold, "failed to record purchase")
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "internal server error"})
+	}
+	err = capturePurchase(ctx, db, hold, transaction, price, discount)
+	if err != nil {
+		logs.Logger.Error("failed to update user balance")
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "internal server error"})
 	}
 
@@ -175,7 +181,7 @@ func GetNumberHandlerApi(c echo.Context) error {
 		ID:             primitive.NewObjectID(),
 		UserID:         apiWalletUser.UserID,
 		Service:        serviceName,
-		Price:          price,
+		Price:          price.Float64(),
 		Server:         serverNumber,
 		NumberID:       numData.Id,
 		Number:         numData.Number,
@@ -187,10 +193,7 @@ func GetNumberHandlerApi(c echo.Context) error {
 		logs.Logger.Error("failed to create order")
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "internal server error"})
 	}
-
-	if numData.Id == "" || numData.Number == "" {
-		return c.JSON(http.StatusBadRequest, echo.Map{"error": "no stock available"})
-	}
+	expiry.Schedule(order)
 	return c.JSON(http.StatusOK, echo.Map{
 		"status": "ok",
 		"id":     numData.Id,
@@ -235,22 +238,16 @@ func GetOTPHandlerApi(c echo.Context) error {
 	}
 	serviceName := transaction.Service
 
-	if transaction.Status == "CANCELLED" {
+	if orderstate.Current(transaction).Closed() {
 		return c.JSON(http.StatusOK, map[string]string{"status": "ok", "otp": "number cancelled"})
 	}
-	if len(transaction.OTP) == 0 && transaction.Status == "PENDING" {
+	if len(transaction.OTP) == 0 && orderstate.Current(transaction) == orderstate.WaitingSMS {
 		return c.JSON(http.StatusOK, map[string]string{"status": "ok", "otp": "waiting for otp"})
 	}
 
-	var apiWalletUser models.ApiWalletUser
-	apiWalletCollection := models.InitializeApiWalletuserCollection(db)
-	err = apiWalletCollection.FindOne(context.TODO(), bson.M{"api_key": apiKey}).Decode(&apiWalletUser)
+	apiWalletUser, err := walletForKey(context.TODO(), c, db, apiKey, apikeys.ScopeBuy)
 	if err != nil {
-		if err == mongo.ErrEmptySlice {
-			return c.JSON(http.StatusInternalServerError, echo.Map{"error": "invalid api key"})
-		}
-		logs.Logger.Error(err)
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "internal server error"})
+		return apiKeyError(c, err)
 	}
 
 	userCollection := models.InitializeUserCollection(db)
@@ -266,13 +263,13 @@ func GetOTPHandlerApi(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
 	}
 
-	constructedOTPRequest, err := constructOtpUrl(server, serverData.APIKey, serverData.Token, id)
+	provider, err := providers.New(serverData)
 	if err != nil {
 		logs.Logger.Error(err)
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "INVALID_SERVER"})
 	}
 
-	validOtpList, err := fetchOTP(server, id, constructedOTPRequest)
+	validOtpList, err := provider.GetStatus(id)
 	if err != nil {
 		logs.Logger.Error(err)
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
@@ -290,8 +287,12 @@ func GetOTPHandlerApi(c echo.Context) error {
 				"$set":      bson.M{"date_time": formattedDateTime},
 			}
 
-			filter := bson.M{"id": id}
-			_, err = transactionCollection.UpdateOne(ctx, filter, update)
+			_, err = orderstate.Transition(ctx, transactionCollection, bson.M{"id": id}, orderstate.SMSReceived,
+				orderstate.ActorUpstream, "otp received", update)
+			if errors.Is(err, orderstate.ErrIllegalTransition) {
+				logs.Logger.Warnf("Ignoring OTP for order %s: %v", id, err)
+				continue
+			}
 			if err != nil {
 				return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 			}
@@ -364,15 +365,9 @@ func CancelNumberHandlerApi(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"errror": "internal server error"})
 	}
 
-	var apiWalletUser models.ApiWalletUser
-	apiWalletCollection := models.InitializeApiWalletuserCollection(db)
-	err = apiWalletCollection.FindOne(context.TODO(), bson.M{"api_key": apiKey}).Decode(&apiWalletUser)
+	apiWalletUser, err := walletForKey(context.TODO(), c, db, apiKey, apikeys.ScopeBuy)
 	if err != nil {
-		if err == mongo.ErrEmptySlice {
-			return c.JSON(http.StatusInternalServerError, echo.Map{"error": "invalid api key"})
-		}
-		logs.Logger.Error(err)
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "internal server error"})
+		return apiKeyError(c, err)
 	}
 
 	userCollection := models.InitializeUserCollection(db)
@@ -414,23 +409,24 @@ func CancelNumberHandlerApi(c echo.Context) error {
 	if otpArrived == true {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "otp already come"})
 	}
-
-	constructedNumberRequest, err := ConstructNumberUrl(server, serverData.APIKey, serverData.Token, id, existingOrder.Number)
-	if err != nil {
-		logs.Logger.Error(err)
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid server"})
+	// An order the upstream already cancelled only needs its refund.
+	state := orderstate.Current(transactionData)
+	if state != orderstate.Cancelled && !orderstate.CanTransition(state, orderstate.Cancelled) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "number already cancelled"})
 	}
 
-	err = CancelNumberThirdParty(constructedNumberRequest.URL, server, id, db, constructedNumberRequest.Headers)
-	if err != nil {
-		logs.Logger.Error(err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
-	}
+	if state != orderstate.Cancelled {
+		provider, err := providers.New(serverData)
+		if err != nil {
+			logs.Logger.Error(err)
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid server"})
+		}
 
-	_, err = orderCollection.DeleteOne(ctx, bson.M{"numberId": id})
-	if err != nil {
-		logs.Logger.Error(err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+		err = provider.Cancel(id, existingOrder.Number)
+		if err != nil {
+			logs.Logger.Error(err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
 	}
 
 	formattedData := FormatDateTime()
@@ -441,34 +437,53 @@ func CancelNumberHandlerApi(c echo.Context) error {
 		logs.Logger.Error(err)
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
-
-	transactionUpdateFilter := bson.M{"id": id}
-	transactionpdate := bson.M{
-		"$set": bson.M{
-			"status":    "CANCELLED",
-			"date_time": formattedData,
-		},
-	}
-
-	_, err = transactionCollection.UpdateOne(ctx, transactionUpdateFilter, transactionpdate)
+	price, err := money.Parse(transaction.Price)
 	if err != nil {
 		logs.Logger.Error(err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
 	}
-	price, err := strconv.ParseFloat(transaction.Price, 64)
-	newBalance := apiWalletUser.Balance + price
-	newBalance = math.Round(newBalance*100) / 100
 
-	update := bson.M{
-		"$set": bson.M{"balance": newBalance},
+	session, err := db.Client().StartSession()
+	if err != nil {
+		logs.Logger.Error("Failed to start session:", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
 	}
-	balanceFilter := bson.M{"_id": apiWalletUser.UserID}
-
-	_, err = apiWalletCollection.UpdateOne(ctx, balanceFilter, update)
+	defer session.EndSession(context.Background())
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		transactionUpdateFilter := bson.M{"id": id, "userId": apiWalletUser.UserID.Hex()}
+		_, err := orderstate.Transition(sc, transactionCollection, transactionUpdateFilter, orderstate.Cancelled,
+			orderstate.ActorAPI, "cancelled by api user", bson.M{"$set": bson.M{"date_time": formattedData}})
+		if err != nil && !errors.Is(err, orderstate.ErrIllegalTransition) {
+			return nil, err
+		}
+		_, err = orderstate.Transition(sc, transactionCollection, transactionUpdateFilter, orderstate.Refunded,
+			orderstate.ActorAPI, "refund on cancel", nil)
+		if errors.Is(err, orderstate.ErrIllegalTransition) {
+			// Already refunded by the expiry scheduler.
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		_, err = ledger.Post(sc, db, ledger.Posting{
+			UserID:           apiWalletUser.UserID,
+			Kind:             ledger.KindRefund,
+			Amount:           price,
+			SourceCollection: "transactionhistories",
+			SourceID:         transaction.ID.Hex(),
+			Note:             "refund on cancel",
+		})
+		return nil, err
+	})
 	if err != nil {
 		logs.Logger.Error(err)
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
 	}
+
+	_, err = orderCollection.DeleteOne(ctx, bson.M{"numberId": id})
+	if err != nil {
+		logs.Logger.Error(err)
+	}
 	return c.JSON(http.StatusOK, map[string]string{"status": "success"})
 }
 
@@ -496,11 +511,9 @@ func GetServiceDataApi(c echo.Context) error {
 		return c.JSON(http.StatusOK, map[string]string{"error": "site is under maintenance"})
 	}
 
-	var apiWalletUser models.ApiWalletUser
-	apiWalletCollection := models.InitializeApiWalletuserCollection(db)
-	err = apiWalletCollection.FindOne(context.TODO(), bson.M{"api_key": apiKey}).Decode(&apiWalletUser)
+	apiWalletUser, err := walletForKey(context.TODO(), c, db, apiKey, apikeys.ScopeRead)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid Api Key"})
+		return apiKeyError(c, err)
 	}
 
 	err = serverCollection.FindOne(context.Background(), bson.M{"server": 0}).Decode(&maintenanceStatus)
@@ -562,15 +575,15 @@ func GetServiceDataApi(c echo.Context) error {
 		seenServers := make(map[int]bool)
 
 		for _, server := range service.Servers {
-			if contains(maintenanceServerNumbers, server.Server) || seenServers[server.Server] {
-				continue // Skip maintenance or duplicate servers
+			if contains(maintenanceServerNumbers, server.Server) || providers.Degraded(server.Server) || seenServers[server.Server] {
+				continue // Skip maintenance, degraded or duplicate servers
 			}
 			seenServers[server.Server] = true
 
 			// Calculate discounts
 			discount := CalculateDiscount(serviceDiscounts, serverDiscounts, userDiscounts, service.Name, server.Server, apiWalletUser.UserID.Hex())
-			price, _ := strconv.ParseFloat(server.Price, 64)
-			adjustedPrice := strconv.FormatFloat(price+discount, 'f', 2, 64)
+			price, _ := money.Parse(server.Price)
+			adjustedPrice := (price + discount).String()
 
 			// Normalize the OTP field
 			var otpType string
@@ -1,22 +1,23 @@
 package handlers
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"net/http"
 	"time"
 
+	"github.com/ranjankuldeep/fakeNumber/internal/apikeys"
 	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/internal/ledger"
+	"github.com/ranjankuldeep/fakeNumber/internal/money"
+	"github.com/ranjankuldeep/fakeNumber/internal/recharge"
 	"github.com/ranjankuldeep/fakeNumber/internal/services"
 	"github.com/ranjankuldeep/fakeNumber/internal/utils"
 	"github.com/ranjankuldeep/fakeNumber/logs"
 
-	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
+	"github.com/ranjankuldeep/fakeNumber/internal/audit"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -32,29 +33,8 @@ func checkMaintenance(ctx context.Context, serverCol *mongo.Collection) (bool, e
 	return serverData.Maintenance, nil
 }
 
-// Handler to retrieve API key
-func ApiKey(c echo.Context) error {
-	db := c.Get("db").(*mongo.Database)
-	// serverCol := models.InitializeServerCollection(db)
-	walletCol := models.InitializeApiWalletuserCollection(db)
-
-	userId := c.QueryParam("userId")
-	if userId == "" {
-		return c.JSON(http.StatusBadRequest, echo.Map{"message": "userId is required"})
-	}
-
-	var user models.ApiWalletUser
-	objID, _ := primitive.ObjectIDFromHex(userId)
-	err := walletCol.FindOne(context.TODO(), bson.M{"userId": objID}).Decode(&user)
-	if err != nil {
-		return c.JSON(http.StatusNotFound, echo.Map{"error": "User not found"})
-	}
-	return c.JSON(http.StatusOK, echo.Map{"api_key": user.APIKey})
-}
-
 func BalanceHandler(c echo.Context) error {
 	db := c.Get("db").(*mongo.Database)
-	walletCol := models.InitializeApiWalletuserCollection(db)
 
 	apiKey := c.QueryParam("apikey")
 	if apiKey == "" {
@@ -75,49 +55,15 @@ func BalanceHandler(c echo.Context) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	var user models.ApiWalletUser
-	err = walletCol.FindOne(ctx, bson.M{"api_key": apiKey}).Decode(&user)
-	if err != nil {
-		return c.JSON(http.StatusNotFound, echo.Map{"error": "Invalid Api Key"})
-	}
-	return c.JSON(http.StatusOK, echo.Map{"balance": user.Balance})
-}
-
-func ChangeAPIKeyHandler(c echo.Context) error {
-	db := c.Get("db").(*mongo.Database)
-	serverCol := models.InitializeServerCollection(db)
-	walletCol := models.InitializeApiWalletuserCollection(db)
-
-	userId := c.QueryParam("userId")
-	if userId == "" {
-		return c.JSON(http.StatusBadRequest, echo.Map{"message": "UserId is required"})
-	}
-
-	objectID, err := primitive.ObjectIDFromHex(userId)
-	if err != nil {
-		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid userId format"})
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	isMaintenance, err := checkMaintenance(ctx, serverCol)
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Internal server error"})
-	}
-	if isMaintenance {
-		return c.JSON(http.StatusForbidden, echo.Map{"error": "Site is under maintenance."})
-	}
-
-	newApiKey := uuid.New().String()
-	filter := bson.M{"userId": objectID}
-	update := bson.M{"$set": bson.M{"api_key": newApiKey}}
-
-	_, err = walletCol.UpdateOne(ctx, filter, update)
+	user, err := walletForKey(ctx, c, db, apiKey, apikeys.ScopeBalance)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to update API key"})
+		return apiKeyError(c, err)
 	}
-
-	return c.JSON(http.StatusOK, echo.Map{"message": "API key updated successfully", "api_key": newApiKey})
+	return c.JSON(http.StatusOK, echo.Map{
+		"balance":   user.Amount(),
+		"available": user.Available(),
+		"held":      user.HeldPaise,
+	})
 }
 
 func CreateOrUpdateAPIKeyHandler(c echo.Context) error {
@@ -131,8 +77,11 @@ func CreateOrUpdateAPIKeyHandler(c echo.Context) error {
 	log.Println("INFO: Initialized recharge API collection")
 
 	type APIKeyRequest struct {
-		RechargeType string `json:"recharge_type"`
-		APIKey       string `json:"api_key"`
+		RechargeType  string `json:"recharge_type"`
+		APIKey        string `json:"api_key"`
+		Verifier      string `json:"verifier"`
+		VerifierURL   string `json:"verifier_url"`
+		WebhookSecret string `json:"webhook_secret"`
 	}
 
 	var req APIKeyRequest
@@ -148,75 +97,49 @@ func CreateOrUpdateAPIKeyHandler(c echo.Context) error {
 	defer cancel()
 	var existingAPI models.RechargeAPI
 	err := rechargeCol.FindOne(ctx, bson.M{"recharge_type": req.RechargeType}).Decode(&existingAPI)
+	audit.SetTarget(c, "recharge-api", req.RechargeType)
 
 	if err == mongo.ErrNoDocuments {
-		_, err = rechargeCol.InsertOne(ctx, models.RechargeAPI{
-			RechargeType: req.RechargeType,
-			APIKey:       req.APIKey,
-		})
+		created := models.RechargeAPI{
+			RechargeType:  req.RechargeType,
+			APIKey:        req.APIKey,
+			Verifier:      req.Verifier,
+			VerifierURL:   req.VerifierURL,
+			WebhookSecret: req.WebhookSecret,
+		}
+		_, err = rechargeCol.InsertOne(ctx, created)
 		if err != nil {
 			log.Println("ERROR: Failed to create API key:", err)
 			return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to create API key"})
 		}
+		audit.SetAfter(c, created)
 		return c.JSON(http.StatusCreated, echo.Map{"message": "API key created successfully"})
 	} else if err != nil {
 		log.Println("ERROR: Failed to query recharge API collection:", err)
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Internal server error"})
 	}
-	_, err = rechargeCol.UpdateOne(ctx, bson.M{"recharge_type": req.RechargeType}, bson.M{"$set": bson.M{"api_key": req.APIKey}})
+	update := bson.M{"api_key": req.APIKey, "verifier": req.Verifier, "verifier_url": req.VerifierURL}
+	// An empty secret keeps the current one, so that it need not be resent.
+	if req.WebhookSecret != "" {
+		update["webhook_secret"] = req.WebhookSecret
+	}
+	_, err = rechargeCol.UpdateOne(ctx, bson.M{"recharge_type": req.RechargeType}, bson.M{"$set": update})
 	if err != nil {
 		log.Println("ERROR: Failed to update API key:", err)
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to update API key"})
 	}
-	return c.JSON(http.StatusOK, echo.Map{"message": "API key updated successfully"})
-}
-
-func GetUpiQR(c echo.Context) error {
-	amount := c.QueryParam("amt")
-	if amount == "" {
-		return c.JSON(http.StatusBadRequest, echo.Map{"error": "empty amount"})
-	}
-
-	db, ok := c.Get("db").(*mongo.Database)
-	if !ok {
-		log.Println("ERROR: Failed to retrieve database instance from context")
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Internal server error"})
-	}
-
-	var adminData models.RechargeAPI
-	adminWalletCollection := models.InitializeRechargeAPICollection(db)
-	err := adminWalletCollection.FindOne(context.TODO(), bson.M{"recharge_type": "upi"}).Decode(&adminData)
-	if err != nil {
-		logs.Logger.Error(err)
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": ""})
+	updated := existingAPI
+	updated.APIKey, updated.Verifier, updated.VerifierURL = req.APIKey, req.Verifier, req.VerifierURL
+	if req.WebhookSecret != "" {
+		updated.WebhookSecret = req.WebhookSecret
 	}
-
-	upiId := adminData.APIKey
-	qrUrl := fmt.Sprintf("https://php.paidsms.in/qr/?upi=%s&amount=%s", upiId, amount)
-
-	resp, err := http.Get(qrUrl)
-	if err != nil {
-		log.Println("ERROR: Failed to fetch QR code SVG:", err)
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to fetch QR code"})
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		log.Printf("ERROR: Non-200 response from QR code service: %d\n", resp.StatusCode)
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to fetch QR code"})
-	}
-
-	svgData, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		log.Println("ERROR: Failed to read QR code SVG:", err)
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to read QR code"})
-	}
-	return c.Blob(http.StatusOK, "image/svg+xml", svgData)
+	audit.SetBefore(c, existingAPI)
+	audit.SetAfter(c, updated)
+	return c.JSON(http.StatusOK, echo.Map{"message": "API key updated successfully"})
 }
 
 func UpdateRechargeHandler(c echo.Context) error {
 	db := c.Get("db").(*mongo.Database)
-	walletCol := models.InitializeApiWalletuserCollection(db)
 	var requestBody struct {
 		UserID         string  `json:"userId"`
 		RechargeAmount float64 `json:"recharge_amount"`
@@ -229,55 +152,37 @@ func UpdateRechargeHandler(c echo.Context) error {
 		logs.Logger.Warn("Validation failed: UserID or NewBalance is missing")
 		return c.JSON(http.StatusBadRequest, echo.Map{"message": "User ID and new_balance are required"})
 	}
-	userObjectID, _ := primitive.ObjectIDFromHex(requestBody.UserID)
+	userObjectID, err := primitive.ObjectIDFromHex(requestBody.UserID)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"message": "Invalid userId format"})
+	}
 
 	var user models.User
 	userCollection := models.InitializeUserCollection(db)
-	err := userCollection.FindOne(context.TODO(), bson.M{
+	err = userCollection.FindOne(context.TODO(), bson.M{
 		"_id": userObjectID,
 	}).Decode(&user)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	rechargeHistory := map[string]interface{}{
-		"userId":         requestBody.UserID,
-		"transaction_id": fmt.Sprintf("Admin%02d%02d%02d", time.Now().Hour(), time.Now().Minute(), time.Now().Second()),
-		"amount":         fmt.Sprintf("%.2f", requestBody.RechargeAmount),
-		"payment_type":   "Admin Added",
-		"status":         "Received",
-	}
-
-	host := c.Request().Host
-	protocol := "http"
-	rechargeHistoryURL := fmt.Sprintf("%s://%s/api/save-recharge-history", protocol, host)
-	rechargeHistoryJSON, _ := json.Marshal(rechargeHistory)
-	req, err := http.NewRequest("POST", rechargeHistoryURL, bytes.NewBuffer(rechargeHistoryJSON))
+	amount := money.FromFloat(requestBody.RechargeAmount)
+	result, err := saveRecharge(ctx, db, recharge.Request{
+		UserID:        userObjectID,
+		TransactionID: "Admin" + primitive.NewObjectID().Hex(),
+		Amount:        amount,
+		PaymentType:   recharge.TypeAdmin,
+		Status:        recharge.StatusReceived,
+	})
 	if err != nil {
-		logs.Logger.Error("Failed to create recharge history request: ", err)
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to create recharge history request"})
-	}
-	req.Header.Set("Content-Type", "application/json")
-	logs.Logger.Infof("Sending recharge history request to URL: %s", rechargeHistoryURL)
-	client := &http.Client{Timeout: 5 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil || resp.StatusCode != http.StatusOK {
-		logs.Logger.Errorf("Failed to save recharge history: %v, Status Code: %d", err, resp.StatusCode)
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to save recharge history"})
+		logs.Logger.Errorf("Failed to save recharge history: %v", err)
+		return rechargeError(c, err)
 	}
-	defer resp.Body.Close()
 	logs.Logger.Info("Recharge history saved successfully")
 
-	var walletUser models.ApiWalletUser
-	err = walletCol.FindOne(ctx, bson.M{"userId": userObjectID}).Decode(&walletUser)
-	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			logs.Logger.Warnf("No user found with UserID: %s", requestBody.UserID)
-			return c.JSON(http.StatusNotFound, echo.Map{"message": "User not found"})
-		}
-		logs.Logger.Error("Failed to fetch user: ", err)
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to fetch user"})
-	}
+	audit.SetTarget(c, "user", requestBody.UserID)
+	audit.SetBefore(c, bson.M{"balance": (result.Balance - amount).String()})
+	audit.SetAfter(c, bson.M{"balance": result.Balance.String()})
 
 	ipDetail, err := utils.ExtractIpDetails(c)
 	if err != nil {
@@ -287,7 +192,7 @@ func UpdateRechargeHandler(c echo.Context) error {
 	rechargeDetails := services.AdminRechargeDetails{
 		Email:          user.Email,
 		UserID:         userObjectID.Hex(),
-		UpdatedBalance: fmt.Sprintf("%0.2f", walletUser.Balance),
+		UpdatedBalance: result.Balance.String(),
 		Amount:         fmt.Sprintf("%0.2f", requestBody.RechargeAmount),
 		IP:             ipDetail,
 	}
@@ -330,13 +235,43 @@ func UpdateWalletBalanceHandler(c echo.Context) error {
 		"_id": userObjectID,
 	}).Decode(&user)
 
-	update := bson.M{"$set": bson.M{"balance": requestBody.NewBalance}}
-	logs.Logger.Info("Updating user balance in the database")
-	_, err = walletCol.UpdateOne(ctx, bson.M{"userId": userObjectID}, update)
+	audit.SetTarget(c, "user", requestBody.UserID)
+
+	session, err := db.Client().StartSession()
 	if err != nil {
+		logs.Logger.Error("Failed to start session: ", err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to update balance"})
+	}
+	defer session.EndSession(context.Background())
+
+	// Book the difference so the ledger explains the new balance. The balance
+	// is read in the same transaction, so a purchase or recharge landing in
+	// between makes the transaction retry instead of being overwritten.
+	logs.Logger.Info("Updating user balance in the database")
+	before, err := session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		var walletUser models.ApiWalletUser
+		if err := walletCol.FindOne(sc, bson.M{"userId": userObjectID}).Decode(&walletUser); err != nil {
+			return nil, err
+		}
+		_, err := ledger.Post(sc, db, ledger.Posting{
+			UserID:           userObjectID,
+			Kind:             ledger.KindAdjustment,
+			Amount:           money.FromFloat(requestBody.NewBalance) - walletUser.Amount(),
+			SourceCollection: "adjustments",
+			SourceID:         primitive.NewObjectID().Hex(),
+			Note:             fmt.Sprintf("balance set to %.2f by admin", requestBody.NewBalance),
+		})
+		return walletUser.Amount(), err
+	})
+	if err == mongo.ErrNoDocuments {
+		logs.Logger.Error("Failed to fetch wallet: ", err)
+		return c.JSON(http.StatusNotFound, echo.Map{"message": "User not found"})
+	} else if err != nil {
 		logs.Logger.Error("Failed to update balance: ", err)
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to update balance"})
 	}
+	audit.SetBefore(c, bson.M{"balance": before.(money.Paise).String()})
+	audit.SetAfter(c, bson.M{"balance": money.FromFloat(requestBody.NewBalance).String()})
 	return c.JSON(http.StatusOK, echo.Map{
 		"message":    "Balance Updated Successfully",
 		"newBalance": requestBody.NewBalance,
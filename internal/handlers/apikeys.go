@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/ranjankuldeep/fakeNumber/internal/apikeys"
+	"github.com/ranjankuldeep/fakeNumber/internal/auth"
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/logs"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// walletForKey authenticates the apikey parameter for scope and returns the
+// wallet of the key's owner.
+func walletForKey(ctx context.Context, c echo.Context, db *mongo.Database, raw, scope string) (models.ApiWalletUser, error) {
+	var wallet models.ApiWalletUser
+	key, err := apikeys.Authenticate(ctx, db, raw, c.RealIP(), scope)
+	if err != nil {
+		return wallet, err
+	}
+	err = models.InitializeApiWalletuserCollection(db).FindOne(ctx, bson.M{"userId": key.UserID}).Decode(&wallet)
+	if err == mongo.ErrNoDocuments {
+		return wallet, apikeys.ErrInvalidKey
+	}
+	return wallet, err
+}
+
+// apiKeyError writes the response for a failed walletForKey.
+func apiKeyError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, apikeys.ErrInvalidKey), errors.Is(err, apikeys.ErrExpired):
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	case errors.Is(err, apikeys.ErrIPNotAllowed), errors.Is(err, apikeys.ErrScopeNotAllowed):
+		return c.JSON(http.StatusForbidden, echo.Map{"error": err.Error()})
+	}
+	logs.Logger.Error(err)
+	return c.JSON(http.StatusInternalServerError, echo.Map{"error": "internal server error"})
+}
+
+// ListAPIKeys returns the user's API keys without the secrets.
+func ListAPIKeys(c echo.Context) error {
+	db := c.Get("db").(*mongo.Database)
+	userId, err := auth.SubjectID(c)
+	if err != nil {
+		return subjectError(c, err)
+	}
+	objID, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid userId format"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	keys, err := apikeys.List(ctx, db, objID)
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to fetch API keys"})
+	}
+	return c.JSON(http.StatusOK, echo.Map{"keys": keys, "scopes": apikeys.Scopes()})
+}
+
+// CreateAPIKey issues a new key for the caller. The key is in the response
+// and is never shown again.
+func CreateAPIKey(c echo.Context) error {
+	db := c.Get("db").(*mongo.Database)
+	var request struct {
+		Name       string     `json:"name"`
+		Scopes     []string   `json:"scopes"`
+		AllowedIPs []string   `json:"allowedIps"`
+		ExpiresAt  *time.Time `json:"expiresAt"`
+	}
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid request body"})
+	}
+	userID, err := primitive.ObjectIDFromHex(auth.UserID(c))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid userId format"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	isMaintenance, err := checkMaintenance(ctx, models.InitializeServerCollection(db))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Internal server error"})
+	}
+	if isMaintenance {
+		return c.JSON(http.StatusForbidden, echo.Map{"error": "Site is under maintenance."})
+	}
+
+	opts := apikeys.Options{
+		Name:       request.Name,
+		Scopes:     request.Scopes,
+		AllowedIPs: request.AllowedIPs,
+		ExpiresAt:  request.ExpiresAt,
+	}
+	if err := opts.Validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+	raw, key, err := apikeys.Create(ctx, db, userID, opts)
+	if err == apikeys.ErrTooManyKeys {
+		return c.JSON(http.StatusConflict, echo.Map{"error": "Too many API keys, revoke one first"})
+	} else if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to create API key"})
+	}
+	return c.JSON(http.StatusCreated, echo.Map{"api_key": raw, "key": key})
+}
+
+// RevokeAPIKey disables one of the caller's keys, given by the id parameter.
+func RevokeAPIKey(c echo.Context) error {
+	db := c.Get("db").(*mongo.Database)
+	keyID, err := primitive.ObjectIDFromHex(c.QueryParam("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid id format"})
+	}
+	userID, err := primitive.ObjectIDFromHex(auth.UserID(c))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid userId format"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = apikeys.Revoke(ctx, db, userID, keyID)
+	if err == apikeys.ErrNotFound {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "API key not found"})
+	} else if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to revoke API key"})
+	}
+	return c.JSON(http.StatusOK, echo.Map{"message": "API key revoked successfully"})
+}
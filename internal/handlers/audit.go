@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/ranjankuldeep/fakeNumber/internal/audit"
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/logs"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 500
+)
+
+// discountSnapshot keeps only the discount of a stored discount document, or
+// nil when there was none.
+func discountSnapshot(doc bson.M) interface{} {
+	if doc == nil {
+		return nil
+	}
+	return bson.M{"discount": doc["discount"]}
+}
+
+// userDiscountSnapshot keys a user's discount by service and server, since
+// the audit target is the user.
+func userDiscountSnapshot(service string, server int, doc bson.M) interface{} {
+	if doc == nil {
+		return nil
+	}
+	return bson.M{fmt.Sprintf("discount:%s:%d", service, server): doc["discount"]}
+}
+
+// parseAuditFilter reads the filters shared by the query and export
+// endpoints: actorId, action, targetId, from and to.
+func parseAuditFilter(c echo.Context) (audit.Filter, error) {
+	var filter audit.Filter
+	if actor := c.QueryParam("actorId"); actor != "" {
+		actorID, err := primitive.ObjectIDFromHex(actor)
+		if err != nil {
+			return filter, errors.New("Invalid actorId format")
+		}
+		filter.ActorID = actorID
+	}
+	filter.Action = c.QueryParam("action")
+	filter.TargetID = c.QueryParam("targetId")
+	var err error
+	if filter.From, err = parseStatementTime(c.QueryParam("from")); err != nil {
+		return filter, errors.New("Invalid from date")
+	}
+	if filter.To, err = parseStatementTime(c.QueryParam("to")); err != nil {
+		return filter, errors.New("Invalid to date")
+	}
+	return filter, nil
+}
+
+// GetAuditLog returns a page of audit entries, newest first.
+func GetAuditLog(c echo.Context) error {
+	db := c.Get("db").(*mongo.Database)
+	filter, err := parseAuditFilter(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+	page, _ := strconv.Atoi(c.QueryParam("page"))
+	if page < 1 {
+		page = 1
+	}
+	limit, _ := strconv.Atoi(c.QueryParam("limit"))
+	if limit < 1 || limit > maxAuditPageSize {
+		limit = defaultAuditPageSize
+	}
+	filter.Skip = int64((page - 1) * limit)
+	filter.Limit = int64(limit)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	cursor, err := audit.Find(ctx, db, filter)
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to fetch audit log"})
+	}
+	entries := []models.AuditEntry{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to fetch audit log"})
+	}
+	return c.JSON(http.StatusOK, echo.Map{"page": page, "limit": limit, "entries": entries})
+}
+
+// ExportAuditLog streams every matching audit entry as CSV.
+func ExportAuditLog(c echo.Context) error {
+	db := c.Get("db").(*mongo.Database)
+	filter, err := parseAuditFilter(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	cursor, err := audit.Find(ctx, db, filter)
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to fetch audit log"})
+	}
+	defer cursor.Close(ctx)
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/csv")
+	res.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=audit-log-%s.csv", time.Now().Format("20060102-150405")))
+	res.WriteHeader(http.StatusOK)
+
+	w := csv.NewWriter(res)
+	w.Write([]string{"time", "actor_id", "actor_email", "actor_role", "action", "target_type", "target_id", "changes", "request", "status", "ip", "request_id"})
+	for cursor.Next(ctx) {
+		var entry models.AuditEntry
+		if err := cursor.Decode(&entry); err != nil {
+			logs.Logger.Error(err)
+			continue
+		}
+		changes, _ := json.Marshal(entry.Changes)
+		w.Write([]string{
+			entry.CreatedAt.Format(time.RFC3339),
+			entry.ActorID.Hex(),
+			entry.ActorEmail,
+			entry.ActorRole,
+			entry.Action,
+			entry.TargetType,
+			entry.TargetID,
+			string(changes),
+			entry.Request,
+			strconv.Itoa(entry.Status),
+			entry.IP,
+			entry.RequestID,
+		})
+	}
+	if err := cursor.Err(); err != nil {
+		// The header is already sent, so the best we can do is log it.
+		logs.Logger.Error(err)
+	}
+	w.Flush()
+	return w.Error()
+}
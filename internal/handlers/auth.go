@@ -0,0 +1,19 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/ranjankuldeep/fakeNumber/internal/auth"
+	"github.com/ranjankuldeep/fakeNumber/logs"
+)
+
+// subjectError answers a request whose auth.SubjectID lookup failed.
+func subjectError(c echo.Context, err error) error {
+	if errors.Is(err, auth.ErrForbidden) {
+		return c.JSON(http.StatusForbidden, echo.Map{"error": err.Error()})
+	}
+	logs.Logger.Error(err)
+	return c.JSON(http.StatusInternalServerError, echo.Map{"error": "internal server error"})
+}
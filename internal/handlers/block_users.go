@@ -10,6 +10,7 @@ import (
 	"github.com/ranjankuldeep/fakeNumber/logs"
 
 	"github.com/labstack/echo/v4"
+	"github.com/ranjankuldeep/fakeNumber/internal/audit"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -60,13 +61,18 @@ func ToggleBlockStatus(c echo.Context) error {
 			{Key: "updatedAt", Value: time.Now()}, // Update the timestamp
 		}},
 	}
-	result, err := blockCol.UpdateOne(c.Request().Context(), bson.M{}, update)
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to update block status"})
+	var previous struct {
+		Block bool `bson:"block"`
 	}
-	if result.MatchedCount == 0 {
+	err := blockCol.FindOneAndUpdate(c.Request().Context(), bson.M{}, update).Decode(&previous)
+	if err == mongo.ErrNoDocuments {
 		return c.JSON(http.StatusNotFound, echo.Map{"error": "Block status document not found"})
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to update block status"})
 	}
+	audit.SetTarget(c, "block-status", "")
+	audit.SetBefore(c, bson.M{"block": previous.Block})
+	audit.SetAfter(c, bson.M{"block": request.Status})
 	return c.JSON(http.StatusOK, echo.Map{
 		"message": "Block status updated successfully",
 		"data": bson.M{
@@ -126,15 +132,21 @@ func BlockFraudClear(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Error finding user"})
 	}
 
-	_, err = rechargeHistoryCol.DeleteMany(ctx, bson.M{"userId": userId})
+	audit.SetTarget(c, "user", userId)
+	snapshot := bson.M{"balance": user.Amount().String(), "trxAddress": user.TRXAddress}
+	audit.SetBefore(c, snapshot)
+
+	recharges, err := rechargeHistoryCol.DeleteMany(ctx, bson.M{"userId": userId})
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Error clearing recharge history"})
 	}
+	snapshot["rechargeHistories"] = recharges.DeletedCount
 
-	_, err = transactionHistoryCol.DeleteMany(ctx, bson.M{"userId": userId})
+	transactions, err := transactionHistoryCol.DeleteMany(ctx, bson.M{"userId": userId})
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Error clearing transaction history"})
 	}
+	snapshot["transactionHistories"] = transactions.DeletedCount
 
 	_, err = walletCol.DeleteOne(ctx, bson.M{"userId": objID})
 	if err != nil {
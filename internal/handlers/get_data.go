@@ -2,10 +2,7 @@ package handlers
 
 import (
 	"context"
-	"encoding/json"
-	"errors"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"net/http"
 	"sort"
@@ -13,30 +10,19 @@ import (
 	"strings"
 	"time"
 
+	"github.com/ranjankuldeep/fakeNumber/internal/apikeys"
 	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/internal/money"
+	"github.com/ranjankuldeep/fakeNumber/internal/providers"
 	"github.com/ranjankuldeep/fakeNumber/logs"
 
 	"github.com/labstack/echo/v4"
+	"github.com/ranjankuldeep/fakeNumber/internal/auth"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
-type BalanceRequest struct {
-	Url     string
-	Headers map[string]string
-}
-
-type ServerCred struct {
-	Token  string
-	ApiKey string
-}
-
-type Balance struct {
-	Value  float64
-	Symbol string
-}
-
 func GetServersData(c echo.Context) error {
 	db := c.Get("db").(*mongo.Database)
 	serverListCol := models.InitializeServerListCollection(db)
@@ -116,7 +102,7 @@ type ServiceUserResponse struct {
 }
 
 func GetServiceData(c echo.Context) error {
-	userId := c.QueryParam("userId")
+	userId := auth.UserID(c)
 	db := c.Get("db").(*mongo.Database)
 	serverCollection := models.InitializeServerCollection(db)
 	serviceCollection := models.InitializeServerListCollection(db)
@@ -180,12 +166,12 @@ func GetServiceData(c echo.Context) error {
 			if server.Block == true {
 				continue
 			}
-			if contains(maintenanceServerNumbers, server.Server) {
+			if contains(maintenanceServerNumbers, server.Server) || providers.Degraded(server.Server) {
 				continue
 			}
 			discount := CalculateDiscount(serviceDiscounts, serverDiscounts, userDiscounts, service.Name, server.Server, userId)
-			price, _ := strconv.ParseFloat(server.Price, 64)
-			adjustedPrice := strconv.FormatFloat(price+discount, 'f', 2, 64)
+			price, _ := money.Parse(server.Price)
+			adjustedPrice := (price + discount).String()
 
 			serverDetails = append(serverDetails, ServerUserDetail{
 				Server: strconv.Itoa(server.Server),
@@ -221,15 +207,10 @@ func GetUserServiceData(c echo.Context) error {
 	serviceDiscountCollection := models.InitializeServiceDiscountCollection(db)
 	serverDiscountCollection := models.InitializeServerDiscountCollection(db)
 	userDiscountCollection := models.InitializeUserDiscountCollection(db)
-	apiCollection := models.InitializeApiWalletuserCollection(db)
 
-	var apiUser models.ApiWalletUser
-	err := apiCollection.FindOne(context.TODO(), bson.M{"api_key": apiKey}).Decode(&apiUser)
-	if err == mongo.ErrEmptySlice || err == mongo.ErrNoDocuments {
-		return c.JSON(http.StatusForbidden, echo.Map{"error": "invalid api key"})
-	}
+	apiUser, err := walletForKey(context.TODO(), c, db, apiKey, apikeys.ScopeRead)
 	if err != nil {
-		return c.JSON(http.StatusForbidden, echo.Map{"error": "internal server error"})
+		return apiKeyError(c, err)
 	}
 	var maintenanceStatus struct {
 		Maintenance bool `bson:"maintainance"`
@@ -288,14 +269,14 @@ func GetUserServiceData(c echo.Context) error {
 			if server.Block == true {
 				continue
 			}
-			if contains(maintenanceServerNumbers, server.Server) {
+			if contains(maintenanceServerNumbers, server.Server) || providers.Degraded(server.Server) {
 				continue
 			}
 
 			discount := CalculateDiscount(serviceDiscounts, serverDiscounts, userDiscounts, service.Name, server.Server, apiUser.UserID.Hex())
 			logs.Logger.Info(discount)
-			price, _ := strconv.ParseFloat(server.Price, 64)
-			adjustedPrice := strconv.FormatFloat(price+discount, 'f', 2, 64)
+			price, _ := money.Parse(server.Price)
+			adjustedPrice := (price + discount).String()
 			otpType := "unknown"
 			if strings.Contains(server.Otp, "Single") {
 				otpType = "single"
@@ -373,15 +354,15 @@ func GetServiceDataAdmin(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to decode server discount data"})
 	}
 
-	serviceDiscountMap := make(map[string]float64)
+	serviceDiscountMap := make(map[string]money.Paise)
 	for _, discount := range serviceDiscountData {
 		key := discount.Service + "_" + strconv.Itoa(discount.Server)
-		serviceDiscountMap[key] = discount.Discount
+		serviceDiscountMap[key] = money.FromFloat(discount.Discount)
 	}
 
-	serverDiscountMap := make(map[int]float64)
+	serverDiscountMap := make(map[int]money.Paise)
 	for _, discount := range serverDiscountData {
-		serverDiscountMap[discount.Server] = discount.Discount
+		serverDiscountMap[discount.Server] = money.FromFloat(discount.Discount)
 	}
 
 	filteredData := []ServiceResponseAdmin{}
@@ -395,7 +376,7 @@ func GetServiceDataAdmin(c echo.Context) error {
 		for _, server := range service.Servers {
 			serviceKey := service.Name + "_" + strconv.Itoa(server.Server)
 			discount := serviceDiscountMap[serviceKey] + serverDiscountMap[server.Server]
-			originalPrice, err := strconv.ParseFloat(server.Price, 64)
+			originalPrice, err := money.Parse(server.Price)
 			if err != nil {
 				log.Printf("ERROR: Invalid price format for service %s, server %d: %v\n", service.Name, server.Server, err)
 				continue
@@ -403,7 +384,7 @@ func GetServiceDataAdmin(c echo.Context) error {
 			finalPrice := originalPrice + discount
 			serverDetails = append(serverDetails, ServerDetailAdmin{
 				Server: strconv.Itoa(server.Server),
-				Price:  strconv.FormatFloat(finalPrice, 'f', 2, 64),
+				Price:  finalPrice.String(),
 				Code:   server.Code,
 				Otp:    server.Otp,
 				Block:  server.Block,
@@ -434,32 +415,32 @@ func contains(arr []int, num int) bool {
 	return false
 }
 
-func loadDiscounts(serviceDiscountCollection, serverDiscountCollection, userDiscountCollection *mongo.Collection, userId string) (map[string]float64, map[int]float64, map[string]float64, error) {
+func loadDiscounts(serviceDiscountCollection, serverDiscountCollection, userDiscountCollection *mongo.Collection, userId string) (map[string]money.Paise, map[int]money.Paise, map[string]money.Paise, error) {
 	userIdObject, _ := primitive.ObjectIDFromHex(userId)
-	serviceDiscounts := make(map[string]float64)
+	serviceDiscounts := make(map[string]money.Paise)
 	serviceCursor, _ := serviceDiscountCollection.Find(context.Background(), bson.M{})
 	defer serviceCursor.Close(context.Background())
 	for serviceCursor.Next(context.Background()) {
 		var discount models.ServiceDiscount
 		if err := serviceCursor.Decode(&discount); err == nil {
 			key := discount.Service + "_" + strconv.Itoa(discount.Server)
-			serviceDiscounts[key] = discount.Discount
+			serviceDiscounts[key] = money.FromFloat(discount.Discount)
 		}
 	}
 
 	// Load server discounts
-	serverDiscounts := make(map[int]float64)
+	serverDiscounts := make(map[int]money.Paise)
 	serverCursor, _ := serverDiscountCollection.Find(context.Background(), bson.M{})
 	defer serverCursor.Close(context.Background())
 	for serverCursor.Next(context.Background()) {
 		var discount models.ServerDiscount
 		if err := serverCursor.Decode(&discount); err == nil {
-			serverDiscounts[discount.Server] = discount.Discount
+			serverDiscounts[discount.Server] = money.FromFloat(discount.Discount)
 		}
 	}
 
 	// Load user discounts if userId is provided
-	userDiscounts := make(map[string]float64)
+	userDiscounts := make(map[string]money.Paise)
 	if userId != "" {
 		userCursor, _ := userDiscountCollection.Find(context.Background(), bson.M{"userId": userIdObject})
 		defer userCursor.Close(context.Background())
@@ -467,14 +448,14 @@ func loadDiscounts(serviceDiscountCollection, serverDiscountCollection, userDisc
 			var discount models.UserDiscount
 			if err := userCursor.Decode(&discount); err == nil {
 				key := discount.Service + "_" + fmt.Sprintf("%d", discount.Server)
-				userDiscounts[key] = float64(discount.Discount)
+				userDiscounts[key] = money.FromFloat(discount.Discount)
 			}
 		}
 	}
 	return serviceDiscounts, serverDiscounts, userDiscounts, nil
 }
 
-func CalculateDiscount(serviceDiscounts map[string]float64, serverDiscounts map[int]float64, userDiscounts map[string]float64, serviceName string, serverNumber int, userId string) float64 {
+func CalculateDiscount(serviceDiscounts map[string]money.Paise, serverDiscounts map[int]money.Paise, userDiscounts map[string]money.Paise, serviceName string, serverNumber int, userId string) money.Paise {
 	key := serviceName + "_" + strconv.Itoa(serverNumber)
 	return serviceDiscounts[key] + serverDiscounts[serverNumber] + userDiscounts[key]
 }
@@ -492,15 +473,15 @@ func TotalRecharge(c echo.Context) error {
 	}
 	defer cursor.Close(ctx)
 
-	var totalAmount float64
+	var totalAmount money.Paise
 	var histories []models.RechargeHistory
 	cursor.All(ctx, &histories)
 	for _, history := range histories {
-		amount, _ := strconv.ParseFloat(history.Amount, 64)
+		amount, _ := money.Parse(history.Amount)
 		totalAmount += amount
 	}
 
-	return c.JSON(http.StatusOK, echo.Map{"totalAmount": strconv.FormatFloat(totalAmount, 'f', 2, 64)})
+	return c.JSON(http.StatusOK, echo.Map{"totalAmount": totalAmount.String()})
 }
 
 // Handler to retrieve total user count
@@ -531,182 +512,20 @@ func GetServerBalanceHandler(c echo.Context) error {
 	return c.JSON(http.StatusOK, echo.Map{"balance": fmt.Sprintf("%0.2f%s", balance.Value, balance.Symbol)})
 }
 
-func GetServerBalance(db *mongo.Database, server string) (Balance, error) {
+func GetServerBalance(db *mongo.Database, server string) (providers.Balance, error) {
 	serverNumber, _ := strconv.Atoi(server)
 	var serverInfo models.Server
 	serverCollection := models.InitializeServerCollection(db)
 	err := serverCollection.FindOne(context.TODO(), bson.M{"server": serverNumber}).Decode(&serverInfo)
 	if err != nil {
 		logs.Logger.Error(err)
-		return Balance{}, err
-	}
-
-	cred := ServerCred{
-		Token:  serverInfo.Token,
-		ApiKey: serverInfo.APIKey,
+		return providers.Balance{}, err
 	}
 
-	balanceFetchUrl, err := ConstructBalanceUrl(server, cred)
+	provider, err := providers.New(serverInfo)
 	if err != nil {
 		logs.Logger.Error(err)
-		return Balance{}, err
-	}
-	balance, err := FetchBalance(server, balanceFetchUrl.Url, balanceFetchUrl.Headers)
-	if err != nil {
-		return Balance{}, err
-	}
-	return balance, nil
-}
-
-func ConstructBalanceUrl(server string, serverCred ServerCred) (BalanceRequest, error) {
-	switch server {
-	case "1":
-		return BalanceRequest{
-			Url:     fmt.Sprintf("https://fastsms.su/stubs/handler_api.php?api_key=%s&action=getBalance", serverCred.ApiKey),
-			Headers: map[string]string{},
-		}, nil
-	case "2":
-		return BalanceRequest{
-			Url: fmt.Sprintf("https://5sim.net/v1/user/profile"),
-			Headers: map[string]string{
-				"Authorization": fmt.Sprintf("Bearer %s", serverCred.Token),
-				"Accept":        "application/json",
-			},
-		}, nil
-	case "3":
-		return BalanceRequest{
-			Url:     fmt.Sprintf("https://smshub.org/stubs/handler_api.php?api_key=%s&action=getBalance", serverCred.ApiKey),
-			Headers: map[string]string{},
-		}, nil
-	case "4":
-		return BalanceRequest{
-			Url:     fmt.Sprintf("https://api.tiger-sms.com/stubs/handler_api.php?api_key=%s&action=getBalance", serverCred.ApiKey),
-			Headers: map[string]string{},
-		}, nil
-	case "5":
-		return BalanceRequest{
-			Url:     fmt.Sprintf("https://api.grizzlysms.com/stubs/handler_api.php?api_key=%s&action=getBalance", serverCred.ApiKey),
-			Headers: map[string]string{},
-		}, nil
-	case "6":
-		return BalanceRequest{
-			Url:     fmt.Sprintf("https://tempnum.org/stubs/handler_api.php?api_key=%s&action=getBalance", serverCred.ApiKey),
-			Headers: map[string]string{},
-		}, nil
-	case "7":
-		return BalanceRequest{
-			Url:     fmt.Sprintf("https://smsbower.online/stubs/handler_api.php?api_key=%s&action=getBalance", serverCred.ApiKey),
-			Headers: map[string]string{},
-		}, nil
-	case "8":
-		return BalanceRequest{
-			Url:     fmt.Sprintf("https://api.sms-activate.guru/stubs/handler_api.php?api_key=%s&action=getBalance", serverCred.ApiKey),
-			Headers: map[string]string{},
-		}, nil
-	case "10":
-		logs.Logger.Info(serverCred.ApiKey)
-		return BalanceRequest{
-			Url:     fmt.Sprintf("https://sms-activation-service.pro/stubs/handler_api?api_key=%s&action=getBalance", serverCred.ApiKey),
-			Headers: map[string]string{},
-		}, nil
-	case "9":
-		return BalanceRequest{
-			Url:     fmt.Sprintf("https://php.paidsms.in/ccpay.php?type=balance"),
-			Headers: map[string]string{},
-		}, nil
-	case "11":
-		return BalanceRequest{
-			Url:     fmt.Sprintf("https://api.sms-man.com/control/get-balance?token=%s", serverCred.ApiKey),
-			Headers: map[string]string{},
-		}, nil
-	}
-	return BalanceRequest{}, nil
-}
-
-func FetchBalance(server string, apiURL string, headers map[string]string) (Balance, error) {
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", apiURL, nil)
-	if err != nil {
-		return Balance{}, fmt.Errorf("failed to create balance request: %w", err)
-	}
-	for key, value := range headers {
-		req.Header.Set(key, value)
-	}
-	resp, err := client.Do(req)
-	if err != nil {
-		return Balance{}, fmt.Errorf("failed to fetch API: %w", err)
-	}
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return Balance{}, fmt.Errorf("failed to read response body: %w", err)
-	}
-	responseData := string(body)
-	if strings.TrimSpace(responseData) == "" {
-		return Balance{}, errors.New("RECEIVED_EMPTY_RESPONSE_FROM_THIRD_PARTY_SERVER")
-	}
-
-	switch server {
-	case "1":
-		balance := strings.TrimPrefix(responseData, "ACCESS_BALANCE:")
-		value, err := strconv.ParseFloat(balance, 64)
-		if err != nil {
-			return Balance{}, fmt.Errorf("failed to parse balance: %w", err)
-		}
-		return Balance{Value: value, Symbol: "p"}, nil
-
-	case "2":
-		var responseDataJSON struct {
-			Balance float64 `json:"balance"`
-		}
-		err = json.Unmarshal(body, &responseDataJSON)
-		if err != nil {
-			return Balance{}, fmt.Errorf("failed to parse JSON response for balance: %w", err)
-		}
-		return Balance{Value: responseDataJSON.Balance, Symbol: "p"}, nil
-
-	case "3":
-		balance := strings.TrimPrefix(responseData, "ACCESS_BALANCE:")
-		value, err := strconv.ParseFloat(balance, 64)
-		if err != nil {
-			return Balance{}, fmt.Errorf("failed to parse balance: %w", err)
-		}
-		return Balance{Value: value, Symbol: "$"}, nil
-
-	case "4", "5", "6", "7", "8":
-		balance := strings.TrimPrefix(responseData, "ACCESS_BALANCE:")
-		value, err := strconv.ParseFloat(balance, 64)
-		if err != nil {
-			return Balance{}, fmt.Errorf("failed to parse balance: %w", err)
-		}
-		return Balance{Value: value, Symbol: "p"}, nil
-
-	case "9":
-		value, err := strconv.ParseFloat(responseData, 64)
-		if err != nil {
-			return Balance{}, fmt.Errorf("failed to parse balance: %w", err)
-		}
-		return Balance{Value: value, Symbol: "p"}, nil
-
-	case "10":
-		value, err := strconv.ParseFloat(responseData, 64)
-		if err != nil {
-			return Balance{}, fmt.Errorf("failed to parse balance: %w", err)
-		}
-		return Balance{Value: value, Symbol: "$"}, nil
-
-	case "11":
-		var responseDataJSON struct {
-			Balance string `json:"balance"`
-		}
-		err = json.Unmarshal(body, &responseDataJSON)
-		if err != nil {
-			return Balance{}, fmt.Errorf("failed to parse JSON response: %w", err)
-		}
-		floatValue, _ := strconv.ParseFloat(responseDataJSON.Balance, 64)
-		return Balance{Value: floatValue, Symbol: "p"}, nil
-
-	default:
-		return Balance{}, errors.New("INVALID_SERVER_VALUE")
+		return providers.Balance{}, err
 	}
+	return provider.GetBalance()
 }
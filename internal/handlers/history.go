@@ -3,14 +3,18 @@ package handlers
 import (
 	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"log"
-	"math"
 	"net/http"
 	"time"
 
 	"github.com/labstack/echo/v4"
+	"github.com/ranjankuldeep/fakeNumber/internal/audit"
+	"github.com/ranjankuldeep/fakeNumber/internal/auth"
 	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/internal/mail"
+	"github.com/ranjankuldeep/fakeNumber/internal/money"
+	"github.com/ranjankuldeep/fakeNumber/internal/recharge"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -22,14 +26,17 @@ func GetRechargeHistory(c echo.Context) error {
 	rechargeHistoryCol := models.InitializeRechargeHistoryCollection(db)
 	serverCol := models.InitializeServerCollection(db)
 
-	userId := c.QueryParam("userId")
+	userId, err := auth.SubjectID(c)
+	if err != nil {
+		return subjectError(c, err)
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	// Check server maintenance status
 	var serverData models.Server
-	err := serverCol.FindOne(ctx, bson.M{"server": 0}).Decode(&serverData)
+	err = serverCol.FindOne(ctx, bson.M{"server": 0}).Decode(&serverData)
 	if err != nil && err != mongo.ErrNoDocuments {
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Error checking maintenance status"})
 	}
@@ -69,13 +76,16 @@ func GetTransactionHistory(c echo.Context) error {
 	transactionHistoryCol := models.InitializeTransactionHistoryCollection(db)
 	serverCol := models.InitializeServerCollection(db)
 
-	userId := c.QueryParam("userId")
+	userId, err := auth.SubjectID(c)
+	if err != nil {
+		return subjectError(c, err)
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	var serverData models.Server
-	err := serverCol.FindOne(ctx, bson.M{"server": 0}).Decode(&serverData)
+	err = serverCol.FindOne(ctx, bson.M{"server": 0}).Decode(&serverData)
 	if err != nil && err != mongo.ErrNoDocuments {
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Error checking maintenance status"})
 	}
@@ -104,8 +114,6 @@ func GetTransactionHistory(c echo.Context) error {
 
 func SaveRechargeHistory(c echo.Context) error {
 	db := c.Get("db").(*mongo.Database)
-	rechargeHistoryCol := models.InitializeRechargeHistoryCollection(db)
-	apiWalletCol := models.InitializeApiWalletuserCollection(db)
 
 	var request struct {
 		UserID        string      `json:"userId"`
@@ -125,71 +133,68 @@ func SaveRechargeHistory(c echo.Context) error {
 		log.Println("[ERROR] Missing required fields in request body")
 		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid request body"})
 	}
-	requestAmountFloat, err := request.Amount.Float64()
-	if err != nil || requestAmountFloat <= 0 {
+	amount, err := money.Parse(request.Amount.String())
+	if err != nil || amount <= 0 {
 		log.Println("[ERROR] Invalid amount:", request.Amount.String())
 		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid amount"})
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	var existingTransaction models.RechargeHistory
-	err = rechargeHistoryCol.FindOne(ctx, bson.M{"transaction_id": request.TransactionID}).Decode(&existingTransaction)
-	if err == nil {
-		log.Println("[ERROR] Transaction already exists:", request.TransactionID)
-		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Transaction already done"})
-	} else if err != mongo.ErrNoDocuments {
-		log.Println("[ERROR] Database error while checking transaction:", err)
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Database error"})
-	}
-
-	userObjectID, err := primitive.ObjectIDFromHex(request.UserID)
+	userID, err := primitive.ObjectIDFromHex(request.UserID)
 	if err != nil {
-		log.Println("[ERROR] Invalid userId format:", request.UserID)
 		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid userId format"})
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 
-	var userWallet models.ApiWalletUser
-	err = apiWalletCol.FindOne(ctx, bson.M{"userId": userObjectID}).Decode(&userWallet)
-	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			log.Println("[ERROR] User not found:", request.UserID)
-			return c.JSON(http.StatusBadRequest, echo.Map{"error": "User not found"})
-		}
-		log.Println("[ERROR] Database error while fetching user wallet:", err)
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Database error"})
-	}
-
-	if request.Status == "Received" {
-		log.Printf("[INFO] Updating balance for userId: %s with amount: %.2f\n", request.UserID, requestAmountFloat)
-		_, err := apiWalletCol.UpdateOne(ctx,
-			bson.M{"userId": userObjectID},
-			bson.M{"$inc": bson.M{"balance": math.Round(requestAmountFloat*100) / 100}},
-		)
-		if err != nil {
-			log.Println("[ERROR] Failed to update user balance:", err)
-			return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to update balance"})
-		}
-		log.Println("[INFO] Balance updated successfully")
-	}
-
-	rechargeHistory := models.RechargeHistory{
-		UserID:        request.UserID,
+	result, err := saveRecharge(ctx, db, recharge.Request{
+		UserID:        userID,
 		TransactionID: request.TransactionID,
-		Amount:        fmt.Sprintf("%.2f", requestAmountFloat),
+		Amount:        amount,
 		PaymentType:   request.PaymentType,
-		DateTime:      time.Now().In(time.FixedZone("IST", 5*3600+30*60)).Format("2006-01-02T15:04:05"),
 		Status:        request.Status,
-		CreatedAt:     time.Now(),
-	}
-	_, err = rechargeHistoryCol.InsertOne(ctx, rechargeHistory)
+	})
 	if err != nil {
-		log.Println("[ERROR] Failed to save recharge history:", err)
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to save recharge"})
+		return rechargeError(c, err)
+	}
+	audit.SetTarget(c, "user", request.UserID)
+	if request.Status == recharge.StatusReceived {
+		audit.SetBefore(c, bson.M{"balance": (result.Balance - amount).String()})
+		audit.SetAfter(c, bson.M{"balance": result.Balance.String(), "recharge": result.History})
+	} else {
+		audit.SetAfter(c, bson.M{"recharge": result.History})
 	}
 	return c.JSON(http.StatusOK, echo.Map{"message": "Recharge Saved Successfully!"})
 }
 
+// saveRecharge records a payment through the recharge service and, once it
+// is credited, emails the user a receipt.
+func saveRecharge(ctx context.Context, db *mongo.Database, request recharge.Request) (recharge.Result, error) {
+	result, err := recharge.NewService(db).Record(ctx, request)
+	if err != nil {
+		return result, err
+	}
+	if request.Status == recharge.StatusReceived {
+		mailUser(db, request.UserID, mail.TemplateRechargeReceipt, mail.RechargeReceiptData{
+			Amount:        request.Amount.String(),
+			PaymentType:   request.PaymentType,
+			TransactionID: request.TransactionID,
+			Date:          result.History.DateTime,
+		})
+	}
+	return result, nil
+}
+
+// rechargeError answers a request whose saveRecharge failed.
+func rechargeError(c echo.Context, err error) error {
+	var invalid *recharge.ValidationError
+	switch {
+	case errors.As(err, &invalid), errors.Is(err, recharge.ErrDuplicate), errors.Is(err, recharge.ErrNoWallet),
+		errors.Is(err, recharge.ErrIntentUsed):
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+	log.Println("[ERROR]", err)
+	return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to save recharge"})
+}
+
 // Handler to count transaction statuses
 func TransactionCount(c echo.Context) error {
 	db := c.Get("db").(*mongo.Database)
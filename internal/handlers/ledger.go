@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/ranjankuldeep/fakeNumber/internal/audit"
+	"github.com/ranjankuldeep/fakeNumber/internal/auth"
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/internal/ledger"
+	"github.com/ranjankuldeep/fakeNumber/internal/money"
+	"github.com/ranjankuldeep/fakeNumber/logs"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// capturePurchase charges a number purchase against its hold. The list price
+// and the discount on top of it are booked as separate entries against the
+// transaction.
+func capturePurchase(ctx context.Context, db *mongo.Database, hold models.BalanceHold, transaction models.TransactionHistory, price, discount money.Paise) error {
+	postings := []ledger.Posting{{
+		UserID:           hold.UserID,
+		Kind:             ledger.KindPurchase,
+		Amount:           -(price - discount),
+		SourceCollection: "transactionhistories",
+		SourceID:         transaction.ID.Hex(),
+		Note:             transaction.Service + " on server " + transaction.Server,
+	}}
+	if discount != 0 {
+		postings = append(postings, ledger.Posting{
+			UserID:           hold.UserID,
+			Kind:             ledger.KindDiscount,
+			Amount:           -discount,
+			SourceCollection: "transactionhistories",
+			SourceID:         transaction.ID.Hex(),
+		})
+	}
+	return ledger.Capture(ctx, db, hold, postings...)
+}
+
+// releaseHold releases a purchase hold on a failure path, where the original
+// error is what gets reported.
+func releaseHold(db *mongo.Database, hold models.BalanceHold, reason string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := ledger.Release(ctx, db, hold, reason); err != nil {
+		logs.Logger.Error(err)
+	}
+}
+
+// GetLedgerStatement returns a user's wallet entries between from and to
+// (RFC3339 or 2006-01-02, both optional) with the opening and closing balance.
+func GetLedgerStatement(c echo.Context) error {
+	db := c.Get("db").(*mongo.Database)
+	subjectID, err := auth.SubjectID(c)
+	if err != nil {
+		return subjectError(c, err)
+	}
+	userID, err := primitive.ObjectIDFromHex(subjectID)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid userId format"})
+	}
+	from, err := parseStatementTime(c.QueryParam("from"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid from date"})
+	}
+	to, err := parseStatementTime(c.QueryParam("to"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid to date"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	statement, err := ledger.GetStatement(ctx, db, userID, from, to)
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to fetch ledger statement"})
+	}
+	return c.JSON(http.StatusOK, statement)
+}
+
+// RebuildWalletBalance resets a user's cached balance to the ledger total.
+func RebuildWalletBalance(c echo.Context) error {
+	db := c.Get("db").(*mongo.Database)
+	var requestBody struct {
+		UserID string `json:"userId"`
+	}
+	if err := c.Bind(&requestBody); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid request body"})
+	}
+	userID, err := primitive.ObjectIDFromHex(requestBody.UserID)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid userId format"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var wallet models.ApiWalletUser
+	err = models.InitializeApiWalletuserCollection(db).FindOne(ctx, bson.M{"userId": userID}).Decode(&wallet)
+	if err == mongo.ErrNoDocuments {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "User not found"})
+	} else if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to rebuild balance"})
+	}
+	audit.SetTarget(c, "user", requestBody.UserID)
+	audit.SetBefore(c, bson.M{"balance": wallet.Amount().String()})
+
+	balance, err := ledger.Rebuild(ctx, db, userID)
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to rebuild balance"})
+	}
+	audit.SetAfter(c, bson.M{"balance": balance.String()})
+	return c.JSON(http.StatusOK, echo.Map{"balance": balance})
+}
+
+func parseStatementTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/internal/mail"
+	"github.com/ranjankuldeep/fakeNumber/internal/money"
+	"github.com/ranjankuldeep/fakeNumber/logs"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// defaultLowBalanceAlert is the balance below which users are warned, unless
+// LOW_BALANCE_ALERT sets another amount in rupees.
+const defaultLowBalanceAlert = money.Paise(2000)
+
+func lowBalanceAlert() money.Paise {
+	if v := os.Getenv("LOW_BALANCE_ALERT"); v != "" {
+		if amount, err := money.Parse(v); err == nil {
+			return amount
+		}
+		logs.Logger.Errorf("invalid LOW_BALANCE_ALERT %q", v)
+	}
+	return defaultLowBalanceAlert
+}
+
+// mailUser emails a user in the background, so that the request does not
+// wait on SMTP. Sends that fail are retried from the outbox.
+func mailUser(db *mongo.Database, userID primitive.ObjectID, name mail.Template, data interface{}) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		var user models.User
+		err := models.InitializeUserCollection(db).FindOne(ctx, bson.M{"_id": userID}).Decode(&user)
+		if err != nil {
+			logs.Logger.Errorf("failed to look up user %s for %s mail: %v", userID.Hex(), name, err)
+			return
+		}
+		if err := mail.Deliver(ctx, db, user.Email, name, data); err != nil {
+			logs.Logger.Errorf("failed to mail %s to user %s: %v", name, userID.Hex(), err)
+		}
+	}()
+}
+
+// warnLowBalance mails the user when a debit takes their balance below the
+// alert threshold.
+func warnLowBalance(db *mongo.Database, userID primitive.ObjectID, before, after money.Paise) {
+	threshold := lowBalanceAlert()
+	if before >= threshold && after < threshold {
+		mailUser(db, userID, mail.TemplateLowBalance, mail.LowBalanceData{
+			Balance:   after.String(),
+			Threshold: threshold.String(),
+		})
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/labstack/echo/v4"
+	"github.com/ranjankuldeep/fakeNumber/internal/audit"
 	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -39,11 +40,17 @@ func AddMinimumRecharge(c echo.Context) error {
 			"createdAt": time.Now(),
 		},
 	}
-	opts := options.Update().SetUpsert(true)
-	_, err := collection.UpdateOne(context.Background(), filter, update, opts)
-	if err != nil {
+	opts := options.FindOneAndUpdate().SetUpsert(true)
+	var previous models.MinimumRecharge
+	err := collection.FindOneAndUpdate(context.Background(), filter, update, opts).Decode(&previous)
+	if err != nil && err != mongo.ErrNoDocuments {
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to set minimum recharge"})
 	}
+	audit.SetTarget(c, "minimum-recharge", "")
+	if err == nil {
+		audit.SetBefore(c, bson.M{"minimumRecharge": previous.MinimumRecharge})
+	}
+	audit.SetAfter(c, bson.M{"minimumRecharge": req.MinimumRecharge})
 	return c.JSON(http.StatusOK, echo.Map{"message": "Minimum recharge amount set successfully"})
 }
 
@@ -72,12 +79,18 @@ func DeleteMinimumRecharge(c echo.Context) error {
 	db := c.Get("db").(*mongo.Database)
 	collection := models.InitializeMinimumCollection(db)
 
-	_, err := collection.DeleteOne(context.Background(), bson.M{})
-	if err != nil {
+	var previous models.MinimumRecharge
+	err := collection.FindOneAndDelete(context.Background(), bson.M{}).Decode(&previous)
+	if err != nil && err != mongo.ErrNoDocuments {
 		return c.JSON(http.StatusInternalServerError, echo.Map{
 			"error": "Failed to delete minimum recharge",
 		})
 	}
+	audit.SetTarget(c, "minimum-recharge", "")
+	if err == nil {
+		audit.SetBefore(c, bson.M{"minimumRecharge": previous.MinimumRecharge})
+	}
+	audit.SetAfter(c, nil)
 	return c.JSON(http.StatusOK, echo.Map{
 		"message": "Minimum recharge amount deleted successfully",
 	})
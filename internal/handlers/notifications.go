@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/ranjankuldeep/fakeNumber/internal/audit"
+	"github.com/ranjankuldeep/fakeNumber/internal/auth"
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/internal/notify"
+	"github.com/ranjankuldeep/fakeNumber/logs"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// maskChannel hides a channel's credentials, keeping the last four
+// characters so that staff can tell them apart.
+func maskChannel(ch models.NotificationChannel) models.NotificationChannel {
+	mask := func(s string) string {
+		if len(s) <= 4 {
+			return strings.Repeat("*", len(s))
+		}
+		return "****" + s[len(s)-4:]
+	}
+	ch.Token = mask(ch.Token)
+	ch.Secret = mask(ch.Secret)
+	return ch
+}
+
+// GetNotificationChannels lists the notification channels, with their
+// credentials masked, and the event types they can subscribe to.
+func GetNotificationChannels(c echo.Context) error {
+	db := c.Get("db").(*mongo.Database)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := models.InitializeNotificationChannelCollection(db).Find(ctx, bson.M{},
+		options.Find().SetSort(bson.M{"name": 1}))
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to fetch channels"})
+	}
+	channels := []models.NotificationChannel{}
+	if err := cursor.All(ctx, &channels); err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to fetch channels"})
+	}
+	for i := range channels {
+		channels[i] = maskChannel(channels[i])
+	}
+	return c.JSON(http.StatusOK, echo.Map{"channels": channels, "events": notify.EventTypes()})
+}
+
+// SaveNotificationChannel creates a channel, or updates the one given by id.
+// On update, an empty token or secret keeps the stored one.
+func SaveNotificationChannel(c echo.Context) error {
+	db := c.Get("db").(*mongo.Database)
+	channelCol := models.InitializeNotificationChannelCollection(db)
+
+	var request struct {
+		ID      string   `json:"id"`
+		Name    string   `json:"name"`
+		Kind    string   `json:"kind"`
+		Token   string   `json:"token"`
+		ChatID  string   `json:"chatId"`
+		URL     string   `json:"url"`
+		Secret  string   `json:"secret"`
+		Events  []string `json:"events"`
+		Enabled bool     `json:"enabled"`
+	}
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid request body"})
+	}
+	request.Name = strings.TrimSpace(request.Name)
+	if request.Name == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Name is required"})
+	}
+	for _, event := range request.Events {
+		known := false
+		for _, t := range notify.EventTypes() {
+			known = known || string(t) == event
+		}
+		if !known {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": "Unknown event type " + event})
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	channel := models.NotificationChannel{
+		ID:        primitive.NewObjectID(),
+		Name:      request.Name,
+		Kind:      request.Kind,
+		Token:     request.Token,
+		ChatID:    request.ChatID,
+		URL:       request.URL,
+		Secret:    request.Secret,
+		Events:    request.Events,
+		Enabled:   request.Enabled,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	var previous *models.NotificationChannel
+	if request.ID != "" {
+		id, err := primitive.ObjectIDFromHex(request.ID)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid id format"})
+		}
+		var existing models.NotificationChannel
+		err = channelCol.FindOne(ctx, bson.M{"_id": id}).Decode(&existing)
+		if err == mongo.ErrNoDocuments {
+			return c.JSON(http.StatusNotFound, echo.Map{"error": "Channel not found"})
+		} else if err != nil {
+			logs.Logger.Error(err)
+			return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to save channel"})
+		}
+		previous = &existing
+		channel.ID = existing.ID
+		channel.CreatedAt = existing.CreatedAt
+		if channel.Token == "" {
+			channel.Token = existing.Token
+		}
+		if channel.Secret == "" {
+			channel.Secret = existing.Secret
+		}
+	}
+	if _, err := notify.ChannelNotifier(channel); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+
+	_, err := channelCol.ReplaceOne(ctx, bson.M{"_id": channel.ID}, channel, options.Replace().SetUpsert(true))
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to save channel"})
+	}
+	notify.Reload()
+
+	audit.SetTarget(c, "notification-channel", channel.ID.Hex())
+	if previous != nil {
+		audit.SetBefore(c, maskChannel(*previous))
+	}
+	audit.SetAfter(c, maskChannel(channel))
+	return c.JSON(http.StatusOK, echo.Map{"channel": maskChannel(channel)})
+}
+
+// DeleteNotificationChannel removes the channel given by the id parameter.
+func DeleteNotificationChannel(c echo.Context) error {
+	db := c.Get("db").(*mongo.Database)
+	id, err := primitive.ObjectIDFromHex(c.QueryParam("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid id format"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var previous models.NotificationChannel
+	err = models.InitializeNotificationChannelCollection(db).FindOneAndDelete(ctx, bson.M{"_id": id}).Decode(&previous)
+	if err == mongo.ErrNoDocuments {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "Channel not found"})
+	} else if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to delete channel"})
+	}
+	notify.Reload()
+
+	audit.SetTarget(c, "notification-channel", id.Hex())
+	audit.SetBefore(c, maskChannel(previous))
+	return c.JSON(http.StatusOK, echo.Map{"message": "Channel deleted successfully"})
+}
+
+// TestNotificationChannel sends a test event to the channel given by the id
+// parameter, whether or not it is enabled or subscribed.
+func TestNotificationChannel(c echo.Context) error {
+	db := c.Get("db").(*mongo.Database)
+	id, err := primitive.ObjectIDFromHex(c.QueryParam("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid id format"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	var channel models.NotificationChannel
+	err = models.InitializeNotificationChannelCollection(db).FindOne(ctx, bson.M{"_id": id}).Decode(&channel)
+	if err == mongo.ErrNoDocuments {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "Channel not found"})
+	} else if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to fetch channel"})
+	}
+	notifier, err := notify.ChannelNotifier(channel)
+	if err == nil {
+		err = notifier.Notify(ctx, notify.Event{
+			Type:   "test",
+			Title:  "Test Notification",
+			Fields: []notify.Field{{Name: "Sent By", Value: auth.UserID(c)}},
+			Time:   time.Now(),
+		})
+	}
+	if err != nil {
+		return c.JSON(http.StatusBadGateway, echo.Map{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, echo.Map{"message": "Test notification sent"})
+}
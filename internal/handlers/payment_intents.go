@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/ranjankuldeep/fakeNumber/internal/auth"
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/internal/money"
+	"github.com/ranjankuldeep/fakeNumber/internal/payments"
+	"github.com/ranjankuldeep/fakeNumber/logs"
+	qrcode "github.com/skip2/go-qrcode"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// upiPayeeName is the name payer apps show for our UPI id.
+func upiPayeeName() string {
+	if name := os.Getenv("UPI_PAYEE_NAME"); name != "" {
+		return name
+	}
+	return "PaidSMS"
+}
+
+// paymentIntentError writes the response for a failed payment intent lookup
+// or match.
+func paymentIntentError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, payments.ErrIntentNotFound):
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "Payment intent not found"})
+	case errors.Is(err, payments.ErrIntentExpired), errors.Is(err, payments.ErrIntentClosed),
+		errors.Is(err, payments.ErrAmountMismatch), errors.Is(err, payments.ErrReferenceMismatch),
+		errors.Is(err, payments.ErrMissingReference):
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	case errors.Is(err, payments.ErrTooManyIntents):
+		return c.JSON(http.StatusTooManyRequests, echo.Map{"error": "Too many open payments, pay or wait for one to expire"})
+	}
+	logs.Logger.Error(err)
+	return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Internal server error"})
+}
+
+// CreatePaymentIntent starts a UPI recharge of the requested amount. The
+// response holds the UPI link and its QR code; the payment must be for
+// exactly this amount, with the reference as its note, before the intent
+// expires. Amounts are whole rupees, since not every gateway reports paise.
+func CreatePaymentIntent(c echo.Context) error {
+	db := c.Get("db").(*mongo.Database)
+	var request struct {
+		Amount json.Number `json:"amount"`
+	}
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid request body"})
+	}
+	amount, err := money.Parse(request.Amount.String())
+	if err != nil || amount <= 0 {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid amount"})
+	}
+	if amount%100 != 0 {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Amount must be in whole rupees"})
+	}
+	userID, err := primitive.ObjectIDFromHex(auth.UserID(c))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid userId format"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var rechargeData models.RechargeAPI
+	err = models.InitializeRechargeAPICollection(db).FindOne(ctx, bson.M{"recharge_type": "upi"}).Decode(&rechargeData)
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Internal server error"})
+	}
+	if rechargeData.Maintenance {
+		return c.JSON(http.StatusForbidden, echo.Map{"error": "UPI recharge is under maintenance."})
+	}
+	if rechargeData.APIKey == "" {
+		logs.Logger.Error("UPI id is not configured")
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Internal server error"})
+	}
+
+	var minimumRecharge models.MinimumRecharge
+	err = models.InitializeMinimumCollection(db).FindOne(ctx, bson.M{}).Decode(&minimumRecharge)
+	if err != nil && err != mongo.ErrNoDocuments {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Internal server error"})
+	}
+	if amount.Float64() < minimumRecharge.MinimumRecharge {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": fmt.Sprintf("Recharge amount is less than %0.2f amount", minimumRecharge.MinimumRecharge)})
+	}
+
+	intent, err := payments.CreateIntent(ctx, db, userID, amount, rechargeData.APIKey)
+	if err != nil {
+		return paymentIntentError(c, err)
+	}
+	link := payments.UPILink(intent, upiPayeeName())
+	png, err := qrcode.Encode(link, qrcode.Medium, 256)
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to generate QR code"})
+	}
+	return c.JSON(http.StatusCreated, echo.Map{
+		"intent": intent,
+		"link":   link,
+		"qr":     "data:image/png;base64," + base64.StdEncoding.EncodeToString(png),
+	})
+}
+
+// ListPaymentIntents returns the caller's recent payment intents.
+func ListPaymentIntents(c echo.Context) error {
+	db := c.Get("db").(*mongo.Database)
+	userID, err := primitive.ObjectIDFromHex(auth.UserID(c))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid userId format"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	intents, err := payments.ListIntents(ctx, db, userID, 20)
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to fetch payment intents"})
+	}
+	return c.JSON(http.StatusOK, echo.Map{"intents": intents})
+}
@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/ranjankuldeep/fakeNumber/internal/audit"
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/internal/payments"
+	"github.com/ranjankuldeep/fakeNumber/internal/recharge"
+	"github.com/ranjankuldeep/fakeNumber/internal/services"
+	"github.com/ranjankuldeep/fakeNumber/logs"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// maxWebhookBody bounds the payload a provider may push.
+const maxWebhookBody = 64 << 10
+
+// PaymentWebhook receives a payment notification pushed by the provider
+// named in the path. The body must be signed with the provider's webhook
+// secret. Signed payloads are stored before they are processed, and the
+// provider only gets an error, and so retries, when processing failed on our
+// side.
+func PaymentWebhook(c echo.Context) error {
+	db := c.Get("db").(*mongo.Database)
+	provider := c.Param("provider")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	var api models.RechargeAPI
+	err := models.InitializeRechargeAPICollection(db).FindOne(ctx, bson.M{"recharge_type": provider}).Decode(&api)
+	if err != nil && err != mongo.ErrNoDocuments {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Internal server error"})
+	}
+	if err == mongo.ErrNoDocuments || api.WebhookSecret == "" {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "Unknown provider"})
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request().Body, maxWebhookBody+1))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid request body"})
+	}
+	if len(body) > maxWebhookBody {
+		return c.JSON(http.StatusRequestEntityTooLarge, echo.Map{"error": "Payload too large"})
+	}
+	signature := c.Request().Header.Get(payments.SignatureHeader)
+	if !payments.ValidSignature(api.WebhookSecret, body, signature) {
+		logs.Logger.Warnf("Payment webhook from %s with invalid signature, ip %s", provider, c.RealIP())
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Invalid signature"})
+	}
+
+	hook := models.PaymentWebhook{
+		ID:         primitive.NewObjectID(),
+		Provider:   provider,
+		Payload:    string(body),
+		Signature:  signature,
+		Status:     models.WebhookReceived,
+		ReceivedAt: time.Now(),
+	}
+	if err := payments.StoreWebhook(ctx, db, hook); err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Internal server error"})
+	}
+	hook, err = processPaymentWebhook(ctx, db, hook)
+	if err != nil {
+		logs.Logger.Errorf("Payment webhook %s failed: %v", hook.ID.Hex(), err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to process webhook"})
+	}
+	return c.JSON(http.StatusOK, echo.Map{"id": hook.ID.Hex(), "status": hook.Status})
+}
+
+// processPaymentWebhook matches a stored webhook to its payment intent and
+// credits the intent's owner. Outcomes that retrying cannot change, such as
+// a mismatched amount, are recorded on the webhook; only failures on our
+// side are returned as errors.
+func processPaymentWebhook(ctx context.Context, db *mongo.Database, hook models.PaymentWebhook) (models.PaymentWebhook, error) {
+	finish := func(status string, cause error) (models.PaymentWebhook, error) {
+		hook.Status = status
+		hook.Error = ""
+		if cause != nil {
+			hook.Error = cause.Error()
+		}
+		if err := payments.SaveWebhookOutcome(ctx, db, hook); err != nil {
+			return hook, err
+		}
+		if status == models.WebhookFailed {
+			return hook, cause
+		}
+		return hook, nil
+	}
+
+	payment, err := payments.ParseWebhook(hook.Provider, []byte(hook.Payload))
+	if err != nil {
+		return finish(models.WebhookRejected, err)
+	}
+	hook.TransactionID = payment.TransactionID
+	hook.Reference = payment.Reference
+	if payment.Status != payments.StatusSuccess {
+		return finish(models.WebhookIgnored, nil)
+	}
+
+	intent, err := payments.IntentByReference(ctx, db, payment.Reference)
+	if errors.Is(err, payments.ErrIntentNotFound) {
+		return finish(models.WebhookUnmatched, err)
+	} else if err != nil {
+		return finish(models.WebhookFailed, err)
+	}
+	hook.UserID = intent.UserID
+	hook.IntentID = intent.ID
+	if intent.Status == models.IntentPaid {
+		if intent.TransactionID == payment.TransactionID {
+			return finish(models.WebhookDuplicate, nil)
+		}
+		return finish(models.WebhookRejected, payments.ErrIntentClosed)
+	}
+	if err := payments.Match(intent, payment); err != nil {
+		return finish(models.WebhookRejected, err)
+	}
+
+	result, err := saveRecharge(ctx, db, recharge.Request{
+		UserID:        intent.UserID,
+		TransactionID: payment.TransactionID,
+		Amount:        payment.Amount,
+		PaymentType:   hook.Provider,
+		Status:        recharge.StatusReceived,
+		IntentID:      intent.ID,
+		PaidAt:        payment.PaidAt,
+	})
+	var invalid *recharge.ValidationError
+	switch {
+	case errors.Is(err, recharge.ErrDuplicate):
+		return finish(models.WebhookDuplicate, nil)
+	case errors.As(err, &invalid), errors.Is(err, recharge.ErrNoWallet), errors.Is(err, recharge.ErrIntentUsed):
+		return finish(models.WebhookRejected, err)
+	case err != nil:
+		return finish(models.WebhookFailed, err)
+	}
+
+	var user models.User
+	if err := models.InitializeUserCollection(db).FindOne(ctx, bson.M{"_id": intent.UserID}).Decode(&user); err != nil {
+		logs.Logger.Error(err)
+	}
+	err = services.UpiRechargeTeleBot(services.UpiRechargeDetails{
+		Email:   user.Email,
+		UserID:  intent.UserID.Hex(),
+		TrnID:   payment.TransactionID,
+		Amount:  payment.Amount.String(),
+		Balance: result.Balance.String(),
+		IP:      "webhook from " + hook.Provider,
+	})
+	if err != nil {
+		logs.Logger.Error(err)
+	}
+	return finish(models.WebhookCredited, nil)
+}
+
+// GetPaymentWebhooks lists stored payment webhooks, optionally filtered by
+// provider and status.
+func GetPaymentWebhooks(c echo.Context) error {
+	db := c.Get("db").(*mongo.Database)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	hooks, err := payments.ListWebhooks(ctx, db, c.QueryParam("provider"), c.QueryParam("status"), 100)
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to fetch webhooks"})
+	}
+	return c.JSON(http.StatusOK, echo.Map{"webhooks": hooks})
+}
+
+// ReplayPaymentWebhook processes a stored webhook again, e.g. once the
+// intent it names exists or after a failure on our side. Credited webhooks
+// cannot be replayed.
+func ReplayPaymentWebhook(c echo.Context) error {
+	db := c.Get("db").(*mongo.Database)
+	id, err := primitive.ObjectIDFromHex(c.QueryParam("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid id format"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	hook, err := payments.GetWebhook(ctx, db, id)
+	if err == mongo.ErrNoDocuments {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "Webhook not found"})
+	} else if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to fetch webhook"})
+	}
+	if hook.Status == models.WebhookCredited || hook.Status == models.WebhookDuplicate {
+		return c.JSON(http.StatusConflict, echo.Map{"error": "Webhook was already credited"})
+	}
+	before := hook.Status
+	hook, err = processPaymentWebhook(ctx, db, hook)
+	audit.SetTarget(c, "payment-webhook", id.Hex())
+	audit.SetBefore(c, bson.M{"status": before})
+	audit.SetAfter(c, bson.M{"status": hook.Status})
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to process webhook"})
+	}
+	return c.JSON(http.StatusOK, echo.Map{"webhook": hook})
+}
@@ -1,22 +1,27 @@
 package handlers
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
-	"strconv"
 	"sync"
 	"time"
 
 	"github.com/labstack/echo/v4"
+	"github.com/ranjankuldeep/fakeNumber/internal/audit"
+	"github.com/ranjankuldeep/fakeNumber/internal/auth"
 	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/internal/idempotency"
+	"github.com/ranjankuldeep/fakeNumber/internal/money"
+	"github.com/ranjankuldeep/fakeNumber/internal/payments"
+	"github.com/ranjankuldeep/fakeNumber/internal/recharge"
 	"github.com/ranjankuldeep/fakeNumber/internal/services"
+	"github.com/ranjankuldeep/fakeNumber/internal/tron"
 	"github.com/ranjankuldeep/fakeNumber/internal/utils"
 	"github.com/ranjankuldeep/fakeNumber/logs"
 	"go.mongodb.org/mongo-driver/bson"
@@ -32,13 +37,6 @@ type UpiRequest struct {
 	Email         string `json:"email"`
 }
 
-type UpiResponse struct {
-	Name   string `json:"name,omitempty"`
-	Amount int    `json:"amount,omitempty"`
-	Date   string `json:"date,omitempty"`
-	Error  string `json:"error,omitempty"`
-}
-
 type IpDetails struct {
 	City            string `json:"city"`
 	State           string `json:"state"`
@@ -55,7 +53,7 @@ func RechargeUpiApi(c echo.Context) error {
 	db := c.Get("db").(*mongo.Database)
 
 	transactionId := c.QueryParam("transactionId")
-	userId := c.QueryParam("userId")
+	userId := auth.UserID(c)
 
 	if userId == "" {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "EMPTY_USER_ID"})
@@ -85,76 +83,50 @@ func RechargeUpiApi(c echo.Context) error {
 	if rechargeData.Maintenance {
 		return c.JSON(http.StatusForbidden, map[string]string{"error": "UPI recharge is under maintenance."})
 	}
-	upiUrl := fmt.Sprintf("https://php.paidsms.in/u.php?txn=%s", transactionId)
-	resp, err := http.Get(upiUrl)
+	intentID, err := primitive.ObjectIDFromHex(c.QueryParam("intentId"))
 	if err != nil {
-		log.Println("UPI API error:", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
-	}
-	defer resp.Body.Close()
-
-	var upiData UpiResponse
-	if err := json.NewDecoder(resp.Body).Decode(&upiData); err != nil {
-		log.Println("UPI response parse error:", err)
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Transaction Not Found. Please try again."})
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid intentId format"})
 	}
-
-	if upiData.Error != "" {
-		log.Println("UPI API returned error:", upiData.Error)
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Transaction Not Found. Please try again."})
+	intent, err := payments.OpenIntent(ctx, db, userObjectID, intentID)
+	if err != nil {
+		return paymentIntentError(c, err)
 	}
-
-	var minimumRecharge models.MinimumRecharge
-	minimumCollection := models.InitializeMinimumCollection(db)
-	err = minimumCollection.FindOne(ctx, bson.M{}).Decode(&minimumRecharge)
+	verifier, err := payments.New(rechargeData)
 	if err != nil {
-		logs.Logger.Error(err)
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Transaction Not Found. Please try again."})
+		log.Println("UPI verifier error:", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
 	}
-
-	if float64(upiData.Amount) < minimumRecharge.MinimumRecharge {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Recharge amount is less than %0.2f amount", minimumRecharge.MinimumRecharge)})
+	payment, err := verifier.Verify(ctx, transactionId)
+	if errors.Is(err, payments.ErrNotFound) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Transaction Not Found. Please try again."})
+	} else if err != nil {
+		log.Println("UPI verifier error:", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
 	}
-	rechargeHistoryUrl := fmt.Sprintf("%sapi/save-recharge-history", os.Getenv("BASE_API_URL"))
-	rechargePayload := map[string]interface{}{
-		"userId":         userId,
-		"transaction_id": transactionId,
-		"amount":         upiData.Amount,
-		"payment_type":   "upi",
-		"status":         "Received",
+	switch payment.Status {
+	case payments.StatusSuccess:
+	case payments.StatusPending:
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Payment is still pending. Please try again later."})
+	default:
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Transaction Not Found. Please try again."})
 	}
-	rechargePayloadBytes, _ := json.Marshal(rechargePayload)
-	rechargeResp, err := http.Post(rechargeHistoryUrl, "application/json", bytes.NewReader(rechargePayloadBytes))
+	// The minimum recharge was enforced when the intent was created.
+	if err := payments.Match(intent, payment); err != nil {
+		return paymentIntentError(c, err)
+	}
+	result, err := saveRecharge(ctx, db, recharge.Request{
+		UserID:        userObjectID,
+		TransactionID: transactionId,
+		Amount:        payment.Amount,
+		PaymentType:   recharge.TypeUPI,
+		Status:        recharge.StatusReceived,
+		IntentID:      intent.ID,
+	})
 	if err != nil {
 		log.Printf("[ERROR] Recharge history save error: %v", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to save recharge history."})
-	}
-	defer rechargeResp.Body.Close()
-	responseBody, _ := ioutil.ReadAll(rechargeResp.Body)
-	log.Printf("[INFO] Recharge history save response status: %d", rechargeResp.StatusCode)
-	log.Printf("[INFO] Recharge history save response body: %s", string(responseBody))
-
-	if rechargeResp.StatusCode == http.StatusBadRequest {
-		var errorResponse map[string]string
-		if err := json.Unmarshal(responseBody, &errorResponse); err != nil {
-			log.Printf("[ERROR] Failed to parse error response: %v", err)
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to process recharge history response."})
-		}
-		return c.JSON(http.StatusBadRequest, errorResponse) // Return the exact error to the client
-	}
-
-	if rechargeResp.StatusCode != http.StatusOK {
-		log.Printf("[ERROR] Recharge history save failed with status: %d, body: %s", rechargeResp.StatusCode, string(responseBody))
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to save recharge history."})
-	}
-
-	var apiWalletUser models.ApiWalletUser
-	apiWalletCollection := models.InitializeApiWalletuserCollection(db)
-	err = apiWalletCollection.FindOne(ctx, bson.M{"userId": userObjectID}).Decode(&apiWalletUser)
-	if err != nil {
-		logs.Logger.Error(err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch api wallet user"})
+		return rechargeError(c, err)
 	}
+	idempotency.Committed(c)
 
 	ipDetail, err := utils.ExtractIpDetails(c)
 	if err != nil {
@@ -165,8 +137,8 @@ func RechargeUpiApi(c echo.Context) error {
 		Email:   user.Email,
 		UserID:  userId,
 		TrnID:   transactionId,
-		Amount:  fmt.Sprintf("%d", upiData.Amount),
-		Balance: fmt.Sprintf("%0.2f", apiWalletUser.Balance),
+		Amount:  payment.Amount.String(),
+		Balance: result.Balance.String(),
 		IP:      ipDetail,
 	}
 	err = services.UpiRechargeTeleBot(rechargeDetail)
@@ -175,7 +147,7 @@ func RechargeUpiApi(c echo.Context) error {
 		logs.Logger.Error("Unable to send upi recharge message")
 	}
 	return c.JSON(http.StatusOK, map[string]string{
-		"message": fmt.Sprintf("%d₹ Added Successfully!", upiData.Amount),
+		"message": fmt.Sprintf("%s₹ Added Successfully!", payment.Amount),
 	})
 }
 
@@ -183,121 +155,122 @@ type ResponseStructure struct {
 	Status string `json:"status"`
 }
 
+// tronError writes the response for a TRX deposit that failed verification.
+func tronError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, tron.ErrInvalidHash), errors.Is(err, tron.ErrNotFound):
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Transaction not found"})
+	case errors.Is(err, tron.ErrUnconfirmed):
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Transaction is not confirmed yet, try again in a minute"})
+	case errors.Is(err, tron.ErrFailed), errors.Is(err, tron.ErrUnsupportedContract),
+		errors.Is(err, tron.ErrWrongRecipient), errors.Is(err, tron.ErrBeforeAddress):
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+	logs.Logger.Error(err)
+	return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Internal server error"})
+}
+
+// RechargeTrxApi credits a TRX transfer to the caller's deposit address. The
+// transfer is checked against the TRON node configured as the trx verifier
+// URL, with TRONGRID_API_KEY sent as its API key.
 func RechargeTrxApi(c echo.Context) error {
 	db := c.Get("db").(*mongo.Database)
 	address := c.QueryParam("address")
 	hash := c.QueryParam("hash")
-	userId := c.QueryParam("userId")
+	userId := auth.UserID(c)
 
-	if address == "" || hash == "" || userId == "" {
+	if hash == "" || userId == "" {
 		return c.JSON(http.StatusBadRequest, map[string]string{
 			"error": "Missing required query parameters",
 		})
 	}
+	userIdObject, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid userId format"})
+	}
 
 	userLock := getUserLock(userId)
 	userLock.Lock()
 	defer userLock.Unlock()
 
-	exchangeRate, err := utils.FetchTRXPrice()
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "Failed to get exchange rate",
-		})
-	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
 
-	trxApiURL := fmt.Sprintf("https://php.paidsms.in/tron/?type=txnid&address=%s&hash=%s", address, hash)
-	req, _ := http.NewRequest("GET", trxApiURL, nil)
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/91.0.4472.124 Safari/537.36")
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Println("ERROR: Failed to fetch TRX transaction data:", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "Internal server error",
-		})
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		log.Println("ERROR: TRX transaction API returned non-200 status code:", resp.StatusCode)
-		return c.JSON(http.StatusBadRequest, map[string]string{
-			"error": "Transaction not found",
-		})
+	var apiWalletUser models.ApiWalletUser
+	err = models.InitializeApiWalletuserCollection(db).FindOne(ctx, bson.M{"userId": userIdObject}).Decode(&apiWalletUser)
+	if err == mongo.ErrNoDocuments {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
+	} else if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
 	}
-
-	var trxData struct {
-		TRX     float64 `json:"trx"`
-		SUCCESS bool    `json:"success"`
-		Message string  `json:"message"`
+	if address != "" && address != apiWalletUser.TRXAddress {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Address does not belong to this account"})
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&trxData); err != nil {
-		log.Println("ERROR: Failed to decode TRX transaction response:", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "Failed to process transaction data",
-		})
+	var adminWallet models.RechargeAPI
+	err = models.InitializeRechargeAPICollection(db).FindOne(ctx, bson.M{"recharge_type": recharge.TypeTRX}).Decode(&adminWallet)
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
 	}
 
-	if trxData.SUCCESS == false {
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": trxData.Message,
-		})
+	client := tron.NewClient(adminWallet.VerifierURL, os.Getenv("TRONGRID_API_KEY"))
+	transfer, err := client.VerifyDeposit(ctx, hash, tron.Deposit{
+		Address:   apiWalletUser.TRXAddress,
+		CreatedAt: apiWalletUser.AddressCreatedAt(),
+	})
+	if err != nil {
+		return tronError(c, err)
 	}
-
-	if trxData.TRX <= 1 {
+	if transfer.Amount <= tron.SunPerTRX {
 		return c.JSON(http.StatusBadRequest, map[string]string{
 			"error": "Invalid TRX transaction",
 		})
 	}
 
-	price := trxData.TRX * exchangeRate
-	amount := strconv.FormatFloat(price, 'f', 2, 64)
-	rechargeHistoryPayload := map[string]interface{}{
-		"userId":         userId,
-		"transaction_id": hash,
-		"amount":         amount,
-		"payment_type":   "trx",
-		"status":         "Received",
-	}
-	payloadBytes, _ := json.Marshal(rechargeHistoryPayload)
-
-	rechargeHistoryURL := fmt.Sprintf("%sapi/save-recharge-history", os.Getenv("BASE_API_URL"))
-	rechargeResp, err := http.Post(rechargeHistoryURL, "application/json", bytes.NewReader(payloadBytes))
+	// Hashes recorded before they were verified on chain kept the case the
+	// user typed them in.
+	count, err := models.InitializeRechargeHistoryCollection(db).CountDocuments(ctx, bson.M{
+		"transaction_id": primitive.Regex{Pattern: "^" + transfer.TxID + "$", Options: "i"},
+	})
 	if err != nil {
-		log.Println("ERROR: Already Done Tranasaction:", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "transaction done already",
-		})
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
 	}
-
-	defer rechargeResp.Body.Close()
-	if rechargeResp.StatusCode != http.StatusOK {
-		body, _ := ioutil.ReadAll(rechargeResp.Body)
-		log.Printf("ERROR: Failed to save recharge history. Response: %s", string(body))
-		return c.JSON(http.StatusInternalServerError, map[string]string{
+	if count > 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{
 			"error": "Transaction Already Done",
 		})
 	}
-	log.Println("INFO: Recharge history saved successfully for hash:", hash)
 
-	userIdObject, _ := primitive.ObjectIDFromHex(userId)
-	apiWalletCollection := models.InitializeApiWalletuserCollection(db)
-	var apiWalletUser models.ApiWalletUser
-	err = apiWalletCollection.FindOne(context.TODO(), bson.M{"userId": userIdObject}).Decode(&apiWalletUser)
+	exchangeRate, err := utils.FetchTRXPrice()
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "",
+			"error": "Failed to get exchange rate",
 		})
 	}
-	var adminWallet models.RechargeAPI
-	rechargeWalletCollection := models.InitializeRechargeAPICollection(db)
-	err = rechargeWalletCollection.FindOne(context.TODO(), bson.M{"recharge_type": "trx"}).Decode(&adminWallet)
-	if err != nil {
-		logs.Logger.Error(err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{
-			"error": "",
+
+	price := money.FromFloat(transfer.Amount.TRX() * exchangeRate)
+	result, err := saveRecharge(ctx, db, recharge.Request{
+		UserID:        userIdObject,
+		TransactionID: transfer.TxID,
+		Amount:        price,
+		PaymentType:   recharge.TypeTRX,
+		Status:        recharge.StatusReceived,
+		PaidAt:        transfer.Time,
+	})
+	if errors.Is(err, recharge.ErrDuplicate) {
+		return c.JSON(http.StatusBadRequest, map[string]string{
+			"error": "Transaction Already Done",
 		})
 	}
+	if err != nil {
+		log.Println("ERROR: Failed to save recharge history:", err)
+		return rechargeError(c, err)
+	}
+	idempotency.Committed(c)
+	log.Println("INFO: Recharge history saved successfully for hash:", hash)
 
 	var user models.User
 	userCollection := models.InitializeUserCollection(db)
@@ -322,14 +295,14 @@ func RechargeTrxApi(c echo.Context) error {
 	rechargeDetail := services.TrxRechargeDetails{
 		Email:        user.Email,
 		UserID:       userId,
-		Trx:          fmt.Sprintf("%.2f", trxData.TRX),
+		Trx:          fmt.Sprintf("%.2f", transfer.Amount.TRX()),
 		ExchangeRate: fmt.Sprintf("%0.2f", exchangeRate),
-		Amount:       amount,
-		Balance:      fmt.Sprintf("%.2f", apiWalletUser.Balance),
+		Amount:       price.String(),
+		Balance:      result.Balance.String(),
 		Address:      fromAddress,
 		SendTo:       toAddress,
 		Status:       "",
-		Hash:         hash,
+		Hash:         transfer.TxID,
 		IP:           ipDetail,
 	}
 	response, err := http.Get(sentUrl)
@@ -375,7 +348,7 @@ func RechargeTrxApi(c echo.Context) error {
 			logs.Logger.Info("recharget trx send failed")
 		}
 		return c.JSON(http.StatusOK, map[string]interface{}{
-			"message": fmt.Sprintf("%.2f₹ Added Successfully!", price),
+			"message": fmt.Sprintf("%s₹ Added Successfully!", price),
 		})
 	}
 	rechargeDetail.Status = "ok"
@@ -386,7 +359,7 @@ func RechargeTrxApi(c echo.Context) error {
 		logs.Logger.Info("recharget trx send failed")
 	}
 	return c.JSON(http.StatusOK, map[string]interface{}{
-		"message": fmt.Sprintf("%.2f₹ Added Successfully!", price),
+		"message": fmt.Sprintf("%s₹ Added Successfully!", price),
 	})
 }
 
@@ -452,6 +425,18 @@ func ToggleMaintenance(c echo.Context) error {
 	log.Printf("INFO: Upserting record with filter: %+v and update: %+v\n", filter, update)
 
 	rechargeApiCol := db.Collection("recharge-apis")
+	var previous struct {
+		Maintenance bool `bson:"maintenance"`
+	}
+	err := rechargeApiCol.FindOne(context.TODO(), filter).Decode(&previous)
+	if err != nil && err != mongo.ErrNoDocuments {
+		log.Println("ERROR: Failed to fetch maintenance status:", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
+	}
+	audit.SetTarget(c, "recharge-api", input.RechargeType)
+	if err == nil {
+		audit.SetBefore(c, bson.M{"maintenance": previous.Maintenance})
+	}
 
 	opts := options.Update().SetUpsert(true)
 	result, err := rechargeApiCol.UpdateOne(context.TODO(), filter, update, opts)
@@ -460,6 +445,7 @@ func ToggleMaintenance(c echo.Context) error {
 		log.Println("ERROR: Failed to update or insert maintenance status:", err)
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
 	}
+	audit.SetAfter(c, bson.M{"maintenance": input.Status})
 	log.Printf("INFO: Successfully upserted maintenance status. Matched count: %d, Modified count: %d, Upserted ID: %v\n",
 		result.MatchedCount, result.ModifiedCount, result.UpsertedID)
 
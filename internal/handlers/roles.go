@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/ranjankuldeep/fakeNumber/internal/audit"
+	"github.com/ranjankuldeep/fakeNumber/internal/auth"
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/logs"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type staffMember struct {
+	ID    primitive.ObjectID `bson:"_id" json:"userId"`
+	Email string             `bson:"email" json:"email"`
+	Role  string             `bson:"role" json:"role"`
+}
+
+// GetAdminRoles lists the staff roles with their permissions and the users
+// holding each one.
+func GetAdminRoles(c echo.Context) error {
+	db := c.Get("db").(*mongo.Database)
+	userCol := models.InitializeUserCollection(db)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := userCol.Find(ctx,
+		bson.M{"role": bson.M{"$exists": true, "$ne": ""}},
+		options.Find().SetProjection(bson.M{"email": 1, "role": 1}).SetSort(bson.M{"email": 1}),
+	)
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to fetch staff"})
+	}
+	staff := []staffMember{}
+	if err := cursor.All(ctx, &staff); err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to fetch staff"})
+	}
+	return c.JSON(http.StatusOK, echo.Map{"roles": auth.Roles(), "staff": staff})
+}
+
+// AssignAdminRole sets a user's staff role. An empty role revokes staff
+// access. Nobody can change their own role, so the last super-admin cannot
+// lock everyone out by accident.
+func AssignAdminRole(c echo.Context) error {
+	db := c.Get("db").(*mongo.Database)
+	userCol := models.InitializeUserCollection(db)
+
+	var request struct {
+		UserID string `json:"userId"`
+		Role   string `json:"role"`
+	}
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid request body"})
+	}
+	userID, err := primitive.ObjectIDFromHex(request.UserID)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid userId format"})
+	}
+	if request.Role != "" && !auth.ValidRole(request.Role) {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Unknown role"})
+	}
+	if request.UserID == auth.UserID(c) {
+		return c.JSON(http.StatusForbidden, echo.Map{"error": "You cannot change your own role"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{"role": request.Role, "updatedAt": time.Now()}}
+	if request.Role == "" {
+		update = bson.M{"$unset": bson.M{"role": ""}, "$set": bson.M{"updatedAt": time.Now()}}
+	}
+	var previous models.User
+	err = userCol.FindOneAndUpdate(ctx, bson.M{"_id": userID}, update).Decode(&previous)
+	if err == mongo.ErrNoDocuments {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "User not found"})
+	} else if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to update role"})
+	}
+	audit.SetTarget(c, "user", request.UserID)
+	audit.SetBefore(c, bson.M{"role": previous.Role})
+	audit.SetAfter(c, bson.M{"role": request.Role})
+	logs.Logger.Infof("Role of user %s set to %q by %s", request.UserID, request.Role, auth.UserID(c))
+	return c.JSON(http.StatusOK, echo.Map{"message": "Role updated successfully"})
+}
@@ -9,7 +9,9 @@ import (
 	"time"
 
 	"github.com/labstack/echo/v4"
+	"github.com/ranjankuldeep/fakeNumber/internal/audit"
 	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/internal/providers"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -53,6 +55,7 @@ func AddServer(c echo.Context) error {
 	filter := bson.M{"server": server}
 	existingServer := models.Server{}
 	err = serverCollection.FindOne(context.Background(), filter).Decode(&existingServer)
+	audit.SetTarget(c, "server", strconv.Itoa(server))
 	if err == nil {
 		// Server exists, update the API key if provided
 		update := bson.M{"$set": bson.M{"api_key": input.APIKey}}
@@ -61,6 +64,10 @@ func AddServer(c echo.Context) error {
 			log.Println("ERROR: Failed to update API key:", err)
 			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to update API key"})
 		}
+		audit.SetBefore(c, existingServer)
+		updatedServer := existingServer
+		updatedServer.APIKey = input.APIKey
+		audit.SetAfter(c, updatedServer)
 		log.Printf("INFO: API key updated successfully for server %d\n", server)
 		return c.JSON(http.StatusOK, map[string]string{"message": "API key updated successfully"})
 	} else if err == mongo.ErrNoDocuments || err == mongo.ErrEmptySlice {
@@ -76,6 +83,7 @@ func AddServer(c echo.Context) error {
 			log.Println("ERROR: Failed to add new server:", err)
 			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to add server"})
 		}
+		audit.SetAfter(c, newServer)
 		log.Printf("INFO: Server %d added successfully\n", server)
 		return c.JSON(http.StatusCreated, map[string]string{"message": "Server added successfully"})
 	} else {
@@ -124,14 +132,16 @@ func DeleteServer(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Server number is required and must be an integer."})
 	}
 
-	result, err := serverCollection.DeleteOne(context.Background(), bson.M{"server": server})
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
-	}
-
-	if result.DeletedCount == 0 {
+	var deleted models.Server
+	err = serverCollection.FindOneAndDelete(context.Background(), bson.M{"server": server}).Decode(&deleted)
+	if err == mongo.ErrNoDocuments {
 		return c.JSON(http.StatusNotFound, map[string]string{"error": "Server not found."})
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
 	}
+	audit.SetTarget(c, "server", strconv.Itoa(server))
+	audit.SetBefore(c, deleted)
+	audit.SetAfter(c, nil)
 	return c.JSON(http.StatusOK, map[string]string{"message": "Server deleted successfully"})
 }
 
@@ -155,6 +165,7 @@ func MaintainanceServer(c echo.Context) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	audit.SetTarget(c, "server", strconv.Itoa(input.Server))
 	if input.Server == 0 {
 		update := bson.M{"$set": bson.M{"maintainance": input.Maintainance}}
 		_, err := serverCollection.UpdateMany(ctx, bson.M{}, update)
@@ -162,6 +173,7 @@ func MaintainanceServer(c echo.Context) error {
 			log.Println("ERROR: Failed to update maintenance status for all servers:", err)
 			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
 		}
+		audit.SetAfter(c, bson.M{"maintainance": input.Maintainance, "servers": "all"})
 		return c.JSON(http.StatusOK, map[string]string{
 			"message": fmt.Sprintf("Maintenance status set to %t for all servers.", input.Maintainance),
 		})
@@ -179,6 +191,7 @@ func MaintainanceServer(c echo.Context) error {
 			log.Println("ERROR: Failed to add new server:", err)
 			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
 		}
+		audit.SetAfter(c, bson.M{"server": input.Server, "maintainance": input.Maintainance})
 		return c.JSON(http.StatusCreated, map[string]string{"message": "Server added successfully."})
 	} else if err != nil {
 		log.Println("ERROR: Database error while checking for server:", err)
@@ -197,12 +210,68 @@ func MaintainanceServer(c echo.Context) error {
 		log.Println("ERROR: Failed to update maintenance status:", err)
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
 	}
+	audit.SetBefore(c, bson.M{"maintainance": currentStatus})
+	audit.SetAfter(c, bson.M{"maintainance": newStatus})
 	return c.JSON(http.StatusOK, map[string]string{
 		"message":      "Maintenance status updated successfully.",
 		"maintainance": fmt.Sprintf("Server %d is now %t", input.Server, newStatus),
 	})
 }
 
+// GetServerHealth lists the manual maintenance flag next to the circuit
+// breaker state of every server.
+func GetServerHealth(c echo.Context) error {
+	db := c.Get("db").(*mongo.Database)
+	serverCollection := models.InitializeServerCollection(db)
+
+	var servers []models.Server
+	cursor, err := serverCollection.Find(context.Background(), bson.M{"server": bson.M{"$ne": 0}}, options.Find().SetSort(bson.M{"server": 1}))
+	if err != nil {
+		log.Println("ERROR: Failed to fetch servers:", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
+	}
+	defer cursor.Close(context.Background())
+	if err := cursor.All(context.Background(), &servers); err != nil {
+		log.Println("ERROR: Failed to decode servers:", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
+	}
+
+	health := make(map[int]providers.Health)
+	for _, h := range providers.HealthReport() {
+		health[h.Server] = h
+	}
+
+	type ServerHealth struct {
+		providers.Health
+		Maintainance bool `json:"maintainance"`
+		Block        bool `json:"block"`
+	}
+	response := []ServerHealth{}
+	for _, server := range servers {
+		h, ok := health[server.ServerNumber]
+		if !ok {
+			h = providers.Health{Server: server.ServerNumber, State: providers.StateClosed}
+		}
+		response = append(response, ServerHealth{Health: h, Maintainance: server.Maintenance, Block: server.Block})
+	}
+	return c.JSON(http.StatusOK, response)
+}
+
+// ResetServerHealth closes the circuit breaker of a server after the upstream
+// has been fixed.
+func ResetServerHealth(c echo.Context) error {
+	type RequestBody struct {
+		Server int `json:"server"`
+	}
+	var input RequestBody
+	if err := c.Bind(&input); err != nil || input.Server == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid input format"})
+	}
+	providers.ResetBreaker(input.Server)
+	log.Printf("INFO: Circuit breaker reset for server %d\n", input.Server)
+	return c.JSON(http.StatusOK, map[string]string{"message": fmt.Sprintf("Server %d health reset", input.Server)})
+}
+
 // Add token for server 9
 func AddTokenForServer9(c echo.Context) error {
 	db := c.Get("db").(*mongo.Database)
@@ -215,10 +284,14 @@ func AddTokenForServer9(c echo.Context) error {
 
 	filter := bson.M{"server": 9}
 	update := bson.M{"$set": bson.M{"token": token}}
-	result, err := serverCollection.UpdateOne(context.Background(), filter, update)
-	if err != nil || result.MatchedCount == 0 {
+	var previous models.Server
+	err := serverCollection.FindOneAndUpdate(context.Background(), filter, update).Decode(&previous)
+	if err != nil {
 		return c.JSON(http.StatusNotFound, map[string]string{"error": "Server 9 not found"})
 	}
+	audit.SetTarget(c, "server", "9")
+	audit.SetBefore(c, bson.M{"token": previous.Token})
+	audit.SetAfter(c, bson.M{"token": token})
 
 	return c.JSON(http.StatusOK, map[string]string{"message": "Token added successfully"})
 }
@@ -302,16 +375,22 @@ func UpdateExchangeRateAndMargin(c echo.Context) error {
 	// Update the server document
 	filter := bson.M{"server": server}
 	update := bson.M{"$set": updateFields}
-	result, err := serverCollection.UpdateOne(context.Background(), filter, update)
-	if err != nil {
+	var previous models.Server
+	err = serverCollection.FindOneAndUpdate(context.Background(), filter, update).Decode(&previous)
+	if err == mongo.ErrNoDocuments {
+		log.Printf("ERROR: Server %d not found\n", server)
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Server not found"})
+	} else if err != nil {
 		log.Println("ERROR: Failed to update server:", err)
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
 	}
-
-	if result.MatchedCount == 0 {
-		log.Printf("ERROR: Server %d not found\n", server)
-		return c.JSON(http.StatusNotFound, map[string]string{"error": "Server not found"})
+	audit.SetTarget(c, "server", strconv.Itoa(server))
+	audit.SetBefore(c, bson.M{"exchangeRate": previous.ExchangeRate, "margin": previous.Margin})
+	after := bson.M{"exchangeRate": previous.ExchangeRate, "margin": previous.Margin}
+	for field, value := range updateFields {
+		after[field] = value
 	}
+	audit.SetAfter(c, after)
 
 	log.Printf("INFO: Successfully updated server %d\n", server)
 	return c.JSON(http.StatusOK, map[string]interface{}{
@@ -322,6 +401,57 @@ func UpdateExchangeRateAndMargin(c echo.Context) error {
 	})
 }
 
+// Set or clear the SMS-Activate adapter configuration of a server. Servers that
+// carry one are served by the generic adapter instead of built-in code.
+func UpdateServerActivation(c echo.Context) error {
+	db := c.Get("db").(*mongo.Database)
+	serverCollection := models.InitializeServerCollection(db)
+
+	type RequestBody struct {
+		Server     string                   `json:"server"`
+		Activation *models.ActivationConfig `json:"activation"`
+	}
+
+	var input RequestBody
+	if err := c.Bind(&input); err != nil {
+		log.Println("ERROR: Failed to parse request body:", err)
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request payload"})
+	}
+
+	server, err := strconv.Atoi(input.Server)
+	if err != nil || server <= 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Server must be a valid number"})
+	}
+
+	// A null activation removes the override and falls back to the built-in provider.
+	update := bson.M{"$unset": bson.M{"activation": ""}, "$set": bson.M{"updatedAt": time.Now()}}
+	if input.Activation != nil {
+		if err := providers.ValidateActivationConfig(*input.Activation); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		update = bson.M{"$set": bson.M{"activation": input.Activation, "updatedAt": time.Now()}}
+	}
+
+	var previous models.Server
+	err = serverCollection.FindOneAndUpdate(context.Background(), bson.M{"server": server}, update).Decode(&previous)
+	if err == mongo.ErrNoDocuments {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Server not found, add it first"})
+	} else if err != nil {
+		log.Println("ERROR: Failed to update server activation config:", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
+	}
+	audit.SetTarget(c, "server", strconv.Itoa(server))
+	audit.SetBefore(c, bson.M{"activation": previous.Activation})
+	audit.SetAfter(c, bson.M{"activation": input.Activation})
+
+	log.Printf("INFO: Updated activation config for server %d\n", server)
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"message":    "Activation config updated successfully",
+		"server":     server,
+		"activation": input.Activation,
+	})
+}
+
 func BlocKServer(c echo.Context) error {
 	db := c.Get("db").(*mongo.Database)
 	type RequestPayload struct {
@@ -353,13 +483,19 @@ func BlocKServer(c echo.Context) error {
 		},
 	}
 
-	result, err := serverListCollection.UpdateOne(context.TODO(), filter, update)
-	if err != nil {
+	var previous models.ServerList
+	err = serverListCollection.FindOneAndUpdate(context.TODO(), filter, update).Decode(&previous)
+	if err == mongo.ErrNoDocuments {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "server or service not found"})
+	} else if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "failed to update server block status"})
 	}
-
-	if result.MatchedCount == 0 {
-		return c.JSON(http.StatusNotFound, map[string]string{"error": "server or service not found"})
+	audit.SetTarget(c, "service", payload.Name+"/"+payload.ServerNumber)
+	for _, s := range previous.Servers {
+		if s.Server == serverNumber {
+			audit.SetBefore(c, bson.M{"block": s.Block})
+		}
 	}
+	audit.SetAfter(c, bson.M{"block": payload.Block})
 	return c.JSON(http.StatusOK, map[string]string{"message": "server block status updated successfully"})
 }
@@ -7,6 +7,7 @@ import (
 	"strconv"
 
 	"github.com/labstack/echo/v4"
+	"github.com/ranjankuldeep/fakeNumber/internal/audit"
 	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -59,14 +60,18 @@ func AddDiscount(c echo.Context) error {
 	serverDiscountCol := db.Collection("server-discounts")
 	filter := bson.M{"server": server}
 	update := bson.M{"$set": bson.M{"server": server, "discount": input.Discount}}
-	opts := options.Update().SetUpsert(true)
+	opts := options.FindOneAndUpdate().SetUpsert(true)
 
 	// Perform the update operation
-	_, err = serverDiscountCol.UpdateOne(context.Background(), filter, update, opts)
-	if err != nil {
+	var previous bson.M
+	err = serverDiscountCol.FindOneAndUpdate(context.Background(), filter, update, opts).Decode(&previous)
+	if err != nil && err != mongo.ErrNoDocuments {
 		log.Println("ERROR: Failed to add or update discount:", err)
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Internal Server Error"})
 	}
+	audit.SetTarget(c, "server-discount", strconv.Itoa(server))
+	audit.SetBefore(c, discountSnapshot(previous))
+	audit.SetAfter(c, bson.M{"discount": input.Discount})
 
 	// Log success
 	log.Println("INFO: Discount added or updated successfully")
@@ -138,15 +143,16 @@ func DeleteDiscount(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Server number must be an integer."})
 	}
 
-	result, err := db.Collection("server-discounts").DeleteOne(context.Background(), bson.M{"server": server})
-	if err != nil {
+	var previous bson.M
+	err = db.Collection("server-discounts").FindOneAndDelete(context.Background(), bson.M{"server": server}).Decode(&previous)
+	if err == mongo.ErrNoDocuments {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Server discount not found."})
+	} else if err != nil {
 		log.Println("Error deleting discount:", err)
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
 	}
-
-	if result.DeletedCount == 0 {
-		return c.JSON(http.StatusNotFound, map[string]string{"error": "Server discount not found."})
-	}
+	audit.SetTarget(c, "server-discount", strconv.Itoa(server))
+	audit.SetBefore(c, discountSnapshot(previous))
 
 	return c.JSON(http.StatusOK, map[string]string{"message": "Server discount deleted successfully"})
 }
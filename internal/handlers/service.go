@@ -5,20 +5,24 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"log"
-	"math"
 	"net/http"
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/labstack/echo/v4"
+	"github.com/ranjankuldeep/fakeNumber/internal/apikeys"
+	"github.com/ranjankuldeep/fakeNumber/internal/auth"
 	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
-	serverscalc "github.com/ranjankuldeep/fakeNumber/internal/serversCalc"
-	serversnextotpcalc "github.com/ranjankuldeep/fakeNumber/internal/serversNextOtpCalc"
-	serversotpcalc "github.com/ranjankuldeep/fakeNumber/internal/serversOtpCalc"
+	"github.com/ranjankuldeep/fakeNumber/internal/expiry"
+	"github.com/ranjankuldeep/fakeNumber/internal/idempotency"
+	"github.com/ranjankuldeep/fakeNumber/internal/ledger"
+	"github.com/ranjankuldeep/fakeNumber/internal/money"
+	"github.com/ranjankuldeep/fakeNumber/internal/orderstate"
+	"github.com/ranjankuldeep/fakeNumber/internal/providers"
 	"github.com/ranjankuldeep/fakeNumber/internal/services"
 	"github.com/ranjankuldeep/fakeNumber/internal/utils"
 	"github.com/ranjankuldeep/fakeNumber/logs"
@@ -28,11 +32,6 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-type ApiRequest struct {
-	URL     string
-	Headers map[string]string
-}
-
 type ResponseData struct {
 	ID     string
 	Number string
@@ -47,11 +46,6 @@ type OTPData struct {
 	Code string
 }
 
-type ServerSecrets struct {
-	ApiKeyServer string
-	Token        string
-}
-
 func FetchMarginAndExchangeRate(ctx context.Context, db *mongo.Database) (map[int]float64, map[int]float64, error) {
 	serverCollection := models.InitializeServerCollection(db)
 	marginMap := make(map[int]float64)
@@ -102,6 +96,10 @@ func HandleGetNumberRequest(c echo.Context) error {
 	if code == "" {
 		return c.JSON(http.StatusBadRequest, echo.Map{"error": "empty code value"})
 	}
+	// server=auto or fallback=true walks the servers for the service by price
+	// until one of them has stock.
+	auto := server == "auto"
+	fallback := auto || c.QueryParam("fallback") == "true"
 	serverNumber, _ := strconv.Atoi(server)
 
 	serverCollection := models.InitializeServerCollection(db)
@@ -115,12 +113,9 @@ func HandleGetNumberRequest(c echo.Context) error {
 		return c.JSON(http.StatusOK, map[string]string{"error": "site is under maintenance"})
 	}
 
-	apiWalletUserCollection := models.InitializeApiWalletuserCollection(db)
-	var apiWalletUser models.ApiWalletUser
-	err = apiWalletUserCollection.FindOne(ctx, bson.M{"api_key": apiKey}).Decode(&apiWalletUser)
+	apiWalletUser, err := walletForKey(ctx, c, db, apiKey, apikeys.ScopeBuy)
 	if err != nil {
-		logs.Logger.Error(err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "invalid api key"})
+		return apiKeyError(c, err)
 	}
 
 	var user models.User
@@ -130,123 +125,128 @@ func HandleGetNumberRequest(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "account blocked"})
 	}
 
+	// With fallback a server in maintenance or blocked is skipped like one
+	// without stock, so it is only checked here when it is the sole choice.
+	serviceFilter := bson.M{"servers.code": code}
 	var serverInfo models.Server
-	err = serverCollection.FindOne(ctx, bson.M{"server": serverNumber}).Decode(&serverInfo)
-	if err != nil {
-		logs.Logger.Error(err)
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "server not found"})
-	}
-	if serverInfo.Maintenance {
-		return c.JSON(http.StatusServiceUnavailable, echo.Map{"error": "server under maintenance"})
-	}
-	if serverInfo.Block == true {
-		return c.JSON(http.StatusServiceUnavailable, echo.Map{"error": "invalid server number"})
+	if !fallback {
+		err = serverCollection.FindOne(ctx, bson.M{"server": serverNumber}).Decode(&serverInfo)
+		if err != nil {
+			logs.Logger.Error(err)
+			return c.JSON(http.StatusInternalServerError, echo.Map{"error": "server not found"})
+		}
+		if serverInfo.Maintenance {
+			return c.JSON(http.StatusServiceUnavailable, echo.Map{"error": "server under maintenance"})
+		}
+		if serverInfo.Block == true {
+			return c.JSON(http.StatusServiceUnavailable, echo.Map{"error": "invalid server number"})
+		}
+		serviceFilter["servers.server"] = serverNumber
 	}
 
 	var serviceList models.ServerList
 	serverListollection := models.InitializeServerListCollection(db)
-	err = serverListollection.FindOne(ctx, bson.M{
-		"servers.server": serverNumber,
-		"servers.code":   code,
-	}).Decode(&serviceList)
+	err = serverListollection.FindOne(ctx, serviceFilter).Decode(&serviceList)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
 	}
-
-	var serverData models.ServerData
-	for _, s := range serviceList.Servers {
-		if s.Server == serverNumber {
-			serverData = models.ServerData{
-				Price:  s.Price,
-				Code:   s.Code,
-				Otp:    s.Otp,
-				Server: serverNumber,
-			}
-		}
-	}
+	serviceName := serviceList.Name
 
 	isMultiple := "true"
 	if otp == "single" {
 		isMultiple = "false"
 	}
 
-	var serviceName string
-	for _, s := range serviceList.Servers {
-		if s.Server == serverNumber && s.Code == code {
-			serviceName = serviceList.Name
-			break
+	var candidates []purchaseCandidate
+	if fallback {
+		candidates, err = purchaseCandidates(ctx, db, serviceList, user.ID.Hex(), serverNumber)
+		if err != nil {
+			logs.Logger.Error(err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
 		}
+	} else {
+		var serverData models.ServerData
+		for _, s := range serviceList.Servers {
+			if s.Server == serverNumber {
+				serverData = models.ServerData{
+					Price:  s.Price,
+					Code:   s.Code,
+					Otp:    s.Otp,
+					Server: serverNumber,
+				}
+			}
+		}
+		price, err := money.Parse(serverData.Price)
+		if err != nil {
+			logs.Logger.Errorf("invalid price %q for %s on server %d: %v", serverData.Price, serviceName, serverNumber, err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "invalid service price"})
+		}
+		discount, _ := FetchDiscount(ctx, db, user.ID.Hex(), serviceName, serverNumber)
+		candidates = []purchaseCandidate{{Info: serverInfo, Data: serverData, Price: price + discount, Discount: discount}}
 	}
-
-	price, _ := strconv.ParseFloat(serverData.Price, 64)
-	discount, err := FetchDiscount(ctx, db, user.ID.Hex(), serviceName, serverNumber)
-	price += discount
-	if apiWalletUser.Balance < price {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "low balance"})
-	}
-
-	apiURLRequest, err := constructApiUrl(db, server, serverInfo.APIKey, serverInfo.Token, serverData, isMultiple)
-	if err != nil {
-		logs.Logger.Error(err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
+	if len(candidates) == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "no stock"})
 	}
 
-	numData, err := ExtractNumber(server, apiURLRequest)
+	numData, chosen, hold, attempts, err := buyFromCandidates(ctx, db, user.ID, candidates, isMultiple)
 	if err != nil {
+		if errors.Is(err, ledger.ErrInsufficientBalance) {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
-
-	newBalance := apiWalletUser.Balance - price
-	roundedBalance := math.Round(newBalance*100) / 100
-	roundedPrice := math.Round(price*100) / 100
+	if !fallback {
+		attempts = nil
+	}
+	serverData := chosen.Data
+	serverNumber = chosen.Info.ServerNumber
+	server = strconv.Itoa(serverNumber)
+	price := chosen.Price
+	newBalance := apiWalletUser.Amount() - price
 
 	session, err := db.Client().StartSession()
 	if err != nil {
 		logs.Logger.Error("Failed to start session:", err)
+		releaseHold(db, hold, "failed to start session")
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to start transaction session"})
 	}
 	defer session.EndSession(context.Background())
 	_, err = session.WithTransaction(context.Background(), func(sc mongo.SessionContext) (interface{}, error) {
-		_, err := apiWalletUserCollection.UpdateOne(
-			sc,
-			bson.M{"userId": user.ID},
-			bson.M{"$inc": bson.M{"balance": -roundedPrice}},
-		)
-		if err != nil {
-			time.Sleep(2 * time.Second)
-		}
-
 		transactionHistoryCollection := models.InitializeTransactionHistoryCollection(db)
+		state, transitions := orderstate.Opened(orderstate.ActorUser, "number assigned by server "+server)
 		transaction := models.TransactionHistory{
 			UserID:        apiWalletUser.UserID.Hex(),
 			Service:       serviceName,
 			TransactionID: numData.Id,
-			Price:         fmt.Sprintf("%.2f", price),
+			Price:         price.String(),
 			Server:        server,
 			OTP:           []string{},
 			ID:            primitive.NewObjectID(),
 			Number:        numData.Number,
-			Status:        "PENDING",
+			Status:        orderstate.WaitingSMS.Status(),
+			State:         state,
+			Transitions:   transitions,
+			Attempts:      attempts,
 			DateTime:      time.Now().In(time.FixedZone("IST", 5*3600+30*60)).Format("2006-01-02T15:04:05"),
 			CreatedAt:     time.Now(),
 		}
-		_, err = transactionHistoryCollection.InsertOne(sc, transaction)
+		_, err := transactionHistoryCollection.InsertOne(sc, transaction)
 		if err != nil {
 			return nil, err
 		}
-		return nil, nil
+
+		return nil, capturePurchase(sc, db, hold, transaction, price, chosen.Discount)
 	})
 
 	if err != nil {
 		logs.Logger.Error("Transaction failed:", err)
+		releaseHold(db, hold, "failed to record purchase")
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
+	idempotency.Committed(c)
 
-	var expirationTime time.Time
-	switch server {
-	case "1", "2", "3", "4", "5", "6", "8", "9", "10", "11":
-		expirationTime = time.Now().Add(19 * time.Minute)
-	case "7":
+	expirationTime := time.Now().Add(19 * time.Minute)
+	if server == "7" {
 		expirationTime = time.Now().Add(9 * time.Minute)
 	}
 
@@ -255,7 +255,7 @@ func HandleGetNumberRequest(c echo.Context) error {
 		ID:             primitive.NewObjectID(),
 		UserID:         apiWalletUser.UserID,
 		Service:        serviceName,
-		Price:          price,
+		Price:          price.Float64(),
 		NumberType:     map[string]string{"true": "Multiple", "false": "Single"}[isMultiple],
 		Server:         serverNumber,
 		NumberID:       numData.Id,
@@ -267,10 +267,7 @@ func HandleGetNumberRequest(c echo.Context) error {
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
 	}
-
-	if numData.Id == "" || numData.Number == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "no stock"})
-	}
+	expiry.Schedule(order)
 
 	ipDetail, err := utils.ExtractIpDetails(c)
 	if err != nil {
@@ -281,9 +278,9 @@ func HandleGetNumberRequest(c echo.Context) error {
 		Email:       user.Email,
 		ServiceName: serviceName,
 		ServiceCode: serverData.Code,
-		Price:       fmt.Sprintf("%.2f", price),
+		Price:       price.String(),
 		Server:      server,
-		Balance:     fmt.Sprintf("%.2f", roundedBalance),
+		Balance:     newBalance.String(),
 		Number:      numData.Number,
 		Ip:          ipDetail,
 	}
@@ -292,135 +289,146 @@ func HandleGetNumberRequest(c echo.Context) error {
 	if err != nil {
 		logs.Logger.Info("Number Details Send Failed")
 	}
-	return c.JSON(http.StatusOK, map[string]string{"status": "ok", "id": numData.Id, "number": numData.Number})
+	warnLowBalance(db, apiWalletUser.UserID, apiWalletUser.Amount(), newBalance)
+	return c.JSON(http.StatusOK, map[string]string{"status": "ok", "id": numData.Id, "number": numData.Number, "server": server})
 }
 
-func ExtractNumber(server string, apiURLRequest ApiRequest) (NumberData, error) {
-	switch server {
-	case "1":
-		// Multiple OTP server with same url
-		id, number, err := serverscalc.ExtractNumberServerFromAccess(apiURLRequest.URL, apiURLRequest.Headers)
-		if err != nil {
-			return NumberData{}, fmt.Errorf("no stock")
+// purchaseCandidate is a server that sells the requested service, with the
+// price the user pays there.
+type purchaseCandidate struct {
+	Info     models.Server
+	Data     models.ServerData
+	Price    money.Paise
+	Discount money.Paise
+}
+
+// purchaseCandidates lists the servers selling the service ordered by
+// discounted price, skipping blocked and maintenance servers. preferred, when
+// set, is tried first.
+func purchaseCandidates(ctx context.Context, db *mongo.Database, serviceList models.ServerList, userId string, preferred int) ([]purchaseCandidate, error) {
+	numbers := []int{}
+	for _, s := range serviceList.Servers {
+		numbers = append(numbers, s.Server)
+	}
+	cursor, err := models.InitializeServerCollection(db).Find(ctx, bson.M{"server": bson.M{"$in": numbers}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch servers: %w", err)
+	}
+	var servers []models.Server
+	if err := cursor.All(ctx, &servers); err != nil {
+		return nil, fmt.Errorf("failed to decode servers: %w", err)
+	}
+	serverInfo := make(map[int]models.Server)
+	for _, s := range servers {
+		serverInfo[s.ServerNumber] = s
+	}
+
+	candidates := []purchaseCandidate{}
+	for _, s := range serviceList.Servers {
+		info, ok := serverInfo[s.Server]
+		if !ok || s.Block || info.Block || info.Maintenance {
+			continue
 		}
-		return NumberData{
-			Id:     id,
-			Number: number,
-		}, nil
-	case "2":
-		// Multiple OTP server with same url
-		number, id, err := serverscalc.ExtractNumberServer2(apiURLRequest.URL, apiURLRequest.Headers)
+		price, err := money.Parse(s.Price)
 		if err != nil {
-			return NumberData{}, fmt.Errorf("no stock")
+			continue
 		}
-		return NumberData{
-			Id:     id,
-			Number: number,
-		}, nil
-	case "3":
-		// Multiple OTP server with same url
-		id, number, err := serverscalc.ExtractNumberServerFromAccess(apiURLRequest.URL, apiURLRequest.Headers)
+		discount, err := FetchDiscount(ctx, db, userId, serviceList.Name, s.Server)
 		if err != nil {
-			return NumberData{}, fmt.Errorf("no stock")
+			return nil, err
 		}
-		return NumberData{
-			Id:     id,
-			Number: number,
-		}, nil
-	case "4":
-		// Single OTP server
-		id, number, err := serverscalc.ExtractNumberServerFromAccess(apiURLRequest.URL, apiURLRequest.Headers)
-		if err != nil {
-			return NumberData{}, fmt.Errorf("no stock")
+		candidates = append(candidates, purchaseCandidate{Info: info, Data: s, Price: price + discount, Discount: discount})
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if (candidates[i].Info.ServerNumber == preferred) != (candidates[j].Info.ServerNumber == preferred) {
+			return candidates[i].Info.ServerNumber == preferred
 		}
-		return NumberData{
-			Id:     id,
-			Number: number,
-		}, nil
-	case "5":
-		// Multiple OTP server with same url
-		id, number, err := serverscalc.ExtractNumberServerFromAccess(apiURLRequest.URL, apiURLRequest.Headers)
-		if err != nil {
-			return NumberData{}, fmt.Errorf("no stock")
+		return candidates[i].Price < candidates[j].Price
+	})
+	return candidates, nil
+}
+
+// buyFromCandidates buys from the first affordable candidate that returns a
+// number and reports every server tried. The candidate's price is held on the
+// wallet before the upstream call and released again if it fails; the hold of
+// the successful purchase is returned for the caller to capture.
+func buyFromCandidates(ctx context.Context, db *mongo.Database, userID primitive.ObjectID, candidates []purchaseCandidate, isMultiple string) (NumberData, purchaseCandidate, models.BalanceHold, []models.PurchaseAttempt, error) {
+	attempts := []models.PurchaseAttempt{}
+	lowBalance := false
+	for _, candidate := range candidates {
+		attempt := models.PurchaseAttempt{
+			Server: candidate.Info.ServerNumber,
+			Price:  candidate.Price.String(),
+			At:     time.Now(),
 		}
-		return NumberData{
-			Id:     id,
-			Number: number,
-		}, nil
-	case "6":
-		// Single OTP server
-		// Done
-		id, number, err := serverscalc.ExtractNumberServerFromAccess(apiURLRequest.URL, apiURLRequest.Headers)
-		if err != nil {
-			return NumberData{}, fmt.Errorf("no stock")
+		hold, err := ledger.Hold(ctx, db, userID, candidate.Price, "number on server "+strconv.Itoa(candidate.Info.ServerNumber))
+		if errors.Is(err, ledger.ErrInsufficientBalance) {
+			lowBalance = true
+			continue
 		}
-		return NumberData{
-			Id:     id,
-			Number: number,
-		}, nil
-	case "7":
-		// Multiple OTP server with same url
-		id, number, err := serverscalc.ExtractNumberServerFromAccess(apiURLRequest.URL, apiURLRequest.Headers)
 		if err != nil {
-			return NumberData{}, fmt.Errorf("no stock")
+			return NumberData{}, purchaseCandidate{}, models.BalanceHold{}, attempts, err
 		}
-		return NumberData{
-			Id:     id,
-			Number: number,
-		}, nil
-	case "8":
-		// Done
-		// Multiple OTP server with same url
-		id, number, err := serverscalc.ExtractNumberServerFromAccess(apiURLRequest.URL, apiURLRequest.Headers)
+		numData, err := buyWithHold(ctx, db, hold, candidate, isMultiple)
 		if err != nil {
-			return NumberData{}, fmt.Errorf("no stock")
+			attempt.Error = err.Error()
+			attempts = append(attempts, attempt)
+			continue
 		}
-		return NumberData{
-			Id:     id,
-			Number: number,
-		}, nil
-	case "9":
-		// Single OTP server
-		// Done
-		number, id, err := serverscalc.ExtractNumberServer9(apiURLRequest.URL, apiURLRequest.Headers)
+		attempts = append(attempts, attempt)
+		return numData, candidate, hold, attempts, nil
+	}
+	if lowBalance && len(attempts) == 0 {
+		return NumberData{}, purchaseCandidate{}, models.BalanceHold{}, attempts, ledger.ErrInsufficientBalance
+	}
+	logs.Logger.Infof("No stock after trying %+v", attempts)
+	return NumberData{}, purchaseCandidate{}, models.BalanceHold{}, attempts, fmt.Errorf("no stock")
+}
+
+// buyWithHold buys from the candidate and releases the hold when no number
+// comes back.
+func buyWithHold(ctx context.Context, db *mongo.Database, hold models.BalanceHold, candidate purchaseCandidate, isMultiple string) (NumberData, error) {
+	numData, err := func() (NumberData, error) {
+		provider, err := providers.New(candidate.Info)
 		if err != nil {
 			logs.Logger.Error(err)
-			return NumberData{}, fmt.Errorf("no stock")
+			return NumberData{}, err
 		}
-		return NumberData{
-			Id:     id,
-			Number: number,
-		}, nil
-	case "10":
-		// Single OTP server
-		id, number, err := serverscalc.ExtractNumberServerFromAccess(apiURLRequest.URL, apiURLRequest.Headers)
-		if err != nil {
-			logs.Logger.Error(err)
-			return NumberData{}, fmt.Errorf("no stock")
+		numData, err := buyNumber(provider, candidate.Data, isMultiple)
+		if err == nil && (numData.Id == "" || numData.Number == "") {
+			err = fmt.Errorf("no stock")
 		}
-		return NumberData{
-			Id:     id,
-			Number: number,
-		}, nil
-	case "11":
-		// Multiple OTP servers with different URLs
-		number, id, err := serverscalc.ExtractNumberServer11(apiURLRequest.URL)
-		if err != nil {
-			if strings.Contains(err.Error(), "no_channels") {
-				logs.Logger.Warn("No channels available. The channel limit has been reached.")
-				return NumberData{}, fmt.Errorf("no stock")
-			}
-			return NumberData{}, fmt.Errorf("no stock")
+		return numData, err
+	}()
+	if err != nil {
+		if releaseErr := ledger.Release(ctx, db, hold, err.Error()); releaseErr != nil {
+			logs.Logger.Error(releaseErr)
 		}
-		return NumberData{
-			Id:     id,
-			Number: number,
-		}, nil
+		return NumberData{}, err
+	}
+	return numData, nil
+}
+
+// buyNumber rents a number from the provider. Every upstream failure is
+// reported to the user as "no stock".
+func buyNumber(provider providers.Provider, serverData models.ServerData, isMultiple string) (NumberData, error) {
+	number, err := provider.BuyNumber(providers.BuyRequest{
+		Code:     serverData.Code,
+		Price:    serverData.Price,
+		Multiple: isMultiple == "true",
+	})
+	if err != nil {
+		logs.Logger.Error(err)
+		return NumberData{}, fmt.Errorf("no stock")
 	}
-	return NumberData{}, nil
+	return NumberData{
+		Id:     number.ID,
+		Number: number.Number,
+	}, nil
 }
-func FetchDiscount(ctx context.Context, db *mongo.Database, userId, sname string, server int) (float64, error) {
-	totalDiscount := 0.0
+
+func FetchDiscount(ctx context.Context, db *mongo.Database, userId, sname string, server int) (money.Paise, error) {
+	var totalDiscount money.Paise
 	userIdObject, _ := primitive.ObjectIDFromHex(userId)
 
 	// User-specific discount
@@ -431,7 +439,7 @@ func FetchDiscount(ctx context.Context, db *mongo.Database, userId, sname string
 		return 0, err
 	}
 
-	totalDiscount += round(userDiscount.Discount, 2)
+	totalDiscount += money.FromFloat(userDiscount.Discount)
 
 	// Service discount
 	serviceDiscountCollection := models.InitializeServiceDiscountCollection(db)
@@ -440,7 +448,7 @@ func FetchDiscount(ctx context.Context, db *mongo.Database, userId, sname string
 	if err != nil && err != mongo.ErrNoDocuments {
 		return 0, err
 	}
-	totalDiscount += round(serviceDiscount.Discount, 2)
+	totalDiscount += money.FromFloat(serviceDiscount.Discount)
 
 	serverDiscountCollection := models.InitializeServerDiscountCollection(db)
 	var serverDiscount models.ServerDiscount
@@ -449,16 +457,9 @@ func FetchDiscount(ctx context.Context, db *mongo.Database, userId, sname string
 		return 0, err
 	}
 	if err == nil {
-		totalDiscount += round(serverDiscount.Discount, 2)
+		totalDiscount += money.FromFloat(serverDiscount.Discount)
 	}
-	return round(totalDiscount, 2), nil
-}
-
-func round(val float64, precision int) float64 {
-	format := fmt.Sprintf("%%.%df", precision)
-	valStr := fmt.Sprintf(format, val)
-	result, _ := strconv.ParseFloat(valStr, 64)
-	return result
+	return totalDiscount, nil
 }
 
 func FormatDateTime() string {
@@ -497,12 +498,9 @@ func HandleGetOtp(c echo.Context) error {
 		return c.JSON(http.StatusOK, map[string]string{"error": "under maintenance"})
 	}
 
-	var apiWalletUser models.ApiWalletUser
-	apiWalletColl := models.InitializeApiWalletuserCollection(db)
-	err = apiWalletColl.FindOne(ctx, bson.M{"api_key": apiKey}).Decode(&apiWalletUser)
+	apiWalletUser, err := walletForKey(ctx, c, db, apiKey, apikeys.ScopeBuy)
 	if err != nil {
-		logs.Logger.Error(err)
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid api key"})
+		return apiKeyError(c, err)
 	}
 
 	var transaction models.TransactionHistory
@@ -512,7 +510,7 @@ func HandleGetOtp(c echo.Context) error {
 		logs.Logger.Error(err)
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
-	if transaction.Status == "CANCELLED" {
+	if orderstate.Current(transaction).Closed() {
 		return c.JSON(http.StatusOK, map[string]interface{}{
 			"status": "ok",
 			"otp":    "number cancelled",
@@ -535,41 +533,23 @@ func HandleGetOtp(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid server number"})
 	}
 
-	constructedOTPRequest, err := constructOtpUrl(server, serverData.APIKey, serverData.Token, id)
+	provider, err := providers.New(serverData)
 	if err != nil {
 		logs.Logger.Error(err)
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
 	}
 
-	validOtpList, err := fetchOTP(server, id, constructedOTPRequest)
-	if err != nil && err.Error() == "ACCESS_CANCEL" {
-		formattedData := FormatDateTime()
-
-		var transaction models.TransactionHistory
-		transactionCollection := models.InitializeTransactionHistoryCollection(db)
-		err = transactionCollection.FindOne(ctx, bson.M{"id": id, "server": server}).Decode(&transaction)
-		if err == mongo.ErrEmptySlice || err == mongo.ErrNoDocuments {
+	validOtpList, err := provider.GetStatus(id)
+	if errors.Is(err, providers.ErrCancelled) {
+		_, err = orderstate.Transition(ctx, transactionCollection, bson.M{"id": id, "server": server}, orderstate.Cancelled,
+			orderstate.ActorUpstream, "cancelled by server", bson.M{"$set": bson.M{"date_time": FormatDateTime()}})
+		if err == orderstate.ErrOrderNotFound {
 			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "invalid server number"})
 		}
-		if err != nil {
+		if err != nil && !errors.Is(err, orderstate.ErrIllegalTransition) {
 			logs.Logger.Error(err)
 			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "internal server error"})
 		}
-
-		if len(transaction.OTP) == 0 {
-			transactionUpdateFilter := bson.M{"id": id, "server": server}
-			transactionpdate := bson.M{
-				"$set": bson.M{
-					"status":    "CANCELLED",
-					"date_time": formattedData,
-				},
-			}
-			_, err = transactionCollection.UpdateOne(ctx, transactionUpdateFilter, transactionpdate)
-			if err != nil {
-				logs.Logger.Error(err)
-				return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
-			}
-		}
 	}
 
 	for _, validOtp := range validOtpList {
@@ -581,14 +561,14 @@ func HandleGetOtp(c echo.Context) error {
 			formattedDateTime := FormatDateTime()
 			update := bson.M{
 				"$addToSet": bson.M{"otp": validOtp},
-				"$set": bson.M{
-					"status":    "SUCCESS",
-					"date_time": formattedDateTime,
-				},
+				"$set":      bson.M{"date_time": formattedDateTime},
+			}
+			_, err = orderstate.Transition(ctx, transactionCollection, bson.M{"id": id, "server": server}, orderstate.SMSReceived,
+				orderstate.ActorUpstream, "otp received", update)
+			if errors.Is(err, orderstate.ErrIllegalTransition) {
+				logs.Logger.Warnf("Ignoring OTP for order %s: %v", id, err)
+				continue
 			}
-
-			filter := bson.M{"id": id}
-			_, err = transactionCollection.UpdateOne(ctx, filter, update)
 			if err != nil {
 				return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 			}
@@ -684,86 +664,23 @@ func triggerNextOtp(db *mongo.Database, server, serviceName, id string) error {
 		}
 	}
 
-	if foundServer.Otp == "Multiple Otp" {
-		switch serverNumber {
-		case 1:
-			secret, err := getApiKeyServer(db, serverNumber)
-			if err != nil {
-				return err
-			}
-			nextOtpUrl := fmt.Sprintf("https://fastsms.su/stubs/handler_api.php?api_key=%s&action=setStatus&id=%s&status=3", secret.ApiKeyServer, id)
-			headers := map[string]string{}
-			if err := serversnextotpcalc.CallNextOTPServerWaiting(nextOtpUrl, headers); err != nil {
-				return err
-			}
-		case 3:
-			secret, err := getApiKeyServer(db, serverNumber)
-			if err != nil {
-				return err
-			}
-			nextOtpUrl := fmt.Sprintf("https://smshub.org/stubs/handler_api.php?api_key=%s&action=setStatus&status=3&id=%s", secret.ApiKeyServer, id)
-			headers := map[string]string{}
-			if err := serversnextotpcalc.CallNextOTPServerRetry(nextOtpUrl, headers); err != nil {
-				return err
-			}
-		case 5:
-			secret, err := getApiKeyServer(db, serverNumber)
-			if err != nil {
-				return err
-			}
-			nextOtpUrl := fmt.Sprintf("https://api.grizzlysms.com/stubs/handler_api.php?api_key=%s&action=setStatus&status=3&id=%s", secret.ApiKeyServer, id)
-			headers := map[string]string{}
-			if err := serversnextotpcalc.CallNextOTPServerRetry(nextOtpUrl, headers); err != nil {
-				return err
-			}
-		case 7:
-			secret, err := getApiKeyServer(db, serverNumber)
-			if err != nil {
-				return err
-			}
-			nextOtpUrl := fmt.Sprintf("https://smsbower.online/stubs/handler_api.php?api_key=%s&action=setStatus&status=3&id=%s", secret.ApiKeyServer, id)
-			headers := map[string]string{}
-			if err := serversnextotpcalc.CallNextOTPServerRetry(nextOtpUrl, headers); err != nil {
-				return err
-			}
-		case 8:
-			secret, err := getApiKeyServer(db, serverNumber)
-			if err != nil {
-				return err
-			}
-			nextOtpUrl := fmt.Sprintf("https://api.sms-activate.io/stubs/handler_api.php?api_key=%s&action=setStatus&status=3&id=%s", secret.ApiKeyServer, id)
-			headers := map[string]string{}
-			if err := serversnextotpcalc.CallNextOTPServerRetry(nextOtpUrl, headers); err != nil {
-				return err
-			}
-		case 11:
-			secret, err := getApiKeyServer(db, serverNumber)
-			if err != nil {
-				return err
-			}
-			nextOtpUrl := fmt.Sprintf("https://api2.sms-man.com/control/set-status?token=%s&request_id=%s&status=retrysms", secret.Token, id)
-			headers := map[string]string{}
-			if err := serversnextotpcalc.CallNextOTPServerRetry(nextOtpUrl, headers); err != nil {
-				return err
-			}
-		}
+	if foundServer.Otp != "Multiple Otp" {
+		return nil
 	}
-	return nil
-}
 
-func getApiKeyServer(db *mongo.Database, serverNumber int) (ServerSecrets, error) {
-	logs.Logger.Info(serverNumber)
-	var server models.Server
-	serverCollection := models.InitializeServerCollection(db)
-	err := serverCollection.FindOne(context.TODO(), bson.M{"server": serverNumber}).Decode(&server)
+	serverInfo, err := getServerDataWithMaintenanceCheck(db, server)
 	if err != nil {
-		return ServerSecrets{}, fmt.Errorf("NO_SERVER_FOUND")
+		return err
 	}
-
-	return ServerSecrets{
-		ApiKeyServer: server.APIKey,
-		Token:        server.Token,
-	}, nil
+	provider, err := providers.New(serverInfo)
+	if err != nil {
+		return err
+	}
+	err = provider.RequestNextSMS(id)
+	if errors.Is(err, providers.ErrNotSupported) {
+		return nil
+	}
+	return err
 }
 
 func searchCodes(codes []string, db *mongo.Database) ([]string, error) {
@@ -799,7 +716,7 @@ func searchCodes(codes []string, db *mongo.Database) ([]string, error) {
 func HandleCancelOrder(c echo.Context) error {
 	db := c.Get("db").(*mongo.Database)
 	id := c.QueryParam("id")
-	userId := c.QueryParam("userId")
+	userId := auth.UserID(c)
 	if id == "" {
 		return c.JSON(http.StatusBadRequest, echo.Map{"error": "empty id"})
 	}
@@ -933,12 +850,9 @@ func HandleNumberCancel(c echo.Context) error {
 		return c.JSON(http.StatusOK, map[string]string{"error": "site is under maintenance"})
 	}
 
-	var apiWalletUser models.ApiWalletUser
-	apiWalletColl := models.InitializeApiWalletuserCollection(db)
-	err = apiWalletColl.FindOne(context.TODO(), bson.M{"api_key": apiKey}).Decode(&apiWalletUser)
-	if err != nil || err == mongo.ErrEmptySlice {
-		logs.Logger.Error(err)
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "invalid api key"})
+	apiWalletUser, err := walletForKey(context.TODO(), c, db, apiKey, apikeys.ScopeBuy)
+	if err != nil {
+		return apiKeyError(c, err)
 	}
 
 	var user models.User
@@ -1017,17 +931,30 @@ func HandleNumberCancel(c echo.Context) error {
 	if otpArrived == true {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "otp already come"})
 	}
-
-	constructedNumberRequest, err := ConstructNumberUrl(server, serverData.APIKey, serverData.Token, id, existingOrder.Number)
+	// An order the upstream already cancelled only needs its refund.
+	state := orderstate.Current(transactionData)
+	if state != orderstate.Cancelled && !orderstate.CanTransition(state, orderstate.Cancelled) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "number already cancelled"})
+	}
+	// Check the refund can be computed before anything is cancelled.
+	price, err := money.Parse(transactionData.Price)
 	if err != nil {
-		logs.Logger.Error(err)
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		logs.Logger.Errorf("invalid price %q on transaction %s: %v", transactionData.Price, id, err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "invalid order price"})
 	}
 
-	err = CancelNumberThirdParty(constructedNumberRequest.URL, server, id, db, constructedNumberRequest.Headers)
-	if err != nil {
-		logs.Logger.Error(err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	if state != orderstate.Cancelled {
+		provider, err := providers.New(serverData)
+		if err != nil {
+			logs.Logger.Error(err)
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+
+		err = provider.Cancel(id, existingOrder.Number)
+		if err != nil {
+			logs.Logger.Error(err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
 	}
 
 	formattedData := FormatDateTime()
@@ -1040,13 +967,7 @@ func HandleNumberCancel(c echo.Context) error {
 
 	logs.Logger.Infof("handled request %+v", id)
 
-	price, err := strconv.ParseFloat(transaction.Price, 64)
-	if err != nil {
-		logs.Logger.Error(err)
-	}
-	newBalance := apiWalletUser.Balance + price
-	newBalance = math.Round(newBalance*100) / 100
-	price = math.Round(price*100) / 100
+	newBalance := apiWalletUser.Amount() + price
 
 	session, err := db.Client().StartSession()
 	if err != nil {
@@ -1055,39 +976,43 @@ func HandleNumberCancel(c echo.Context) error {
 	}
 	defer session.EndSession(context.Background())
 
-	_, err = session.WithTransaction(context.Background(), func(sc mongo.SessionContext) (interface{}, error) {
-		balanceUpdate := bson.M{
-			"$inc": bson.M{"balance": price},
-		}
-		balanceFilter := bson.M{"userId": apiWalletUser.UserID}
-		balanceResult, err := apiWalletColl.UpdateOne(sc, balanceFilter, balanceUpdate)
-		if err != nil {
+	refunded, err := session.WithTransaction(context.Background(), func(sc mongo.SessionContext) (interface{}, error) {
+		transactionFilter := bson.M{"id": id, "server": server}
+		_, err := orderstate.Transition(sc, transactionCollection, transactionFilter, orderstate.Cancelled,
+			orderstate.ActorUser, "cancelled by user", bson.M{"$set": bson.M{"date_time": formattedData}})
+		if err != nil && !errors.Is(err, orderstate.ErrIllegalTransition) {
 			return nil, err
 		}
-		if balanceResult.ModifiedCount == 0 {
-			return nil, errors.New("balance update failed, no document modified")
+		_, err = orderstate.Transition(sc, transactionCollection, transactionFilter, orderstate.Refunded,
+			orderstate.ActorUser, "refund on cancel", nil)
+		if errors.Is(err, orderstate.ErrIllegalTransition) {
+			// Already refunded by the expiry scheduler.
+			return false, nil
 		}
-
-		transactionUpdateFilter := bson.M{"id": id, "server": server}
-		transactionUpdate := bson.M{
-			"$set": bson.M{
-				"status":    "CANCELLED",
-				"date_time": formattedData,
-			},
-		}
-		transactionResult, err := transactionCollection.UpdateOne(sc, transactionUpdateFilter, transactionUpdate)
 		if err != nil {
 			return nil, err
 		}
-		if transactionResult.ModifiedCount == 0 {
-			return nil, errors.New("transaction status update failed, no document modified")
-		}
-		return nil, nil
+
+		_, err = ledger.Post(sc, db, ledger.Posting{
+			UserID:           apiWalletUser.UserID,
+			Kind:             ledger.KindRefund,
+			Amount:           price,
+			SourceCollection: "transactionhistories",
+			SourceID:         transaction.ID.Hex(),
+			Note:             "refund on cancel",
+		})
+		return err == nil, err
 	})
 	if err != nil {
 		logs.Logger.Error("Transaction failed:", err)
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
+	if !refunded.(bool) {
+		if _, err := orderCollection.DeleteOne(context.TODO(), bson.M{"numberId": id}); err != nil {
+			logs.Logger.Error(err)
+		}
+		return c.JSON(http.StatusOK, map[string]string{"status": "success"})
+	}
 
 	logs.Logger.Info("Transaction completed successfully")
 	_, err = orderCollection.DeleteOne(context.TODO(), bson.M{"numberId": id})
@@ -1106,7 +1031,7 @@ func HandleNumberCancel(c echo.Context) error {
 		ServiceCode: serverDataInfo.Code,
 		Price:       transaction.Price,
 		Server:      transaction.Server,
-		Balance:     fmt.Sprintf("%.2f", newBalance),
+		Balance:     newBalance.String(),
 		Number:      transaction.Number,
 		IP:          ipDetail,
 	}
@@ -1118,133 +1043,6 @@ func HandleNumberCancel(c echo.Context) error {
 	return c.JSON(http.StatusOK, map[string]string{"status": "success"})
 }
 
-func CancelNumberThirdParty(apiURL, server, id string, db *mongo.Database, headers map[string]string) error {
-	logs.Logger.Infof("Number Cancel URL: %s", apiURL)
-	client := &http.Client{}
-
-	req, err := http.NewRequest("GET", apiURL, nil)
-	if err != nil {
-		return fmt.Errorf("failed to create API request: %w", err)
-	}
-	for key, value := range headers {
-		req.Header.Set(key, value)
-	}
-	resp, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to fetch API: %w", err)
-	}
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to read response body: %w", err)
-	}
-	responseData := string(body)
-	logs.Logger.Infof("Number Cancel Response %+v", responseData)
-
-	if strings.TrimSpace(responseData) == "" {
-		return errors.New("RECEIVED_EMTPY_RESPONSE_FROM_THIRD_PARTY_SERVER")
-	}
-
-	switch server {
-	case "1":
-		if strings.HasPrefix(responseData, "ACCESS_CANCEL") {
-			return nil
-		} else if strings.HasPrefix(responseData, "ACCESS_APPROVED") {
-			return nil
-		} else if strings.HasPrefix(responseData, "ACCESS_CANCEL_ALREADY") {
-			return nil
-		} else if strings.HasPrefix(responseData, "STATUS_CANCEL") {
-			return nil
-		}
-		return errors.New(fmt.Sprintf("NUMBER_REQUEST_FAILED_FOR_THIRD_PARTY_SERVER_%s", server))
-
-	case "2":
-		if strings.Contains(responseData, "order has sms") {
-			return nil
-		} else if strings.Contains(responseData, "order not found") {
-			return nil
-		}
-		var responseDataJSON map[string]interface{}
-		err = json.Unmarshal(body, &responseDataJSON)
-		if err != nil {
-			return fmt.Errorf("failed to parse JSON response: %w", err)
-		}
-		if responseDataJSON["status"] == "CANCELED" {
-			return nil
-		}
-		return errors.New(fmt.Sprintf("NUMBER_REQUEST_FAILED_FROM_THIRD_PARTY_SERVER_%s", server))
-
-	case "3":
-		if strings.HasPrefix(responseData, "ACCESS_CANCEL") || strings.HasPrefix(responseData, "ALREADY_CANCELLED") ||
-			strings.HasPrefix(responseData, "ACCESS_ACTIVATION") {
-			return nil
-		} else {
-			return errors.New(fmt.Sprintf("NUMBER_REQUEST_FAILED_FOR_THIRD_PARTY_SERVER_%s", server))
-		}
-	case "4":
-		if strings.HasPrefix(responseData, "ACCESS_CANCEL") {
-			return nil
-		} else if strings.HasPrefix(responseData, "EARLY_CANCEL_DENIED") {
-			return errors.New("EARLY_CANCEL_DENIED")
-		} else if strings.HasPrefix(responseData, "BAD_STATUS") {
-			return errors.New("BAD_STATUS")
-		}
-		return errors.New(fmt.Sprintf("NUMBER_REQUEST_FAILED_FROM_THIRD_PARTY_SERVER_%s", server))
-	case "5":
-		if strings.HasPrefix(responseData, "ACCESS_CANCEL") {
-			return nil
-		} else if strings.HasPrefix(responseData, "BAD_ACTION") {
-			return errors.New("BAD_ACTION")
-		}
-		return errors.New(fmt.Sprintf("NUMBER_REQUEST_FAILED_FROM_THIRD_PARTY_SERVER_%s", server))
-	case "6":
-		if strings.HasPrefix(responseData, "ACCESS_CANCEL") {
-			return nil
-		} else if strings.HasPrefix(responseData, "NO_ACTIVATION") {
-			return errors.New("NO_ACTIVATION")
-		}
-		return errors.New(fmt.Sprintf("NUMBER_REQUEST_FAILED_FOR_THIRD_PARTY_SERVER_%s", server))
-	case "8":
-		if strings.HasPrefix(responseData, "ACCESS_CANCEL") {
-			return nil
-		} else if strings.HasPrefix(responseData, "BAD_STATUS") {
-			return errors.New("BAD_STATUS")
-		}
-		return errors.New(fmt.Sprintf("NUMBER_REQUEST_FAILED_FOR_THIRD_PARTY_SERVER_%s", server))
-	case "7":
-		if strings.HasPrefix(responseData, "ACCESS_CANCEL") {
-			return nil
-		} else if strings.HasPrefix(responseData, "BAD_STATUS") {
-			return errors.New("BAD_STATUS")
-		}
-		return errors.New(fmt.Sprintf("NUMBER_REQUEST_FAILED_FOR_THIRD_PARTY_SERVER_%s", server))
-	case "9":
-		if strings.HasPrefix(responseData, "success") {
-			return nil
-		}
-		return errors.New(fmt.Sprintf("NUMBER_REQUEST_FAILED_FOR_THIRD_PARTY_SERVER_%s", server))
-	case "10":
-		if strings.HasPrefix(responseData, "ACCESS_CANCEL") {
-			return nil
-		}
-		return errors.New(fmt.Sprintf("NUMBER_REQUEST_FAILED_FOR_THIRD_PARTY_SERVER_%s", server))
-	case "11":
-		var responseDataJSON map[string]interface{}
-		err = json.Unmarshal(body, &responseDataJSON)
-		if err != nil {
-			return fmt.Errorf("failed to parse JSON response: %w", err)
-		}
-		if success, ok := responseDataJSON["success"].(bool); ok && success {
-			return nil
-		} else if responseDataJSON["error_code"] == "change_status" {
-			return nil
-		}
-		return errors.New(fmt.Sprintf("NUMBER_REQUEST_FAILED_FOR_THIRD_PARTY_SERVER_%s", server))
-	default:
-		return errors.New("INVALID_SERVER_VALUE")
-	}
-}
-
 func getServerDataWithMaintenanceCheck(db *mongo.Database, server string) (models.Server, error) {
 	serverNumber, _ := strconv.Atoi(server)
 	var serverData models.Server
@@ -1260,38 +1058,3 @@ func getServerDataWithMaintenanceCheck(db *mongo.Database, server string) (model
 	}
 	return serverData, nil
 }
-
-func fetchOTP(server, id string, otpRequest ApiRequest) ([]string, error) {
-	otpData := []string{}
-	switch server {
-	case "1", "3", "4", "5", "6", "7", "8", "10":
-		otp, err := serversotpcalc.GetOTPServer1(otpRequest.URL, otpRequest.Headers, id)
-		if err != nil && err.Error() == "ACCESS_CANCEL" {
-			logs.Logger.Error(err)
-			return otpData, err
-		}
-		otpData = append(otpData, otp...)
-	case "2":
-		otp, err := serversotpcalc.GetSMSTextsServer2(otpRequest.URL, id, otpRequest.Headers)
-		if err != nil {
-			return otpData, err
-		}
-		otpData = append(otpData, otp...)
-	case "9":
-		otp, err := serversotpcalc.FetchTokenAndOTP(otpRequest.URL, id, otpRequest.Headers)
-		if err != nil {
-			return otpData, err
-		}
-		otpData = append(otpData, otp...)
-	case "11":
-		otp, err := serversotpcalc.GetOTPServer11(otpRequest.URL, id)
-		if err != nil {
-			return otpData, err
-		}
-		otpData = append(otpData, otp...)
-
-	default:
-		return otpData, fmt.Errorf("INVALID_SERVER_CHOICE")
-	}
-	return otpData, nil
-}
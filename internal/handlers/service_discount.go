@@ -11,6 +11,7 @@ import (
 	"strings"
 
 	"github.com/labstack/echo/v4"
+	"github.com/ranjankuldeep/fakeNumber/internal/audit"
 	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -66,6 +67,8 @@ func AddServiceDiscount(c echo.Context) error {
 	filter := bson.M{"service": input.Service, "server": serverNumber}
 	var existingService models.ServiceDiscount
 	err = servicedDiscountCollection.FindOne(context.TODO(), filter).Decode(&existingService)
+	audit.SetTarget(c, "service-discount", fmt.Sprintf("%s:%d", input.Service, serverNumber))
+	audit.SetAfter(c, bson.M{"discount": discount})
 
 	if err == mongo.ErrNoDocuments {
 		// Add new discount
@@ -83,6 +86,7 @@ func AddServiceDiscount(c echo.Context) error {
 	} else if err == nil {
 		// Update existing discount
 		log.Println("INFO: Updating existing service discount")
+		audit.SetBefore(c, bson.M{"discount": existingService.Discount})
 		update := bson.M{"$set": bson.M{"discount": discount}}
 		_, err = servicedDiscountCollection.UpdateOne(context.TODO(), filter, update)
 		if err != nil {
@@ -202,20 +206,20 @@ func DeleteServiceDiscount(c echo.Context) error {
 	log.Printf("DEBUG: Filter being used for deletion: %+v\n", filter)
 
 	// Perform the delete operation
-	result, err := servicedDiscountCollection.DeleteOne(context.TODO(), filter)
-	if err != nil {
-		log.Println("ERROR: Failed to delete service discount:", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete service discount."})
-	}
-
-	// Check if a document was deleted
-	if result.DeletedCount == 0 {
+	var previous bson.M
+	err = servicedDiscountCollection.FindOneAndDelete(context.TODO(), filter).Decode(&previous)
+	if err == mongo.ErrNoDocuments {
 		log.Println("INFO: No document found to delete with the given filter")
 		return c.JSON(http.StatusNotFound, map[string]string{"error": "Service discount not found."})
+	} else if err != nil {
+		log.Println("ERROR: Failed to delete service discount:", err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete service discount."})
 	}
+	audit.SetTarget(c, "service-discount", fmt.Sprintf("%s:%d", service, serverNumber))
+	audit.SetBefore(c, discountSnapshot(previous))
 
 	// Log the successful deletion
-	log.Printf("INFO: Successfully deleted document. Deleted count: %d\n", result.DeletedCount)
+	log.Println("INFO: Successfully deleted service discount")
 
 	// Return success response
 	return c.JSON(http.StatusOK, map[string]string{"message": "Service discount deleted successfully."})
@@ -0,0 +1,385 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/base64"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/ranjankuldeep/fakeNumber/internal/auth"
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/internal/totp"
+	"github.com/ranjankuldeep/fakeNumber/logs"
+	qrcode "github.com/skip2/go-qrcode"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	defaultTOTPIssuer = "FakeNumber"
+	recoveryCodeCount = 10
+)
+
+type twoFactorRequest struct {
+	Code string `json:"code"`
+}
+
+func totpIssuer() string {
+	if issuer := os.Getenv("TOTP_ISSUER"); issuer != "" {
+		return issuer
+	}
+	return defaultTOTPIssuer
+}
+
+// generateRecoveryCodes returns fresh recovery codes, formatted for the user,
+// and the hashes to store.
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		buf := make([]byte, 5)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, err
+		}
+		code := base32.StdEncoding.EncodeToString(buf)
+		codes[i] = code[:4] + "-" + code[4:]
+		hashes[i] = hashRecoveryCode(code)
+	}
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode ignores case, dashes and spaces so that codes can be typed
+// loosely.
+func hashRecoveryCode(code string) string {
+	code = strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+	return hashOTP(code)
+}
+
+// verifySecondFactor accepts a current TOTP code or an unused recovery code
+// and consumes it, so that neither can be replayed.
+func verifySecondFactor(ctx context.Context, userCol *mongo.Collection, user models.User, code string) (bool, error) {
+	if step, ok := totp.Validate(user.TOTPSecret, code, time.Now()); ok {
+		res, err := userCol.UpdateOne(ctx,
+			bson.M{"_id": user.ID, "totpLastStep": bson.M{"$not": bson.M{"$gte": step}}},
+			bson.M{"$set": bson.M{"totpLastStep": step}},
+		)
+		if err != nil {
+			return false, err
+		}
+		return res.ModifiedCount == 1, nil
+	}
+	hash := hashRecoveryCode(code)
+	res, err := userCol.UpdateOne(ctx,
+		bson.M{"_id": user.ID, "recoveryCodes": hash},
+		bson.M{"$pull": bson.M{"recoveryCodes": hash}},
+	)
+	if err != nil {
+		return false, err
+	}
+	if res.ModifiedCount == 1 {
+		logs.Logger.Infof("Recovery code used by user %s", user.ID.Hex())
+	}
+	return res.ModifiedCount == 1, nil
+}
+
+// twoFactorChallenge ends the first login step for users with two-factor
+// enabled. The client sends the challenge back to LoginTwoFactor with a code.
+func twoFactorChallenge(c echo.Context, user models.User, loginType string) error {
+	challenge, err := auth.IssueChallenge(user, loginType)
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to generate token"})
+	}
+	return c.JSON(http.StatusOK, echo.Map{"twoFactorRequired": true, "challenge": challenge})
+}
+
+// currentUser loads the authenticated caller.
+func currentUser(ctx context.Context, userCol *mongo.Collection, c echo.Context) (models.User, error) {
+	var user models.User
+	userID, err := primitive.ObjectIDFromHex(auth.UserID(c))
+	if err != nil {
+		return user, err
+	}
+	err = userCol.FindOne(ctx, bson.M{"_id": userID}).Decode(&user)
+	return user, err
+}
+
+// SetupTwoFactor starts TOTP enrolment: it generates a secret and returns it
+// with the provisioning URI and a QR code for authenticator apps. Nothing
+// changes for the user until EnableTwoFactor confirms a code.
+func SetupTwoFactor(c echo.Context) error {
+	db := c.Get("db").(*mongo.Database)
+	userCol := models.InitializeUserCollection(db)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	user, err := currentUser(ctx, userCol, c)
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "User not found"})
+	}
+	if user.TOTPEnabled {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Two-factor authentication is already enabled"})
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to generate secret"})
+	}
+	uri := totp.URI(totpIssuer(), user.Email, secret)
+	png, err := qrcode.Encode(uri, qrcode.Medium, 256)
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to generate QR code"})
+	}
+	_, err = userCol.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": bson.M{"totpPendingSecret": secret}})
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to start two-factor setup"})
+	}
+	return c.JSON(http.StatusOK, echo.Map{
+		"secret": secret,
+		"uri":    uri,
+		"qr":     "data:image/png;base64," + base64.StdEncoding.EncodeToString(png),
+	})
+}
+
+// EnableTwoFactor confirms enrolment with a code from the app. It returns
+// the recovery codes, which are not shown again, and a token that counts as a
+// two-factor login.
+func EnableTwoFactor(c echo.Context) error {
+	db := c.Get("db").(*mongo.Database)
+	userCol := models.InitializeUserCollection(db)
+
+	var request twoFactorRequest
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid request body"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	user, err := currentUser(ctx, userCol, c)
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "User not found"})
+	}
+	if user.TOTPEnabled {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Two-factor authentication is already enabled"})
+	}
+	if user.TOTPPendingSecret == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Start two-factor setup first"})
+	}
+	step, ok := totp.Validate(user.TOTPPendingSecret, request.Code, time.Now())
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Invalid code"})
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to generate recovery codes"})
+	}
+	_, err = userCol.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{
+		"$set": bson.M{
+			"totpEnabled":   true,
+			"totpSecret":    user.TOTPPendingSecret,
+			"totpLastStep":  step,
+			"recoveryCodes": hashes,
+			"updatedAt":     time.Now(),
+		},
+		"$unset": bson.M{"totpPendingSecret": ""},
+	})
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to enable two-factor authentication"})
+	}
+
+	claims := auth.CurrentClaims(c)
+	token, err := auth.IssueTwoFactorToken(user, claims.LoginType, claims.TRXAddress)
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to generate token"})
+	}
+	logs.Logger.Infof("Two-factor authentication enabled for user %s", user.ID.Hex())
+	return c.JSON(http.StatusOK, echo.Map{
+		"message":       "Two-factor authentication enabled",
+		"recoveryCodes": codes,
+		"token":         token,
+	})
+}
+
+// DisableTwoFactor turns two-factor off after checking a code. Staff must
+// keep it on. Wrong codes count towards the login lockout.
+func DisableTwoFactor(c echo.Context) error {
+	db := c.Get("db").(*mongo.Database)
+	userCol := models.InitializeUserCollection(db)
+
+	var request twoFactorRequest
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid request body"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	user, err := currentUser(ctx, userCol, c)
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "User not found"})
+	}
+	if !user.TOTPEnabled {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Two-factor authentication is not enabled"})
+	}
+	if user.Role != "" {
+		return c.JSON(http.StatusForbidden, echo.Map{"error": "Staff accounts must keep two-factor authentication enabled"})
+	}
+	if time.Now().Before(user.LockedUntil) {
+		return c.JSON(http.StatusTooManyRequests, echo.Map{"error": "Too many failed attempts, try again later"})
+	}
+	ok, err := verifySecondFactor(ctx, userCol, user, request.Code)
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Internal server error"})
+	}
+	if !ok {
+		if err := recordFailedLogin(ctx, userCol, user.ID); err != nil {
+			logs.Logger.Error(err)
+		}
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Invalid code"})
+	}
+
+	_, err = userCol.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{
+		"$unset": bson.M{"totpEnabled": "", "totpSecret": "", "totpLastStep": "", "recoveryCodes": "", "failedLogins": ""},
+		"$set":   bson.M{"updatedAt": time.Now()},
+	})
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to disable two-factor authentication"})
+	}
+	logs.Logger.Infof("Two-factor authentication disabled for user %s", user.ID.Hex())
+	return c.JSON(http.StatusOK, echo.Map{"message": "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes after checking a code.
+// Wrong codes count towards the login lockout.
+func RegenerateRecoveryCodes(c echo.Context) error {
+	db := c.Get("db").(*mongo.Database)
+	userCol := models.InitializeUserCollection(db)
+
+	var request twoFactorRequest
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid request body"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	user, err := currentUser(ctx, userCol, c)
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "User not found"})
+	}
+	if !user.TOTPEnabled {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Two-factor authentication is not enabled"})
+	}
+	if time.Now().Before(user.LockedUntil) {
+		return c.JSON(http.StatusTooManyRequests, echo.Map{"error": "Too many failed attempts, try again later"})
+	}
+	ok, err := verifySecondFactor(ctx, userCol, user, request.Code)
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Internal server error"})
+	}
+	if !ok {
+		if err := recordFailedLogin(ctx, userCol, user.ID); err != nil {
+			logs.Logger.Error(err)
+		}
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Invalid code"})
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to generate recovery codes"})
+	}
+	_, err = userCol.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{
+		"$set":   bson.M{"recoveryCodes": hashes, "updatedAt": time.Now()},
+		"$unset": bson.M{"failedLogins": ""},
+	})
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to save recovery codes"})
+	}
+	return c.JSON(http.StatusOK, echo.Map{"recoveryCodes": codes})
+}
+
+// LoginTwoFactor is the second login step. It exchanges the challenge from
+// Login or GoogleLogin and a TOTP or recovery code for a token. Wrong codes
+// count towards the same lockout as wrong passwords.
+func LoginTwoFactor(c echo.Context) error {
+	db := c.Get("db").(*mongo.Database)
+	userCol := models.InitializeUserCollection(db)
+
+	var request struct {
+		Challenge string `json:"challenge"`
+		Code      string `json:"code"`
+	}
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid request body"})
+	}
+	claims, err := auth.ParseChallenge(request.Challenge)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Invalid or expired challenge, please log in again"})
+	}
+	userID, _ := primitive.ObjectIDFromHex(claims.UserID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var user models.User
+	err = userCol.FindOne(ctx, bson.M{"_id": userID}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "User not found"})
+	} else if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Internal server error"})
+	}
+	if time.Now().Before(user.LockedUntil) {
+		return c.JSON(http.StatusTooManyRequests, echo.Map{"error": "Too many failed attempts, try again later"})
+	}
+	if !user.TOTPEnabled {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Two-factor authentication is not enabled"})
+	}
+
+	ok, err := verifySecondFactor(ctx, userCol, user, request.Code)
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Internal server error"})
+	}
+	if !ok {
+		if err := recordFailedLogin(ctx, userCol, user.ID); err != nil {
+			logs.Logger.Error(err)
+		}
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Invalid code"})
+	}
+	if _, err := userCol.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$unset": bson.M{"failedLogins": "", "lockedUntil": ""}}); err != nil {
+		logs.Logger.Error(err)
+	}
+
+	var wallet models.ApiWalletUser
+	err = models.InitializeApiWalletuserCollection(db).FindOne(ctx, bson.M{"userId": user.ID}).Decode(&wallet)
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to fetch wallet details"})
+	}
+	token, err := auth.IssueTwoFactorToken(user, claims.LoginType, wallet.TRXAddress)
+	if err != nil {
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to generate token"})
+	}
+	return c.JSON(http.StatusOK, echo.Map{"token": token})
+}
@@ -8,6 +8,7 @@ import (
 	"strconv"
 
 	"github.com/labstack/echo/v4"
+	"github.com/ranjankuldeep/fakeNumber/internal/audit"
 	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
 	"github.com/ranjankuldeep/fakeNumber/logs"
 	"go.mongodb.org/mongo-driver/bson"
@@ -41,11 +42,15 @@ func AddUserDiscount(c echo.Context) error {
 	filter := bson.M{"userId": user.ID, "service": req.Service, "server": req.Server}
 	update := bson.M{"$set": bson.M{"discount": req.Discount}}
 
-	upsertOpts := options.Update().SetUpsert(true)
-	_, err := userDiscountCollection.UpdateOne(context.Background(), filter, update, upsertOpts)
-	if err != nil {
+	upsertOpts := options.FindOneAndUpdate().SetUpsert(true)
+	var previous bson.M
+	err := userDiscountCollection.FindOneAndUpdate(context.Background(), filter, update, upsertOpts).Decode(&previous)
+	if err != nil && err != mongo.ErrNoDocuments {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Error updating discount"})
 	}
+	audit.SetTarget(c, "user", user.ID.Hex())
+	audit.SetBefore(c, userDiscountSnapshot(req.Service, req.Server, previous))
+	audit.SetAfter(c, userDiscountSnapshot(req.Service, req.Server, bson.M{"discount": req.Discount}))
 	return c.JSON(http.StatusOK, map[string]string{"message": "Discount added/updated successfully"})
 }
 
@@ -104,10 +109,13 @@ func DeleteUserDiscount(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid User ID"})
 	}
 
-	result, err := userDiscountCollection.DeleteOne(context.Background(), bson.M{"userId": objectId, "service": service, "server": server})
-	if err != nil || result.DeletedCount == 0 {
+	var previous bson.M
+	err = userDiscountCollection.FindOneAndDelete(context.Background(), bson.M{"userId": objectId, "service": service, "server": server}).Decode(&previous)
+	if err != nil {
 		return c.JSON(http.StatusNotFound, map[string]string{"error": "User discount not found"})
 	}
+	audit.SetTarget(c, "user", userID)
+	audit.SetBefore(c, userDiscountSnapshot(service, server, previous))
 	return c.JSON(http.StatusOK, map[string]string{"message": "User discount deleted successfully"})
 }
 
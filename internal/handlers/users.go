@@ -2,7 +2,6 @@ package handlers
 
 import (
 	"context"
-	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
@@ -10,18 +9,18 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
-	"math/big"
 
 	"net/http"
 	"os"
 	"strings"
 	"time"
 
-	"gopkg.in/gomail.v2"
-
-	"github.com/golang-jwt/jwt"
 	"github.com/labstack/echo/v4"
+	"github.com/ranjankuldeep/fakeNumber/internal/audit"
+	"github.com/ranjankuldeep/fakeNumber/internal/auth"
 	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/internal/mail"
+	"github.com/ranjankuldeep/fakeNumber/internal/otp"
 	"github.com/ranjankuldeep/fakeNumber/internal/services"
 	"github.com/ranjankuldeep/fakeNumber/internal/utils"
 	"github.com/ranjankuldeep/fakeNumber/logs"
@@ -113,19 +112,6 @@ func verifyCaptcha(captcha string) error {
 	return nil
 }
 
-// Function to generate OTP (stubbed here for simplicity)
-func generateOTP() (string, error) {
-	var otp string
-	for i := 0; i < 6; i++ { // Generate 6 random digits
-		num, err := rand.Int(rand.Reader, big.NewInt(10)) // Random number in range [0, 9]
-		if err != nil {
-			return "", errors.New("failed to generate a secure random number")
-		}
-		otp += num.String()
-	}
-	return otp, nil
-}
-
 // Handler function for signup
 func SignUp(c echo.Context) error {
 	db := c.Get("db").(*mongo.Database)
@@ -168,33 +154,16 @@ func SignUp(c echo.Context) error {
 	}
 	log.Println("INFO: CAPTCHA verification successful")
 
-	// Generate and send OTP
-	log.Println("INFO: Generating OTP")
-	otp, err := generateOTP()
-	if err != nil {
-		log.Println("ERROR: Failed to generate OTP:", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to generate OTP"})
-	}
-
-	log.Printf("INFO: Generated OTP: %s\n", otp)
-
+	// Issue and send the OTP
 	log.Println("INFO: Sending OTP to email")
-	otpText := "Your OTP for registration is"
-	subText := "OTP verification"
-	if err := sendOTPByEmail(req.Email, otp, otpText, subText); err != nil {
-		log.Println("ERROR: Failed to send OTP via email:", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to send OTP"})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := sendOTP(ctx, db, otp.PurposeSignup, req.Email, mail.TemplateSignupOTP); err != nil {
+		log.Println("ERROR: Failed to send OTP:", err)
+		return otpError(c, err)
 	}
 	log.Println("INFO: OTP sent successfully")
 
-	// Store OTP for the user in the database
-	log.Println("INFO: Storing OTP in the database")
-	if err := storeOTP(db, req.Email, otp); err != nil {
-		log.Println("ERROR: Failed to store OTP:", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to store OTP"})
-	}
-	log.Println("INFO: OTP stored successfully")
-
 	// Respond with success
 	log.Println("INFO: Returning success response")
 	return c.JSON(http.StatusOK, echo.Map{
@@ -211,83 +180,41 @@ func findUserByEmail(email string) (interface{}, error) {
 	return nil, nil
 }
 
-// Replace with actual email sending logic
-func sendOTPByEmail(email, otp, text, subject string) error {
-	// SMTP credentials
-	smtpHost := "smtp.gmail.com"
-	smtpPort := 587
-
-	smtpUser := os.Getenv("SMTP_USER")
-	smtpPass := os.Getenv("SMTP_PASS") // Replace with your email password or app-specific password
-
-	// Create a new email message
-	message := gomail.NewMessage()
-	message.SetHeader("From", smtpUser)
-	message.SetHeader("To", email)
-	message.SetHeader("Subject", subject)
-	message.SetBody("text/plain", text+": "+otp)
-	dialer := gomail.NewDialer(smtpHost, smtpPort, smtpUser, smtpPass)
-
-	log.Printf("INFO: Sending email to %s with subject: %s\n", email, subject)
-	if err := dialer.DialAndSend(message); err != nil {
-		log.Printf("ERROR: Failed to send email: %v\n", err)
-		return err
-	}
-	log.Println("INFO: Email sent successfully")
-	return nil
-}
-
-type OTP struct {
-	Email     string    `bson:"email"`
-	HashedOTP string    `bson:"otp"`
-	ExpiresAt time.Time `bson:"expiresAt"`
-}
-
-const OTPExpirationTime = 5 * time.Minute
-
 func hashOTP(otp string) string {
 	hash := sha256.Sum256([]byte(otp))
 	return hex.EncodeToString(hash[:])
 }
 
-func storeOTP(db *mongo.Database, email string, otp string) error {
-	otpCollection := models.InitializeOTPCollection(db)
-	hashedOTP := hashOTP(otp)
-	filter := bson.M{"email": email}
-
-	// New OTP document to insert or update
-	update := bson.M{
-		"$set": bson.M{
-			"email":     email,
-			"otp":       otp,
-			"hashedOTP": hashedOTP,
-			"expiresAt": time.Now().Add(5 * time.Minute), // Adjust expiration time as needed
-		},
-	}
-
-	// Upsert the document: update if it exists, insert if it doesn't
-	opts := options.Update().SetUpsert(true)
-	_, err := otpCollection.UpdateOne(context.Background(), filter, update, opts)
+// sendOTP issues a code for purpose and emails it. The code is discarded if
+// the email can neither be sent nor queued, so that the user can ask again
+// straight away.
+func sendOTP(ctx context.Context, db *mongo.Database, purpose otp.Purpose, email string, template mail.Template) error {
+	code, err := otp.Issue(ctx, db, purpose, email)
 	if err != nil {
-		log.Println("ERROR: Failed to upsert OTP:", err)
 		return err
 	}
-
-	// Set a timeout to delete the OTP after expiration
-	go func() {
-		time.Sleep(5 * time.Minute) // Adjust timeout duration as needed
-		_, err := otpCollection.DeleteOne(context.Background(), bson.M{"email": email})
-		if err != nil {
-			log.Printf("ERROR: Failed to delete expired OTP for email %s: %v", email, err)
-		} else {
-			log.Printf("INFO: OTP deleted after expiration for email: %s", email)
+	data := mail.OTPData{Code: code, Minutes: int(otp.CodeTTL / time.Minute)}
+	if err := mail.Deliver(ctx, db, email, template, data); err != nil {
+		if err := otp.Discard(ctx, db, purpose, email); err != nil {
+			log.Println("ERROR: Failed to discard unsent OTP:", err)
 		}
-	}()
-
-	log.Printf("INFO: OTP successfully stored or updated for email: %s", email)
+		return err
+	}
 	return nil
 }
 
+// otpError writes the response for a failed otp call.
+func otpError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, otp.ErrCooldown), errors.Is(err, otp.ErrTooManyAttempts):
+		return c.JSON(http.StatusTooManyRequests, echo.Map{"error": err.Error()})
+	case errors.Is(err, otp.ErrNotFound), errors.Is(err, otp.ErrInvalid), errors.Is(err, otp.ErrNotVerified):
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+	log.Println("ERROR: OTP failure:", err)
+	return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to send OTP"})
+}
+
 func GoogleSignup(c echo.Context) error {
 	db := c.Get("db").(*mongo.Database)
 	type RequestBody struct {
@@ -327,9 +254,7 @@ func GoogleSignup(c echo.Context) error {
 			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create user"})
 		}
 
-		// Generate API key and wallet
-		apiKey := generateAPIKey()
-
+		// Create the wallet. API keys are created by the user afterwards.
 		trxPrivateKey, trxAddress, err := services.GenerateTronAddress()
 		if err != nil {
 			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to generate TRON wallet"})
@@ -337,10 +262,11 @@ func GoogleSignup(c echo.Context) error {
 
 		apiWallet := models.ApiWalletUser{
 			UserID:        newUser.ID,
-			APIKey:        apiKey,
 			Balance:       0,
 			TRXAddress:    trxAddress,
 			TRXPrivateKey: trxPrivateKey,
+			CreatedAt:     now,
+			UpdatedAt:     now,
 		}
 
 		apiWalletColl := models.InitializeApiWalletuserCollection(db)
@@ -349,7 +275,11 @@ func GoogleSignup(c echo.Context) error {
 			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to create wallet"})
 		}
 
-		token := generateJWT(newUser.Email, newUser.ID.Hex(), "google", trxAddress)
+		token, err := auth.IssueToken(newUser, "google", trxAddress)
+		if err != nil {
+			logs.Logger.Error(err)
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to generate token"})
+		}
 		return c.JSON(http.StatusOK, map[string]string{"token": token})
 	}
 
@@ -397,18 +327,11 @@ func Login(c echo.Context) error {
 	userCol := db.Collection("users")
 	walletCol := db.Collection("apikey_and_balances")
 
-	// Define a struct to represent user data
-	type LoginUser struct {
-		ID       string `bson:"_id"`
-		Email    string `bson:"email"`
-		Password string `bson:"password"`
-	}
-
 	// Find the user by email
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	var loginUser LoginUser
+	var loginUser models.User
 	err = userCol.FindOne(ctx, bson.M{"email": req.Email}).Decode(&loginUser)
 	if err == mongo.ErrNoDocuments {
 		log.Println("ERROR: User not found")
@@ -418,9 +341,41 @@ func Login(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
 	}
 
-	if loginUser.Password != req.Password {
+	if time.Now().Before(loginUser.LockedUntil) {
+		log.Println("ERROR: Login attempt on locked account")
+		return c.JSON(http.StatusTooManyRequests, map[string]string{"error": "Too many failed attempts, try again later"})
+	}
+
+	ok, rehash := utils.CheckPassword(loginUser.Password, req.Password)
+	if !ok {
 		log.Println("ERROR: Invalid credentials")
-		c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid credentials"})
+		if err := recordFailedLogin(ctx, userCol, loginUser.ID); err != nil {
+			log.Println("ERROR: Failed to record failed login:", err)
+		}
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid credentials"})
+	}
+
+	// Reset the failure count and upgrade plaintext or weaker hashes. With
+	// two-factor on, the count is only reset once the code is verified too.
+	loginUpdate := bson.M{}
+	if !loginUser.TOTPEnabled {
+		loginUpdate["$unset"] = bson.M{"failedLogins": "", "lockedUntil": ""}
+	}
+	if rehash {
+		hashed, err := utils.HashPassword(req.Password)
+		if err != nil {
+			log.Println("ERROR: Failed to hash password:", err)
+		} else {
+			loginUpdate["$set"] = bson.M{"password": hashed}
+		}
+	}
+	if len(loginUpdate) > 0 {
+		if _, err := userCol.UpdateOne(ctx, bson.M{"_id": loginUser.ID}, loginUpdate); err != nil {
+			log.Println("ERROR: Failed to update user after login:", err)
+		}
+	}
+	if loginUser.TOTPEnabled {
+		return twoFactorChallenge(c, loginUser, "password")
 	}
 
 	// Fetch the wallet information
@@ -430,8 +385,7 @@ func Login(c echo.Context) error {
 	}
 
 	var wallet WalletUser
-	userID, err := primitive.ObjectIDFromHex(loginUser.ID)
-	err = walletCol.FindOne(ctx, bson.M{"userId": userID}).Decode(&wallet)
+	err = walletCol.FindOne(ctx, bson.M{"userId": loginUser.ID}).Decode(&wallet)
 	if err == mongo.ErrNoDocuments {
 		log.Println("ERROR: Wallet not found for user:", err)
 		return c.JSON(http.StatusNotFound, map[string]string{"error": "Wallet not found"})
@@ -441,15 +395,7 @@ func Login(c echo.Context) error {
 	}
 
 	// Generate JWT token
-	jwtSecret := os.Getenv("JWT_SECRET_KEY")
-	claims := jwt.MapClaims{
-		"email":      loginUser.Email,
-		"userId":     loginUser.ID,
-		"trxAddress": wallet.TrxAddress,
-		"exp":        time.Now().Add(7 * 24 * time.Hour).Unix(),
-	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(jwtSecret))
+	tokenString, err := auth.IssueToken(loginUser, "password", wallet.TrxAddress)
 	if err != nil {
 		log.Println("ERROR: Failed to generate JWT token:", err)
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to generate token"})
@@ -459,6 +405,34 @@ func Login(c echo.Context) error {
 	return c.JSON(http.StatusOK, map[string]string{"token": tokenString})
 }
 
+// Login lockout policy.
+const (
+	maxFailedLogins = 5
+	loginLockout    = 15 * time.Minute
+)
+
+// recordFailedLogin counts a failed password and locks the account for
+// loginLockout once maxFailedLogins is reached.
+func recordFailedLogin(ctx context.Context, userCol *mongo.Collection, userID primitive.ObjectID) error {
+	var user models.User
+	err := userCol.FindOneAndUpdate(ctx,
+		bson.M{"_id": userID},
+		bson.M{"$inc": bson.M{"failedLogins": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&user)
+	if err != nil {
+		return err
+	}
+	if user.FailedLogins < maxFailedLogins {
+		return nil
+	}
+	_, err = userCol.UpdateOne(ctx, bson.M{"_id": userID}, bson.M{
+		"$set":   bson.M{"lockedUntil": time.Now().Add(loginLockout)},
+		"$unset": bson.M{"failedLogins": ""},
+	})
+	return err
+}
+
 func GoogleLogin(c echo.Context) error {
 	db := c.Get("db").(*mongo.Database)
 	type RequestBody struct {
@@ -487,6 +461,9 @@ func GoogleLogin(c echo.Context) error {
 		logs.Logger.Error(err)
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "User not found, Please register."})
 	}
+	if user.TOTPEnabled {
+		return twoFactorChallenge(c, user, "google")
+	}
 
 	// Fetch wallet details
 	apiWalletColl := models.InitializeApiWalletuserCollection(db)
@@ -498,42 +475,12 @@ func GoogleLogin(c echo.Context) error {
 	}
 
 	// Generate JWT token
-	token := generateJWT(user.Email, user.ID.Hex(), "google", apiWallet.TRXAddress)
-	return c.JSON(http.StatusOK, map[string]string{"token": token})
-}
-
-// todo replace with env file
-// JWT Secret Key
-var jwtSecretKey = []byte("your_secret_key") // Replace with your secret key
-
-// Claims defines the structure of the JWT claims
-type Claims struct {
-	Email      string `json:"email"`
-	UserID     string `json:"userId"`
-	LoginType  string `json:"logintype"`
-	TRXAddress string `json:"trxAddress"`
-	jwt.StandardClaims
-}
-
-// Generate a JWT token
-func generateJWT(email, userID, loginType, trxAddress string) string {
-	claims := &Claims{
-		Email:      email,
-		UserID:     userID,
-		LoginType:  loginType,
-		TRXAddress: trxAddress,
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(7 * 24 * time.Hour).Unix(),
-		},
-	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signedToken, err := token.SignedString(jwtSecretKey)
+	token, err := auth.IssueToken(user, "google", apiWallet.TRXAddress)
 	if err != nil {
-		fmt.Println("Error generating JWT:", err)
-		return ""
+		logs.Logger.Error(err)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to generate token"})
 	}
-	return signedToken
+	return c.JSON(http.StatusOK, map[string]string{"token": token})
 }
 
 // Fetch Google user profile using access token
@@ -563,17 +510,6 @@ func fetchGoogleUserProfile(token string) (map[string]interface{}, error) {
 	return profile, nil
 }
 
-// Generate a random API key
-func generateAPIKey() string {
-	bytes := make([]byte, 16)
-	_, err := rand.Read(bytes)
-	if err != nil {
-		fmt.Println("Error generating API key:", err)
-		return ""
-	}
-	return hex.EncodeToString(bytes)
-}
-
 // ForgotPasswordRequest represents the request body for forgot password
 type ForgotPasswordRequest struct {
 	Email string `json:"email"`
@@ -583,7 +519,6 @@ type ForgotPasswordRequest struct {
 func ForgotPassword(c echo.Context) error {
 	db := c.Get("db").(*mongo.Database)
 	userCol := models.InitializeUserCollection(db)
-	otpCol := models.InitializeForgotOTPCollection(db)
 
 	var request ForgotPasswordRequest
 	if err := c.Bind(&request); err != nil {
@@ -600,7 +535,7 @@ func ForgotPassword(c echo.Context) error {
 	defer cancel()
 
 	var user bson.M
-	err := userCol.FindOne(ctx, bson.M{"email": email}).Decode(&user)
+	err := userCol.FindOne(ctx, bson.M{"email": email}, options.FindOne().SetProjection(userSecretFields)).Decode(&user)
 	if err == mongo.ErrNoDocuments {
 		return c.JSON(http.StatusBadRequest, echo.Map{
 			"error": "User does not exist. Please sign up for an account.",
@@ -609,32 +544,9 @@ func ForgotPassword(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Database error"})
 	}
 
-	// Generate a new OTP
-	newOtp, err := generateOTP()
-	if err != nil {
-		log.Println("ERROR: Failed to generate OTP:", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to generate OTP"})
-	}
-	otpText := "Your OTP for Changing Password is"
-	subText := "Forgot Password OTP verification"
-
-	// Send OTP via email
-	sendOtpResult := sendOTPByEmail(email, newOtp, otpText, subText)
-	if sendOtpResult != nil { // Check if there was an error
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to send OTP"})
-	}
-
-	// Store OTP in the database
-	otpData := models.OTP{
-		ID:        primitive.NewObjectID(),
-		Email:     email,
-		OTP:       newOtp,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
-	}
-	_, err = otpCol.InsertOne(ctx, otpData)
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to store OTP"})
+	// Issue and send the OTP
+	if err := sendOTP(ctx, db, otp.PurposeForgotPassword, email, mail.TemplatePasswordReset); err != nil {
+		return otpError(c, err)
 	}
 
 	return c.JSON(http.StatusOK, echo.Map{
@@ -644,17 +556,6 @@ func ForgotPassword(c echo.Context) error {
 	})
 }
 
-func GenerateSecureOTP() string {
-	bytes := make([]byte, 3) // 3 bytes for a 6-digit number
-	_, err := rand.Read(bytes)
-	if err != nil {
-		fmt.Println("Error generating secure OTP:", err)
-		return ""
-	}
-	otp := int(bytes[0])<<16 + int(bytes[1])<<8 + int(bytes[2])
-	return fmt.Sprintf("%06d", otp%1000000)
-}
-
 // ResendForgotOTPRequest represents the request body for resending OTP
 type ResendForgotOTPRequest struct {
 	Email string `json:"email"`
@@ -664,7 +565,6 @@ type ResendForgotOTPRequest struct {
 func ResendForgotOTP(c echo.Context) error {
 	db := c.Get("db").(*mongo.Database)
 	userCol := models.InitializeUserCollection(db)
-	otpCol := models.InitializeOTPCollection(db)
 
 	var request ResendForgotOTPRequest
 	if err := c.Bind(&request); err != nil {
@@ -681,35 +581,16 @@ func ResendForgotOTP(c echo.Context) error {
 	defer cancel()
 
 	var user bson.M
-	err := userCol.FindOne(ctx, bson.M{"email": email}).Decode(&user)
+	err := userCol.FindOne(ctx, bson.M{"email": email}, options.FindOne().SetProjection(userSecretFields)).Decode(&user)
 	if err == mongo.ErrNoDocuments {
 		return c.JSON(http.StatusBadRequest, echo.Map{"error": "User does not exist"})
 	} else if err != nil {
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Database error"})
 	}
 
-	// Generate a new OTP
-	newOtp := GenerateSecureOTP() // Ensure you have a GenerateOTP function
-	otpText := "Your new OTP for Changing Password is"
-	subText := "Forgot Password OTP verification"
-
-	// Send the new OTP via email
-	if err := sendOTPByEmail(email, newOtp, otpText, subText); err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to send OTP"})
-	}
-
-	// Update the OTP in the database
-	filter := bson.M{"email": email}
-	update := bson.M{
-		"$set": bson.M{
-			"otp": newOtp,
-			"ttl": time.Now().Add(15 * time.Minute), // Update TTL for new OTP
-		},
-	}
-
-	_, err = otpCol.UpdateOne(ctx, filter, update)
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to update OTP in database"})
+	// Issue and send a new OTP, replacing the previous one
+	if err := sendOTP(ctx, db, otp.PurposeForgotPassword, email, mail.TemplatePasswordReset); err != nil {
+		return otpError(c, err)
 	}
 
 	return c.JSON(http.StatusOK, echo.Map{
@@ -725,44 +606,25 @@ type ForgotVerifyOTPRequest struct {
 	OTP   string `json:"otp"`
 }
 
-// ForgotVerifyOTP handles the OTP verification process
+// ForgotVerifyOTP checks a password reset OTP. The password can then be
+// changed with ChangePasswordUnauthenticated.
 func ForgotVerifyOTP(c echo.Context) error {
 	db := c.Get("db").(*mongo.Database)
-	otpCol := models.InitializeForgotOTPCollection(db) // Ensure this collection corresponds to where OTPs are stored
 
 	var request ForgotVerifyOTPRequest
 	if err := c.Bind(&request); err != nil {
 		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid request body"})
 	}
 
-	email := request.Email
-	otp := request.OTP
-
-	if email == "" || otp == "" {
+	if request.Email == "" || request.OTP == "" {
 		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Email and OTP are required"})
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	// Find the OTP document for the provided email
-	var otpDoc bson.M
-	err := otpCol.FindOne(ctx, bson.M{"email": email}).Decode(&otpDoc)
-	if err == mongo.ErrNoDocuments {
-		return c.JSON(http.StatusBadRequest, echo.Map{"error": "No OTP sent"})
-	} else if err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Database error"})
-	}
-
-	// Retrieve the stored OTP from the document
-	storedOTP, ok := otpDoc["otp"].(string)
-	if !ok {
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Invalid OTP data format"})
-	}
-
-	// Compare the provided OTP with the stored OTP
-	if storedOTP != otp {
-		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid OTP"})
+	if err := otp.Verify(ctx, db, otp.PurposeForgotPassword, request.Email, request.OTP); err != nil {
+		return otpError(c, err)
 	}
 
 	// OTP verified successfully
@@ -782,7 +644,6 @@ type ChangePasswordUnauthenticatedRequest struct {
 func ChangePasswordUnauthenticated(c echo.Context) error {
 	db := c.Get("db").(*mongo.Database)
 	userCol := models.InitializeUserCollection(db)
-	otpCol := models.InitializeForgotOTPCollection(db)
 
 	var request ChangePasswordUnauthenticatedRequest
 	if err := c.Bind(&request); err != nil {
@@ -795,24 +656,27 @@ func ChangePasswordUnauthenticated(c echo.Context) error {
 	if email == "" || password == "" {
 		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Email and password are required"})
 	}
+	if err := utils.ValidatePasswordStrength(password, email); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+	hashedPassword, err := utils.HashPassword(password)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to update password"})
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	var otpDoc bson.M
-	err := otpCol.FindOne(ctx, bson.M{"email": email}).Decode(&otpDoc)
-	if err == mongo.ErrNoDocuments {
-		return c.JSON(http.StatusBadRequest, echo.Map{"error": "OTP not verified"})
-	} else if err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Database error"})
+	// The OTP must have been verified with ForgotVerifyOTP; redeeming it
+	// here means it cannot be used twice.
+	if err := otp.Consume(ctx, db, otp.PurposeForgotPassword, email); err != nil {
+		return otpError(c, err)
 	}
 
-	_, err = otpCol.DeleteOne(ctx, bson.M{"email": email})
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to delete OTP document"})
+	update := bson.M{
+		"$set":   bson.M{"password": hashedPassword},
+		"$unset": bson.M{"failedLogins": "", "lockedUntil": ""},
 	}
-
-	update := bson.M{"$set": bson.M{"password": string(password)}}
 	_, err = userCol.UpdateOne(ctx, bson.M{"email": email}, update)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to update password"})
@@ -828,7 +692,6 @@ func ChangePasswordUnauthenticated(c echo.Context) error {
 type ChangePasswordAuthenticatedRequest struct {
 	CurrentPassword string `json:"currentPassword"`
 	NewPassword     string `json:"newPassword"`
-	UserID          string `json:"userId"`
 	Captcha         string `json:"captcha"`
 }
 
@@ -858,14 +721,13 @@ func ChangePasswordAuthenticated(c echo.Context) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	// Convert UserID to ObjectId
-	userID, err := primitive.ObjectIDFromHex(request.UserID)
+	userID, err := primitive.ObjectIDFromHex(auth.UserID(c))
 	if err != nil {
 		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid UserID format"})
 	}
 
 	// Find the user by UserID
-	var user bson.M
+	var user models.User
 	err = userCol.FindOne(ctx, bson.M{"_id": userID}).Decode(&user)
 	if err == mongo.ErrNoDocuments {
 		return c.JSON(http.StatusNotFound, echo.Map{"error": "User not found"})
@@ -873,12 +735,18 @@ func ChangePasswordAuthenticated(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Database error"})
 	}
 
-	currentPassword := user["password"].(string)
-	if currentPassword != request.CurrentPassword {
+	if ok, _ := utils.CheckPassword(user.Password, request.CurrentPassword); !ok {
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "current password doesn't match"})
 	}
+	if err := utils.ValidatePasswordStrength(request.NewPassword, user.Email); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+	hashedPassword, err := utils.HashPassword(request.NewPassword)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to update password"})
+	}
 
-	_, err = userCol.UpdateOne(ctx, bson.M{"_id": userID}, bson.M{"$set": bson.M{"password": request.NewPassword}})
+	_, err = userCol.UpdateOne(ctx, bson.M{"_id": userID}, bson.M{"$set": bson.M{"password": hashedPassword}})
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to update password"})
 	}
@@ -922,6 +790,15 @@ func GetUserBalance(userID string, walletCol *mongo.Collection) (float64, error)
 	return wallet.Balance, nil
 }
 
+// userSecretFields projects out the fields that must never leave the server.
+var userSecretFields = bson.M{
+	"password":          0,
+	"totpSecret":        0,
+	"totpPendingSecret": 0,
+	"totpLastStep":      0,
+	"recoveryCodes":     0,
+}
+
 // GetAllUsers retrieves all users and includes their balances
 func GetAllUsers(c echo.Context) error {
 	db := c.Get("db").(*mongo.Database)
@@ -933,10 +810,8 @@ func GetAllUsers(c echo.Context) error {
 
 	// Define the filter to fetch all users
 	filter := bson.M{}
-	projection := bson.M{"password": 0} // Exclude the password field
-
-	// Set the find options to include the projection
-	findOptions := options.Find().SetProjection(projection)
+	// Set the find options to exclude secrets
+	findOptions := options.Find().SetProjection(userSecretFields)
 
 	cursor, err := userCol.Find(ctx, filter, findOptions)
 	if err != nil {
@@ -980,10 +855,9 @@ func GetUser(c echo.Context) error {
 	userCol := db.Collection("users")
 	walletCol := db.Collection("apikey_and_balances")
 
-	// Retrieve userId from query parameters
-	userId := c.QueryParam("userId")
-	if userId == "" {
-		return c.JSON(http.StatusBadRequest, echo.Map{"error": "userId is required"})
+	userId, err := auth.SubjectID(c)
+	if err != nil {
+		return subjectError(c, err)
 	}
 
 	objID, err := primitive.ObjectIDFromHex(userId)
@@ -995,7 +869,7 @@ func GetUser(c echo.Context) error {
 	defer cancel()
 
 	var user bson.M
-	err = userCol.FindOne(ctx, bson.M{"_id": objID}).Decode(&user)
+	err = userCol.FindOne(ctx, bson.M{"_id": objID}, options.FindOne().SetProjection(userSecretFields)).Decode(&user)
 	if err == mongo.ErrNoDocuments {
 		return c.JSON(http.StatusNotFound, echo.Map{"error": "User not found"})
 	} else if err != nil {
@@ -1017,15 +891,13 @@ func GetUser(c echo.Context) error {
 		userDataWithWallet["balance"] = 0.0
 	}
 
-	if apiKey, ok := wallet["api_key"]; ok {
-		userDataWithWallet["api_key"] = apiKey
-	}
-
 	if trxAddress, ok := wallet["trxAddress"]; ok {
 		userDataWithWallet["trxAddress"] = trxAddress
 	}
 
-	if trxPrivateKey, ok := wallet["trxPrivateKey"]; ok {
+	// The deposit key is only ever shown to its owner, never to staff
+	// looking the user up.
+	if trxPrivateKey, ok := wallet["trxPrivateKey"]; ok && userId == auth.UserID(c) {
 		userDataWithWallet["trxPrivateKey"] = trxPrivateKey
 	}
 	return c.JSON(http.StatusOK, userDataWithWallet)
@@ -1058,7 +930,7 @@ func BlockUnblockUser(c echo.Context) error {
 
 	// Check if the user exists
 	var user bson.M
-	err = userCol.FindOne(ctx, bson.M{"_id": objID}).Decode(&user)
+	err = userCol.FindOne(ctx, bson.M{"_id": objID}, options.FindOne().SetProjection(userSecretFields)).Decode(&user)
 	if err == mongo.ErrNoDocuments {
 		return c.JSON(http.StatusNotFound, echo.Map{"error": "User not found"})
 	} else if err != nil {
@@ -1070,6 +942,13 @@ func BlockUnblockUser(c echo.Context) error {
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to update user status"})
 	}
+	audit.SetTarget(c, "user", body.UserID)
+	audit.SetBefore(c, bson.M{"blocked": user["blocked"]})
+	audit.SetAfter(c, bson.M{"blocked": body.Blocked})
+	if wasBlocked, _ := user["blocked"].(bool); body.Blocked && !wasBlocked {
+		reason, _ := user["blocked_reason"].(string)
+		mailUser(db, objID, mail.TemplateAccountBlocked, mail.AccountBlockedData{Reason: reason})
+	}
 
 	return c.JSON(http.StatusOK, echo.Map{
 		"status":  "SUCCESS",
@@ -1082,10 +961,9 @@ func BlockedUser(c echo.Context) error {
 	db := c.Get("db").(*mongo.Database)
 	userCol := db.Collection("users")
 
-	// Get userId from query parameters
-	userId := c.QueryParam("userId")
-	if userId == "" {
-		return c.JSON(http.StatusBadRequest, echo.Map{"error": "userId is required"})
+	userId, err := auth.SubjectID(c)
+	if err != nil {
+		return subjectError(c, err)
 	}
 
 	// Validate the userId format
@@ -1099,7 +977,7 @@ func BlockedUser(c echo.Context) error {
 
 	// Find the user by ID
 	var user bson.M
-	err = userCol.FindOne(ctx, bson.M{"_id": objID}).Decode(&user)
+	err = userCol.FindOne(ctx, bson.M{"_id": objID}, options.FindOne().SetProjection(userSecretFields)).Decode(&user)
 	if err == mongo.ErrNoDocuments {
 		return c.JSON(http.StatusNotFound, echo.Map{"error": "User not found"})
 	} else if err != nil {
@@ -1138,7 +1016,7 @@ func GetAllBlockedUsers(c echo.Context) error {
 	defer cancel()
 
 	// Query for all users with "blocked" set to true
-	cursor, err := userCol.Find(ctx, bson.M{"blocked": true})
+	cursor, err := userCol.Find(ctx, bson.M{"blocked": true}, options.Find().SetProjection(userSecretFields))
 	if err != nil {
 		log.Println("ERROR: Error querying blocked users:", err)
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Internal server error"})
@@ -1173,9 +1051,9 @@ func GetOrdersByUserId(c echo.Context) error {
 	db := c.Get("db").(*mongo.Database)
 	orderCol := models.InitializeOrderCollection(db)
 
-	userId := c.QueryParam("userId")
-	if userId == "" {
-		return c.JSON(http.StatusBadRequest, echo.Map{"message": "userId is required"})
+	userId, err := auth.SubjectID(c)
+	if err != nil {
+		return subjectError(c, err)
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -1216,7 +1094,6 @@ func GetOrdersByUserId(c echo.Context) error {
 func VerifyOTP(c echo.Context) error {
 	db := c.Get("db").(*mongo.Database)
 	userCol := models.InitializeUserCollection(db)
-	otpCol := models.InitializeOTPCollection(db)
 	apiWalletCol := models.InitializeApiWalletuserCollection(db)
 
 	type RequestBody struct {
@@ -1242,34 +1119,32 @@ func VerifyOTP(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Database error"})
 	}
 
-	// Find the OTP document
-	var otpDoc bson.M
-	err = otpCol.FindOne(ctx, bson.M{"email": body.Email}).Decode(&otpDoc)
-	if err == mongo.ErrNoDocuments {
-		return c.JSON(http.StatusBadRequest, echo.Map{"error": "OTP not found or expired"})
-	} else if err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Database error"})
+	// Reject the password before the code is used up
+	if body.Email == "" || body.Password == "" {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Email and password are required"})
+	}
+	if err := utils.ValidatePasswordStrength(body.Password, body.Email); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
 	}
 
-	// Validate the OTP
-	storedHashedOTP := otpDoc["hashedOTP"].(string) // OTP hash stored in the database
-	inputHashedOTP := hashOTP(body.OTP)             // Hash the provided OTP using the same function
-	if storedHashedOTP != inputHashedOTP {
-		log.Printf("ERROR: Invalid OTP provided. Provided Hash: %s, Stored Hash: %s\n", inputHashedOTP, storedHashedOTP)
-		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid OTP"})
+	// Check the OTP and redeem it
+	if err := otp.Verify(ctx, db, otp.PurposeSignup, body.Email, body.OTP); err != nil {
+		return otpError(c, err)
+	}
+	if err := otp.Consume(ctx, db, otp.PurposeSignup, body.Email); err != nil {
+		return otpError(c, err)
 	}
 
-	// Delete the OTP document after validation
-	_, err = otpCol.DeleteOne(ctx, bson.M{"email": body.Email})
+	hashedPassword, err := utils.HashPassword(body.Password)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to delete OTP"})
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to register user"})
 	}
 
 	// Create a new user
 	newUser := models.User{
 		ID:        primitive.NewObjectID(),
 		Email:     body.Email,
-		Password:  body.Password,
+		Password:  hashedPassword,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
@@ -1279,8 +1154,7 @@ func VerifyOTP(c echo.Context) error {
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to register user"})
 	}
 
-	// Generate API key and TRON wallet
-	apiKey := generateAPIKey()
+	// Generate the TRON wallet. API keys are created by the user afterwards.
 	trxPrivateKey, trxAddress, err := services.GenerateTronAddress()
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to generate TRON wallet"})
@@ -1289,10 +1163,11 @@ func VerifyOTP(c echo.Context) error {
 	// Create a new API wallet entry
 	apiWallet := models.ApiWalletUser{
 		UserID:        newUser.ID,
-		APIKey:        apiKey,
 		Balance:       0,
 		TRXAddress:    trxAddress,
 		TRXPrivateKey: trxPrivateKey,
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
 	}
 	_, err = apiWalletCol.InsertOne(ctx, apiWallet)
 	if err != nil {
@@ -1332,18 +1207,11 @@ func ResendOTP(c echo.Context) error {
 	// 	return c.JSON(http.StatusBadRequest, map[string]string{"error": "Unable to Fetch user details"})
 	// }
 
-	newOtp := utils.GenerateOTP()
-	otpText := "Your new OTP for registration is"
-	subText := "OTP verification"
-	if err := sendOTPByEmail(email, newOtp, otpText, subText); err != nil {
-		log.Printf("Error sending OTP: %v\n", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to send OTP"})
-	}
-
-	err := storeOTP(db, email, newOtp)
-	if err != nil {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := sendOTP(ctx, db, otp.PurposeSignup, email, mail.TemplateSignupOTP); err != nil {
 		logs.Logger.Error(err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to send OTP"})
+		return otpError(c, err)
 	}
 
 	return c.JSON(http.StatusOK, map[string]interface{}{
@@ -0,0 +1,249 @@
+// Package idempotency lets clients retry purchase and recharge requests
+// safely. A request carrying an Idempotency-Key header (or client_order_id
+// query parameter) runs once; retries with the same key get the stored
+// response back instead of running the handler again.
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/ranjankuldeep/fakeNumber/internal/auth"
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/logs"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	HeaderKey = "Idempotency-Key"
+	QueryKey  = "client_order_id"
+
+	statusInProgress = "in_progress"
+	statusCompleted  = "completed"
+
+	// retention is how long a key is remembered.
+	retention = 24 * time.Hour
+	// lockTimeout lets a retry take over a key whose first request died
+	// without storing a response.
+	lockTimeout = 2 * time.Minute
+)
+
+// committedKey marks a request whose handler has made its side effects.
+const committedKey = "idempotency.committed"
+
+// Committed tells the middleware that the handler has charged or credited
+// the caller. From then on the response is stored even if it is an error, so
+// a retry cannot repeat the side effect.
+func Committed(c echo.Context) {
+	c.Set(committedKey, true)
+}
+
+// Middleware makes the route idempotent for requests that carry a key. Keys
+// are scoped to the route and the caller's apikey or login. Reusing a key
+// with different parameters is rejected, as is a retry that arrives while the
+// first request is still running. 5xx responses of requests that failed
+// before being Committed are not stored so that the request can be retried.
+func Middleware() echo.MiddlewareFunc {
+	return middleware(func(c echo.Context) store {
+		return mongoStore{models.InitializeIdempotencyCollection(c.Get("db").(*mongo.Database))}
+	})
+}
+
+func middleware(storeFor func(echo.Context) store) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			key := c.Request().Header.Get(HeaderKey)
+			if key == "" {
+				key = c.QueryParam(QueryKey)
+			}
+			if key == "" {
+				return next(c)
+			}
+			records := storeFor(c)
+			ctx := c.Request().Context()
+
+			id := recordID(c, key)
+			fingerprint := requestFingerprint(c)
+			record, claimed, err := claim(ctx, records, id, fingerprint)
+			if err != nil {
+				logs.Logger.Error(err)
+				return c.JSON(http.StatusInternalServerError, echo.Map{"error": "internal server error"})
+			}
+			if !claimed {
+				if record.Fingerprint != fingerprint {
+					return c.JSON(http.StatusUnprocessableEntity, echo.Map{"error": "idempotency key reused with different parameters"})
+				}
+				if record.Status != statusCompleted {
+					return c.JSON(http.StatusConflict, echo.Map{"error": "request with this idempotency key is in progress"})
+				}
+				c.Response().Header().Set("Idempotent-Replayed", "true")
+				return c.Blob(record.StatusCode, record.ContentType, record.Body)
+			}
+
+			recorder := &responseRecorder{ResponseWriter: c.Response().Writer}
+			c.Response().Writer = recorder
+			handlerErr := next(c)
+			if handlerErr != nil {
+				c.Error(handlerErr)
+			}
+
+			// Store the outcome even if the client has gone away.
+			storeCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			statusCode := c.Response().Status
+			committed, _ := c.Get(committedKey).(bool)
+			if shouldStore(statusCode, committed) {
+				err = records.complete(storeCtx, id, statusCode, c.Response().Header().Get(echo.HeaderContentType), recorder.body.Bytes())
+			} else {
+				err = records.remove(storeCtx, id)
+			}
+			if err != nil {
+				logs.Logger.Error(err)
+			}
+			return nil
+		}
+	}
+}
+
+// shouldStore reports whether a response is kept for replay. Server errors
+// are forgotten so that the request can be retried, unless the handler had
+// already made its side effects.
+func shouldStore(statusCode int, committed bool) bool {
+	return statusCode < http.StatusInternalServerError || committed
+}
+
+// claim inserts an in-progress record for the key, or takes over one whose
+// lock has lapsed. Otherwise it returns the existing record.
+func claim(ctx context.Context, records store, id, fingerprint string) (models.IdempotencyRecord, bool, error) {
+	now := time.Now()
+	record := models.IdempotencyRecord{
+		ID:          id,
+		Fingerprint: fingerprint,
+		Status:      statusInProgress,
+		LockedUntil: now.Add(lockTimeout),
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(retention),
+	}
+	inserted, err := records.insert(ctx, record)
+	if err != nil {
+		return models.IdempotencyRecord{}, false, err
+	}
+	if inserted {
+		return record, true, nil
+	}
+
+	tookOver, err := records.takeOver(ctx, id, fingerprint, now, now.Add(lockTimeout))
+	if err != nil {
+		return models.IdempotencyRecord{}, false, err
+	}
+	if tookOver {
+		return record, true, nil
+	}
+
+	existing, err := records.find(ctx, id)
+	if err != nil {
+		return models.IdempotencyRecord{}, false, err
+	}
+	return existing, false, nil
+}
+
+// store keeps idempotency records.
+type store interface {
+	// insert adds record unless its key is already taken.
+	insert(ctx context.Context, record models.IdempotencyRecord) (bool, error)
+	// takeOver relocks an in-progress record for the same request whose lock
+	// lapsed before now.
+	takeOver(ctx context.Context, id, fingerprint string, now, lockedUntil time.Time) (bool, error)
+	find(ctx context.Context, id string) (models.IdempotencyRecord, error)
+	// complete stores the response of the request.
+	complete(ctx context.Context, id string, statusCode int, contentType string, body []byte) error
+	remove(ctx context.Context, id string) error
+}
+
+type mongoStore struct {
+	col *mongo.Collection
+}
+
+func (s mongoStore) insert(ctx context.Context, record models.IdempotencyRecord) (bool, error) {
+	_, err := s.col.InsertOne(ctx, record)
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s mongoStore) takeOver(ctx context.Context, id, fingerprint string, now, lockedUntil time.Time) (bool, error) {
+	result, err := s.col.UpdateOne(ctx,
+		bson.M{"_id": id, "fingerprint": fingerprint, "status": statusInProgress, "lockedUntil": bson.M{"$lt": now}},
+		bson.M{"$set": bson.M{"lockedUntil": lockedUntil}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+func (s mongoStore) find(ctx context.Context, id string) (models.IdempotencyRecord, error) {
+	var record models.IdempotencyRecord
+	err := s.col.FindOne(ctx, bson.M{"_id": id}).Decode(&record)
+	return record, err
+}
+
+func (s mongoStore) complete(ctx context.Context, id string, statusCode int, contentType string, body []byte) error {
+	_, err := s.col.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{
+		"status":      statusCompleted,
+		"statusCode":  statusCode,
+		"contentType": contentType,
+		"body":        body,
+	}, "$unset": bson.M{"lockedUntil": ""}})
+	return err
+}
+
+func (s mongoStore) remove(ctx context.Context, id string) error {
+	_, err := s.col.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+// recordID scopes the key to the route and caller. The apikey is hashed
+// along with it so that it is never stored.
+func recordID(c echo.Context, key string) string {
+	caller := c.QueryParam("apikey")
+	if caller == "" {
+		caller = auth.UserID(c)
+	}
+	return hash(c.Request().Method, c.Path(), caller, key)
+}
+
+// requestFingerprint identifies the parameters of the request, excluding the
+// key itself.
+func requestFingerprint(c echo.Context) string {
+	query := c.Request().URL.Query()
+	query.Del(QueryKey)
+	return hash(c.Request().Method, c.Path(), query.Encode())
+}
+
+func hash(parts ...string) string {
+	h := sha256.New()
+	for _, part := range parts {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// responseRecorder keeps a copy of the response body as it is written.
+type responseRecorder struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
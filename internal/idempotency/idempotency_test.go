@@ -0,0 +1,297 @@
+package idempotency
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// memoryStore applies the same conditions as mongoStore to records kept in
+// memory.
+type memoryStore struct {
+	mu      sync.Mutex
+	records map[string]models.IdempotencyRecord
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{records: make(map[string]models.IdempotencyRecord)}
+}
+
+func (s *memoryStore) insert(_ context.Context, record models.IdempotencyRecord) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.records[record.ID]; ok {
+		return false, nil
+	}
+	s.records[record.ID] = record
+	return true, nil
+}
+
+func (s *memoryStore) takeOver(_ context.Context, id, fingerprint string, now, lockedUntil time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.records[id]
+	if !ok || record.Fingerprint != fingerprint || record.Status != statusInProgress || !record.LockedUntil.Before(now) {
+		return false, nil
+	}
+	record.LockedUntil = lockedUntil
+	s.records[id] = record
+	return true, nil
+}
+
+func (s *memoryStore) find(_ context.Context, id string) (models.IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.records[id]
+	if !ok {
+		return record, mongo.ErrNoDocuments
+	}
+	return record, nil
+}
+
+func (s *memoryStore) complete(_ context.Context, id string, statusCode int, contentType string, body []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record := s.records[id]
+	record.Status = statusCompleted
+	record.StatusCode = statusCode
+	record.ContentType = contentType
+	record.Body = body
+	record.LockedUntil = time.Time{}
+	s.records[id] = record
+	return nil
+}
+
+func (s *memoryStore) remove(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, id)
+	return nil
+}
+
+func TestClaim(t *testing.T) {
+	ctx := context.Background()
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Minute)
+	tests := []struct {
+		name        string
+		existing    *models.IdempotencyRecord
+		fingerprint string
+		wantClaimed bool
+	}{
+		{name: "new key", fingerprint: "a", wantClaimed: true},
+		{
+			name:        "in progress",
+			existing:    &models.IdempotencyRecord{ID: "k", Fingerprint: "a", Status: statusInProgress, LockedUntil: future},
+			fingerprint: "a",
+		},
+		{
+			name:        "lapsed lock is taken over",
+			existing:    &models.IdempotencyRecord{ID: "k", Fingerprint: "a", Status: statusInProgress, LockedUntil: past},
+			fingerprint: "a",
+			wantClaimed: true,
+		},
+		{
+			name:        "lapsed lock of other parameters",
+			existing:    &models.IdempotencyRecord{ID: "k", Fingerprint: "b", Status: statusInProgress, LockedUntil: past},
+			fingerprint: "a",
+		},
+		{
+			name:        "completed",
+			existing:    &models.IdempotencyRecord{ID: "k", Fingerprint: "a", Status: statusCompleted, StatusCode: http.StatusOK},
+			fingerprint: "a",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records := newMemoryStore()
+			if tt.existing != nil {
+				records.records["k"] = *tt.existing
+			}
+			record, claimed, err := claim(ctx, records, "k", tt.fingerprint)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claimed != tt.wantClaimed {
+				t.Fatalf("claimed = %v, want %v", claimed, tt.wantClaimed)
+			}
+			if claimed {
+				stored := records.records["k"]
+				if stored.Status != statusInProgress || !stored.LockedUntil.After(time.Now()) {
+					t.Errorf("stored record = %+v, want a fresh lock", stored)
+				}
+				return
+			}
+			if !reflect.DeepEqual(record, *tt.existing) {
+				t.Errorf("record = %+v, want the existing %+v", record, *tt.existing)
+			}
+		})
+	}
+}
+
+func TestShouldStore(t *testing.T) {
+	tests := []struct {
+		statusCode int
+		committed  bool
+		want       bool
+	}{
+		{http.StatusOK, false, true},
+		{http.StatusBadRequest, false, true},
+		{http.StatusInternalServerError, false, false},
+		{http.StatusBadGateway, false, false},
+		{http.StatusInternalServerError, true, true},
+	}
+	for _, tt := range tests {
+		if got := shouldStore(tt.statusCode, tt.committed); got != tt.want {
+			t.Errorf("shouldStore(%d, %v) = %v, want %v", tt.statusCode, tt.committed, got, tt.want)
+		}
+	}
+}
+
+// testServer serves POST /buy through the middleware, answering each call
+// with the next of its responses.
+type testServer struct {
+	echo    *echo.Echo
+	records *memoryStore
+	calls   int
+}
+
+func newTestServer(t *testing.T, responses ...func(c echo.Context) error) *testServer {
+	s := &testServer{echo: echo.New(), records: newMemoryStore()}
+	s.echo.POST("/buy", func(c echo.Context) error {
+		if s.calls >= len(responses) {
+			t.Fatalf("handler ran %d times, want at most %d", s.calls+1, len(responses))
+		}
+		s.calls++
+		return responses[s.calls-1](c)
+	}, middleware(func(echo.Context) store { return s.records }))
+	return s
+}
+
+func (s *testServer) do(query string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/buy?"+query, nil)
+	req.Header.Set(HeaderKey, "key-1")
+	rec := httptest.NewRecorder()
+	s.echo.ServeHTTP(rec, req)
+	return rec
+}
+
+func respond(status int, body string, commit bool) func(c echo.Context) error {
+	return func(c echo.Context) error {
+		if commit {
+			Committed(c)
+		}
+		return c.JSON(status, echo.Map{"result": body})
+	}
+}
+
+func TestMiddlewareReplay(t *testing.T) {
+	s := newTestServer(t, respond(http.StatusOK, "number", true))
+	first := s.do("apikey=k&service=wa")
+	second := s.do("apikey=k&service=wa")
+	if first.Code != http.StatusOK || second.Code != http.StatusOK {
+		t.Fatalf("status = %d, %d, want 200 twice", first.Code, second.Code)
+	}
+	if second.Body.String() != first.Body.String() {
+		t.Errorf("replayed body = %q, want %q", second.Body.String(), first.Body.String())
+	}
+	if second.Header().Get("Idempotent-Replayed") != "true" {
+		t.Error("replay not marked with Idempotent-Replayed")
+	}
+	if s.calls != 1 {
+		t.Errorf("handler ran %d times, want once", s.calls)
+	}
+}
+
+func TestMiddlewareFingerprintMismatch(t *testing.T) {
+	s := newTestServer(t, respond(http.StatusOK, "number", true))
+	s.do("apikey=k&service=wa")
+	rec := s.do("apikey=k&service=tg")
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("status = %d, want 422", rec.Code)
+	}
+	if s.calls != 1 {
+		t.Errorf("handler ran %d times, want once", s.calls)
+	}
+}
+
+func TestMiddlewareInProgress(t *testing.T) {
+	var s *testServer
+	s = newTestServer(t, func(c echo.Context) error {
+		retry := s.do("apikey=k&service=wa")
+		if retry.Code != http.StatusConflict {
+			t.Errorf("retry while running: status = %d, want 409", retry.Code)
+		}
+		return respond(http.StatusOK, "number", true)(c)
+	})
+	if rec := s.do("apikey=k&service=wa"); rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200", rec.Code)
+	}
+}
+
+func TestMiddlewareLockTakeover(t *testing.T) {
+	s := newTestServer(t, respond(http.StatusOK, "number", true))
+	// A first attempt that died after claiming the key.
+	req := httptest.NewRequest(http.MethodPost, "/buy?apikey=k&service=wa", nil)
+	c := s.echo.NewContext(req, httptest.NewRecorder())
+	c.SetPath("/buy")
+	id, fingerprint := recordID(c, "key-1"), requestFingerprint(c)
+	s.records.records[id] = models.IdempotencyRecord{
+		ID:          id,
+		Fingerprint: fingerprint,
+		Status:      statusInProgress,
+		LockedUntil: time.Now().Add(-time.Second),
+	}
+
+	if rec := s.do("apikey=k&service=wa"); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 after taking over the lapsed lock", rec.Code)
+	}
+	if s.calls != 1 || len(s.records.records) != 1 || s.records.records[id].Status != statusCompleted {
+		t.Errorf("calls = %d, record = %+v, want the retry run and stored", s.calls, s.records.records[id])
+	}
+}
+
+func TestMiddlewareServerErrors(t *testing.T) {
+	t.Run("uncommitted 5xx is retried", func(t *testing.T) {
+		s := newTestServer(t, respond(http.StatusBadGateway, "upstream down", false), respond(http.StatusOK, "number", true))
+		if rec := s.do("apikey=k&service=wa"); rec.Code != http.StatusBadGateway {
+			t.Fatalf("status = %d, want 502", rec.Code)
+		}
+		if len(s.records.records) != 0 {
+			t.Fatalf("records = %+v, want the key forgotten", s.records.records)
+		}
+		if rec := s.do("apikey=k&service=wa"); rec.Code != http.StatusOK || s.calls != 2 {
+			t.Errorf("retry status = %d after %d calls, want 200 from a second run", rec.Code, s.calls)
+		}
+	})
+	t.Run("committed 5xx is replayed", func(t *testing.T) {
+		s := newTestServer(t, respond(http.StatusInternalServerError, "charged, then failed", true))
+		first := s.do("apikey=k&service=wa")
+		second := s.do("apikey=k&service=wa")
+		if first.Code != http.StatusInternalServerError || second.Code != http.StatusInternalServerError {
+			t.Fatalf("status = %d, %d, want 500 twice", first.Code, second.Code)
+		}
+		if second.Body.String() != first.Body.String() || s.calls != 1 {
+			t.Errorf("retry ran the handler again (%d calls) or changed the body", s.calls)
+		}
+	})
+}
+
+func TestMiddlewareWithoutKey(t *testing.T) {
+	s := newTestServer(t, respond(http.StatusOK, "one", true), respond(http.StatusOK, "two", true))
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/buy?apikey=k", nil)
+		s.echo.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	if s.calls != 2 || len(s.records.records) != 0 {
+		t.Errorf("calls = %d, records = %d, want requests without a key left alone", s.calls, len(s.records.records))
+	}
+}
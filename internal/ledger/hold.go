@@ -0,0 +1,166 @@
+package ledger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/internal/money"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Hold statuses.
+const (
+	HoldHeld     = "held"
+	HoldCaptured = "captured"
+	HoldReleased = "released"
+)
+
+// holdTTL bounds how long a hold may stay open before the sweeper releases
+// it. It is well above any upstream purchase timeout.
+const holdTTL = 5 * time.Minute
+
+var (
+	ErrInsufficientBalance = errors.New("low balance")
+	ErrHoldSettled         = errors.New("HOLD_ALREADY_SETTLED")
+	ErrInvalidHoldAmount   = errors.New("INVALID_HOLD_AMOUNT")
+)
+
+func holdCollection(db *mongo.Database) *mongo.Collection {
+	return models.InitializeBalanceHoldCollection(db)
+}
+
+// Hold reserves amount from the user's available balance. It fails with
+// ErrInsufficientBalance rather than letting concurrent purchases overdraw.
+// Only positive amounts can be held.
+func Hold(ctx context.Context, db *mongo.Database, userID primitive.ObjectID, amount money.Paise, note string) (models.BalanceHold, error) {
+	if amount <= 0 {
+		return models.BalanceHold{}, ErrInvalidHoldAmount
+	}
+	holdCol := holdCollection(db)
+	walletCol := models.InitializeApiWalletuserCollection(db)
+	now := time.Now()
+	hold := models.BalanceHold{
+		ID:        primitive.NewObjectID(),
+		UserID:    userID,
+		Amount:    amount,
+		Status:    HoldHeld,
+		Note:      note,
+		CreatedAt: now,
+		ExpiresAt: now.Add(holdTTL),
+	}
+
+	balance := bson.M{"$ifNull": bson.A{"$balancePaise", bson.M{"$round": bson.A{bson.M{"$multiply": bson.A{"$balance", 100}}, 0}}}}
+	available := bson.M{"$subtract": bson.A{balance, bson.M{"$ifNull": bson.A{"$heldPaise", 0}}}}
+	_, err := inTransaction(ctx, db, func(ctx context.Context) (interface{}, error) {
+		result, err := walletCol.UpdateOne(ctx,
+			bson.M{"userId": userID, "$expr": bson.M{"$gte": bson.A{available, int64(amount)}}},
+			bson.M{"$inc": bson.M{"heldPaise": int64(amount)}},
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to hold balance: %w", err)
+		}
+		if result.MatchedCount == 0 {
+			return nil, ErrInsufficientBalance
+		}
+		_, err = holdCol.InsertOne(ctx, hold)
+		return nil, err
+	})
+	if err != nil {
+		return models.BalanceHold{}, err
+	}
+	return hold, nil
+}
+
+// Capture settles the hold and books the postings that spend it. A hold the
+// sweeper already released is still charged, since the purchase went through.
+func Capture(ctx context.Context, db *mongo.Database, hold models.BalanceHold, postings ...Posting) error {
+	_, err := inTransaction(ctx, db, func(ctx context.Context) (interface{}, error) {
+		err := settle(ctx, db, hold, HoldCaptured, "")
+		if err != nil && !errors.Is(err, errHoldReleased) {
+			return nil, err
+		}
+		for _, p := range postings {
+			if _, err := post(ctx, db, p); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	})
+	return err
+}
+
+// Release returns the held amount to the available balance.
+func Release(ctx context.Context, db *mongo.Database, hold models.BalanceHold, reason string) error {
+	_, err := inTransaction(ctx, db, func(ctx context.Context) (interface{}, error) {
+		err := settle(ctx, db, hold, HoldReleased, reason)
+		if errors.Is(err, errHoldReleased) {
+			return nil, nil
+		}
+		return nil, err
+	})
+	return err
+}
+
+// ReleaseExpiredHolds releases holds left open past their expiry, e.g. by a
+// request that died between Hold and Capture.
+func ReleaseExpiredHolds(ctx context.Context, db *mongo.Database) (int, error) {
+	holdCol := holdCollection(db)
+	cursor, err := holdCol.Find(ctx, bson.M{"status": HoldHeld, "expiresAt": bson.M{"$lt": time.Now()}})
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch expired holds: %w", err)
+	}
+	var holds []models.BalanceHold
+	if err := cursor.All(ctx, &holds); err != nil {
+		return 0, fmt.Errorf("failed to decode expired holds: %w", err)
+	}
+	released := 0
+	for _, hold := range holds {
+		err := Release(ctx, db, hold, "expired")
+		if errors.Is(err, ErrHoldSettled) {
+			continue
+		}
+		if err != nil {
+			return released, err
+		}
+		released++
+	}
+	return released, nil
+}
+
+var errHoldReleased = errors.New("hold already released")
+
+// settle moves an open hold to status and frees its amount on the wallet.
+func settle(ctx context.Context, db *mongo.Database, hold models.BalanceHold, status, reason string) error {
+	holdCol := holdCollection(db)
+	var previous models.BalanceHold
+	err := holdCol.FindOneAndUpdate(ctx,
+		bson.M{"_id": hold.ID, "status": HoldHeld},
+		bson.M{"$set": bson.M{"status": status, "reason": reason, "settledAt": time.Now()}},
+		options.FindOneAndUpdate().SetReturnDocument(options.Before),
+	).Decode(&previous)
+	if err == mongo.ErrNoDocuments {
+		if err := holdCol.FindOne(ctx, bson.M{"_id": hold.ID}).Decode(&previous); err != nil {
+			return fmt.Errorf("failed to fetch hold: %w", err)
+		}
+		if previous.Status == HoldReleased {
+			return errHoldReleased
+		}
+		return ErrHoldSettled
+	}
+	if err != nil {
+		return fmt.Errorf("failed to settle hold: %w", err)
+	}
+
+	walletCol := models.InitializeApiWalletuserCollection(db)
+	_, err = walletCol.UpdateOne(ctx, bson.M{"userId": previous.UserID}, bson.M{"$inc": bson.M{"heldPaise": -int64(previous.Amount)}})
+	if err != nil {
+		return fmt.Errorf("failed to free held balance: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,310 @@
+// Package ledger records every wallet balance change as a double-entry
+// posting. The balance on apikey_and_balances is a cached projection of the
+// wallet's ledger entries and is only changed through Post.
+package ledger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/internal/money"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Posting kinds.
+const (
+	KindOpening    = "opening"
+	KindPurchase   = "purchase"
+	KindDiscount   = "discount"
+	KindRefund     = "refund"
+	KindRecharge   = "recharge"
+	KindAdjustment = "adjustment"
+)
+
+// counterAccounts is the system account each kind is booked against.
+var counterAccounts = map[string]string{
+	KindOpening:    "system:opening",
+	KindPurchase:   "system:sales",
+	KindDiscount:   "system:discounts",
+	KindRefund:     "system:sales",
+	KindRecharge:   "system:recharges",
+	KindAdjustment: "system:adjustments",
+}
+
+var ErrDuplicatePosting = errors.New("LEDGER_DUPLICATE_POSTING")
+
+// Posting moves Amount into (positive) or out of (negative) a user's wallet.
+type Posting struct {
+	UserID           primitive.ObjectID
+	Kind             string
+	Amount           money.Paise
+	SourceCollection string
+	SourceID         string
+	Note             string
+}
+
+// WalletAccount is the ledger account of a user's wallet.
+func WalletAccount(userID primitive.ObjectID) string {
+	return "wallet:" + userID.Hex()
+}
+
+func collection(db *mongo.Database) *mongo.Collection {
+	return models.InitializeLedgerCollection(db)
+}
+
+// Post records the posting and applies it to the cached wallet balance. When
+// ctx is a mongo.SessionContext the writes join that transaction, otherwise
+// Post runs its own. It returns the wallet side entry.
+func Post(ctx context.Context, db *mongo.Database, p Posting) (models.LedgerEntry, error) {
+	entry, err := inTransaction(ctx, db, func(ctx context.Context) (interface{}, error) {
+		return post(ctx, db, p)
+	})
+	if err != nil {
+		return models.LedgerEntry{}, err
+	}
+	return entry.(models.LedgerEntry), nil
+}
+
+// inTransaction runs fn in the caller's transaction if ctx carries one and in
+// a new one otherwise.
+func inTransaction(ctx context.Context, db *mongo.Database, fn func(context.Context) (interface{}, error)) (interface{}, error) {
+	if mongo.SessionFromContext(ctx) != nil {
+		return fn(ctx)
+	}
+	session, err := db.Client().StartSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.EndSession(context.Background())
+	return session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return fn(sc)
+	})
+}
+
+func post(ctx context.Context, db *mongo.Database, p Posting) (models.LedgerEntry, error) {
+	counter, ok := counterAccounts[p.Kind]
+	if !ok {
+		return models.LedgerEntry{}, fmt.Errorf("unknown ledger kind %q", p.Kind)
+	}
+	amount := p.Amount
+	ledgerCol := collection(db)
+	walletCol := models.InitializeApiWalletuserCollection(db)
+	account := WalletAccount(p.UserID)
+
+	if err := ensureOpening(ctx, ledgerCol, walletCol, p.UserID); err != nil {
+		return models.LedgerEntry{}, err
+	}
+
+	wallet, err := applyToWallet(ctx, walletCol, p.UserID, amount)
+	if err != nil {
+		return models.LedgerEntry{}, fmt.Errorf("failed to update wallet: %w", err)
+	}
+
+	now := time.Now()
+	postingID := primitive.NewObjectID()
+	entry := models.LedgerEntry{
+		ID:               primitive.NewObjectID(),
+		PostingID:        postingID,
+		Account:          account,
+		UserID:           p.UserID,
+		Kind:             p.Kind,
+		Amount:           amount,
+		BalanceAfter:     wallet.BalancePaise,
+		SourceCollection: p.SourceCollection,
+		SourceID:         p.SourceID,
+		Note:             p.Note,
+		CreatedAt:        now,
+	}
+	contra := models.LedgerEntry{
+		ID:               primitive.NewObjectID(),
+		PostingID:        postingID,
+		Account:          counter,
+		UserID:           p.UserID,
+		Kind:             p.Kind,
+		Amount:           -amount,
+		SourceCollection: p.SourceCollection,
+		SourceID:         p.SourceID,
+		Note:             p.Note,
+		CreatedAt:        now,
+	}
+	if _, err := ledgerCol.InsertMany(ctx, []interface{}{entry, contra}); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return models.LedgerEntry{}, ErrDuplicatePosting
+		}
+		return models.LedgerEntry{}, err
+	}
+	return entry, nil
+}
+
+// ensureOpening books the wallet's pre-ledger balance as an opening entry the
+// first time the wallet is posted to. The wallet side is upserted on the
+// unique source key, so when two first postings race only one of them books
+// the opening and the other finds it in place.
+func ensureOpening(ctx context.Context, ledgerCol, walletCol *mongo.Collection, userID primitive.ObjectID) error {
+	account := WalletAccount(userID)
+	count, err := ledgerCol.CountDocuments(ctx, bson.M{"account": account}, options.Count().SetLimit(1))
+	if err != nil || count > 0 {
+		return err
+	}
+	var wallet models.ApiWalletUser
+	if err := walletCol.FindOne(ctx, bson.M{"userId": userID}).Decode(&wallet); err != nil {
+		return fmt.Errorf("failed to fetch wallet: %w", err)
+	}
+
+	balance := wallet.Amount()
+	postingID := primitive.NewObjectID()
+	now := time.Now()
+	opening := models.LedgerEntry{
+		ID:               primitive.NewObjectID(),
+		PostingID:        postingID,
+		Account:          account,
+		UserID:           userID,
+		Kind:             KindOpening,
+		Amount:           balance,
+		BalanceAfter:     balance,
+		SourceCollection: "apikey_and_balances",
+		SourceID:         wallet.ID.Hex(),
+		CreatedAt:        now,
+	}
+	result, err := ledgerCol.UpdateOne(ctx,
+		bson.M{
+			"account":          opening.Account,
+			"kind":             opening.Kind,
+			"sourceCollection": opening.SourceCollection,
+			"sourceId":         opening.SourceID,
+		},
+		bson.M{"$setOnInsert": opening},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil || result.UpsertedCount == 0 {
+		return err
+	}
+	_, err = ledgerCol.InsertOne(ctx, models.LedgerEntry{
+		ID:               primitive.NewObjectID(),
+		PostingID:        postingID,
+		Account:          counterAccounts[KindOpening],
+		UserID:           userID,
+		Kind:             KindOpening,
+		Amount:           -balance,
+		SourceCollection: "apikey_and_balances",
+		SourceID:         wallet.ID.Hex(),
+		CreatedAt:        now,
+	})
+	return err
+}
+
+// applyToWallet adds amount to the exact balance and refreshes the rupee
+// mirror from it in a single update.
+func applyToWallet(ctx context.Context, walletCol *mongo.Collection, userID primitive.ObjectID, amount money.Paise) (models.ApiWalletUser, error) {
+	current := bson.M{"$ifNull": bson.A{"$balancePaise", bson.M{"$round": bson.A{bson.M{"$multiply": bson.A{"$balance", 100}}, 0}}}}
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{"balancePaise": bson.M{"$toLong": bson.M{"$add": bson.A{current, int64(amount)}}}}}},
+		{{Key: "$set", Value: bson.M{"balance": bson.M{"$divide": bson.A{"$balancePaise", 100}}}}},
+	}
+	var wallet models.ApiWalletUser
+	err := walletCol.FindOneAndUpdate(ctx,
+		bson.M{"userId": userID},
+		update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&wallet)
+	return wallet, err
+}
+
+// Statement is a user's wallet entries over a period.
+type Statement struct {
+	Account        string               `json:"account"`
+	OpeningBalance money.Paise          `json:"openingBalance"`
+	ClosingBalance money.Paise          `json:"closingBalance"`
+	Entries        []models.LedgerEntry `json:"entries"`
+}
+
+// GetStatement returns the wallet entries created in [from, to). A zero
+// from or to leaves that side open.
+func GetStatement(ctx context.Context, db *mongo.Database, userID primitive.ObjectID, from, to time.Time) (Statement, error) {
+	ledgerCol := collection(db)
+	account := WalletAccount(userID)
+	statement := Statement{Account: account, Entries: []models.LedgerEntry{}}
+
+	if !from.IsZero() {
+		opening, err := sumBefore(ctx, ledgerCol, account, from)
+		if err != nil {
+			return Statement{}, err
+		}
+		statement.OpeningBalance = opening
+	}
+
+	createdAt := bson.M{}
+	if !from.IsZero() {
+		createdAt["$gte"] = from
+	}
+	if !to.IsZero() {
+		createdAt["$lt"] = to
+	}
+	filter := bson.M{"account": account}
+	if len(createdAt) > 0 {
+		filter["createdAt"] = createdAt
+	}
+	cursor, err := ledgerCol.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}))
+	if err != nil {
+		return Statement{}, fmt.Errorf("failed to fetch ledger entries: %w", err)
+	}
+	if err := cursor.All(ctx, &statement.Entries); err != nil {
+		return Statement{}, fmt.Errorf("failed to decode ledger entries: %w", err)
+	}
+
+	balance := statement.OpeningBalance
+	for _, entry := range statement.Entries {
+		balance += entry.Amount
+	}
+	statement.ClosingBalance = balance
+	return statement, nil
+}
+
+// Rebuild recomputes the cached wallet balance from the ledger.
+func Rebuild(ctx context.Context, db *mongo.Database, userID primitive.ObjectID) (money.Paise, error) {
+	balance, err := sumBefore(ctx, collection(db), WalletAccount(userID), time.Time{})
+	if err != nil {
+		return 0, err
+	}
+	walletCol := models.InitializeApiWalletuserCollection(db)
+	_, err = walletCol.UpdateOne(ctx, bson.M{"userId": userID}, bson.M{"$set": bson.M{
+		"balancePaise": balance,
+		"balance":      balance.Float64(),
+	}})
+	if err != nil {
+		return 0, fmt.Errorf("failed to update wallet: %w", err)
+	}
+	return balance, nil
+}
+
+// sumBefore totals the account's entries created before t, or all of them
+// when t is zero.
+func sumBefore(ctx context.Context, ledgerCol *mongo.Collection, account string, t time.Time) (money.Paise, error) {
+	match := bson.M{"account": account}
+	if !t.IsZero() {
+		match["createdAt"] = bson.M{"$lt": t}
+	}
+	cursor, err := ledgerCol.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$group", Value: bson.M{"_id": nil, "total": bson.M{"$sum": "$amount"}}}},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to sum ledger entries: %w", err)
+	}
+	var result []struct {
+		Total money.Paise `bson:"total"`
+	}
+	if err := cursor.All(ctx, &result); err != nil {
+		return 0, fmt.Errorf("failed to sum ledger entries: %w", err)
+	}
+	if len(result) == 0 {
+		return 0, nil
+	}
+	return result[0].Total, nil
+}
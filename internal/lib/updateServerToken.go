@@ -10,13 +10,14 @@ import (
 	"time"
 
 	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/internal/providers"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
 func fetchTokenFromAPI(apiKey string) (string, error) {
 	apiURL := fmt.Sprintf("http://www.phantomunion.com:10023/pickCode-api/push/ticket?key=%s", apiKey)
-	resp, err := http.Get(apiURL)
+	resp, err := http.Get(providers.Endpoint(apiURL))
 	if err != nil {
 		return "", fmt.Errorf("failed to fetch token: %w", err)
 	}
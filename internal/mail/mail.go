@@ -0,0 +1,181 @@
+// Package mail sends the emails the site sends to users. Messages are
+// rendered from the templates in templates/ and handed to a Mailer; sends
+// that fail are kept in an outbox in Mongo and retried by the outbox runner.
+package mail
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ranjankuldeep/fakeNumber/logs"
+	"gopkg.in/gomail.v2"
+)
+
+// Message is a rendered email with a plain-text and an HTML body.
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+func (m Message) mime(from string) *gomail.Message {
+	msg := gomail.NewMessage()
+	msg.SetHeader("From", from)
+	msg.SetHeader("To", m.To)
+	msg.SetHeader("Subject", m.Subject)
+	msg.SetBody("text/plain", m.Text)
+	if m.HTML != "" {
+		msg.AddAlternative("text/html", m.HTML)
+	}
+	return msg
+}
+
+// Mailer delivers a message.
+type Mailer interface {
+	Send(ctx context.Context, m Message) error
+}
+
+// SMTPMailer sends through an SMTP server with STARTTLS.
+type SMTPMailer struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+func (s SMTPMailer) Send(ctx context.Context, m Message) error {
+	dialer := gomail.NewDialer(s.Host, s.Port, s.Username, s.Password)
+	return dialer.DialAndSend(m.mime(s.From))
+}
+
+// FileMailer writes each message as an .eml file in Dir instead of sending
+// it, for local development.
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+func (f FileMailer) Send(ctx context.Context, m Message) error {
+	if err := os.MkdirAll(f.Dir, 0o755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102-150405.000000"), sanitize(m.To))
+	file, err := os.Create(filepath.Join(f.Dir, name))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := m.mime(f.From).WriteTo(file); err != nil {
+		return err
+	}
+	logs.Logger.Infof("Mail %q to %s written to %s", m.Subject, m.To, file.Name())
+	return nil
+}
+
+// LogMailer only logs that a message would have been sent. Bodies are not
+// logged since they may hold one-time codes; use FileMailer to read them.
+type LogMailer struct{}
+
+func (LogMailer) Send(ctx context.Context, m Message) error {
+	logs.Logger.Infof("Mail %q to %s not sent, MAIL_DRIVER is log", m.Subject, m.To)
+	return nil
+}
+
+func sanitize(s string) string {
+	out := []rune(s)
+	for i, r := range out {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-') {
+			out[i] = '_'
+		}
+	}
+	return string(out)
+}
+
+// FromEnv builds the mailer selected by MAIL_DRIVER: "smtp" (SMTP_HOST,
+// SMTP_PORT, SMTP_USER, SMTP_PASS, MAIL_FROM), "file" (MAIL_SINK_DIR) or
+// "log". MAIL_USER and MAIL_PASS are still read when SMTP_USER and SMTP_PASS
+// are unset. Without MAIL_DRIVER, SMTP is used when a user is configured,
+// and it is an error otherwise, so that mail is never dropped silently.
+func FromEnv() (Mailer, error) {
+	user := envOr("SMTP_USER", "MAIL_USER")
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = user
+	}
+	driver := os.Getenv("MAIL_DRIVER")
+	if driver == "" {
+		if user == "" {
+			return nil, fmt.Errorf("MAIL_DRIVER is not set and neither SMTP_USER nor MAIL_USER is configured")
+		}
+		driver = "smtp"
+	}
+	switch driver {
+	case "smtp":
+		host := os.Getenv("SMTP_HOST")
+		if host == "" {
+			host = "smtp.gmail.com"
+		}
+		port := 587
+		if v := os.Getenv("SMTP_PORT"); v != "" {
+			p, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid SMTP_PORT %q", v)
+			}
+			port = p
+		}
+		return SMTPMailer{
+			Host:     host,
+			Port:     port,
+			Username: user,
+			Password: envOr("SMTP_PASS", "MAIL_PASS"),
+			From:     from,
+		}, nil
+	case "file":
+		dir := os.Getenv("MAIL_SINK_DIR")
+		if dir == "" {
+			dir = "mail-sink"
+		}
+		if from == "" {
+			from = "no-reply@localhost"
+		}
+		return FileMailer{Dir: dir, From: from}, nil
+	case "log":
+		return LogMailer{}, nil
+	}
+	return nil, fmt.Errorf("unknown MAIL_DRIVER %q", driver)
+}
+
+// envOr returns the first of the named variables that is set.
+func envOr(names ...string) string {
+	for _, name := range names {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+var (
+	mu     sync.RWMutex
+	mailer Mailer = LogMailer{}
+)
+
+// SetMailer replaces the mailer used by Deliver and the outbox.
+func SetMailer(m Mailer) {
+	mu.Lock()
+	defer mu.Unlock()
+	mailer = m
+}
+
+func current() Mailer {
+	mu.RLock()
+	defer mu.RUnlock()
+	return mailer
+}
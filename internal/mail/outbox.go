@@ -0,0 +1,112 @@
+package mail
+
+import (
+	"context"
+	"time"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/logs"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// maxAttempts is how many sends are tried before a message is marked
+	// failed.
+	maxAttempts = 8
+	// claimTimeout lets another instance retry a message whose sender died
+	// mid-send.
+	claimTimeout = 5 * time.Minute
+	maxBackoff   = time.Hour
+)
+
+func outbox(db *mongo.Database) *mongo.Collection {
+	return models.InitializeMailOutboxCollection(db)
+}
+
+// backoff is the wait before the next attempt after attempts failures.
+func backoff(attempts int) time.Duration {
+	wait := time.Minute << (attempts - 1)
+	if wait <= 0 || wait > maxBackoff {
+		return maxBackoff
+	}
+	return wait
+}
+
+// Deliver renders a template and sends it. If the send fails the message is
+// queued in the outbox for retry and Deliver still succeeds; it only fails
+// when the message could neither be sent nor queued. Messages with one-time
+// codes are not queued; their send error is returned so the caller can let
+// the user ask for a new code.
+func Deliver(ctx context.Context, db *mongo.Database, to string, name Template, data interface{}) error {
+	msg, err := Render(to, name, data)
+	if err != nil {
+		return err
+	}
+	sendErr := current().Send(ctx, msg)
+	if sendErr == nil {
+		return nil
+	}
+	if transient[name] {
+		return sendErr
+	}
+	logs.Logger.Errorf("failed to send %s mail to %s, queued for retry: %v", name, to, sendErr)
+	now := time.Now()
+	_, err = outbox(db).InsertOne(ctx, models.OutboxEmail{
+		To:            msg.To,
+		Template:      string(name),
+		Subject:       msg.Subject,
+		Text:          msg.Text,
+		HTML:          msg.HTML,
+		Status:        models.OutboxPending,
+		Attempts:      1,
+		LastError:     sendErr.Error(),
+		NextAttemptAt: now.Add(backoff(1)),
+		CreatedAt:     now,
+	})
+	if err != nil {
+		return sendErr
+	}
+	return nil
+}
+
+// ProcessOutbox retries every queued message that is due and returns how
+// many were sent.
+func ProcessOutbox(ctx context.Context, db *mongo.Database) (int, error) {
+	col := outbox(db)
+	sent := 0
+	for {
+		now := time.Now()
+		var email models.OutboxEmail
+		// Claim the message by pushing its next attempt out, so that other
+		// instances skip it while it is being sent.
+		err := col.FindOneAndUpdate(ctx,
+			bson.M{"status": models.OutboxPending, "nextAttemptAt": bson.M{"$lte": now}},
+			bson.M{"$set": bson.M{"nextAttemptAt": now.Add(claimTimeout)}},
+			options.FindOneAndUpdate().SetSort(bson.M{"nextAttemptAt": 1}),
+		).Decode(&email)
+		if err == mongo.ErrNoDocuments {
+			return sent, nil
+		} else if err != nil {
+			return sent, err
+		}
+
+		sendErr := current().Send(ctx, Message{To: email.To, Subject: email.Subject, Text: email.Text, HTML: email.HTML})
+		update := bson.M{"$set": bson.M{"status": models.OutboxSent, "sentAt": time.Now()}, "$inc": bson.M{"attempts": 1}}
+		if sendErr != nil {
+			attempts := email.Attempts + 1
+			set := bson.M{"lastError": sendErr.Error(), "nextAttemptAt": time.Now().Add(backoff(attempts))}
+			if attempts >= maxAttempts {
+				set["status"] = models.OutboxFailed
+				logs.Logger.Errorf("giving up on %s mail to %s after %d attempts: %v", email.Template, email.To, attempts, sendErr)
+			}
+			update = bson.M{"$set": set, "$inc": bson.M{"attempts": 1}}
+		} else {
+			sent++
+		}
+		if _, err := col.UpdateOne(ctx, bson.M{"_id": email.ID}, update); err != nil {
+			return sent, err
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package mail
+
+import (
+	"bytes"
+	"embed"
+	htmltemplate "html/template"
+	"os"
+	texttemplate "text/template"
+)
+
+// Template names an email the site sends.
+type Template string
+
+const (
+	TemplateSignupOTP       Template = "signup-otp"
+	TemplatePasswordReset   Template = "password-reset"
+	TemplateLowBalance      Template = "low-balance"
+	TemplateRechargeReceipt Template = "recharge-receipt"
+	TemplateAccountBlocked  Template = "account-blocked"
+)
+
+var subjects = map[Template]string{
+	TemplateSignupOTP:       "Your verification code",
+	TemplatePasswordReset:   "Reset your password",
+	TemplateLowBalance:      "Your balance is running low",
+	TemplateRechargeReceipt: "Recharge received",
+	TemplateAccountBlocked:  "Your account has been blocked",
+}
+
+// transient templates carry one-time codes that are useless once they
+// expire, so they are never queued for a later retry.
+var transient = map[Template]bool{
+	TemplateSignupOTP:     true,
+	TemplatePasswordReset: true,
+}
+
+// OTPData fills TemplateSignupOTP and TemplatePasswordReset.
+type OTPData struct {
+	Code    string
+	Minutes int
+}
+
+// LowBalanceData fills TemplateLowBalance. Amounts are in rupees.
+type LowBalanceData struct {
+	Balance   string
+	Threshold string
+}
+
+// RechargeReceiptData fills TemplateRechargeReceipt.
+type RechargeReceiptData struct {
+	Amount        string
+	PaymentType   string
+	TransactionID string
+	Date          string
+}
+
+// AccountBlockedData fills TemplateAccountBlocked. Reason may be empty.
+type AccountBlockedData struct {
+	Reason string
+}
+
+//go:embed templates
+var templateFS embed.FS
+
+var (
+	htmlTemplates = map[Template]*htmltemplate.Template{}
+	textTemplates = map[Template]*texttemplate.Template{}
+)
+
+func init() {
+	for name := range subjects {
+		htmlTemplates[name] = htmltemplate.Must(htmltemplate.ParseFS(templateFS, "templates/layout.html", "templates/"+string(name)+".html"))
+		textTemplates[name] = texttemplate.Must(texttemplate.ParseFS(templateFS, "templates/"+string(name)+".txt"))
+	}
+}
+
+func siteName() string {
+	if name := os.Getenv("SITE_NAME"); name != "" {
+		return name
+	}
+	return "PaidSMS"
+}
+
+// Render builds the message for a template. data is the template's Data
+// struct.
+func Render(to string, name Template, data interface{}) (Message, error) {
+	view := struct {
+		Site string
+		Data interface{}
+	}{siteName(), data}
+
+	var text, html bytes.Buffer
+	if err := textTemplates[name].Execute(&text, view); err != nil {
+		return Message{}, err
+	}
+	if err := htmlTemplates[name].ExecuteTemplate(&html, "layout", view); err != nil {
+		return Message{}, err
+	}
+	return Message{
+		To:      to,
+		Subject: siteName() + ": " + subjects[name],
+		Text:    text.String(),
+		HTML:    html.String(),
+	}, nil
+}
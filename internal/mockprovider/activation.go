@@ -0,0 +1,108 @@
+package mockprovider
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// serveActivation emulates the SMS-Activate handler_api dialect.
+func (m *Mock) serveActivation(w http.ResponseWriter, r *http.Request, vendor string) {
+	query := r.URL.Query()
+	action := query.Get("action")
+	if body, ok := m.scriptedFailure(DialectActivation, action); ok {
+		writeText(w, body)
+		return
+	}
+	if query.Get("api_key") == "" {
+		writeText(w, "BAD_KEY")
+		return
+	}
+
+	switch action {
+	case "getNumber":
+		activation := m.buy(vendor, DialectActivation, query.Get("service"))
+		if activation == nil {
+			writeText(w, "NO_NUMBERS")
+			return
+		}
+		writeText(w, fmt.Sprintf("ACCESS_NUMBER:%d:91%s", activation.ID, activation.Number))
+
+	case "getStatus":
+		activation, ok := m.lookup(query.Get("id"))
+		switch {
+		case !ok:
+			writeText(w, "NO_ACTIVATION")
+		case activation.Status == statusCancelled:
+			writeText(w, "STATUS_CANCEL")
+		case activation.Status == statusReceived:
+			writeText(w, "STATUS_OK:"+lastSMS(activation))
+		case len(activation.SMS) > 0:
+			writeText(w, "STATUS_WAIT_RETRY:"+lastSMS(activation))
+		default:
+			writeText(w, "STATUS_WAIT_CODE")
+		}
+
+	case "setStatus":
+		id := query.Get("id")
+		switch query.Get("status") {
+		case "8":
+			_, err := m.cancel(id)
+			switch {
+			case err == nil:
+				writeText(w, "ACCESS_CANCEL")
+			case err.Error() == "not found":
+				writeText(w, "NO_ACTIVATION")
+			default:
+				writeText(w, "BAD_STATUS")
+			}
+		case "3":
+			if !m.requestNext(id) {
+				writeText(w, "BAD_STATUS")
+				return
+			}
+			// fastsms acknowledges a retry with ACCESS_WAITING.
+			if vendor == "fastsms.su" {
+				writeText(w, "ACCESS_WAITING")
+				return
+			}
+			writeText(w, "ACCESS_RETRY_GET")
+		case "6":
+			writeText(w, "ACCESS_ACTIVATION")
+		default:
+			writeText(w, "BAD_STATUS")
+		}
+
+	case "getBalance":
+		writeText(w, fmt.Sprintf("ACCESS_BALANCE:%.2f", m.cfg.Balance))
+
+	case "getPrices":
+		writeJSON(w, map[string]interface{}{query.Get("country"): m.priceList(query.Get("service"))})
+
+	default:
+		writeText(w, "BAD_ACTION")
+	}
+}
+
+// priceList reports Config.Price for every scripted code plus extra.
+func (m *Mock) priceList(extra string) map[string]map[string]interface{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	prices := make(map[string]map[string]interface{})
+	add := func(code string) {
+		count, ok := m.stock[code]
+		if !ok {
+			count = m.cfg.DefaultStock
+		}
+		if count < 0 {
+			count = 9999
+		}
+		prices[code] = map[string]interface{}{"cost": m.cfg.Price, "count": count}
+	}
+	for code := range m.stock {
+		add(code)
+	}
+	if extra != "" {
+		add(extra)
+	}
+	return prices
+}
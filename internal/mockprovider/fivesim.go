@@ -0,0 +1,88 @@
+package mockprovider
+
+import (
+	"net/http"
+	"strings"
+)
+
+// serveFiveSim emulates the 5sim.net v1 API.
+func (m *Mock) serveFiveSim(w http.ResponseWriter, r *http.Request, vendor, path string) {
+	parts := strings.Split(path, "/")
+	action := parts[0]
+	if len(parts) > 1 {
+		action = parts[1]
+	}
+	if body, ok := m.scriptedFailure(DialectFiveSim, action); ok {
+		writeText(w, body)
+		return
+	}
+	if parts[0] == "user" && !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+		http.Error(w, "", http.StatusUnauthorized)
+		return
+	}
+
+	switch {
+	// user/buy/activation/{country}/{operator}/{product}
+	case action == "buy" && len(parts) == 6:
+		activation := m.buy(vendor, DialectFiveSim, parts[5])
+		if activation == nil {
+			writeText(w, "no free phones")
+			return
+		}
+		writeJSON(w, fiveSimOrder(*activation))
+
+	case action == "check" && len(parts) == 3:
+		activation, ok := m.lookup(parts[2])
+		if !ok {
+			http.Error(w, "order not found", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, fiveSimOrder(activation))
+
+	case action == "cancel" && len(parts) == 3:
+		activation, err := m.cancel(parts[2])
+		switch {
+		case err == nil:
+			writeJSON(w, fiveSimOrder(activation))
+		case err.Error() == "not found":
+			writeText(w, "order not found")
+		default:
+			writeText(w, "order has sms")
+		}
+
+	case action == "profile":
+		writeJSON(w, map[string]interface{}{"id": 1, "email": "mock@example.com", "balance": m.cfg.Balance})
+
+	case parts[0] == "guest" && action == "prices":
+		products := make(map[string]interface{})
+		for code, price := range m.priceList(r.URL.Query().Get("product")) {
+			products[code] = map[string]interface{}{"any": price}
+		}
+		writeJSON(w, map[string]interface{}{"india": products})
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func fiveSimOrder(activation Activation) map[string]interface{} {
+	status := "PENDING"
+	switch activation.Status {
+	case statusReceived:
+		status = "RECEIVED"
+	case statusCancelled:
+		status = "CANCELED"
+	}
+	sms := make([]map[string]string, 0, len(activation.SMS))
+	for _, text := range activation.SMS {
+		sms = append(sms, map[string]string{"sender": activation.Code, "text": text, "code": text})
+	}
+	return map[string]interface{}{
+		"id":      activation.ID,
+		"phone":   "+91" + activation.Number,
+		"product": activation.Code,
+		"status":  status,
+		"sms":     sms,
+		"country": "india",
+	}
+}
@@ -0,0 +1,322 @@
+package mockprovider
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Dialects understood by the mock. Scripted failures are keyed by dialect
+// and action, e.g. FailNext(DialectActivation, "getNumber", "NO_BALANCE").
+const (
+	DialectActivation = "activation"
+	DialectFiveSim    = "5sim"
+	DialectSmsMan     = "smsman"
+	DialectPhantom    = "phantom"
+)
+
+const (
+	statusWaiting   = "WAITING"
+	statusReceived  = "RECEIVED"
+	statusCancelled = "CANCELLED"
+)
+
+type Config struct {
+	// DefaultStock is the number of numbers available per service code,
+	// negative for unlimited.
+	DefaultStock int
+	// SMSDelay is how long after purchase (or a next-SMS request) the SMS arrives.
+	SMSDelay time.Duration
+	// SMSCode is the code delivered; a random 6 digit code is used when empty.
+	SMSCode string
+	Balance float64
+	// Price is the upstream cost reported for every service code.
+	Price float64
+}
+
+type Activation struct {
+	ID      int       `json:"id"`
+	Vendor  string    `json:"vendor"`
+	Dialect string    `json:"dialect"`
+	Code    string    `json:"code"`
+	Number  string    `json:"number"`
+	Status  string    `json:"status"`
+	SMS     []string  `json:"sms"`
+	ReadyAt time.Time `json:"readyAt"`
+}
+
+// Mock emulates the SMS-Activate, 5sim, sms-man and phantomunion APIs.
+// Requests may be prefixed with the real vendor host as the first path
+// segment, which is how providers.SetUpstreamOverride rewrites URLs.
+type Mock struct {
+	mu          sync.Mutex
+	cfg         Config
+	nextID      int
+	stock       map[string]int
+	activations map[int]*Activation
+	failures    map[string][]string
+}
+
+func New(cfg Config) *Mock {
+	m := &Mock{cfg: cfg}
+	m.Reset()
+	return m
+}
+
+// NewTestServer starts the mock on a loopback httptest server. Pass
+// server.URL to providers.SetUpstreamOverride.
+func NewTestServer(cfg Config) (*httptest.Server, *Mock) {
+	m := New(cfg)
+	return httptest.NewServer(m), m
+}
+
+// Reset drops all activations, scripted stock and failures.
+func (m *Mock) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextID = 100000
+	m.stock = make(map[string]int)
+	m.activations = make(map[int]*Activation)
+	m.failures = make(map[string][]string)
+}
+
+// SetStock sets the stock left for a service code, negative for unlimited.
+func (m *Mock) SetStock(code string, count int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stock[code] = count
+}
+
+// FailNext makes the next call to action on the dialect reply with the raw body.
+func (m *Mock) FailNext(dialect, action, body string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := dialect + ":" + action
+	m.failures[key] = append(m.failures[key], body)
+}
+
+// DeliverSMS makes text available on the activation immediately.
+func (m *Mock) DeliverSMS(id int, text string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	activation, ok := m.activations[id]
+	if !ok {
+		return fmt.Errorf("activation %d not found", id)
+	}
+	if activation.Status == statusCancelled {
+		return fmt.Errorf("activation %d is cancelled", id)
+	}
+	activation.SMS = append(activation.SMS, text)
+	activation.Status = statusReceived
+	return nil
+}
+
+// Activations returns a snapshot of every activation.
+func (m *Mock) Activations() []Activation {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	list := make([]Activation, 0, len(m.activations))
+	for _, activation := range m.activations {
+		list = append(list, *activation)
+	}
+	return list
+}
+
+func (m *Mock) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	vendor, path := splitVendor(r.URL.Path)
+	switch {
+	case strings.HasPrefix(path, "/mock/"):
+		m.serveScript(w, r, strings.TrimPrefix(path, "/mock/"))
+	case strings.HasPrefix(path, "/stubs/handler_api"):
+		m.serveActivation(w, r, vendor)
+	case strings.HasPrefix(path, "/v1/"):
+		m.serveFiveSim(w, r, vendor, strings.TrimPrefix(path, "/v1/"))
+	case strings.HasPrefix(path, "/control/"):
+		m.serveSmsMan(w, r, vendor, strings.TrimPrefix(path, "/control/"))
+	case strings.HasPrefix(path, "/pickCode-api/push/"):
+		m.servePhantom(w, r, vendor, strings.TrimPrefix(path, "/pickCode-api/push/"))
+	case path == "/ccpay.php":
+		m.serveCcpayBridge(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// splitVendor strips a leading "/<host>" segment added by the upstream override.
+func splitVendor(path string) (string, string) {
+	trimmed := strings.TrimPrefix(path, "/")
+	segment, rest, found := strings.Cut(trimmed, "/")
+	if found && strings.Contains(segment, ".") {
+		return segment, "/" + rest
+	}
+	return "", path
+}
+
+// serveScript exposes the scripting methods over HTTP for cmd/mockprovider.
+func (m *Mock) serveScript(w http.ResponseWriter, r *http.Request, action string) {
+	query := r.URL.Query()
+	switch action {
+	case "stock":
+		count, err := strconv.Atoi(query.Get("count"))
+		if err != nil || query.Get("code") == "" {
+			http.Error(w, "code and count are required", http.StatusBadRequest)
+			return
+		}
+		m.SetStock(query.Get("code"), count)
+	case "fail":
+		if query.Get("dialect") == "" || query.Get("action") == "" {
+			http.Error(w, "dialect and action are required", http.StatusBadRequest)
+			return
+		}
+		m.FailNext(query.Get("dialect"), query.Get("action"), query.Get("response"))
+	case "sms":
+		id, err := strconv.Atoi(query.Get("id"))
+		if err != nil {
+			http.Error(w, "invalid id", http.StatusBadRequest)
+			return
+		}
+		text := query.Get("text")
+		if text == "" {
+			text = m.smsCode()
+		}
+		if err := m.DeliverSMS(id, text); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+	case "reset":
+		m.Reset()
+	case "activations":
+		writeJSON(w, m.Activations())
+		return
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, map[string]string{"status": "ok"})
+}
+
+// scriptedFailure pops the next scripted response for dialect:action.
+func (m *Mock) scriptedFailure(dialect, action string) (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := dialect + ":" + action
+	queue := m.failures[key]
+	if len(queue) == 0 {
+		return "", false
+	}
+	m.failures[key] = queue[1:]
+	return queue[0], true
+}
+
+// buy reserves stock and creates an activation, or returns nil when out of stock.
+func (m *Mock) buy(vendor, dialect, code string) *Activation {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	left, ok := m.stock[code]
+	if !ok {
+		left = m.cfg.DefaultStock
+	}
+	if left == 0 {
+		return nil
+	}
+	if left > 0 {
+		m.stock[code] = left - 1
+	}
+
+	m.nextID++
+	activation := &Activation{
+		ID:      m.nextID,
+		Vendor:  vendor,
+		Dialect: dialect,
+		Code:    code,
+		Number:  fmt.Sprintf("9%09d", rand.Intn(1000000000)),
+		Status:  statusWaiting,
+		SMS:     []string{},
+		ReadyAt: time.Now().Add(m.cfg.SMSDelay),
+	}
+	m.activations[activation.ID] = activation
+	return activation
+}
+
+// lookup returns a copy of the activation after delivering any SMS that
+// became due.
+func (m *Mock) lookup(id string) (Activation, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	activation, ok := m.activationByID(id)
+	if !ok {
+		return Activation{}, false
+	}
+	if activation.Status == statusWaiting && !time.Now().Before(activation.ReadyAt) {
+		activation.SMS = append(activation.SMS, m.smsCode())
+		activation.Status = statusReceived
+	}
+	return *activation, true
+}
+
+func (m *Mock) activationByID(id string) (*Activation, bool) {
+	n, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, false
+	}
+	activation, ok := m.activations[n]
+	return activation, ok
+}
+
+// cancel marks the activation cancelled; it fails once an SMS has arrived.
+func (m *Mock) cancel(id string) (Activation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	activation, ok := m.activationByID(id)
+	if !ok {
+		return Activation{}, fmt.Errorf("not found")
+	}
+	if len(activation.SMS) > 0 {
+		return *activation, fmt.Errorf("has sms")
+	}
+	activation.Status = statusCancelled
+	return *activation, nil
+}
+
+// requestNext waits for another SMS on a received activation.
+func (m *Mock) requestNext(id string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	activation, ok := m.activationByID(id)
+	if !ok || activation.Status == statusCancelled {
+		return false
+	}
+	activation.Status = statusWaiting
+	activation.ReadyAt = time.Now().Add(m.cfg.SMSDelay)
+	return true
+}
+
+func (m *Mock) smsCode() string {
+	if m.cfg.SMSCode != "" {
+		return m.cfg.SMSCode
+	}
+	return fmt.Sprintf("%06d", rand.Intn(1000000))
+}
+
+func lastSMS(activation Activation) string {
+	if len(activation.SMS) == 0 {
+		return ""
+	}
+	return activation.SMS[len(activation.SMS)-1]
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeText(w http.ResponseWriter, body string) {
+	w.Header().Set("Content-Type", "text/plain")
+	fmt.Fprint(w, body)
+}
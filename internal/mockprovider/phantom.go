@@ -0,0 +1,114 @@
+package mockprovider
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// servePhantom emulates the phantomunion pickCode push API.
+func (m *Mock) servePhantom(w http.ResponseWriter, r *http.Request, vendor, action string) {
+	query := r.URL.Query()
+	if body, ok := m.scriptedFailure(DialectPhantom, action); ok {
+		writeText(w, body)
+		return
+	}
+
+	switch action {
+	case "ticket":
+		if query.Get("key") == "" {
+			writeJSON(w, map[string]interface{}{"code": "201", "message": "key is required"})
+			return
+		}
+		writeJSON(w, map[string]interface{}{"code": "200", "message": "success", "data": map[string]string{"token": "mock-token"}})
+
+	case "buyCandy":
+		activation := m.buy(vendor, DialectPhantom, query.Get("businessCode"))
+		if activation == nil {
+			writeJSON(w, map[string]interface{}{"code": "221", "message": "no stock"})
+			return
+		}
+		writeJSON(w, map[string]interface{}{
+			"code":    "200",
+			"message": "success",
+			"data": map[string]interface{}{
+				"phoneNumber": []map[string]string{{
+					"number":       "+91" + activation.Number,
+					"businessCode": activation.Code,
+					"serialNumber": fmt.Sprint(activation.ID),
+					"country":      "IN",
+				}},
+				"balance": fmt.Sprintf("%.2f", m.cfg.Balance),
+			},
+		})
+
+	case "sweetWrapper":
+		id := query.Get("serialNumber")
+		activation, ok := m.lookup(id)
+		switch {
+		case !ok:
+			writeJSON(w, map[string]interface{}{"code": "210", "message": "serial number not found"})
+		case activation.Status == statusCancelled:
+			writeJSON(w, map[string]interface{}{"code": "245", "message": "number released"})
+		default:
+			writeJSON(w, map[string]interface{}{
+				"code":    "200",
+				"message": "success",
+				"data": map[string]interface{}{
+					"verificationCode": []map[string]string{{
+						"serialNumber": id,
+						"vc":           lastSMS(activation),
+						"businessCode": activation.Code,
+					}},
+				},
+			})
+		}
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// serveCcpayBridge emulates the php.paidsms.in bridge used for server 9
+// cancels and balance.
+func (m *Mock) serveCcpayBridge(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	action := query.Get("type")
+	if body, ok := m.scriptedFailure(DialectPhantom, action); ok {
+		writeText(w, body)
+		return
+	}
+
+	switch action {
+	case "cancel":
+		number := query.Get("number")
+		if len(number) == 12 {
+			number = strings.TrimPrefix(number, "91")
+		}
+		id, ok := m.idByNumber(number)
+		if !ok {
+			writeText(w, "failed: number not found")
+			return
+		}
+		if _, err := m.cancel(id); err != nil {
+			writeText(w, "failed: "+err.Error())
+			return
+		}
+		writeText(w, "success")
+	case "balance":
+		writeText(w, fmt.Sprintf("%.2f", m.cfg.Balance))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (m *Mock) idByNumber(number string) (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, activation := range m.activations {
+		if activation.Number == number && activation.Dialect == DialectPhantom {
+			return fmt.Sprint(id), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,74 @@
+package mockprovider
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// serveSmsMan emulates the sms-man.com control API.
+func (m *Mock) serveSmsMan(w http.ResponseWriter, r *http.Request, vendor, action string) {
+	query := r.URL.Query()
+	if body, ok := m.scriptedFailure(DialectSmsMan, action); ok {
+		writeText(w, body)
+		return
+	}
+	if query.Get("token") == "" {
+		writeJSON(w, map[string]interface{}{"success": false, "error_code": "wrong_token", "error_msg": "Wrong token!"})
+		return
+	}
+
+	switch action {
+	case "get-number":
+		activation := m.buy(vendor, DialectSmsMan, query.Get("application_id"))
+		if activation == nil {
+			writeJSON(w, map[string]interface{}{"success": false, "error_code": "no_numbers", "error_msg": "No numbers"})
+			return
+		}
+		writeJSON(w, map[string]interface{}{"request_id": activation.ID, "number": "91" + activation.Number})
+
+	case "get-sms":
+		id := query.Get("request_id")
+		activation, ok := m.lookup(id)
+		switch {
+		case !ok || activation.Status == statusCancelled:
+			writeJSON(w, map[string]interface{}{"request_id": id, "error_code": "wrong_status", "error_msg": "Wrong status"})
+		case activation.Status == statusReceived:
+			writeJSON(w, map[string]interface{}{"request_id": id, "number": "91" + activation.Number, "sms_code": lastSMS(activation)})
+		default:
+			writeJSON(w, map[string]interface{}{"request_id": id, "number": "91" + activation.Number, "error_code": "wait_sms", "error_msg": "Still waiting..."})
+		}
+
+	case "set-status":
+		id := query.Get("request_id")
+		switch query.Get("status") {
+		case "reject":
+			if _, err := m.cancel(id); err != nil {
+				writeJSON(w, map[string]interface{}{"success": false, "error_code": "wrong_status", "error_msg": err.Error()})
+				return
+			}
+			writeJSON(w, map[string]interface{}{"request_id": id, "success": true})
+		case "retrysms":
+			if !m.requestNext(id) {
+				writeJSON(w, map[string]interface{}{"success": false, "error_code": "wrong_status"})
+				return
+			}
+			writeJSON(w, map[string]interface{}{"request_id": id, "success": true, "status": "ACCESS_RETRY_GET"})
+		default:
+			writeJSON(w, map[string]interface{}{"success": false, "error_code": "wrong_status"})
+		}
+
+	case "get-balance":
+		writeJSON(w, map[string]string{"balance": fmt.Sprintf("%.2f", m.cfg.Balance)})
+
+	case "get-prices":
+		country := query.Get("country_id")
+		if _, err := strconv.Atoi(country); err != nil {
+			country = "14"
+		}
+		writeJSON(w, map[string]interface{}{country: m.priceList("")})
+
+	default:
+		http.NotFound(w, r)
+	}
+}
@@ -0,0 +1,110 @@
+// Package money holds rupee amounts as an integer number of paise so that
+// prices, discounts and balances add up exactly.
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Paise is an amount in paise (1/100 rupee). It marshals to JSON as a rupee
+// number with two decimals and is stored in Mongo as an int64.
+type Paise int64
+
+var ErrInvalidAmount = errors.New("INVALID_AMOUNT")
+
+// maxRupees is the largest whole rupee part Parse accepts, so that the amount
+// in paise, rounding included, fits in an int64.
+const maxRupees = (math.MaxInt64 - 100) / 100
+
+// Parse reads a decimal rupee string such as "12", "12.5" or "-0.05".
+// Digits past the second decimal are rounded half away from zero.
+func Parse(s string) (Paise, error) {
+	s = strings.TrimSpace(s)
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+	whole, fraction, _ := strings.Cut(s, ".")
+	if whole == "" && fraction == "" {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+	if !digits(whole) || !digits(fraction) {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+
+	var rupees int64
+	if whole != "" {
+		var err error
+		rupees, err = strconv.ParseInt(whole, 10, 64)
+		if err != nil || rupees > maxRupees {
+			return 0, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+		}
+	}
+	cents := int64(0)
+	for i := 0; i < 2; i++ {
+		cents *= 10
+		if i < len(fraction) {
+			cents += int64(fraction[i] - '0')
+		}
+	}
+	if len(fraction) > 2 && fraction[2] >= '5' {
+		cents++
+	}
+
+	p := Paise(rupees*100 + cents)
+	if negative {
+		p = -p
+	}
+	return p, nil
+}
+
+// FromFloat rounds a rupee float to the nearest paisa.
+func FromFloat(rupees float64) Paise {
+	return Paise(math.Round(rupees * 100))
+}
+
+// Float64 is the amount in rupees, for display and legacy float fields.
+func (p Paise) Float64() float64 {
+	return float64(p) / 100
+}
+
+// String formats the amount in rupees with two decimals, e.g. "12.50".
+func (p Paise) String() string {
+	sign := ""
+	abs := int64(p)
+	if abs < 0 {
+		sign = "-"
+		abs = -abs
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, abs/100, abs%100)
+}
+
+func (p Paise) MarshalJSON() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// UnmarshalJSON accepts a rupee number or string.
+func (p *Paise) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if s == "null" || s == "" {
+		*p = 0
+		return nil
+	}
+	parsed, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*p = parsed
+	return nil
+}
+
+func digits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
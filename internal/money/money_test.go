@@ -0,0 +1,107 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	maxWhole := strconv.FormatInt(maxRupees, 10)
+	tests := []struct {
+		in   string
+		want Paise
+		err  bool
+	}{
+		{in: "12", want: 1200},
+		{in: "12.5", want: 1250},
+		{in: "12.50", want: 1250},
+		{in: " 0.05 ", want: 5},
+		{in: ".5", want: 50},
+		{in: "7.", want: 700},
+		{in: "+3", want: 300},
+		{in: "-0.05", want: -5},
+		{in: "1.234", want: 123},
+		{in: "1.235", want: 124},
+		{in: "0.995", want: 100},
+		{in: "-1.005", want: -101},
+		{in: maxWhole + ".99", want: Paise(maxRupees*100 + 99)},
+		{in: maxWhole + ".999", want: Paise(maxRupees*100 + 100)},
+		{in: "", err: true},
+		{in: ".", err: true},
+		{in: "-", err: true},
+		{in: "abc", err: true},
+		{in: "1e3", err: true},
+		{in: "1,000", err: true},
+		{in: "1.2.3", err: true},
+		{in: "--1", err: true},
+		{in: strconv.FormatInt(maxRupees+1, 10), err: true},
+		{in: "92233720368547758", err: true},
+		{in: "99999999999999999999", err: true},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.in)
+		if tt.err {
+			if !errors.Is(err, ErrInvalidAmount) {
+				t.Errorf("Parse(%q) = %d, %v; want ErrInvalidAmount", tt.in, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("Parse(%q) = %d, %v; want %d", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		in   Paise
+		want string
+	}{
+		{0, "0.00"},
+		{5, "0.05"},
+		{1250, "12.50"},
+		{-5, "-0.05"},
+		{-1250, "-12.50"},
+		{math.MaxInt64, "92233720368547758.07"},
+	}
+	for _, tt := range tests {
+		if got := tt.in.String(); got != tt.want {
+			t.Errorf("Paise(%d).String() = %s, want %s", int64(tt.in), got, tt.want)
+		}
+		if back, err := Parse(tt.want); tt.in != math.MaxInt64 && (err != nil || back != tt.in) {
+			t.Errorf("Parse(%s) = %d, %v; want %d", tt.want, back, err, int64(tt.in))
+		}
+	}
+}
+
+func TestFromFloat(t *testing.T) {
+	for in, want := range map[float64]Paise{0.1 + 0.2: 30, 12.345: 1235, -0.005: -1, 99.99: 9999} {
+		if got := FromFloat(in); got != want {
+			t.Errorf("FromFloat(%v) = %d, want %d", in, got, want)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	var v struct {
+		A Paise `json:"a"`
+		B Paise `json:"b"`
+		C Paise `json:"c"`
+	}
+	if err := json.Unmarshal([]byte(`{"a": 12.5, "b": "0.05", "c": null}`), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.A != 1250 || v.B != 5 || v.C != 0 {
+		t.Errorf("Unmarshal = %+v", v)
+	}
+	out, err := json.Marshal(v)
+	if err != nil || string(out) != `{"a":12.50,"b":0.05,"c":0.00}` {
+		t.Errorf("Marshal = %s, %v", out, err)
+	}
+	if err := json.Unmarshal([]byte(`{"a": "ten"}`), &v); !errors.Is(err, ErrInvalidAmount) {
+		t.Errorf("Unmarshal of a bad amount error = %v, want ErrInvalidAmount", err)
+	}
+}
@@ -0,0 +1,185 @@
+// Package notify sends staff notifications about what happens on the site,
+// such as purchases, recharges and blocked users. Events are routed to the
+// channels configured in Mongo, each of which is a Telegram chat, a webhook
+// or a Slack/Discord-compatible chat webhook.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ranjankuldeep/fakeNumber/logs"
+)
+
+// EventType names a kind of event; channels subscribe to event types.
+type EventType string
+
+const (
+	EventNumberBought    EventType = "number.bought"
+	EventNumberOTP       EventType = "number.otp"
+	EventNumberCancelled EventType = "number.cancelled"
+	EventRechargeUPI     EventType = "recharge.upi"
+	EventRechargeTRX     EventType = "recharge.trx"
+	EventRechargeAdmin   EventType = "recharge.admin"
+	EventUserBlocked     EventType = "user.blocked"
+	EventSellingReport   EventType = "report.selling"
+)
+
+// EventTypes lists every event type, for configuring channels.
+func EventTypes() []EventType {
+	return []EventType{
+		EventNumberBought, EventNumberOTP, EventNumberCancelled,
+		EventRechargeUPI, EventRechargeTRX, EventRechargeAdmin,
+		EventUserBlocked, EventSellingReport,
+	}
+}
+
+// Field is one labelled value of an event.
+type Field struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Event is something staff are told about. Body, if set, is free text shown
+// after the fields.
+type Event struct {
+	Type   EventType `json:"type"`
+	Title  string    `json:"title"`
+	Fields []Field   `json:"fields,omitempty"`
+	Body   string    `json:"body,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+var ist = time.FixedZone("IST", 5*3600+30*60)
+
+// Text renders the event as a plain-text message.
+func (e Event) Text() string {
+	var b strings.Builder
+	b.WriteString(e.Title + "\n\n")
+	fmt.Fprintf(&b, "Date => %s\n\n", e.Time.In(ist).Format("02-01-2006 03:04:05 PM"))
+	for _, f := range e.Fields {
+		if strings.Contains(f.Value, "\n") {
+			fmt.Fprintf(&b, "%s => \n%s\n\n", f.Name, f.Value)
+		} else {
+			fmt.Fprintf(&b, "%s => %s\n\n", f.Name, f.Value)
+		}
+	}
+	b.WriteString(e.Body)
+	return b.String()
+}
+
+// Notifier delivers an event to one channel.
+type Notifier interface {
+	Notify(ctx context.Context, e Event) error
+}
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// Telegram sends events as messages from a bot to a chat.
+type Telegram struct {
+	Token  string
+	ChatID string
+}
+
+func (t Telegram) Notify(ctx context.Context, e Event) error {
+	form := url.Values{"chat_id": {t.ChatID}, "text": {e.Text()}}
+	endpoint := "https://api.telegram.org/bot" + t.Token + "/sendMessage"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		// The request URL contains the token, so don't let it reach the logs.
+		return fmt.Errorf("failed to send telegram message to chat %s", t.ChatID)
+	}
+	defer resp.Body.Close()
+	var response struct {
+		Ok          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return fmt.Errorf("telegram returned status %d", resp.StatusCode)
+	}
+	if !response.Ok {
+		return fmt.Errorf("telegram rejected message: %s", response.Description)
+	}
+	return nil
+}
+
+// Webhook posts events as JSON to URL. When Secret is set, the body is signed
+// with HMAC-SHA256 in the X-Signature header.
+type Webhook struct {
+	URL    string
+	Secret string
+}
+
+func (w Webhook) Notify(ctx context.Context, e Event) error {
+	body, err := json.Marshal(struct {
+		Event
+		Text string `json:"text"`
+	}{e, e.Text()})
+	if err != nil {
+		return err
+	}
+	headers := map[string]string{}
+	if w.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(w.Secret))
+		mac.Write(body)
+		headers["X-Signature"] = "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+	return postJSON(ctx, w.URL, body, headers)
+}
+
+// ChatWebhook posts events to a Slack or Discord incoming webhook. Slack
+// reads the text field and Discord the content field.
+type ChatWebhook struct {
+	URL string
+}
+
+func (w ChatWebhook) Notify(ctx context.Context, e Event) error {
+	text := "```\n" + e.Text() + "```"
+	body, err := json.Marshal(map[string]string{"text": text, "content": text})
+	if err != nil {
+		return err
+	}
+	return postJSON(ctx, w.URL, body, nil)
+}
+
+func postJSON(ctx context.Context, endpoint string, body []byte, headers map[string]string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// LogNotifier writes events to the application log.
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(ctx context.Context, e Event) error {
+	logs.Logger.Infof("Notification %s:\n%s", e.Type, e.Text())
+	return nil
+}
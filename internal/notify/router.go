@@ -0,0 +1,150 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// refreshInterval is how long the channel configuration is cached.
+const refreshInterval = time.Minute
+
+// Router sends each event to the enabled channels subscribed to its type.
+// When no channel is configured at all, events are logged so that they are
+// not lost silently.
+type Router struct {
+	db *mongo.Database
+
+	mu       sync.Mutex
+	channels []models.NotificationChannel
+	loadedAt time.Time
+}
+
+func NewRouter(db *mongo.Database) *Router {
+	return &Router{db: db}
+}
+
+// Invalidate makes the next event reload the channels from Mongo.
+func (r *Router) Invalidate() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.loadedAt = time.Time{}
+}
+
+func (r *Router) load(ctx context.Context) ([]models.NotificationChannel, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.loadedAt.IsZero() && time.Since(r.loadedAt) < refreshInterval {
+		return r.channels, nil
+	}
+	cursor, err := models.InitializeNotificationChannelCollection(r.db).Find(ctx, bson.M{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load notification channels: %w", err)
+	}
+	channels := []models.NotificationChannel{}
+	if err := cursor.All(ctx, &channels); err != nil {
+		return nil, fmt.Errorf("failed to load notification channels: %w", err)
+	}
+	r.channels = channels
+	r.loadedAt = time.Now()
+	return channels, nil
+}
+
+func (r *Router) Notify(ctx context.Context, e Event) error {
+	channels, err := r.load(ctx)
+	if err != nil {
+		return err
+	}
+	if len(channels) == 0 {
+		return LogNotifier{}.Notify(ctx, e)
+	}
+	var errs []error
+	for _, ch := range channels {
+		if !ch.Enabled || !Subscribed(ch, e.Type) {
+			continue
+		}
+		n, err := ChannelNotifier(ch)
+		if err == nil {
+			err = n.Notify(ctx, e)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("channel %s: %w", ch.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Subscribed reports whether ch receives events of type t.
+func Subscribed(ch models.NotificationChannel, t EventType) bool {
+	if len(ch.Events) == 0 {
+		return true
+	}
+	for _, event := range ch.Events {
+		if EventType(event) == t {
+			return true
+		}
+	}
+	return false
+}
+
+// ChannelNotifier builds the notifier for a configured channel.
+func ChannelNotifier(ch models.NotificationChannel) (Notifier, error) {
+	switch ch.Kind {
+	case models.ChannelTelegram:
+		if ch.Token == "" || ch.ChatID == "" {
+			return nil, errors.New("telegram channel needs a token and a chat id")
+		}
+		return Telegram{Token: ch.Token, ChatID: ch.ChatID}, nil
+	case models.ChannelWebhook:
+		if ch.URL == "" {
+			return nil, errors.New("webhook channel needs a url")
+		}
+		return Webhook{URL: ch.URL, Secret: ch.Secret}, nil
+	case models.ChannelChat:
+		if ch.URL == "" {
+			return nil, errors.New("chat channel needs a url")
+		}
+		return ChatWebhook{URL: ch.URL}, nil
+	case models.ChannelLog:
+		return LogNotifier{}, nil
+	}
+	return nil, fmt.Errorf("unknown channel kind %q", ch.Kind)
+}
+
+var (
+	mu       sync.RWMutex
+	notifier Notifier = LogNotifier{}
+)
+
+// SetNotifier replaces the notifier used by Publish.
+func SetNotifier(n Notifier) {
+	mu.Lock()
+	defer mu.Unlock()
+	notifier = n
+}
+
+// Reload drops cached channel configuration after it has been edited.
+func Reload() {
+	mu.RLock()
+	defer mu.RUnlock()
+	if r, ok := notifier.(*Router); ok {
+		r.Invalidate()
+	}
+}
+
+// Publish sends e through the current notifier, stamping its time if unset.
+func Publish(ctx context.Context, e Event) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	mu.RLock()
+	n := notifier
+	mu.RUnlock()
+	return n.Notify(ctx, e)
+}
@@ -0,0 +1,164 @@
+// Package orderstate owns the lifecycle of a number order. The state lives on
+// the order's transactionhistories document, which outlives the orders
+// document, and every change is appended to its transitions.
+package orderstate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type State string
+
+const (
+	Created        State = "CREATED"
+	NumberAssigned State = "NUMBER_ASSIGNED"
+	WaitingSMS     State = "WAITING_SMS"
+	SMSReceived    State = "SMS_RECEIVED"
+	Completed      State = "COMPLETED"
+	Cancelled      State = "CANCELLED"
+	Expired        State = "EXPIRED"
+	Refunded       State = "REFUNDED"
+)
+
+// Actors recorded on transitions.
+const (
+	ActorUser      = "user"
+	ActorAPI       = "api"
+	ActorUpstream  = "upstream"
+	ActorScheduler = "scheduler"
+)
+
+var (
+	ErrIllegalTransition = errors.New("ILLEGAL_ORDER_TRANSITION")
+	ErrOrderNotFound     = errors.New("ORDER_NOT_FOUND")
+)
+
+// transitions lists the states reachable from each state. SMS_RECEIVED may
+// repeat for multiple OTP orders; nothing that has received an SMS can be
+// cancelled or refunded.
+var transitions = map[State][]State{
+	Created:        {NumberAssigned, Cancelled},
+	NumberAssigned: {WaitingSMS, Cancelled, Expired},
+	WaitingSMS:     {SMSReceived, Cancelled, Expired},
+	SMSReceived:    {SMSReceived, Completed},
+	Cancelled:      {Refunded},
+	Expired:        {Refunded},
+}
+
+// CanTransition reports whether from may move to to.
+func CanTransition(from, to State) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Closed reports whether the order can no longer receive an SMS.
+func (s State) Closed() bool {
+	return s == Cancelled || s == Expired || s == Refunded
+}
+
+// Status is the legacy transactionhistories status for the state.
+func (s State) Status() string {
+	switch s {
+	case SMSReceived, Completed:
+		return "SUCCESS"
+	case Cancelled, Expired, Refunded:
+		return "CANCELLED"
+	}
+	return "PENDING"
+}
+
+// Current returns the state of a transaction, deriving it from the legacy
+// status for documents written before states were recorded. Every legacy
+// cancel was refunded at once, so a legacy CANCELLED order is REFUNDED.
+func Current(transaction models.TransactionHistory) State {
+	if transaction.State != "" {
+		return State(transaction.State)
+	}
+	switch transaction.Status {
+	case "SUCCESS":
+		return SMSReceived
+	case "CANCELLED":
+		return Refunded
+	}
+	return WaitingSMS
+}
+
+// Opened returns the state and history for a transaction being inserted
+// right after its number was bought.
+func Opened(actor, reason string) (string, []models.OrderTransition) {
+	now := time.Now()
+	return string(WaitingSMS), []models.OrderTransition{
+		{From: "", To: string(Created), Actor: actor, At: now},
+		{From: string(Created), To: string(NumberAssigned), Actor: actor, Reason: reason, At: now},
+		{From: string(NumberAssigned), To: string(WaitingSMS), Actor: actor, At: now},
+	}
+}
+
+// Transition moves the transaction matched by filter to the given state and
+// records who did it and why. extra is merged into the same update so that
+// related fields (otp, date_time) change atomically with the state. It
+// returns ErrIllegalTransition when the current state does not allow it,
+// including when another writer changed the state first.
+func Transition(ctx context.Context, collection *mongo.Collection, filter bson.M, to State, actor, reason string, extra bson.M) (State, error) {
+	var transaction models.TransactionHistory
+	err := collection.FindOne(ctx, filter).Decode(&transaction)
+	if err == mongo.ErrNoDocuments {
+		return "", ErrOrderNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	from := Current(transaction)
+	if !CanTransition(from, to) {
+		return from, fmt.Errorf("%w: %s -> %s", ErrIllegalTransition, from, to)
+	}
+
+	// Only apply the update if nobody moved the order in the meantime.
+	guarded := bson.M{"_id": transaction.ID}
+	if transaction.State != "" {
+		guarded["state"] = transaction.State
+	} else {
+		guarded["state"] = bson.M{"$exists": false}
+		guarded["status"] = transaction.Status
+	}
+
+	update := bson.M{}
+	for operator, fields := range extra {
+		update[operator] = fields
+	}
+	set, _ := update["$set"].(bson.M)
+	if set == nil {
+		set = bson.M{}
+	}
+	set["state"] = string(to)
+	set["status"] = to.Status()
+	set["updatedAt"] = time.Now()
+	update["$set"] = set
+	update["$push"] = bson.M{"transitions": models.OrderTransition{
+		From:   string(from),
+		To:     string(to),
+		Actor:  actor,
+		Reason: reason,
+		At:     time.Now(),
+	}}
+
+	result, err := collection.UpdateOne(ctx, guarded, update)
+	if err != nil {
+		return from, err
+	}
+	if result.MatchedCount == 0 {
+		return from, fmt.Errorf("%w: %s changed concurrently", ErrIllegalTransition, from)
+	}
+	return from, nil
+}
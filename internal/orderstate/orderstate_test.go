@@ -0,0 +1,102 @@
+package orderstate
+
+import (
+	"testing"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+)
+
+var allStates = []State{Created, NumberAssigned, WaitingSMS, SMSReceived, Completed, Cancelled, Expired, Refunded}
+
+func TestCanTransition(t *testing.T) {
+	allowed := map[[2]State]bool{
+		{Created, NumberAssigned}:    true,
+		{Created, Cancelled}:         true,
+		{NumberAssigned, WaitingSMS}: true,
+		{NumberAssigned, Cancelled}:  true,
+		{NumberAssigned, Expired}:    true,
+		{WaitingSMS, SMSReceived}:    true,
+		{WaitingSMS, Cancelled}:      true,
+		{WaitingSMS, Expired}:        true,
+		{SMSReceived, SMSReceived}:   true,
+		{SMSReceived, Completed}:     true,
+		{Cancelled, Refunded}:        true,
+		{Expired, Refunded}:          true,
+	}
+	for _, from := range allStates {
+		for _, to := range allStates {
+			if got, want := CanTransition(from, to), allowed[[2]State{from, to}]; got != want {
+				t.Errorf("CanTransition(%s, %s) = %v, want %v", from, to, got, want)
+			}
+		}
+	}
+}
+
+func TestClosedAndStatus(t *testing.T) {
+	tests := []struct {
+		state  State
+		closed bool
+		status string
+	}{
+		{Created, false, "PENDING"},
+		{NumberAssigned, false, "PENDING"},
+		{WaitingSMS, false, "PENDING"},
+		{SMSReceived, false, "SUCCESS"},
+		{Completed, false, "SUCCESS"},
+		{Cancelled, true, "CANCELLED"},
+		{Expired, true, "CANCELLED"},
+		{Refunded, true, "CANCELLED"},
+	}
+	for _, tt := range tests {
+		if got := tt.state.Closed(); got != tt.closed {
+			t.Errorf("%s.Closed() = %v, want %v", tt.state, got, tt.closed)
+		}
+		if got := tt.state.Status(); got != tt.status {
+			t.Errorf("%s.Status() = %s, want %s", tt.state, got, tt.status)
+		}
+	}
+}
+
+func TestCurrent(t *testing.T) {
+	tests := []struct {
+		name        string
+		transaction models.TransactionHistory
+		want        State
+	}{
+		{"recorded state", models.TransactionHistory{State: string(Expired), Status: "CANCELLED"}, Expired},
+		{"legacy success", models.TransactionHistory{Status: "SUCCESS"}, SMSReceived},
+		{"legacy cancel was refunded", models.TransactionHistory{Status: "CANCELLED"}, Refunded},
+		{"legacy pending", models.TransactionHistory{Status: "PENDING"}, WaitingSMS},
+	}
+	for _, tt := range tests {
+		if got := Current(tt.transaction); got != tt.want {
+			t.Errorf("%s: Current = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+	if CanTransition(Current(models.TransactionHistory{Status: "CANCELLED"}), Refunded) {
+		t.Error("a legacy cancelled order could be refunded again")
+	}
+}
+
+func TestOpened(t *testing.T) {
+	state, transitions := Opened(ActorUser, "server 1")
+	if state != string(WaitingSMS) {
+		t.Errorf("Opened state = %s, want %s", state, WaitingSMS)
+	}
+	from := State("")
+	for i, tr := range transitions {
+		if State(tr.From) != from {
+			t.Errorf("transition %d starts at %q, want %q", i, tr.From, from)
+		}
+		if from != "" && !CanTransition(from, State(tr.To)) {
+			t.Errorf("transition %d %s -> %s is not allowed", i, tr.From, tr.To)
+		}
+		if tr.Actor != ActorUser {
+			t.Errorf("transition %d actor = %s, want %s", i, tr.Actor, ActorUser)
+		}
+		from = State(tr.To)
+	}
+	if from != WaitingSMS {
+		t.Errorf("transitions end at %s, want %s", from, WaitingSMS)
+	}
+}
@@ -0,0 +1,171 @@
+// Package otp issues and checks the one-time codes emailed for signup,
+// password reset and email changes. Codes are kept hashed in Mongo, scoped to
+// an email and a purpose, and removed by a TTL index, so they survive
+// restarts and are shared by every instance.
+package otp
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Purpose scopes a code to one flow, so a code sent for one cannot be used
+// for another.
+type Purpose string
+
+const (
+	PurposeSignup         Purpose = "signup"
+	PurposeForgotPassword Purpose = "forgot-password"
+	PurposeEmailChange    Purpose = "email-change"
+)
+
+const (
+	// CodeTTL is how long a code can be entered.
+	CodeTTL = 10 * time.Minute
+	// verifiedTTL is how long a verified code can be redeemed with Consume.
+	verifiedTTL = 15 * time.Minute
+	// maxAttempts is how many wrong codes are allowed before a new one must
+	// be requested.
+	maxAttempts = 5
+	// resendCooldown is the minimum time between two codes for the same
+	// email and purpose.
+	resendCooldown = time.Minute
+)
+
+var (
+	ErrCooldown        = errors.New("please wait before requesting another OTP")
+	ErrNotFound        = errors.New("OTP not found or expired")
+	ErrInvalid         = errors.New("invalid OTP")
+	ErrTooManyAttempts = errors.New("too many attempts, please request a new OTP")
+	ErrNotVerified     = errors.New("OTP not verified")
+)
+
+func collection(db *mongo.Database) *mongo.Collection {
+	return models.InitializeOTPCollection(db)
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func hash(email string, purpose Purpose, code string) string {
+	sum := sha256.Sum256([]byte(string(purpose) + ":" + email + ":" + code))
+	return hex.EncodeToString(sum[:])
+}
+
+func generateCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// Issue creates a new code for email and purpose, replacing any earlier one,
+// and returns it for sending. It fails with ErrCooldown if a code was issued
+// less than resendCooldown ago.
+func Issue(ctx context.Context, db *mongo.Database, purpose Purpose, email string) (string, error) {
+	email = normalizeEmail(email)
+	code, err := generateCode()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	_, err = collection(db).UpdateOne(ctx,
+		bson.M{"email": email, "purpose": purpose, "sentAt": bson.M{"$not": bson.M{"$gt": now.Add(-resendCooldown)}}},
+		bson.M{"$set": bson.M{
+			"hash":      hash(email, purpose, code),
+			"attempts":  0,
+			"verified":  false,
+			"sentAt":    now,
+			"expiresAt": now.Add(CodeTTL),
+		}},
+		options.Update().SetUpsert(true),
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		// The filter missed because of the cooldown, and the upsert hit the
+		// existing code.
+		return "", ErrCooldown
+	}
+	if err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// Discard removes the code for email and purpose, e.g. when it could not be
+// sent, so that the cooldown does not block a retry.
+func Discard(ctx context.Context, db *mongo.Database, purpose Purpose, email string) error {
+	_, err := collection(db).DeleteOne(ctx, bson.M{"email": normalizeEmail(email), "purpose": purpose})
+	return err
+}
+
+// Verify checks code and marks it verified. Every attempt is counted
+// against maxAttempts before the code is compared, in the same write that
+// checks the limit, so concurrent guesses cannot exceed it.
+func Verify(ctx context.Context, db *mongo.Database, purpose Purpose, email, code string) error {
+	email = normalizeEmail(email)
+	col := collection(db)
+	live := bson.M{"$gt": time.Now()}
+
+	var doc models.OTP
+	err := col.FindOneAndUpdate(ctx,
+		bson.M{"email": email, "purpose": purpose, "expiresAt": live, "verified": false, "attempts": bson.M{"$lt": maxAttempts}},
+		bson.M{"$inc": bson.M{"attempts": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&doc)
+	if err == mongo.ErrNoDocuments {
+		// Either there is no live code, it is already verified, or it has
+		// used up its attempts.
+		err = col.FindOne(ctx, bson.M{"email": email, "purpose": purpose, "expiresAt": live}).Decode(&doc)
+		switch {
+		case err == mongo.ErrNoDocuments:
+			return ErrNotFound
+		case err != nil:
+			return err
+		case doc.Verified:
+			return nil
+		}
+		return ErrTooManyAttempts
+	} else if err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare([]byte(doc.Hash), []byte(hash(email, purpose, strings.TrimSpace(code)))) != 1 {
+		return ErrInvalid
+	}
+	// Only mark this code, in case a new one has been issued meanwhile.
+	_, err = col.UpdateOne(ctx, bson.M{"_id": doc.ID, "hash": doc.Hash}, bson.M{"$set": bson.M{
+		"verified":  true,
+		"expiresAt": time.Now().Add(verifiedTTL),
+	}})
+	return err
+}
+
+// Consume redeems a verified code, which can then not be used again. It
+// fails with ErrNotVerified if there is no verified code for email and
+// purpose.
+func Consume(ctx context.Context, db *mongo.Database, purpose Purpose, email string) error {
+	err := collection(db).FindOneAndDelete(ctx, bson.M{
+		"email":     normalizeEmail(email),
+		"purpose":   purpose,
+		"verified":  true,
+		"expiresAt": bson.M{"$gt": time.Now()},
+	}).Err()
+	if err == mongo.ErrNoDocuments {
+		return ErrNotVerified
+	}
+	return err
+}
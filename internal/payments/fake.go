@@ -0,0 +1,34 @@
+package payments
+
+import (
+	"context"
+	"sync"
+)
+
+// Fake is an in-memory verifier for tests and local development. Install it
+// with SetOverride and add the payments it should know.
+type Fake struct {
+	mu       sync.Mutex
+	payments map[string]Payment
+}
+
+func NewFake() *Fake {
+	return &Fake{payments: make(map[string]Payment)}
+}
+
+// Add makes p known to the fake, replacing any payment with the same id.
+func (f *Fake) Add(p Payment) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.payments[p.TransactionID] = p
+}
+
+func (f *Fake) Verify(ctx context.Context, transactionID string) (Payment, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, ok := f.payments[transactionID]
+	if !ok {
+		return Payment{}, ErrNotFound
+	}
+	return p, nil
+}
@@ -0,0 +1,189 @@
+package payments
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"time"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/internal/money"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// IntentTTL is how long a user has to pay an intent.
+	IntentTTL = 15 * time.Minute
+	// maxOpenIntents bounds the unpaid intents a user can hold at once.
+	maxOpenIntents = 5
+	// referenceLength is the number of random characters in a reference.
+	referenceLength = 10
+	referencePrefix = "FN"
+)
+
+const referenceAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+var (
+	ErrIntentNotFound    = errors.New("payment intent not found")
+	ErrIntentExpired     = errors.New("payment intent has expired")
+	ErrIntentClosed      = errors.New("payment intent is already paid")
+	ErrTooManyIntents    = errors.New("too many open payment intents")
+	ErrAmountMismatch    = errors.New("payment amount does not match the payment intent")
+	ErrReferenceMismatch = errors.New("payment reference does not match the payment intent")
+	ErrMissingReference  = errors.New("payment has no reference, pay with the payment intent's note")
+)
+
+func intentCollection(db *mongo.Database) *mongo.Collection {
+	return models.InitializePaymentIntentCollection(db)
+}
+
+func newReference() (string, error) {
+	buf := make([]byte, referenceLength)
+	max := big.NewInt(int64(len(referenceAlphabet)))
+	for i := range buf {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		buf[i] = referenceAlphabet[n.Int64()]
+	}
+	return referencePrefix + string(buf), nil
+}
+
+// CreateIntent opens an intent for userID to pay amount to payeeVPA. Asking
+// again for an amount that already has an open intent returns that intent.
+func CreateIntent(ctx context.Context, db *mongo.Database, userID primitive.ObjectID, amount money.Paise, payeeVPA string) (models.PaymentIntent, error) {
+	col := intentCollection(db)
+	now := time.Now()
+	var existing models.PaymentIntent
+	err := col.FindOne(ctx, bson.M{
+		"userId":    userID,
+		"amount":    amount,
+		"status":    models.IntentOpen,
+		"expiresAt": bson.M{"$gt": now},
+	}).Decode(&existing)
+	if err == nil {
+		return existing, nil
+	} else if err != mongo.ErrNoDocuments {
+		return models.PaymentIntent{}, err
+	}
+	open, err := col.CountDocuments(ctx, bson.M{
+		"userId":    userID,
+		"status":    models.IntentOpen,
+		"expiresAt": bson.M{"$gt": now},
+	})
+	if err != nil {
+		return models.PaymentIntent{}, err
+	}
+	if open >= maxOpenIntents {
+		return models.PaymentIntent{}, ErrTooManyIntents
+	}
+
+	reference, err := newReference()
+	if err != nil {
+		return models.PaymentIntent{}, err
+	}
+	intent := models.PaymentIntent{
+		ID:        primitive.NewObjectID(),
+		UserID:    userID,
+		Reference: reference,
+		Amount:    amount,
+		PayeeVPA:  payeeVPA,
+		Status:    models.IntentOpen,
+		ExpiresAt: now.Add(IntentTTL),
+		CreatedAt: now,
+	}
+	if _, err := col.InsertOne(ctx, intent); err != nil {
+		return models.PaymentIntent{}, err
+	}
+	return intent, nil
+}
+
+// OpenIntent returns userID's intent intentID if it can still be paid.
+func OpenIntent(ctx context.Context, db *mongo.Database, userID, intentID primitive.ObjectID) (models.PaymentIntent, error) {
+	var intent models.PaymentIntent
+	err := intentCollection(db).FindOne(ctx, bson.M{"_id": intentID, "userId": userID}).Decode(&intent)
+	if err == mongo.ErrNoDocuments {
+		return intent, ErrIntentNotFound
+	} else if err != nil {
+		return intent, err
+	}
+	if intent.Status != models.IntentOpen {
+		return intent, ErrIntentClosed
+	}
+	if !time.Now().Before(intent.ExpiresAt) {
+		return intent, ErrIntentExpired
+	}
+	return intent, nil
+}
+
+// IntentByReference returns the intent with the given reference, whatever
+// its status.
+func IntentByReference(ctx context.Context, db *mongo.Database, reference string) (models.PaymentIntent, error) {
+	var intent models.PaymentIntent
+	if reference == "" {
+		return intent, ErrIntentNotFound
+	}
+	err := intentCollection(db).FindOne(ctx, bson.M{"reference": reference}).Decode(&intent)
+	if err == mongo.ErrNoDocuments {
+		return intent, ErrIntentNotFound
+	}
+	return intent, err
+}
+
+// Match checks that payment is the one intent asked for. The reference is
+// the only thing tying a payment to the user who made it, so a payment whose
+// gateway did not report the note is refused rather than matched by amount;
+// anyone who saw its transaction id could otherwise claim it.
+func Match(intent models.PaymentIntent, payment Payment) error {
+	if payment.Amount != intent.Amount {
+		return ErrAmountMismatch
+	}
+	if payment.Reference == "" {
+		return ErrMissingReference
+	}
+	if payment.Reference != intent.Reference {
+		return ErrReferenceMismatch
+	}
+	return nil
+}
+
+// ListIntents returns userID's most recent intents, newest first, with
+// lapsed open intents reported as expired.
+func ListIntents(ctx context.Context, db *mongo.Database, userID primitive.ObjectID, limit int64) ([]models.PaymentIntent, error) {
+	cursor, err := intentCollection(db).Find(ctx, bson.M{"userId": userID},
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}).SetLimit(limit))
+	if err != nil {
+		return nil, err
+	}
+	intents := []models.PaymentIntent{}
+	if err := cursor.All(ctx, &intents); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for i := range intents {
+		if intents[i].Status == models.IntentOpen && !now.Before(intents[i].ExpiresAt) {
+			intents[i].Status = models.IntentExpired
+		}
+	}
+	return intents, nil
+}
+
+// UPILink is the upi://pay deep link for an intent. Payer apps prefill the
+// amount and the note, which carries the intent's reference back to us.
+func UPILink(intent models.PaymentIntent, payeeName string) string {
+	query := fmt.Sprintf("pa=%s&pn=%s&am=%s&cu=INR&tn=%s&tr=%s",
+		url.PathEscape(intent.PayeeVPA),
+		url.PathEscape(payeeName),
+		intent.Amount.String(),
+		intent.Reference,
+		intent.Reference,
+	)
+	return "upi://pay?" + query
+}
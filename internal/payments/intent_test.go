@@ -0,0 +1,98 @@
+package payments
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/internal/money"
+)
+
+func testIntent() models.PaymentIntent {
+	created := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	return models.PaymentIntent{
+		Reference: "FNABCDEFGH23",
+		Amount:    money.Paise(15000),
+		PayeeVPA:  "shop@upi",
+		Status:    models.IntentOpen,
+		CreatedAt: created,
+		ExpiresAt: created.Add(IntentTTL),
+	}
+}
+
+func TestMatch(t *testing.T) {
+	intent := testIntent()
+	tests := []struct {
+		name    string
+		payment Payment
+		want    error
+	}{
+		{
+			name:    "amount and reference",
+			payment: Payment{Amount: intent.Amount, Reference: intent.Reference},
+		},
+		{
+			name:    "reference wins over time",
+			payment: Payment{Amount: intent.Amount, Reference: intent.Reference, PaidAt: intent.CreatedAt.Add(-time.Hour)},
+		},
+		{
+			name:    "other amount",
+			payment: Payment{Amount: money.Paise(15050), Reference: intent.Reference},
+			want:    ErrAmountMismatch,
+		},
+		{
+			name:    "other reference",
+			payment: Payment{Amount: intent.Amount, Reference: "FNZZZZZZZZZZ"},
+			want:    ErrReferenceMismatch,
+		},
+		{
+			name:    "no reference",
+			payment: Payment{Amount: intent.Amount, PaidAt: intent.CreatedAt.Add(5 * time.Minute)},
+			want:    ErrMissingReference,
+		},
+		{
+			name:    "no reference, other amount",
+			payment: Payment{Amount: money.Paise(15050)},
+			want:    ErrAmountMismatch,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Match(intent, tt.payment); !errors.Is(err, tt.want) {
+				t.Errorf("Match error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewReference(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		ref, err := newReference()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(ref, referencePrefix) || len(ref) != len(referencePrefix)+referenceLength {
+			t.Fatalf("reference %q is not %s followed by %d characters", ref, referencePrefix, referenceLength)
+		}
+		for _, r := range ref[len(referencePrefix):] {
+			if !strings.ContainsRune(referenceAlphabet, r) {
+				t.Fatalf("reference %q has %q outside the alphabet", ref, r)
+			}
+		}
+		if seen[ref] {
+			t.Fatalf("reference %q repeated", ref)
+		}
+		seen[ref] = true
+	}
+}
+
+func TestUPILink(t *testing.T) {
+	got := UPILink(testIntent(), "Paid SMS")
+	want := "upi://pay?pa=shop@upi&pn=Paid%20SMS&am=150.00&cu=INR&tn=FNABCDEFGH23&tr=FNABCDEFGH23"
+	if got != want {
+		t.Errorf("UPILink = %s, want %s", got, want)
+	}
+}
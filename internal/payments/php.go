@@ -0,0 +1,77 @@
+package payments
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/internal/money"
+)
+
+const defaultPHPURL = "https://php.paidsms.in/u.php"
+
+func init() {
+	Register("php", func(api models.RechargeAPI) (Verifier, error) {
+		endpoint := api.VerifierURL
+		if endpoint == "" {
+			endpoint = defaultPHPURL
+		}
+		return &phpVerifier{endpoint: endpoint, client: &http.Client{Timeout: 15 * time.Second}}, nil
+	})
+}
+
+// phpVerifier asks the PHP bridge that reads the merchant UPI account. It
+// only knows completed payments, in whole rupees, and reports the payment
+// note only when the payer's app sent one.
+type phpVerifier struct {
+	endpoint string
+	client   *http.Client
+}
+
+// phpDateLayouts are the date formats the bridge has been seen to return. A
+// bare date is not a payment time and leaves PaidAt unset.
+var phpDateLayouts = []string{"2006-01-02 15:04:05", "02-01-2006 15:04:05", "2006-01-02T15:04:05"}
+
+func (v *phpVerifier) Verify(ctx context.Context, transactionID string) (Payment, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.endpoint+"?txn="+url.QueryEscape(transactionID), nil)
+	if err != nil {
+		return Payment{}, err
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return Payment{}, fmt.Errorf("UPI verifier: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var response struct {
+		Name   string `json:"name"`
+		Amount int    `json:"amount"`
+		Date   string `json:"date"`
+		Note   string `json:"note"`
+		Error  string `json:"error"`
+	}
+	// The bridge answers unknown transactions with an error field or a body
+	// that is not JSON at all.
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil || response.Error != "" {
+		return Payment{}, ErrNotFound
+	}
+	payment := Payment{
+		TransactionID: transactionID,
+		Amount:        money.FromFloat(float64(response.Amount)),
+		Payer:         response.Name,
+		Reference:     strings.TrimSpace(response.Note),
+		Status:        StatusSuccess,
+	}
+	for _, layout := range phpDateLayouts {
+		if t, err := time.ParseInLocation(layout, response.Date, time.FixedZone("IST", 5*3600+30*60)); err == nil {
+			payment.PaidAt = t
+			break
+		}
+	}
+	return payment, nil
+}
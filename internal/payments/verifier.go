@@ -0,0 +1,102 @@
+// Package payments verifies the payments users claim to have made before
+// their wallet is credited. Each recharge type is served by a Verifier chosen
+// from the recharge API document, so that gateways can be swapped without
+// touching the recharge handlers.
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/internal/money"
+)
+
+// Payment statuses.
+const (
+	StatusSuccess = "success"
+	StatusPending = "pending"
+	StatusFailed  = "failed"
+)
+
+// Payment is a verified transaction as reported by the gateway. Reference is
+// the note the payer sent with it, which names the payment intent.
+type Payment struct {
+	TransactionID string
+	Amount        money.Paise
+	Payer         string
+	Reference     string
+	PaidAt        time.Time
+	Status        string
+}
+
+// Verifier looks up a transaction with a payment gateway.
+type Verifier interface {
+	// Verify returns the payment for transactionID, or ErrNotFound if the
+	// gateway does not know it.
+	Verify(ctx context.Context, transactionID string) (Payment, error)
+}
+
+// Factory builds a verifier from its recharge API document.
+type Factory func(api models.RechargeAPI) (Verifier, error)
+
+var (
+	ErrNotFound        = errors.New("transaction not found")
+	ErrUnknownVerifier = errors.New("unknown payment verifier")
+)
+
+// defaultVerifiers names the verifier used when a recharge API document does
+// not choose one.
+var defaultVerifiers = map[string]string{
+	"upi": "php",
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Factory)
+	overrides  = make(map[string]Verifier)
+)
+
+// Register makes a verifier available under name.
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, exists := registry[name]; exists {
+		panic(fmt.Sprintf("payment verifier %q already registered", name))
+	}
+	registry[name] = factory
+}
+
+// SetOverride makes New return v for rechargeType whatever the document
+// says, e.g. a Fake in tests. A nil v removes the override.
+func SetOverride(rechargeType string, v Verifier) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if v == nil {
+		delete(overrides, rechargeType)
+		return
+	}
+	overrides[rechargeType] = v
+}
+
+// New returns the verifier for a recharge API document: the one named by its
+// Verifier field, or the default for its recharge type.
+func New(api models.RechargeAPI) (Verifier, error) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	if v, ok := overrides[api.RechargeType]; ok {
+		return v, nil
+	}
+	name := api.Verifier
+	if name == "" {
+		name = defaultVerifiers[api.RechargeType]
+	}
+	factory, ok := registry[name]
+	if !ok {
+		return nil, fmt.Errorf("%w %q for %s", ErrUnknownVerifier, name, api.RechargeType)
+	}
+	return factory(api)
+}
@@ -0,0 +1,103 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/internal/money"
+)
+
+func TestNewPicksVerifier(t *testing.T) {
+	v, err := New(models.RechargeAPI{RechargeType: "upi"})
+	if err != nil {
+		t.Fatalf("New(upi): %v", err)
+	}
+	if _, ok := v.(*phpVerifier); !ok {
+		t.Errorf("default upi verifier is %T, want *phpVerifier", v)
+	}
+	if _, err := New(models.RechargeAPI{RechargeType: "upi", Verifier: "nope"}); !errors.Is(err, ErrUnknownVerifier) {
+		t.Errorf("New with unknown verifier error = %v, want ErrUnknownVerifier", err)
+	}
+	if _, err := New(models.RechargeAPI{RechargeType: "card"}); !errors.Is(err, ErrUnknownVerifier) {
+		t.Errorf("New for a type without default error = %v, want ErrUnknownVerifier", err)
+	}
+}
+
+func TestFakeOverride(t *testing.T) {
+	fake := NewFake()
+	SetOverride("upi", fake)
+	defer SetOverride("upi", nil)
+
+	v, err := New(models.RechargeAPI{RechargeType: "upi", Verifier: "php"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != Verifier(fake) {
+		t.Fatalf("New returned %T, want the override", v)
+	}
+	if _, err := v.Verify(context.Background(), "T1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Verify of unknown id error = %v, want ErrNotFound", err)
+	}
+	fake.Add(Payment{TransactionID: "T1", Amount: money.Paise(15000), Status: StatusSuccess})
+	p, err := v.Verify(context.Background(), "T1")
+	if err != nil || p.Amount != money.Paise(15000) {
+		t.Errorf("Verify(T1) = %+v, %v", p, err)
+	}
+
+	SetOverride("upi", nil)
+	if v, _ := New(models.RechargeAPI{RechargeType: "upi"}); v == Verifier(fake) {
+		t.Error("override still active after removing it")
+	}
+}
+
+func TestPHPVerifier(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("txn") {
+		case "412345678901":
+			fmt.Fprint(w, `{"name":"A Payer","amount":150,"date":"2024-05-01 10:20:30"}`)
+		case "dateonly":
+			fmt.Fprint(w, `{"name":"A Payer","amount":150,"date":"2024-05-01","note":"FNABCDEFGH23"}`)
+		case "missing":
+			fmt.Fprint(w, `{"error":"Transaction not found"}`)
+		default:
+			fmt.Fprint(w, "<html>oops</html>")
+		}
+	}))
+	defer server.Close()
+
+	v, err := New(models.RechargeAPI{RechargeType: "upi", VerifierURL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := v.Verify(context.Background(), "412345678901")
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	ist := time.FixedZone("IST", 5*3600+30*60)
+	want := Payment{
+		TransactionID: "412345678901",
+		Amount:        money.Paise(15000),
+		Payer:         "A Payer",
+		PaidAt:        time.Date(2024, 5, 1, 10, 20, 30, 0, ist),
+		Status:        StatusSuccess,
+	}
+	if p.TransactionID != want.TransactionID || p.Amount != want.Amount || p.Payer != want.Payer ||
+		!p.PaidAt.Equal(want.PaidAt) || p.Status != want.Status || p.Reference != "" {
+		t.Errorf("Verify = %+v, want %+v", p, want)
+	}
+	p, err = v.Verify(context.Background(), "dateonly")
+	if err != nil || !p.PaidAt.IsZero() || p.Reference != "FNABCDEFGH23" {
+		t.Errorf("Verify(dateonly) = %+v, %v, want no payment time", p, err)
+	}
+	for _, id := range []string{"missing", "garbage"} {
+		if _, err := v.Verify(context.Background(), id); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Verify(%s) error = %v, want ErrNotFound", id, err)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package payments
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/internal/money"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SignatureHeader carries the hex HMAC-SHA256 of a webhook body, optionally
+// prefixed with "sha256=".
+const SignatureHeader = "X-Signature"
+
+var ErrInvalidPayload = errors.New("invalid webhook payload")
+
+// ValidSignature reports whether signature is the HMAC-SHA256 of body under
+// secret.
+func ValidSignature(secret string, body []byte, signature string) bool {
+	if secret == "" {
+		return false
+	}
+	got, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(signature), "sha256="))
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// WebhookParser decodes one provider's webhook body into a payment.
+type WebhookParser func(body []byte) (Payment, error)
+
+var (
+	parsersMu sync.RWMutex
+	parsers   = make(map[string]WebhookParser)
+)
+
+// RegisterWebhookParser sets the parser for a provider whose webhooks do not
+// use the generic format.
+func RegisterWebhookParser(provider string, parser WebhookParser) {
+	parsersMu.Lock()
+	defer parsersMu.Unlock()
+	parsers[provider] = parser
+}
+
+// ParseWebhook decodes a webhook from provider with its registered parser,
+// or as a generic webhook.
+func ParseWebhook(provider string, body []byte) (Payment, error) {
+	parsersMu.RLock()
+	parser, ok := parsers[provider]
+	parsersMu.RUnlock()
+	if !ok {
+		parser = parseGenericWebhook
+	}
+	return parser(body)
+}
+
+// parseGenericWebhook reads
+//
+//	{"transactionId": "...", "amount": "150.00", "reference": "FN...",
+//	 "payer": "...", "status": "success", "paidAt": "2006-01-02T15:04:05Z07:00"}
+func parseGenericWebhook(body []byte) (Payment, error) {
+	var payload struct {
+		TransactionID string      `json:"transactionId"`
+		Amount        json.Number `json:"amount"`
+		Reference     string      `json:"reference"`
+		Payer         string      `json:"payer"`
+		Status        string      `json:"status"`
+		PaidAt        time.Time   `json:"paidAt"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return Payment{}, ErrInvalidPayload
+	}
+	if payload.TransactionID == "" {
+		return Payment{}, ErrInvalidPayload
+	}
+	amount, err := money.Parse(payload.Amount.String())
+	if err != nil {
+		return Payment{}, ErrInvalidPayload
+	}
+	status := strings.ToLower(payload.Status)
+	switch status {
+	case StatusSuccess, StatusPending, StatusFailed:
+	default:
+		return Payment{}, ErrInvalidPayload
+	}
+	return Payment{
+		TransactionID: payload.TransactionID,
+		Amount:        amount,
+		Payer:         payload.Payer,
+		Reference:     strings.TrimSpace(payload.Reference),
+		PaidAt:        payload.PaidAt,
+		Status:        status,
+	}, nil
+}
+
+func webhookCollection(db *mongo.Database) *mongo.Collection {
+	return models.InitializePaymentWebhookCollection(db)
+}
+
+// StoreWebhook saves a newly received webhook.
+func StoreWebhook(ctx context.Context, db *mongo.Database, hook models.PaymentWebhook) error {
+	_, err := webhookCollection(db).InsertOne(ctx, hook)
+	return err
+}
+
+// SaveWebhookOutcome records the result of processing hook and counts the
+// attempt.
+func SaveWebhookOutcome(ctx context.Context, db *mongo.Database, hook models.PaymentWebhook) error {
+	set := bson.M{
+		"status":        hook.Status,
+		"error":         hook.Error,
+		"transactionId": hook.TransactionID,
+		"reference":     hook.Reference,
+		"processedAt":   time.Now(),
+	}
+	if !hook.UserID.IsZero() {
+		set["userId"] = hook.UserID
+		set["intentId"] = hook.IntentID
+	}
+	_, err := webhookCollection(db).UpdateOne(ctx, bson.M{"_id": hook.ID}, bson.M{
+		"$set": set,
+		"$inc": bson.M{"attempts": 1},
+	})
+	return err
+}
+
+// GetWebhook returns a stored webhook.
+func GetWebhook(ctx context.Context, db *mongo.Database, id primitive.ObjectID) (models.PaymentWebhook, error) {
+	var hook models.PaymentWebhook
+	err := webhookCollection(db).FindOne(ctx, bson.M{"_id": id}).Decode(&hook)
+	return hook, err
+}
+
+// ListWebhooks returns the most recent webhooks, newest first, optionally
+// only those of one provider or status.
+func ListWebhooks(ctx context.Context, db *mongo.Database, provider, status string, limit int64) ([]models.PaymentWebhook, error) {
+	filter := bson.M{}
+	if provider != "" {
+		filter["provider"] = provider
+	}
+	if status != "" {
+		filter["status"] = status
+	}
+	cursor, err := webhookCollection(db).Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "receivedAt", Value: -1}}).SetLimit(limit))
+	if err != nil {
+		return nil, err
+	}
+	hooks := []models.PaymentWebhook{}
+	if err := cursor.All(ctx, &hooks); err != nil {
+		return nil, err
+	}
+	return hooks, nil
+}
@@ -0,0 +1,88 @@
+package payments
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/money"
+)
+
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestValidSignature(t *testing.T) {
+	body := []byte(`{"transactionId":"T1"}`)
+	good := sign("s3cret", body)
+	tests := []struct {
+		name      string
+		secret    string
+		body      []byte
+		signature string
+		want      bool
+	}{
+		{name: "plain hex", secret: "s3cret", body: body, signature: good, want: true},
+		{name: "prefixed", secret: "s3cret", body: body, signature: "sha256=" + good, want: true},
+		{name: "upper case", secret: "s3cret", body: body, signature: strings.ToUpper(good), want: true},
+		{name: "other secret", secret: "other", body: body, signature: good},
+		{name: "tampered body", secret: "s3cret", body: []byte(`{"transactionId":"T2"}`), signature: good},
+		{name: "not hex", secret: "s3cret", body: body, signature: "zz"},
+		{name: "missing", secret: "s3cret", body: body},
+		{name: "no secret", body: body, signature: sign("", body)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ValidSignature(tt.secret, tt.body, tt.signature); got != tt.want {
+				t.Errorf("ValidSignature = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseGenericWebhook(t *testing.T) {
+	p, err := ParseWebhook("generic-test", []byte(`{
+		"transactionId": "T1", "amount": "150.50", "reference": " FNABCDEFGH23 ",
+		"payer": "A Payer", "status": "SUCCESS", "paidAt": "2024-05-01T10:20:30Z"}`))
+	if err != nil {
+		t.Fatalf("ParseWebhook: %v", err)
+	}
+	want := Payment{
+		TransactionID: "T1",
+		Amount:        money.Paise(15050),
+		Payer:         "A Payer",
+		Reference:     "FNABCDEFGH23",
+		PaidAt:        time.Date(2024, 5, 1, 10, 20, 30, 0, time.UTC),
+		Status:        StatusSuccess,
+	}
+	if p != want {
+		t.Errorf("ParseWebhook = %+v, want %+v", p, want)
+	}
+
+	for name, body := range map[string]string{
+		"not json":       `transactionId=T1`,
+		"no transaction": `{"amount":"1","status":"success"}`,
+		"bad amount":     `{"transactionId":"T1","amount":"1e3","status":"success"}`,
+		"unknown status": `{"transactionId":"T1","amount":"1","status":"refunded"}`,
+	} {
+		if _, err := ParseWebhook("generic-test", []byte(body)); !errors.Is(err, ErrInvalidPayload) {
+			t.Errorf("%s: ParseWebhook error = %v, want ErrInvalidPayload", name, err)
+		}
+	}
+}
+
+func TestRegisteredWebhookParser(t *testing.T) {
+	RegisterWebhookParser("custom-test", func(body []byte) (Payment, error) {
+		return Payment{TransactionID: string(body), Status: StatusPending}, nil
+	})
+	p, err := ParseWebhook("custom-test", []byte("T9"))
+	if err != nil || p.TransactionID != "T9" || p.Status != StatusPending {
+		t.Errorf("ParseWebhook = %+v, %v; want the custom parser's payment", p, err)
+	}
+}
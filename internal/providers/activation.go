@@ -0,0 +1,231 @@
+package providers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	serverscalc "github.com/ranjankuldeep/fakeNumber/internal/serversCalc"
+	serversnextotpcalc "github.com/ranjankuldeep/fakeNumber/internal/serversNextOtpCalc"
+	"github.com/ranjankuldeep/fakeNumber/logs"
+)
+
+const (
+	nextSMSWaiting = "waiting"
+	nextSMSRetry   = "retry"
+)
+
+// Actions a getStatus reply prefix can map to in ActivationConfig.StatusMap.
+const (
+	StatusOTP    = "OTP"
+	StatusWait   = "WAIT"
+	StatusCancel = "CANCEL"
+)
+
+var defaultStatusMap = map[string]string{
+	"STATUS_OK:":         StatusOTP,
+	"STATUS_WAIT_RETRY:": StatusOTP,
+	"STATUS_WAIT_CODE":   StatusWait,
+	"STATUS_WAIT_RESEND": StatusWait,
+	"STATUS_CANCEL":      StatusCancel,
+	"ACCESS_CANCEL":      StatusCancel,
+}
+
+// activation speaks the SMS-Activate handler_api dialect
+// (getNumber/getStatus/setStatus/getBalance/getPrices) and is configured
+// entirely by models.ActivationConfig.
+type activation struct {
+	server    models.Server
+	cfg       models.ActivationConfig
+	statusMap map[string]string
+}
+
+func newActivation(server models.Server, cfg models.ActivationConfig) *activation {
+	statusMap := make(map[string]string, len(defaultStatusMap)+len(cfg.StatusMap))
+	for prefix, action := range defaultStatusMap {
+		statusMap[prefix] = action
+	}
+	for prefix, action := range cfg.StatusMap {
+		statusMap[prefix] = strings.ToUpper(action)
+	}
+	if cfg.BalanceSymbol == "" {
+		cfg.BalanceSymbol = "p"
+	}
+	return &activation{server: server, cfg: cfg, statusMap: statusMap}
+}
+
+// activationFactory builds a Factory around a built-in configuration.
+func activationFactory(cfg models.ActivationConfig) Factory {
+	return func(server models.Server) Provider {
+		return newActivation(server, cfg)
+	}
+}
+
+// ValidateActivationConfig checks a configuration submitted from the admin panel.
+func ValidateActivationConfig(cfg models.ActivationConfig) error {
+	if _, err := url.ParseRequestURI(cfg.BaseURL); err != nil {
+		return fmt.Errorf("invalid base url: %w", err)
+	}
+	if cfg.NextBaseURL != "" {
+		if _, err := url.ParseRequestURI(cfg.NextBaseURL); err != nil {
+			return fmt.Errorf("invalid next base url: %w", err)
+		}
+	}
+	if cfg.Country == "" {
+		return errors.New("country is required")
+	}
+	switch cfg.NextSMS {
+	case "", nextSMSWaiting, nextSMSRetry:
+	default:
+		return fmt.Errorf("invalid nextSms value %q", cfg.NextSMS)
+	}
+	for prefix, action := range cfg.StatusMap {
+		switch strings.ToUpper(action) {
+		case StatusOTP, StatusWait, StatusCancel:
+		default:
+			return fmt.Errorf("invalid status action %q for %q", action, prefix)
+		}
+	}
+	return nil
+}
+
+func (a *activation) BuyNumber(req BuyRequest) (Number, error) {
+	apiURL := fmt.Sprintf("%s?api_key=%s&action=getNumber&service=%s&country=%s",
+		a.cfg.BaseURL, a.server.APIKey, req.Code, a.cfg.Country)
+	if a.cfg.Operator != "" {
+		apiURL += "&operator=" + a.cfg.Operator
+	}
+	if a.cfg.MaxPrice {
+		priceFloat, err := strconv.ParseFloat(req.Price, 64)
+		if err != nil {
+			return Number{}, fmt.Errorf("invalid price for server %d: %v", a.server.ServerNumber, err)
+		}
+		priceFloat = (priceFloat - a.server.Margin) / a.server.ExchangeRate
+		apiURL += fmt.Sprintf("&maxPrice=%.2f", priceFloat)
+	}
+
+	id, number, err := serverscalc.ExtractNumberServerFromAccess(Endpoint(apiURL), map[string]string{})
+	if err != nil {
+		return Number{}, err
+	}
+	return Number{ID: id, Number: number}, nil
+}
+
+// GetStatus only surfaces ErrCancelled; any other upstream failure is logged
+// and treated as "still waiting".
+func (a *activation) GetStatus(id string) ([]string, error) {
+	apiURL := fmt.Sprintf("%s?api_key=%s&action=getStatus&id=%s", a.cfg.BaseURL, a.server.APIKey, id)
+	body, err := get(apiURL, map[string]string{})
+	if err != nil {
+		logs.Logger.Error(err)
+		return []string{}, nil
+	}
+	return a.parseStatus(strings.TrimSpace(string(body)))
+}
+
+func (a *activation) parseStatus(responseText string) ([]string, error) {
+	// Longest prefix wins so that e.g. STATUS_CANCEL_X can be mapped apart
+	// from STATUS_CANCEL.
+	matched := ""
+	for prefix := range a.statusMap {
+		if strings.HasPrefix(responseText, prefix) && len(prefix) > len(matched) {
+			matched = prefix
+		}
+	}
+	switch a.statusMap[matched] {
+	case StatusOTP:
+		return []string{strings.TrimPrefix(responseText, matched)}, nil
+	case StatusWait:
+		return []string{}, nil
+	case StatusCancel:
+		return []string{}, ErrCancelled
+	}
+	logs.Logger.Errorf("UNEXPECTED_RESPONSE %v", responseText)
+	return []string{}, nil
+}
+
+func (a *activation) Cancel(id, number string) error {
+	apiURL := fmt.Sprintf("%s?api_key=%s&action=setStatus&status=8&id=%s", a.cfg.BaseURL, a.server.APIKey, id)
+	logs.Logger.Infof("Number Cancel URL: %s", apiURL)
+	body, err := get(apiURL, map[string]string{})
+	if err != nil {
+		return err
+	}
+	responseData := string(body)
+	logs.Logger.Infof("Number Cancel Response %+v", responseData)
+
+	for _, prefix := range a.cfg.CancelOK {
+		if strings.HasPrefix(responseData, prefix) {
+			return nil
+		}
+	}
+	for _, prefix := range a.cfg.CancelErrors {
+		if strings.HasPrefix(responseData, prefix) {
+			return errors.New(prefix)
+		}
+	}
+	return cancelFailed(a.server.ServerNumber)
+}
+
+func (a *activation) RequestNextSMS(id string) error {
+	baseURL := a.cfg.BaseURL
+	if a.cfg.NextBaseURL != "" {
+		baseURL = a.cfg.NextBaseURL
+	}
+	apiURL := fmt.Sprintf("%s?api_key=%s&action=setStatus&status=3&id=%s", baseURL, a.server.APIKey, id)
+	switch a.cfg.NextSMS {
+	case nextSMSWaiting:
+		return serversnextotpcalc.CallNextOTPServerWaiting(Endpoint(apiURL), map[string]string{})
+	case nextSMSRetry:
+		return serversnextotpcalc.CallNextOTPServerRetry(Endpoint(apiURL), map[string]string{})
+	}
+	return ErrNotSupported
+}
+
+func (a *activation) GetBalance() (Balance, error) {
+	apiURL := fmt.Sprintf("%s?api_key=%s&action=getBalance", a.cfg.BaseURL, a.server.APIKey)
+	body, err := get(apiURL, map[string]string{})
+	if err != nil {
+		return Balance{}, err
+	}
+	balance := strings.TrimSpace(strings.TrimPrefix(string(body), "ACCESS_BALANCE:"))
+	value, err := strconv.ParseFloat(balance, 64)
+	if err != nil {
+		return Balance{}, fmt.Errorf("failed to parse balance: %w", err)
+	}
+	return Balance{Value: value, Symbol: a.cfg.BalanceSymbol}, nil
+}
+
+func (a *activation) GetPrices() (map[string]float64, error) {
+	apiURL := fmt.Sprintf("%s?api_key=%s&action=getPrices&country=%s", a.cfg.BaseURL, a.server.APIKey, a.cfg.Country)
+	body, err := get(apiURL, map[string]string{})
+	if err != nil {
+		return nil, err
+	}
+	return parseCountryPrices(body, a.cfg.Country)
+}
+
+// parseCountryPrices decodes the {"<country>": {"<code>": {"cost": ...}}}
+// shape returned by getPrices.
+func parseCountryPrices(body []byte, country string) (map[string]float64, error) {
+	var response map[string]map[string]struct {
+		Cost json.Number `json:"cost"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON response for prices: %w", err)
+	}
+
+	prices := make(map[string]float64)
+	for code, price := range response[country] {
+		cost, err := price.Cost.Float64()
+		if err != nil {
+			continue
+		}
+		prices[code] = cost
+	}
+	return prices, nil
+}
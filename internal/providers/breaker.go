@@ -0,0 +1,296 @@
+package providers
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ranjankuldeep/fakeNumber/logs"
+)
+
+// Breaker states. A degraded (open) provider rejects calls with ErrDegraded
+// until the cooldown passes, then a single half-open probe decides whether it
+// closes again.
+const (
+	StateClosed   = "closed"
+	StateOpen     = "degraded"
+	StateHalfOpen = "half-open"
+)
+
+var ErrDegraded = errors.New("SERVER_DEGRADED")
+
+const (
+	breakerWindow      = 20
+	breakerMinCalls    = 5
+	breakerFailureRate = 0.5
+	breakerCooldown    = 30 * time.Second
+	breakerSlowCall    = 10 * time.Second
+)
+
+// Health is a snapshot of one provider's breaker.
+type Health struct {
+	Server       int       `json:"server"`
+	State        string    `json:"state"`
+	Calls        int       `json:"calls"`
+	Failures     int       `json:"failures"`
+	ErrorRate    float64   `json:"errorRate"`
+	AvgLatencyMs int64     `json:"avgLatencyMs"`
+	LastError    string    `json:"lastError,omitempty"`
+	OpenedAt     time.Time `json:"openedAt,omitempty"`
+}
+
+type callResult struct {
+	failed  bool
+	latency time.Duration
+}
+
+type breaker struct {
+	mu        sync.Mutex
+	server    int
+	state     string
+	window    []callResult
+	lastError string
+	openedAt  time.Time
+	probing   bool
+}
+
+var (
+	breakersMu sync.Mutex
+	breakers   = make(map[int]*breaker)
+)
+
+func breakerFor(serverNumber int) *breaker {
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+	b, ok := breakers[serverNumber]
+	if !ok {
+		b = &breaker{server: serverNumber, state: StateClosed}
+		breakers[serverNumber] = b
+	}
+	return b
+}
+
+// Degraded reports whether the provider for serverNumber is currently not
+// accepting calls. Once the cooldown has passed it is listed again, so that
+// the next purchase can be the half-open probe.
+func Degraded(serverNumber int) bool {
+	breakersMu.Lock()
+	b, ok := breakers[serverNumber]
+	breakersMu.Unlock()
+	if !ok {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case StateOpen:
+		return time.Since(b.openedAt) < breakerCooldown
+	case StateHalfOpen:
+		return b.probing
+	}
+	return false
+}
+
+// HealthReport returns the breaker state of every provider called so far.
+func HealthReport() []Health {
+	breakersMu.Lock()
+	list := make([]*breaker, 0, len(breakers))
+	for _, b := range breakers {
+		list = append(list, b)
+	}
+	breakersMu.Unlock()
+
+	report := make([]Health, 0, len(list))
+	for _, b := range list {
+		report = append(report, b.health())
+	}
+	sort.Slice(report, func(i, j int) bool { return report[i].Server < report[j].Server })
+	return report
+}
+
+// ResetBreaker closes the breaker for serverNumber and clears its history.
+func ResetBreaker(serverNumber int) {
+	b := breakerFor(serverNumber)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state = StateClosed
+	b.window = nil
+	b.lastError = ""
+	b.openedAt = time.Time{}
+	b.probing = false
+}
+
+func (b *breaker) health() Health {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	h := Health{Server: b.server, State: b.state, Calls: len(b.window), LastError: b.lastError, OpenedAt: b.openedAt}
+	var total time.Duration
+	for _, r := range b.window {
+		if r.failed {
+			h.Failures++
+		}
+		total += r.latency
+	}
+	if h.Calls > 0 {
+		h.ErrorRate = float64(h.Failures) / float64(h.Calls)
+		h.AvgLatencyMs = (total / time.Duration(h.Calls)).Milliseconds()
+	}
+	return h
+}
+
+// allow reports whether a call may go upstream, moving an open breaker to
+// half-open once the cooldown has passed.
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case StateOpen:
+		if time.Since(b.openedAt) < breakerCooldown {
+			return false
+		}
+		b.state = StateHalfOpen
+		b.probing = true
+		logs.Logger.Infof("Provider for server %d half-open, probing", b.server)
+		return true
+	case StateHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	}
+	return true
+}
+
+func (b *breaker) record(err error, latency time.Duration) {
+	failed := isUpstreamFailure(err) || latency > breakerSlowCall
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if failed {
+		b.lastError = "slow response"
+		if err != nil {
+			b.lastError = err.Error()
+		}
+	}
+
+	if b.state == StateHalfOpen {
+		b.probing = false
+		if failed {
+			b.trip()
+			return
+		}
+		b.state = StateClosed
+		b.window = nil
+		logs.Logger.Infof("Provider for server %d recovered", b.server)
+	}
+
+	b.window = append(b.window, callResult{failed: failed, latency: latency})
+	if len(b.window) > breakerWindow {
+		b.window = b.window[len(b.window)-breakerWindow:]
+	}
+	if b.state != StateClosed || len(b.window) < breakerMinCalls {
+		return
+	}
+	failures := 0
+	for _, r := range b.window {
+		if r.failed {
+			failures++
+		}
+	}
+	if float64(failures)/float64(len(b.window)) >= breakerFailureRate {
+		b.trip()
+	}
+}
+
+func (b *breaker) trip() {
+	b.state = StateOpen
+	b.openedAt = time.Now()
+	logs.Logger.Warnf("Provider for server %d degraded: %s", b.server, b.lastError)
+}
+
+// isUpstreamFailure separates an unhealthy upstream (transport errors,
+// garbage or empty bodies) from ordinary replies such as no stock.
+func isUpstreamFailure(err error) bool {
+	if err == nil || errors.Is(err, ErrNotSupported) || errors.Is(err, ErrCancelled) {
+		return false
+	}
+	var urlErr *url.Error
+	var netErr net.Error
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &urlErr) || errors.As(err, &netErr) || errors.As(err, &syntaxErr) {
+		return true
+	}
+	message := err.Error()
+	return strings.Contains(message, "RECEIVED_EMPTY_RESPONSE") || strings.Contains(message, "unexpected status code")
+}
+
+// guarded wraps a provider so every call but Cancel goes through its
+// server's breaker.
+type guarded struct {
+	provider Provider
+	breaker  *breaker
+}
+
+func withBreaker(serverNumber int, provider Provider) Provider {
+	return &guarded{provider: provider, breaker: breakerFor(serverNumber)}
+}
+
+func (g *guarded) call(fn func() error) error {
+	if !g.breaker.allow() {
+		return ErrDegraded
+	}
+	start := time.Now()
+	err := fn()
+	g.breaker.record(err, time.Since(start))
+	return err
+}
+
+func (g *guarded) BuyNumber(req BuyRequest) (number Number, err error) {
+	err = g.call(func() error {
+		number, err = g.provider.BuyNumber(req)
+		return err
+	})
+	return number, err
+}
+
+func (g *guarded) GetStatus(id string) (otp []string, err error) {
+	err = g.call(func() error {
+		otp, err = g.provider.GetStatus(id)
+		return err
+	})
+	return otp, err
+}
+
+// Cancel bypasses the breaker. By the time a number is cancelled its order
+// has been refunded, so refusing the call would leave it active upstream
+// with nothing left to retry it.
+func (g *guarded) Cancel(id, number string) error {
+	return g.provider.Cancel(id, number)
+}
+
+func (g *guarded) RequestNextSMS(id string) error {
+	return g.call(func() error {
+		return g.provider.RequestNextSMS(id)
+	})
+}
+
+func (g *guarded) GetBalance() (balance Balance, err error) {
+	err = g.call(func() error {
+		balance, err = g.provider.GetBalance()
+		return err
+	})
+	return balance, err
+}
+
+func (g *guarded) GetPrices() (prices map[string]float64, err error) {
+	err = g.call(func() error {
+		prices, err = g.provider.GetPrices()
+		return err
+	})
+	return prices, err
+}
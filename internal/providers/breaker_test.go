@@ -0,0 +1,203 @@
+package providers
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+var errUpstream = fmt.Errorf("unexpected status code: %d", 502)
+
+// testBreaker registers a fresh closed breaker for serverNumber.
+func testBreaker(t *testing.T, serverNumber int) *breaker {
+	ResetBreaker(serverNumber)
+	t.Cleanup(func() { ResetBreaker(serverNumber) })
+	return breakerFor(serverNumber)
+}
+
+func TestBreakerTrips(t *testing.T) {
+	b := testBreaker(t, 9001)
+	for i := 0; i < breakerMinCalls-1; i++ {
+		b.record(errUpstream, time.Millisecond)
+	}
+	if b.state != StateClosed {
+		t.Fatalf("state = %s after %d failures, want closed below the minimum calls", b.state, breakerMinCalls-1)
+	}
+	b.record(errUpstream, time.Millisecond)
+	if b.state != StateOpen {
+		t.Fatalf("state = %s, want open", b.state)
+	}
+	if b.allow() {
+		t.Error("open breaker allowed a call during the cooldown")
+	}
+	if !Degraded(9001) {
+		t.Error("Degraded = false for an open breaker")
+	}
+}
+
+func TestBreakerFailureRate(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int
+		calls    int
+		want     string
+	}{
+		{name: "below rate", failures: 4, calls: 10, want: StateClosed},
+		{name: "at rate", failures: 5, calls: 10, want: StateOpen},
+		{name: "full window", failures: 10, calls: breakerWindow, want: StateOpen},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := testBreaker(t, 9100+i)
+			// Successes first, so the rate is only reached by the last call.
+			for n := 0; n < tt.calls-tt.failures; n++ {
+				b.record(nil, time.Millisecond)
+			}
+			for n := 0; n < tt.failures; n++ {
+				b.record(errUpstream, time.Millisecond)
+			}
+			if b.state != tt.want {
+				t.Errorf("state = %s, want %s", b.state, tt.want)
+			}
+		})
+	}
+}
+
+func TestBreakerWindowForgets(t *testing.T) {
+	b := testBreaker(t, 9005)
+	for i := 0; i < 2; i++ {
+		b.record(errUpstream, time.Millisecond)
+	}
+	for i := 0; i < breakerWindow; i++ {
+		b.record(nil, time.Millisecond)
+	}
+	if len(b.window) != breakerWindow {
+		t.Errorf("window holds %d calls, want %d", len(b.window), breakerWindow)
+	}
+	if h := b.health(); h.Failures != 0 || h.State != StateClosed {
+		t.Errorf("health = %+v, want the old failures forgotten", h)
+	}
+}
+
+func TestBreakerCountsUpstreamFailuresOnly(t *testing.T) {
+	b := testBreaker(t, 9002)
+	for i := 0; i < breakerWindow; i++ {
+		b.record(ErrNotSupported, time.Millisecond)
+		b.record(errors.New("NO_NUMBERS"), time.Millisecond)
+		b.record(ErrCancelled, time.Millisecond)
+	}
+	if b.state != StateClosed {
+		t.Errorf("state = %s after ordinary replies, want closed", b.state)
+	}
+	b = testBreaker(t, 9006)
+	for i := 0; i < breakerMinCalls; i++ {
+		b.record(nil, breakerSlowCall+time.Second)
+	}
+	if b.state != StateOpen {
+		t.Errorf("state = %s after slow calls, want open", b.state)
+	}
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		probe error
+		want  string
+	}{
+		{name: "probe succeeds", probe: nil, want: StateClosed},
+		{name: "probe fails", probe: errUpstream, want: StateOpen},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			b := testBreaker(t, 9003)
+			b.lastError = errUpstream.Error()
+			b.trip()
+			b.openedAt = time.Now().Add(-breakerCooldown)
+			if Degraded(9003) {
+				t.Error("Degraded = true after the cooldown, want the provider listed for a probe")
+			}
+
+			if !b.allow() {
+				t.Fatal("breaker refused the half-open probe")
+			}
+			if b.state != StateHalfOpen {
+				t.Fatalf("state = %s, want half-open", b.state)
+			}
+			if b.allow() {
+				t.Error("breaker allowed a second call while probing")
+			}
+			if !Degraded(9003) {
+				t.Error("Degraded = false while probing")
+			}
+
+			b.record(tt.probe, time.Millisecond)
+			if b.state != tt.want {
+				t.Fatalf("state = %s, want %s", b.state, tt.want)
+			}
+			if got := b.allow(); got != (tt.want == StateClosed) {
+				t.Errorf("allow = %v after the probe", got)
+			}
+		})
+	}
+}
+
+func TestDegradedUnknownServer(t *testing.T) {
+	if Degraded(-1) {
+		t.Error("Degraded = true for a provider never called")
+	}
+}
+
+// stubProvider counts calls and fails them with err.
+type stubProvider struct {
+	calls int
+	err   error
+}
+
+func (s *stubProvider) BuyNumber(BuyRequest) (Number, error) {
+	s.calls++
+	return Number{}, s.err
+}
+
+func (s *stubProvider) GetStatus(string) ([]string, error) {
+	s.calls++
+	return nil, s.err
+}
+
+func (s *stubProvider) Cancel(string, string) error {
+	s.calls++
+	return s.err
+}
+
+func (s *stubProvider) RequestNextSMS(string) error {
+	s.calls++
+	return s.err
+}
+
+func (s *stubProvider) GetBalance() (Balance, error) {
+	s.calls++
+	return Balance{}, s.err
+}
+
+func (s *stubProvider) GetPrices() (map[string]float64, error) {
+	s.calls++
+	return nil, s.err
+}
+
+func TestGuardedCancelBypassesBreaker(t *testing.T) {
+	testBreaker(t, 9004)
+	stub := &stubProvider{err: errUpstream}
+	provider := withBreaker(9004, stub)
+	for i := 0; i < breakerMinCalls; i++ {
+		provider.GetStatus("1")
+	}
+	if _, err := provider.BuyNumber(BuyRequest{}); !errors.Is(err, ErrDegraded) {
+		t.Fatalf("BuyNumber error = %v, want ErrDegraded", err)
+	}
+	stub.err = nil
+	if err := provider.Cancel("1", "+910000000000"); err != nil {
+		t.Errorf("Cancel error = %v on a degraded provider", err)
+	}
+	if stub.calls != breakerMinCalls+1 {
+		t.Errorf("upstream saw %d calls, want %d", stub.calls, breakerMinCalls+1)
+	}
+}
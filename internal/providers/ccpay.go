@@ -0,0 +1,79 @@
+package providers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	serverscalc "github.com/ranjankuldeep/fakeNumber/internal/serversCalc"
+	serversotpcalc "github.com/ranjankuldeep/fakeNumber/internal/serversOtpCalc"
+	"github.com/ranjankuldeep/fakeNumber/logs"
+)
+
+// ccpay is phantomunion, server 9. Server.Token is refreshed by
+// lib.UpdateServerToken; cancel and balance go through our PHP bridge.
+type ccpay struct {
+	server models.Server
+}
+
+func init() {
+	Register(9, func(server models.Server) Provider {
+		return &ccpay{server: server}
+	})
+}
+
+func (p *ccpay) BuyNumber(req BuyRequest) (Number, error) {
+	apiURL := fmt.Sprintf(
+		"http://www.phantomunion.com:10023/pickCode-api/push/buyCandy?token=%s&businessCode=%s&quantity=1&country=IN&effectiveTime=10",
+		p.server.Token, req.Code,
+	)
+	number, id, err := serverscalc.ExtractNumberServer9(Endpoint(apiURL), map[string]string{})
+	if err != nil {
+		logs.Logger.Error(err)
+		return Number{}, err
+	}
+	return Number{ID: id, Number: number}, nil
+}
+
+func (p *ccpay) GetStatus(id string) ([]string, error) {
+	apiURL := fmt.Sprintf("http://www.phantomunion.com:10023/pickCode-api/push/sweetWrapper?token=%s&serialNumber=%s", p.server.Token, id)
+	otp, err := serversotpcalc.FetchTokenAndOTP(Endpoint(apiURL), id, map[string]string{})
+	return otp, normalizeStatusErr(err)
+}
+
+func (p *ccpay) Cancel(id, number string) error {
+	apiURL := fmt.Sprintf("https://php.paidsms.in/ccpay.php?type=cancel&number=%s", number)
+	logs.Logger.Infof("Number Cancel URL: %s", apiURL)
+	body, err := get(apiURL, map[string]string{})
+	if err != nil {
+		return err
+	}
+	responseData := string(body)
+	logs.Logger.Infof("Number Cancel Response %+v", responseData)
+
+	if strings.HasPrefix(responseData, "success") {
+		return nil
+	}
+	return cancelFailed(p.server.ServerNumber)
+}
+
+func (p *ccpay) RequestNextSMS(id string) error {
+	return ErrNotSupported
+}
+
+func (p *ccpay) GetBalance() (Balance, error) {
+	body, err := get("https://php.paidsms.in/ccpay.php?type=balance", map[string]string{})
+	if err != nil {
+		return Balance{}, err
+	}
+	value, err := strconv.ParseFloat(strings.TrimSpace(string(body)), 64)
+	if err != nil {
+		return Balance{}, fmt.Errorf("failed to parse balance: %w", err)
+	}
+	return Balance{Value: value, Symbol: "p"}, nil
+}
+
+func (p *ccpay) GetPrices() (map[string]float64, error) {
+	return nil, ErrNotSupported
+}
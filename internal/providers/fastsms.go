@@ -0,0 +1,13 @@
+package providers
+
+import "github.com/ranjankuldeep/fakeNumber/internal/database/models"
+
+// fastsms.su, server 1.
+func init() {
+	Register(1, activationFactory(models.ActivationConfig{
+		BaseURL:  "https://fastsms.su/stubs/handler_api.php",
+		Country:  "22",
+		NextSMS:  nextSMSWaiting,
+		CancelOK: []string{"ACCESS_CANCEL", "ACCESS_APPROVED", "STATUS_CANCEL"},
+	}))
+}
@@ -0,0 +1,107 @@
+package providers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	serverscalc "github.com/ranjankuldeep/fakeNumber/internal/serversCalc"
+	serversotpcalc "github.com/ranjankuldeep/fakeNumber/internal/serversOtpCalc"
+	"github.com/ranjankuldeep/fakeNumber/logs"
+)
+
+// fiveSim is 5sim.net, server 2. Every call authenticates with Server.Token.
+type fiveSim struct {
+	server models.Server
+}
+
+func init() {
+	Register(2, func(server models.Server) Provider {
+		return &fiveSim{server: server}
+	})
+}
+
+func (f *fiveSim) BuyNumber(req BuyRequest) (Number, error) {
+	apiURL := fmt.Sprintf("https://5sim.net/v1/user/buy/activation/india/any/%s", req.Code)
+	number, id, err := serverscalc.ExtractNumberServer2(Endpoint(apiURL), bearer(f.server.Token))
+	if err != nil {
+		return Number{}, err
+	}
+	return Number{ID: id, Number: number}, nil
+}
+
+func (f *fiveSim) GetStatus(id string) ([]string, error) {
+	apiURL := fmt.Sprintf("https://5sim.net/v1/user/check/%s", id)
+	otp, err := serversotpcalc.GetSMSTextsServer2(Endpoint(apiURL), id, bearer(f.server.Token))
+	return otp, normalizeStatusErr(err)
+}
+
+func (f *fiveSim) Cancel(id, number string) error {
+	apiURL := fmt.Sprintf("https://5sim.net/v1/user/cancel/%s", id)
+	logs.Logger.Infof("Number Cancel URL: %s", apiURL)
+	body, err := get(apiURL, bearer(f.server.Token))
+	if err != nil {
+		return err
+	}
+	responseData := string(body)
+	logs.Logger.Infof("Number Cancel Response %+v", responseData)
+
+	if strings.Contains(responseData, "order has sms") || strings.Contains(responseData, "order not found") {
+		return nil
+	}
+	var responseDataJSON map[string]interface{}
+	if err := json.Unmarshal(body, &responseDataJSON); err != nil {
+		return fmt.Errorf("failed to parse JSON response: %w", err)
+	}
+	if responseDataJSON["status"] == "CANCELED" {
+		return nil
+	}
+	return cancelFailed(f.server.ServerNumber)
+}
+
+func (f *fiveSim) RequestNextSMS(id string) error {
+	return ErrNotSupported
+}
+
+func (f *fiveSim) GetBalance() (Balance, error) {
+	body, err := get("https://5sim.net/v1/user/profile", bearer(f.server.Token))
+	if err != nil {
+		return Balance{}, err
+	}
+	var responseDataJSON struct {
+		Balance float64 `json:"balance"`
+	}
+	if err := json.Unmarshal(body, &responseDataJSON); err != nil {
+		return Balance{}, fmt.Errorf("failed to parse JSON response for balance: %w", err)
+	}
+	return Balance{Value: responseDataJSON.Balance, Symbol: "p"}, nil
+}
+
+// GetPrices returns the cheapest operator per product for India.
+func (f *fiveSim) GetPrices() (map[string]float64, error) {
+	body, err := get("https://5sim.net/v1/guest/prices?country=india", map[string]string{"Accept": "application/json"})
+	if err != nil {
+		return nil, err
+	}
+	var response map[string]map[string]map[string]struct {
+		Cost  float64 `json:"cost"`
+		Count int     `json:"count"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON response for prices: %w", err)
+	}
+
+	prices := make(map[string]float64)
+	for product, operators := range response["india"] {
+		for _, operator := range operators {
+			if operator.Count == 0 {
+				continue
+			}
+			if current, ok := prices[product]; !ok || operator.Cost < current {
+				prices[product] = operator.Cost
+			}
+		}
+	}
+	return prices, nil
+}
@@ -0,0 +1,14 @@
+package providers
+
+import "github.com/ranjankuldeep/fakeNumber/internal/database/models"
+
+// grizzlysms.com, server 5.
+func init() {
+	Register(5, activationFactory(models.ActivationConfig{
+		BaseURL:      "https://api.grizzlysms.com/stubs/handler_api.php",
+		Country:      "22",
+		NextSMS:      nextSMSRetry,
+		CancelOK:     []string{"ACCESS_CANCEL"},
+		CancelErrors: []string{"BAD_ACTION"},
+	}))
+}
@@ -0,0 +1,90 @@
+package providers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+var (
+	overrideMu  sync.RWMutex
+	overrideURL *url.URL
+)
+
+// SetUpstreamOverride sends every upstream call to base instead of the real
+// vendor host, e.g. a cmd/mockprovider instance. The vendor host is kept as
+// the first path segment so the mock can tell vendors apart. An empty base
+// restores the real hosts.
+func SetUpstreamOverride(base string) error {
+	overrideMu.Lock()
+	defer overrideMu.Unlock()
+	if base == "" {
+		overrideURL = nil
+		return nil
+	}
+	parsed, err := url.Parse(strings.TrimRight(base, "/"))
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return fmt.Errorf("invalid upstream override %q", base)
+	}
+	overrideURL = parsed
+	return nil
+}
+
+// Endpoint applies the upstream override, if any, to a vendor URL.
+func Endpoint(rawURL string) string {
+	overrideMu.RLock()
+	base := overrideURL
+	overrideMu.RUnlock()
+	if base == nil {
+		return rawURL
+	}
+	parsed, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return rawURL
+	}
+	parsed.Path = base.Path + "/" + parsed.Host + parsed.Path
+	parsed.Scheme = base.Scheme
+	parsed.Host = base.Host
+	return parsed.String()
+}
+
+func get(apiURL string, headers map[string]string) ([]byte, error) {
+	req, err := http.NewRequest("GET", Endpoint(apiURL), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create API request: %w", err)
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	if strings.TrimSpace(string(body)) == "" {
+		return nil, errors.New("RECEIVED_EMPTY_RESPONSE_FROM_THIRD_PARTY_SERVER")
+	}
+	return body, nil
+}
+
+func bearer(token string) map[string]string {
+	return map[string]string{
+		"Authorization": fmt.Sprintf("Bearer %s", token),
+		"Accept":        "application/json",
+	}
+}
+
+func cancelFailed(serverNumber int) error {
+	return fmt.Errorf("NUMBER_REQUEST_FAILED_FOR_THIRD_PARTY_SERVER_%d", serverNumber)
+}
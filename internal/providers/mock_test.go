@@ -0,0 +1,99 @@
+package providers_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/internal/mockprovider"
+	"github.com/ranjankuldeep/fakeNumber/internal/providers"
+)
+
+// newMockProvider points upstream calls at a fresh mock and returns an
+// SMS-Activate compatible provider configured from a server document. SMS
+// only arrive when the test delivers them.
+func newMockProvider(t *testing.T, serverNumber int) (providers.Provider, *mockprovider.Mock) {
+	server, mock := mockprovider.NewTestServer(mockprovider.Config{DefaultStock: -1, SMSDelay: time.Hour, Balance: 42.5})
+	t.Cleanup(server.Close)
+	if err := providers.SetUpstreamOverride(server.URL); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { providers.SetUpstreamOverride("") })
+
+	provider, err := providers.New(models.Server{
+		ServerNumber: serverNumber,
+		APIKey:       "test-key",
+		Activation: &models.ActivationConfig{
+			BaseURL:      "https://activation.example/stubs/handler_api.php",
+			Country:      "22",
+			NextSMS:      "retry",
+			CancelOK:     []string{"ACCESS_CANCEL"},
+			CancelErrors: []string{"BAD_STATUS"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return provider, mock
+}
+
+func TestActivationAgainstMock(t *testing.T) {
+	provider, mock := newMockProvider(t, 9001)
+
+	number, err := provider.BuyNumber(providers.BuyRequest{Code: "tg"})
+	if err != nil {
+		t.Fatalf("BuyNumber: %v", err)
+	}
+	if number.ID == "" || number.Number == "" {
+		t.Fatalf("BuyNumber = %+v, want an id and a number", number)
+	}
+	otps, err := provider.GetStatus(number.ID)
+	if err != nil || len(otps) != 0 {
+		t.Fatalf("GetStatus before the SMS = %v, %v; want no codes", otps, err)
+	}
+
+	activations := mock.Activations()
+	if len(activations) != 1 {
+		t.Fatalf("mock has %d activations, want 1", len(activations))
+	}
+	if err := mock.DeliverSMS(activations[0].ID, "654321"); err != nil {
+		t.Fatal(err)
+	}
+	otps, err = provider.GetStatus(number.ID)
+	if err != nil || len(otps) != 1 || otps[0] != "654321" {
+		t.Fatalf("GetStatus after the SMS = %v, %v; want [654321]", otps, err)
+	}
+
+	balance, err := provider.GetBalance()
+	if err != nil || balance.Value != 42.5 {
+		t.Errorf("GetBalance = %+v, %v; want 42.5", balance, err)
+	}
+}
+
+func TestActivationCancelAgainstMock(t *testing.T) {
+	provider, _ := newMockProvider(t, 9002)
+
+	number, err := provider.BuyNumber(providers.BuyRequest{Code: "wa"})
+	if err != nil {
+		t.Fatalf("BuyNumber: %v", err)
+	}
+	if err := provider.Cancel(number.ID, number.Number); err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+	if _, err := provider.GetStatus(number.ID); !errors.Is(err, providers.ErrCancelled) {
+		t.Errorf("GetStatus after cancel error = %v, want ErrCancelled", err)
+	}
+}
+
+func TestActivationNoStock(t *testing.T) {
+	provider, mock := newMockProvider(t, 9003)
+	mock.SetStock("tg", 0)
+	if _, err := provider.BuyNumber(providers.BuyRequest{Code: "tg"}); err == nil {
+		t.Error("BuyNumber succeeded without stock")
+	}
+	mock.FailNext(mockprovider.DialectActivation, "getNumber", "NO_BALANCE")
+	if _, err := provider.BuyNumber(providers.BuyRequest{Code: "wa"}); err == nil {
+		t.Error("BuyNumber succeeded on a scripted NO_BALANCE")
+	}
+}
@@ -0,0 +1,93 @@
+package providers
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+)
+
+// Provider is implemented once per upstream number vendor.
+type Provider interface {
+	// BuyNumber rents a number for the given service code.
+	BuyNumber(req BuyRequest) (Number, error)
+	// GetStatus returns every OTP received so far for the activation id.
+	// ErrCancelled is returned once the upstream has cancelled the activation.
+	GetStatus(id string) ([]string, error)
+	// Cancel releases the number back to the upstream.
+	Cancel(id, number string) error
+	// RequestNextSMS asks the upstream to wait for another SMS on the same number.
+	RequestNextSMS(id string) error
+	// GetBalance returns our balance with the upstream.
+	GetBalance() (Balance, error)
+	// GetPrices returns the upstream cost keyed by service code.
+	GetPrices() (map[string]float64, error)
+}
+
+type BuyRequest struct {
+	Code     string
+	Price    string
+	Multiple bool
+}
+
+type Number struct {
+	ID     string
+	Number string
+}
+
+type Balance struct {
+	Value  float64
+	Symbol string
+}
+
+// Factory builds a provider from its servers document.
+type Factory func(server models.Server) Provider
+
+var (
+	ErrCancelled     = errors.New("ACCESS_CANCEL")
+	ErrNotSupported  = errors.New("NOT_SUPPORTED_BY_SERVER")
+	ErrInvalidServer = errors.New("INVALID_SERVER_CHOICE")
+)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[int]Factory)
+)
+
+// Register makes a provider available for the given server number.
+func Register(serverNumber int, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, exists := registry[serverNumber]; exists {
+		panic(fmt.Sprintf("provider already registered for server %d", serverNumber))
+	}
+	registry[serverNumber] = factory
+}
+
+// New returns the provider for the server document, guarded by the server's
+// circuit breaker. A document carrying an activation config is served by the
+// generic SMS-Activate adapter, otherwise the provider registered for its
+// ServerNumber is used.
+func New(server models.Server) (Provider, error) {
+	if server.Activation != nil && server.Activation.BaseURL != "" {
+		return withBreaker(server.ServerNumber, newActivation(server, *server.Activation)), nil
+	}
+
+	registryMu.RLock()
+	factory, ok := registry[server.ServerNumber]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, ErrInvalidServer
+	}
+	return withBreaker(server.ServerNumber, factory(server)), nil
+}
+
+// normalizeStatusErr maps the "ACCESS_CANCEL" errors returned by the
+// serversotpcalc helpers onto ErrCancelled.
+func normalizeStatusErr(err error) error {
+	if err != nil && err.Error() == ErrCancelled.Error() {
+		return ErrCancelled
+	}
+	return err
+}
@@ -0,0 +1,17 @@
+package providers
+
+import "github.com/ranjankuldeep/fakeNumber/internal/database/models"
+
+// sms-activate, server 8. Next-SMS requests go to the .io host.
+func init() {
+	Register(8, activationFactory(models.ActivationConfig{
+		BaseURL:      "https://api.sms-activate.guru/stubs/handler_api.php",
+		NextBaseURL:  "https://api.sms-activate.io/stubs/handler_api.php",
+		Country:      "22",
+		Operator:     "any",
+		MaxPrice:     true,
+		NextSMS:      nextSMSRetry,
+		CancelOK:     []string{"ACCESS_CANCEL"},
+		CancelErrors: []string{"BAD_STATUS"},
+	}))
+}
@@ -0,0 +1,14 @@
+package providers
+
+import "github.com/ranjankuldeep/fakeNumber/internal/database/models"
+
+// sms-activation-service.pro, server 10.
+func init() {
+	Register(10, activationFactory(models.ActivationConfig{
+		BaseURL:       "https://sms-activation-service.pro/stubs/handler_api",
+		Country:       "22",
+		Operator:      "any",
+		CancelOK:      []string{"ACCESS_CANCEL"},
+		BalanceSymbol: "$",
+	}))
+}
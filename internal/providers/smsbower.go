@@ -0,0 +1,15 @@
+package providers
+
+import "github.com/ranjankuldeep/fakeNumber/internal/database/models"
+
+// smsbower.online, server 7.
+func init() {
+	Register(7, activationFactory(models.ActivationConfig{
+		BaseURL:      "https://smsbower.online/stubs/handler_api.php",
+		Country:      "22",
+		MaxPrice:     true,
+		NextSMS:      nextSMSRetry,
+		CancelOK:     []string{"ACCESS_CANCEL"},
+		CancelErrors: []string{"BAD_STATUS"},
+	}))
+}
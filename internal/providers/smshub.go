@@ -0,0 +1,16 @@
+package providers
+
+import "github.com/ranjankuldeep/fakeNumber/internal/database/models"
+
+// smshub.org, server 3.
+func init() {
+	Register(3, activationFactory(models.ActivationConfig{
+		BaseURL:       "https://smshub.org/stubs/handler_api.php",
+		Country:       "22",
+		Operator:      "any",
+		MaxPrice:      true,
+		NextSMS:       nextSMSRetry,
+		CancelOK:      []string{"ACCESS_CANCEL", "ALREADY_CANCELLED", "ACCESS_ACTIVATION"},
+		BalanceSymbol: "$",
+	}))
+}
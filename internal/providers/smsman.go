@@ -0,0 +1,100 @@
+package providers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	serverscalc "github.com/ranjankuldeep/fakeNumber/internal/serversCalc"
+	serversnextotpcalc "github.com/ranjankuldeep/fakeNumber/internal/serversNextOtpCalc"
+	serversotpcalc "github.com/ranjankuldeep/fakeNumber/internal/serversOtpCalc"
+	"github.com/ranjankuldeep/fakeNumber/logs"
+)
+
+// smsMan is sms-man.com, server 11. Purchases and balance use Server.APIKey,
+// everything tied to an activation uses Server.Token.
+type smsMan struct {
+	server models.Server
+}
+
+const smsManCountry = "14"
+
+func init() {
+	Register(11, func(server models.Server) Provider {
+		return &smsMan{server: server}
+	})
+}
+
+func (s *smsMan) BuyNumber(req BuyRequest) (Number, error) {
+	apiURL := fmt.Sprintf(
+		"https://api.sms-man.com/control/get-number?token=%s&application_id=%s&country_id=%s&hasMultipleSms=%t",
+		s.server.APIKey, req.Code, smsManCountry, req.Multiple,
+	)
+	number, id, err := serverscalc.ExtractNumberServer11(Endpoint(apiURL))
+	if err != nil {
+		if strings.Contains(err.Error(), "no_channels") {
+			logs.Logger.Warn("No channels available. The channel limit has been reached.")
+		}
+		return Number{}, err
+	}
+	return Number{ID: id, Number: number}, nil
+}
+
+func (s *smsMan) GetStatus(id string) ([]string, error) {
+	apiURL := fmt.Sprintf("https://api.sms-man.com/control/get-sms?token=%s&request_id=%s", s.server.Token, id)
+	otp, err := serversotpcalc.GetOTPServer11(Endpoint(apiURL), id)
+	return otp, normalizeStatusErr(err)
+}
+
+func (s *smsMan) Cancel(id, number string) error {
+	apiURL := fmt.Sprintf("https://api2.sms-man.com/control/set-status?token=%s&request_id=%s&status=reject", s.server.Token, id)
+	logs.Logger.Infof("Number Cancel URL: %s", apiURL)
+	body, err := get(apiURL, map[string]string{})
+	if err != nil {
+		return err
+	}
+	logs.Logger.Infof("Number Cancel Response %+v", string(body))
+
+	var responseDataJSON map[string]interface{}
+	if err := json.Unmarshal(body, &responseDataJSON); err != nil {
+		return fmt.Errorf("failed to parse JSON response: %w", err)
+	}
+	if success, ok := responseDataJSON["success"].(bool); ok && success {
+		return nil
+	} else if responseDataJSON["error_code"] == "change_status" {
+		return nil
+	}
+	return cancelFailed(s.server.ServerNumber)
+}
+
+func (s *smsMan) RequestNextSMS(id string) error {
+	apiURL := fmt.Sprintf("https://api2.sms-man.com/control/set-status?token=%s&request_id=%s&status=retrysms", s.server.Token, id)
+	return serversnextotpcalc.CallNextOTPServerRetry(Endpoint(apiURL), map[string]string{})
+}
+
+func (s *smsMan) GetBalance() (Balance, error) {
+	apiURL := fmt.Sprintf("https://api.sms-man.com/control/get-balance?token=%s", s.server.APIKey)
+	body, err := get(apiURL, map[string]string{})
+	if err != nil {
+		return Balance{}, err
+	}
+	var responseDataJSON struct {
+		Balance string `json:"balance"`
+	}
+	if err := json.Unmarshal(body, &responseDataJSON); err != nil {
+		return Balance{}, fmt.Errorf("failed to parse JSON response: %w", err)
+	}
+	floatValue, _ := strconv.ParseFloat(responseDataJSON.Balance, 64)
+	return Balance{Value: floatValue, Symbol: "p"}, nil
+}
+
+func (s *smsMan) GetPrices() (map[string]float64, error) {
+	apiURL := fmt.Sprintf("https://api.sms-man.com/control/get-prices?token=%s&country_id=%s", s.server.APIKey, smsManCountry)
+	body, err := get(apiURL, map[string]string{})
+	if err != nil {
+		return nil, err
+	}
+	return parseCountryPrices(body, smsManCountry)
+}
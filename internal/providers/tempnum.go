@@ -0,0 +1,13 @@
+package providers
+
+import "github.com/ranjankuldeep/fakeNumber/internal/database/models"
+
+// tempnum.org, server 6.
+func init() {
+	Register(6, activationFactory(models.ActivationConfig{
+		BaseURL:      "https://tempnum.org/stubs/handler_api.php",
+		Country:      "22",
+		CancelOK:     []string{"ACCESS_CANCEL"},
+		CancelErrors: []string{"NO_ACTIVATION"},
+	}))
+}
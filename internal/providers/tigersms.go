@@ -0,0 +1,13 @@
+package providers
+
+import "github.com/ranjankuldeep/fakeNumber/internal/database/models"
+
+// tiger-sms.com, server 4.
+func init() {
+	Register(4, activationFactory(models.ActivationConfig{
+		BaseURL:      "https://api.tiger-sms.com/stubs/handler_api.php",
+		Country:      "22",
+		CancelOK:     []string{"ACCESS_CANCEL"},
+		CancelErrors: []string{"EARLY_CANCEL_DENIED", "BAD_STATUS"},
+	}))
+}
@@ -0,0 +1,182 @@
+// Package recharge records payments in the recharge history and credits them
+// to the user's wallet. Each transaction id can be recorded once; the history
+// entry and the ledger posting are written in one transaction.
+package recharge
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/internal/ledger"
+	"github.com/ranjankuldeep/fakeNumber/internal/money"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// StatusReceived marks a payment that was received and is credited to the
+// wallet. Other statuses are only recorded.
+const StatusReceived = "Received"
+
+// Payment types.
+const (
+	TypeUPI   = "upi"
+	TypeTRX   = "trx"
+	TypeAdmin = "Admin Added"
+)
+
+var (
+	ErrDuplicate  = errors.New("Transaction already done")
+	ErrNoWallet   = errors.New("User not found")
+	ErrIntentUsed = errors.New("Payment intent is no longer open")
+)
+
+// ValidationError reports an invalid Request.
+type ValidationError struct {
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Reason
+}
+
+// Request is a payment to record. IntentID, if set, is the payment intent
+// the payment settles; it is marked paid in the same transaction, provided
+// the payment was made before the intent expired. PaidAt defaults to now.
+type Request struct {
+	UserID        primitive.ObjectID
+	TransactionID string
+	Amount        money.Paise
+	PaymentType   string
+	Status        string
+	IntentID      primitive.ObjectID
+	PaidAt        time.Time
+}
+
+// Validate checks that the request is complete and the amount positive.
+func (r *Request) Validate() error {
+	r.TransactionID = strings.TrimSpace(r.TransactionID)
+	switch {
+	case r.UserID.IsZero():
+		return &ValidationError{"userId is required"}
+	case r.TransactionID == "":
+		return &ValidationError{"transaction id is required"}
+	case r.Amount <= 0:
+		return &ValidationError{"Invalid amount"}
+	case r.PaymentType == "":
+		return &ValidationError{"payment type is required"}
+	case r.Status == "":
+		return &ValidationError{"status is required"}
+	}
+	return nil
+}
+
+// Result is a recorded payment. Balance is the wallet balance after the
+// credit, and is only set for received payments.
+type Result struct {
+	History models.RechargeHistory
+	Balance money.Paise
+}
+
+// Service records recharges.
+type Service struct {
+	db *mongo.Database
+}
+
+func NewService(db *mongo.Database) *Service {
+	return &Service{db: db}
+}
+
+func (s *Service) collection() *mongo.Collection {
+	return models.InitializeRechargeHistoryCollection(s.db)
+}
+
+// Record validates the request, writes the recharge history and, for
+// received payments, credits the wallet. It returns ErrDuplicate if the
+// transaction id was already recorded.
+func (s *Service) Record(ctx context.Context, request Request) (Result, error) {
+	if err := request.Validate(); err != nil {
+		return Result{}, err
+	}
+	historyCol := s.collection()
+
+	now := time.Now()
+	paidAt := request.PaidAt
+	if paidAt.IsZero() || paidAt.After(now) {
+		paidAt = now
+	}
+	history := models.RechargeHistory{
+		ID:            primitive.NewObjectID(),
+		UserID:        request.UserID.Hex(),
+		TransactionID: request.TransactionID,
+		Amount:        request.Amount.String(),
+		PaymentType:   request.PaymentType,
+		DateTime:      now.In(time.FixedZone("IST", 5*3600+30*60)).Format("2006-01-02T15:04:05"),
+		Status:        request.Status,
+		CreatedAt:     now,
+	}
+
+	session, err := s.db.Client().StartSession()
+	if err != nil {
+		return Result{}, err
+	}
+	defer session.EndSession(context.Background())
+	balance, err := session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		count, err := models.InitializeApiWalletuserCollection(s.db).CountDocuments(sc, bson.M{"userId": request.UserID})
+		if err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			return nil, ErrNoWallet
+		}
+		if _, err := historyCol.InsertOne(sc, history); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				return nil, ErrDuplicate
+			}
+			return nil, err
+		}
+		if !request.IntentID.IsZero() {
+			res, err := models.InitializePaymentIntentCollection(s.db).UpdateOne(sc,
+				bson.M{
+					"_id":       request.IntentID,
+					"userId":    request.UserID,
+					"status":    models.IntentOpen,
+					"expiresAt": bson.M{"$gt": paidAt},
+				},
+				bson.M{"$set": bson.M{
+					"status":        models.IntentPaid,
+					"transactionId": request.TransactionID,
+					"paidAt":        now,
+				}},
+			)
+			if err != nil {
+				return nil, err
+			}
+			if res.MatchedCount == 0 {
+				return nil, ErrIntentUsed
+			}
+		}
+		if request.Status != StatusReceived {
+			return money.Paise(0), nil
+		}
+		entry, err := ledger.Post(sc, s.db, ledger.Posting{
+			UserID:           request.UserID,
+			Kind:             ledger.KindRecharge,
+			Amount:           request.Amount,
+			SourceCollection: "rechargehistories",
+			SourceID:         history.ID.Hex(),
+			Note:             request.PaymentType + " " + request.TransactionID,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return entry.BalanceAfter, nil
+	})
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{History: history, Balance: balance.(money.Paise)}, nil
+}
@@ -2,16 +2,26 @@ package routes
 
 import (
 	"github.com/labstack/echo/v4"
+	"github.com/ranjankuldeep/fakeNumber/internal/audit"
+	"github.com/ranjankuldeep/fakeNumber/internal/auth"
 	"github.com/ranjankuldeep/fakeNumber/internal/handlers"
 )
 
 func RegisterApiWalletRoutes(e *echo.Echo) {
-	apiWalletGroup := e.Group("/api/")
-	apiWalletGroup.GET("api_key", handlers.ApiKey)
+	apiWalletGroup := group(e, "/api/")
 	apiWalletGroup.GET("balance", handlers.BalanceHandler)
-	apiWalletGroup.GET("change_api_key", handlers.ChangeAPIKeyHandler)
-	apiWalletGroup.POST("edit-balance", handlers.UpdateWalletBalanceHandler)
-	apiWalletGroup.GET("get-qr", handlers.GetUpiQR)
-	apiWalletGroup.POST("add-recharge-api", handlers.CreateOrUpdateAPIKeyHandler)
-	apiWalletGroup.GET("get-recharge-api", handlers.GetAPIKeyHandler)
+
+	userGroup := group(e, "/api/", auth.RequireUser())
+	userGroup.GET("api-keys", handlers.ListAPIKeys)
+	userGroup.POST("api-keys", handlers.CreateAPIKey)
+	userGroup.DELETE("api-keys", handlers.RevokeAPIKey)
+	userGroup.GET("ledger-statement", handlers.GetLedgerStatement)
+	userGroup.GET("payment-intents", handlers.ListPaymentIntents)
+	userGroup.POST("payment-intents", handlers.CreatePaymentIntent)
+
+	adminGroup := group(e, "/api/", auth.RequireAdmin())
+	adminGroup.POST("edit-balance", handlers.UpdateWalletBalanceHandler, auth.Require(auth.PermBalanceEdit), audit.Log("edit-balance"))
+	adminGroup.POST("rebuild-wallet-balance", handlers.RebuildWalletBalance, auth.Require(auth.PermBalanceEdit), audit.Log("rebuild-wallet-balance"))
+	adminGroup.POST("add-recharge-api", handlers.CreateOrUpdateAPIKeyHandler, auth.Require(auth.PermRechargeAdmin), audit.Log("add-recharge-api"))
+	adminGroup.GET("get-recharge-api", handlers.GetAPIKeyHandler, auth.Require(auth.PermRechargeAdmin))
 }
@@ -0,0 +1,15 @@
+package routes
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/ranjankuldeep/fakeNumber/internal/auth"
+	"github.com/ranjankuldeep/fakeNumber/internal/handlers"
+)
+
+// RegisterAuditRoutes sets up routes for reading the audit log.
+func RegisterAuditRoutes(e *echo.Echo) {
+	auditGroup := group(e, "/api/", auth.RequireAdmin())
+
+	auditGroup.GET("audit-log", handlers.GetAuditLog, auth.Require(auth.PermAuditRead))
+	auditGroup.GET("audit-log/export", handlers.ExportAuditLog, auth.Require(auth.PermAuditRead))
+}
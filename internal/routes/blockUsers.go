@@ -2,14 +2,16 @@ package routes
 
 import (
 	"github.com/labstack/echo/v4"
+	"github.com/ranjankuldeep/fakeNumber/internal/audit"
+	"github.com/ranjankuldeep/fakeNumber/internal/auth"
 	"github.com/ranjankuldeep/fakeNumber/internal/handlers"
 )
 
 func RegisterBlockUsersRoutes(e *echo.Echo) {
-	blockGroup := e.Group("/api/")
+	blockGroup := group(e, "/api/", auth.RequireAdmin())
 
-	blockGroup.POST("block-status-toggle", handlers.ToggleBlockStatus)
-	blockGroup.GET("get-block-status", handlers.GetBlockStatus)
-	blockGroup.GET("save-block-types", handlers.SavePredefinedBlockTypes)
-	blockGroup.DELETE("block-fraud-clear", handlers.BlockFraudClear)
+	blockGroup.POST("block-status-toggle", handlers.ToggleBlockStatus, auth.Require(auth.PermFraudManage), audit.Log("block-status-toggle"))
+	blockGroup.GET("get-block-status", handlers.GetBlockStatus, auth.Require(auth.PermUsersRead))
+	blockGroup.GET("save-block-types", handlers.SavePredefinedBlockTypes, auth.Require(auth.PermFraudManage), audit.Log("save-block-types"))
+	blockGroup.DELETE("block-fraud-clear", handlers.BlockFraudClear, auth.Require(auth.PermFraudManage), audit.Log("block-fraud-clear"))
 }
@@ -2,16 +2,19 @@ package routes
 
 import (
 	"github.com/labstack/echo/v4"
+	"github.com/ranjankuldeep/fakeNumber/internal/auth"
 	"github.com/ranjankuldeep/fakeNumber/internal/handlers"
 )
 
 func RegisterGetDataRoutes(e *echo.Echo) {
-	dataGroup := e.Group("/api/")
+	dataGroup := group(e, "/api/")
 	dataGroup.GET("get-service", handlers.GetUserServiceData)
-	dataGroup.GET("get-service-data", handlers.GetServiceData)
-	dataGroup.GET("get-service-data-admin", handlers.GetServiceDataAdmin)
+	dataGroup.GET("get-service-data", handlers.GetServiceData, auth.OptionalUser())
 	dataGroup.GET("get-service-data-server", handlers.GetServersData)
-	dataGroup.GET("total-recharge-balance", handlers.TotalRecharge)
-	dataGroup.GET("total-user-count", handlers.GetTotalUserCount)
-	dataGroup.GET("get-server-balance", handlers.GetServerBalanceHandler)
+
+	adminGroup := group(e, "/api/", auth.RequireAdmin())
+	adminGroup.GET("get-service-data-admin", handlers.GetServiceDataAdmin, auth.Require(auth.PermCatalogRead))
+	adminGroup.GET("total-recharge-balance", handlers.TotalRecharge, auth.Require(auth.PermFinanceRead))
+	adminGroup.GET("total-user-count", handlers.GetTotalUserCount, auth.Require(auth.PermUsersRead))
+	adminGroup.GET("get-server-balance", handlers.GetServerBalanceHandler, auth.Require(auth.PermFinanceRead))
 }
@@ -0,0 +1,34 @@
+package routes
+
+import (
+	"github.com/labstack/echo/v4"
+)
+
+// routeGroup registers routes under a prefix with its middleware attached to
+// each route. An echo.Group with middleware also claims every unknown path
+// under its prefix, so groups sharing /api/ would answer unknown paths with
+// whichever auth check was registered last instead of a 404.
+type routeGroup struct {
+	group      *echo.Group
+	middleware []echo.MiddlewareFunc
+}
+
+func group(e *echo.Echo, prefix string, m ...echo.MiddlewareFunc) *routeGroup {
+	return &routeGroup{group: e.Group(prefix), middleware: m}
+}
+
+func (g *routeGroup) with(m []echo.MiddlewareFunc) []echo.MiddlewareFunc {
+	return append(append([]echo.MiddlewareFunc{}, g.middleware...), m...)
+}
+
+func (g *routeGroup) GET(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) *echo.Route {
+	return g.group.GET(path, h, g.with(m)...)
+}
+
+func (g *routeGroup) POST(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) *echo.Route {
+	return g.group.POST(path, h, g.with(m)...)
+}
+
+func (g *routeGroup) DELETE(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) *echo.Route {
+	return g.group.DELETE(path, h, g.with(m)...)
+}
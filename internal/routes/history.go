@@ -2,16 +2,20 @@ package routes
 
 import (
 	"github.com/labstack/echo/v4"
+	"github.com/ranjankuldeep/fakeNumber/internal/audit"
+	"github.com/ranjankuldeep/fakeNumber/internal/auth"
 	"github.com/ranjankuldeep/fakeNumber/internal/handlers"
 )
 
 // RegisterHistoryRoutes sets up routes for history-related operations.
 func RegisterHistoryRoutes(e *echo.Echo) {
-	historyGroup := e.Group("/api/")
+	historyGroup := group(e, "/api/", auth.RequireUser())
 
 	// Define routes
 	historyGroup.GET("recharge-history", handlers.GetRechargeHistory)
 	historyGroup.GET("transaction-history", handlers.GetTransactionHistory)
-	historyGroup.POST("save-recharge-history", handlers.SaveRechargeHistory)
-	historyGroup.GET("transaction-history-count", handlers.TransactionCount)
+
+	adminGroup := group(e, "/api/", auth.RequireAdmin())
+	adminGroup.POST("save-recharge-history", handlers.SaveRechargeHistory, auth.Require(auth.PermBalanceEdit), audit.Log("save-recharge-history"))
+	adminGroup.GET("transaction-history-count", handlers.TransactionCount, auth.Require(auth.PermFinanceRead))
 }
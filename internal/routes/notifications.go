@@ -0,0 +1,18 @@
+package routes
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/ranjankuldeep/fakeNumber/internal/audit"
+	"github.com/ranjankuldeep/fakeNumber/internal/auth"
+	"github.com/ranjankuldeep/fakeNumber/internal/handlers"
+)
+
+// RegisterNotificationRoutes sets up routes for managing notification channels.
+func RegisterNotificationRoutes(e *echo.Echo) {
+	notifyGroup := group(e, "/api/", auth.RequireAdmin())
+
+	notifyGroup.GET("notification-channels", handlers.GetNotificationChannels, auth.Require(auth.PermNotifyManage))
+	notifyGroup.POST("notification-channels", handlers.SaveNotificationChannel, auth.Require(auth.PermNotifyManage), audit.Log("notification-channel"))
+	notifyGroup.DELETE("notification-channels", handlers.DeleteNotificationChannel, auth.Require(auth.PermNotifyManage), audit.Log("notification-channel-delete"))
+	notifyGroup.POST("notification-channels/test", handlers.TestNotificationChannel, auth.Require(auth.PermNotifyManage))
+}
@@ -2,25 +2,32 @@ package routes
 
 import (
 	"github.com/labstack/echo/v4"
+	"github.com/ranjankuldeep/fakeNumber/internal/audit"
+	"github.com/ranjankuldeep/fakeNumber/internal/auth"
 	"github.com/ranjankuldeep/fakeNumber/internal/handlers"
+	"github.com/ranjankuldeep/fakeNumber/internal/idempotency"
 )
 
 // RegisterRechargeRoutes sets up routes for recharge-related operations.
 func RegisterRechargeRoutes(e *echo.Echo) {
-	rechargeGroup := e.Group("/api/")
+	rechargeGroup := group(e, "/api/")
 
 	// Define GET routes
-	rechargeGroup.GET("recharge-upi-transaction", handlers.RechargeUpiApi)
-	rechargeGroup.GET("recharge-trx-transaction", handlers.RechargeTrxApi)
 	rechargeGroup.GET("exchange-rate", handlers.ExchangeRate)
 	rechargeGroup.GET("get-recharge-maintenance", handlers.GetMaintenanceStatus)
 	rechargeGroup.GET("get-minimum-recharge", handlers.GetMinimumRecharge)
 
-	// Define POST routes
-	rechargeGroup.POST("recharge-maintenance-toggle", handlers.ToggleMaintenance)
-	rechargeGroup.POST("add-minimum-recharge", handlers.AddMinimumRecharge)
+	// Providers push payment notifications here, signed with their webhook secret.
+	e.POST("/webhooks/payments/:provider", handlers.PaymentWebhook)
 
-	// Define DELETE routes
-	rechargeGroup.DELETE("delete-minimum-recharge", handlers.DeleteMinimumRecharge)
+	userGroup := group(e, "/api/", auth.RequireUser())
+	userGroup.GET("recharge-upi-transaction", handlers.RechargeUpiApi, idempotency.Middleware())
+	userGroup.GET("recharge-trx-transaction", handlers.RechargeTrxApi, idempotency.Middleware())
 
+	adminGroup := group(e, "/api/", auth.RequireAdmin())
+	adminGroup.POST("recharge-maintenance-toggle", handlers.ToggleMaintenance, auth.Require(auth.PermRechargeAdmin), audit.Log("recharge-maintenance-toggle"))
+	adminGroup.POST("add-minimum-recharge", handlers.AddMinimumRecharge, auth.Require(auth.PermRechargeAdmin), audit.Log("add-minimum-recharge"))
+	adminGroup.DELETE("delete-minimum-recharge", handlers.DeleteMinimumRecharge, auth.Require(auth.PermRechargeAdmin), audit.Log("delete-minimum-recharge"))
+	adminGroup.GET("payment-webhooks", handlers.GetPaymentWebhooks, auth.Require(auth.PermFinanceRead))
+	adminGroup.POST("payment-webhooks/replay", handlers.ReplayPaymentWebhook, auth.Require(auth.PermRechargeAdmin), audit.Log("replay-payment-webhook"))
 }
@@ -2,22 +2,24 @@ package routes
 
 import (
 	"github.com/labstack/echo/v4"
+	"github.com/ranjankuldeep/fakeNumber/internal/audit"
+	"github.com/ranjankuldeep/fakeNumber/internal/auth"
 	"github.com/ranjankuldeep/fakeNumber/internal/handlers"
 )
 
 // RegisterServerDataRoutes sets up routes for server data operations.
 func RegisterServerDataRoutes(e *echo.Echo) {
-	serverGroup := e.Group("/")
+	serverGroup := group(e, "/", auth.RequireAdmin())
 
 	// Define GET routes
-	serverGroup.GET("save-server-data-once", handlers.SaveServerDataOnce)
-	serverGroup.GET("check-duplicates", handlers.CheckDuplicates)
-	serverGroup.GET("merge-duplicates", handlers.MergeDuplicates)
-	serverGroup.GET("update-server-prices", handlers.UpdateServerPrices)
+	serverGroup.GET("save-server-data-once", handlers.SaveServerDataOnce, auth.Require(auth.PermCatalogManage), audit.Log("save-server-data-once"))
+	serverGroup.GET("check-duplicates", handlers.CheckDuplicates, auth.Require(auth.PermCatalogRead))
+	serverGroup.GET("merge-duplicates", handlers.MergeDuplicates, auth.Require(auth.PermCatalogManage), audit.Log("merge-duplicates"))
+	serverGroup.GET("update-server-prices", handlers.UpdateServerPrices, auth.Require(auth.PermCatalogManage), audit.Log("update-server-prices"))
 
 	// Define POST routes
-	serverGroup.POST("add-new-service-data", handlers.AddNewServiceData)
-	serverGroup.POST("add-ccpay-service-name-data", handlers.AddCcpayServiceNameData)
-	serverGroup.POST("service-data-block-unblock", handlers.BlockUnblockService)
-	serverGroup.POST("delete-service", handlers.DeleteService)
+	serverGroup.POST("add-new-service-data", handlers.AddNewServiceData, auth.Require(auth.PermCatalogManage), audit.Log("add-new-service-data"))
+	serverGroup.POST("add-ccpay-service-name-data", handlers.AddCcpayServiceNameData, auth.Require(auth.PermCatalogManage), audit.Log("add-ccpay-service-name-data"))
+	serverGroup.POST("service-data-block-unblock", handlers.BlockUnblockService, auth.Require(auth.PermCatalogManage), audit.Log("service-data-block-unblock"))
+	serverGroup.POST("delete-service", handlers.DeleteService, auth.Require(auth.PermCatalogManage), audit.Log("delete-service"))
 }
@@ -2,15 +2,17 @@ package routes
 
 import (
 	"github.com/labstack/echo/v4"
+	"github.com/ranjankuldeep/fakeNumber/internal/audit"
+	"github.com/ranjankuldeep/fakeNumber/internal/auth"
 	"github.com/ranjankuldeep/fakeNumber/internal/handlers"
 )
 
 // RegisterServerDiscountRoutes sets up routes for server discounts.
 func RegisterServerDiscountRoutes(e *echo.Echo) {
-	serverGroup := e.Group("/api/server/")
+	serverGroup := group(e, "/api/server/", auth.RequireAdmin())
 
 	// Define routes and link them to handler functions
-	serverGroup.POST("add-discount", handlers.AddDiscount)
-	serverGroup.GET("get-discount", handlers.GetDiscount)
-	serverGroup.DELETE("delete-discount", handlers.DeleteDiscount)
+	serverGroup.POST("add-discount", handlers.AddDiscount, auth.Require(auth.PermCatalogManage), audit.Log("server/add-discount"))
+	serverGroup.GET("get-discount", handlers.GetDiscount, auth.Require(auth.PermCatalogRead))
+	serverGroup.DELETE("delete-discount", handlers.DeleteDiscount, auth.Require(auth.PermCatalogManage), audit.Log("server/delete-discount"))
 }
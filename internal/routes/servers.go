@@ -2,19 +2,25 @@ package routes
 
 import (
 	"github.com/labstack/echo/v4"
+	"github.com/ranjankuldeep/fakeNumber/internal/audit"
+	"github.com/ranjankuldeep/fakeNumber/internal/auth"
 	"github.com/ranjankuldeep/fakeNumber/internal/handlers"
 )
 
 func RegisterServerRoutes(e *echo.Echo) {
-	serverGroup := e.Group("/api/")
+	e.GET("/api/maintainance-check", handlers.GetServerZero)
 
-	serverGroup.POST("add-server", handlers.AddServer)
-	serverGroup.GET("get-server", handlers.GetServer)
-	serverGroup.DELETE("delete-server", handlers.DeleteServer)
-	serverGroup.POST("maintainance-server", handlers.MaintainanceServer)
-	serverGroup.GET("maintainance-check", handlers.GetServerZero)
-	serverGroup.POST("add-token-server9", handlers.AddTokenForServer9)
-	serverGroup.GET("get-token-server9", handlers.GetTokenForServer9)
-	serverGroup.POST("add-exchange-rate-margin-server", handlers.UpdateExchangeRateAndMargin)
-	serverGroup.POST("service-data-block-unblock", handlers.BlocKServer)
+	serverGroup := group(e, "/api/", auth.RequireAdmin())
+
+	serverGroup.POST("add-server", handlers.AddServer, auth.Require(auth.PermCatalogManage), audit.Log("add-server"))
+	serverGroup.GET("get-server", handlers.GetServer, auth.Require(auth.PermCatalogManage))
+	serverGroup.DELETE("delete-server", handlers.DeleteServer, auth.Require(auth.PermCatalogManage), audit.Log("delete-server"))
+	serverGroup.POST("maintainance-server", handlers.MaintainanceServer, auth.Require(auth.PermCatalogManage), audit.Log("maintainance-server"))
+	serverGroup.GET("server-health", handlers.GetServerHealth, auth.Require(auth.PermCatalogRead))
+	serverGroup.POST("reset-server-health", handlers.ResetServerHealth, auth.Require(auth.PermCatalogManage), audit.Log("reset-server-health"))
+	serverGroup.POST("add-token-server9", handlers.AddTokenForServer9, auth.Require(auth.PermCatalogManage), audit.Log("add-token-server9"))
+	serverGroup.GET("get-token-server9", handlers.GetTokenForServer9, auth.Require(auth.PermCatalogManage))
+	serverGroup.POST("add-exchange-rate-margin-server", handlers.UpdateExchangeRateAndMargin, auth.Require(auth.PermCatalogManage), audit.Log("add-exchange-rate-margin-server"))
+	serverGroup.POST("update-server-activation", handlers.UpdateServerActivation, auth.Require(auth.PermCatalogManage), audit.Log("update-server-activation"))
+	serverGroup.POST("service-data-block-unblock", handlers.BlocKServer, auth.Require(auth.PermCatalogManage), audit.Log("service-data-block-unblock"))
 }
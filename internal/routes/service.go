@@ -2,14 +2,16 @@ package routes
 
 import (
 	"github.com/labstack/echo/v4"
+	"github.com/ranjankuldeep/fakeNumber/internal/auth"
 	"github.com/ranjankuldeep/fakeNumber/internal/handlers"
+	"github.com/ranjankuldeep/fakeNumber/internal/idempotency"
 )
 
 // RegisterServiceRoutes sets up the routes for the application
 func RegisterServiceRoutes(e *echo.Echo) {
-	e.GET("/api/get-number", handlers.HandleGetNumberRequest)
+	e.GET("/api/get-number", handlers.HandleGetNumberRequest, idempotency.Middleware())
 	e.GET("/api/check-otp", handlers.HandleCheckOTP)
-	e.POST("/api/cancel-order", handlers.HandleCancelOrder)
+	e.POST("/api/cancel-order", handlers.HandleCancelOrder, auth.RequireUser())
 	e.GET("/api/get-otp", handlers.HandleGetOtp)
 	e.GET("/api/number-cancel", handlers.HandleNumberCancel)
 }
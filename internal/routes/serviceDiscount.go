@@ -2,15 +2,17 @@ package routes
 
 import (
 	"github.com/labstack/echo/v4"
+	"github.com/ranjankuldeep/fakeNumber/internal/audit"
+	"github.com/ranjankuldeep/fakeNumber/internal/auth"
 	"github.com/ranjankuldeep/fakeNumber/internal/handlers"
 )
 
 // RegisterServiceDiscountRoutes sets up routes for service discounts.
 func RegisterServiceDiscountRoutes(e *echo.Echo) {
-	serviceGroup := e.Group("/api/service/")
+	serviceGroup := group(e, "/api/service/", auth.RequireAdmin())
 
 	// Define routes and link them to handler functions
-	serviceGroup.POST("add-discount", handlers.AddServiceDiscount)
-	serviceGroup.GET("get-discount", handlers.GetServiceDiscount)
-	serviceGroup.DELETE("delete-discount", handlers.DeleteServiceDiscount)
+	serviceGroup.POST("add-discount", handlers.AddServiceDiscount, auth.Require(auth.PermCatalogManage), audit.Log("service/add-discount"))
+	serviceGroup.GET("get-discount", handlers.GetServiceDiscount, auth.Require(auth.PermCatalogRead))
+	serviceGroup.DELETE("delete-discount", handlers.DeleteServiceDiscount, auth.Require(auth.PermCatalogManage), audit.Log("service/delete-discount"))
 }
@@ -2,14 +2,16 @@ package routes
 
 import (
 	"github.com/labstack/echo/v4"
+	"github.com/ranjankuldeep/fakeNumber/internal/audit"
+	"github.com/ranjankuldeep/fakeNumber/internal/auth"
 	"github.com/ranjankuldeep/fakeNumber/internal/handlers"
 )
 
 // RegisterUnsendTrxRoutes sets up routes for unsend transactions.
 func RegisterUnsendTrxRoutes(e *echo.Echo) {
-	trxGroup := e.Group("/unsend-trx")
+	trxGroup := group(e, "/unsend-trx", auth.RequireAdmin())
 
 	// Define routes and link them to handler functions
-	trxGroup.GET("", handlers.GetAllUnsendTrx)
-	trxGroup.DELETE("", handlers.DeleteUnsendTrx)
+	trxGroup.GET("", handlers.GetAllUnsendTrx, auth.Require(auth.PermFinanceRead))
+	trxGroup.DELETE("", handlers.DeleteUnsendTrx, auth.Require(auth.PermRechargeAdmin), audit.Log("unsend-trx/delete"))
 }
@@ -2,14 +2,16 @@ package routes
 
 import (
 	"github.com/labstack/echo/v4"
+	"github.com/ranjankuldeep/fakeNumber/internal/audit"
+	"github.com/ranjankuldeep/fakeNumber/internal/auth"
 	"github.com/ranjankuldeep/fakeNumber/internal/handlers"
 )
 
 func RegisterUserDiscountRoutes(e *echo.Echo) {
-	userGroup := e.Group("/api/users/")
+	userGroup := group(e, "/api/users/", auth.RequireAdmin())
 
-	userGroup.POST("add-discount", handlers.AddUserDiscount)
-	userGroup.GET("get-discount", handlers.GetUserDiscount)
-	userGroup.DELETE("delete-discount", handlers.DeleteUserDiscount)
-	userGroup.GET("get-all-discounts", handlers.GetAllUserDiscounts)
+	userGroup.POST("add-discount", handlers.AddUserDiscount, auth.Require(auth.PermCatalogManage), audit.Log("users/add-discount"))
+	userGroup.GET("get-discount", handlers.GetUserDiscount, auth.Require(auth.PermCatalogRead))
+	userGroup.DELETE("delete-discount", handlers.DeleteUserDiscount, auth.Require(auth.PermCatalogManage), audit.Log("users/delete-discount"))
+	userGroup.GET("get-all-discounts", handlers.GetAllUserDiscounts, auth.Require(auth.PermCatalogRead))
 }
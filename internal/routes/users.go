@@ -2,6 +2,8 @@ package routes
 
 import (
 	"github.com/labstack/echo/v4"
+	"github.com/ranjankuldeep/fakeNumber/internal/audit"
+	"github.com/ranjankuldeep/fakeNumber/internal/auth"
 	"github.com/ranjankuldeep/fakeNumber/internal/handlers"
 )
 
@@ -11,21 +13,30 @@ func RegisterUserRoutes(e *echo.Echo) {
 	e.POST("/api/verify-otp", handlers.VerifyOTP)
 	e.POST("/api/resend-otp", handlers.ResendOTP)
 	e.POST("/api/login", handlers.Login)
+	e.POST("/api/login-2fa", handlers.LoginTwoFactor)
 	e.POST("/api/forgot-password", handlers.ForgotPassword)
 	e.POST("/api/resend-forgot-otp", handlers.ResendForgotOTP)
 	e.POST("/api/verify-forgot-otp", handlers.ForgotVerifyOTP)
 	e.POST("/api/change-password-unauthenticated", handlers.ChangePasswordUnauthenticated)
-	e.POST("/api/change-password-authenticated", handlers.ChangePasswordAuthenticated)
 	e.POST("/api/google-login", handlers.GoogleLogin)
 	e.POST("/api/google-signup", handlers.GoogleSignup)
 
+	userGroup := group(e, "/api/", auth.RequireUser())
+	userGroup.POST("change-password-authenticated", handlers.ChangePasswordAuthenticated)
+	userGroup.GET("get-user", handlers.GetUser)
+	userGroup.GET("blocked-user", handlers.BlockedUser)
+	userGroup.GET("orders", handlers.GetOrdersByUserId)
+	userGroup.POST("2fa-setup", handlers.SetupTwoFactor)
+	userGroup.POST("2fa-enable", handlers.EnableTwoFactor)
+	userGroup.POST("2fa-disable", handlers.DisableTwoFactor)
+	userGroup.POST("2fa-recovery-codes", handlers.RegenerateRecoveryCodes)
+
 	// Admin APIs with `/api` prefix
-	e.GET("/api/get-all-users", handlers.GetAllUsers)
-	e.GET("/api/get-user", handlers.GetUser)
-	e.POST("/api/user", handlers.BlockUnblockUser)
-	e.GET("/api/blocked-user", handlers.BlockedUser)
-	e.GET("/api/get-all-blocked-users", handlers.GetAllBlockedUsers)
-	e.GET("/api/orders", handlers.GetOrdersByUserId)
-	e.POST("/api/edit-balance", handlers.UpdateWalletBalanceHandler)
-	e.POST("/api/edit-recharge", handlers.UpdateRechargeHandler)
+	adminGroup := group(e, "/api/", auth.RequireAdmin())
+	adminGroup.GET("get-all-users", handlers.GetAllUsers, auth.Require(auth.PermUsersRead))
+	adminGroup.POST("user", handlers.BlockUnblockUser, auth.Require(auth.PermUsersBlock), audit.Log("user"))
+	adminGroup.GET("get-all-blocked-users", handlers.GetAllBlockedUsers, auth.Require(auth.PermUsersRead))
+	adminGroup.POST("edit-recharge", handlers.UpdateRechargeHandler, auth.Require(auth.PermBalanceEdit), audit.Log("edit-recharge"))
+	adminGroup.GET("admin-roles", handlers.GetAdminRoles, auth.Require(auth.PermRolesManage))
+	adminGroup.POST("admin-roles", handlers.AssignAdminRole, auth.Require(auth.PermRolesManage), audit.Log("admin-roles"))
 }
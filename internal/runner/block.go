@@ -4,10 +4,10 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"strconv"
 	"time"
 
 	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/internal/money"
 	"github.com/ranjankuldeep/fakeNumber/internal/services"
 	"github.com/ranjankuldeep/fakeNumber/logs"
 	"go.mongodb.org/mongo-driver/bson"
@@ -31,14 +31,14 @@ func fetchAllUsers(ctx context.Context, db *mongo.Database) ([]models.User, erro
 	return users, nil
 }
 
-func fetchRechargeSum(ctx context.Context, userID string, db *mongo.Database) (float64, error) {
+func fetchRechargeSum(ctx context.Context, userID string, db *mongo.Database) (money.Paise, error) {
 	rechargeHistoryCollection := models.InitializeRechargeHistoryCollection(db)
 	cursor, err := rechargeHistoryCollection.Find(ctx, bson.M{"userId": userID})
 	if err != nil {
 		return 0, fmt.Errorf("failed to query recharge histories for user %s: %w", userID, err)
 	}
 	defer cursor.Close(ctx)
-	totalRecharge := 0.0
+	var totalRecharge money.Paise
 	for cursor.Next(ctx) {
 		var recharge models.RechargeHistory
 		if err := cursor.Decode(&recharge); err != nil {
@@ -46,7 +46,7 @@ func fetchRechargeSum(ctx context.Context, userID string, db *mongo.Database) (f
 			continue
 		}
 
-		amount, err := strconv.ParseFloat(recharge.Amount, 64)
+		amount, err := money.Parse(recharge.Amount)
 		if err != nil {
 			log.Printf("Invalid recharge amount for user %s: %v", userID, err)
 			continue
@@ -59,21 +59,21 @@ func fetchRechargeSum(ctx context.Context, userID string, db *mongo.Database) (f
 	return totalRecharge, nil
 }
 
-func fetchSuccessTransactionSum(ctx context.Context, transactionHistoryCollection *mongo.Collection, userID string) (float64, error) {
+func fetchSuccessTransactionSum(ctx context.Context, transactionHistoryCollection *mongo.Collection, userID string) (money.Paise, error) {
 	cursor, err := transactionHistoryCollection.Find(ctx, bson.M{"userId": userID, "status": "SUCCESS"})
 	if err != nil {
 		return 0, fmt.Errorf("failed to query transaction histories for user %s: %w", userID, err)
 	}
 	defer cursor.Close(ctx)
 
-	totalPrice := 0.0
+	var totalPrice money.Paise
 	for cursor.Next(ctx) {
 		var transaction models.TransactionHistory
 		if err := cursor.Decode(&transaction); err != nil {
 			log.Printf("Failed to decode transaction history: %v", err)
 			continue
 		}
-		price, err := strconv.ParseFloat(transaction.Price, 64)
+		price, err := money.Parse(transaction.Price)
 		if err != nil {
 			log.Printf("Invalid transaction price for user %s: %v", userID, err)
 			continue
@@ -83,21 +83,21 @@ func fetchSuccessTransactionSum(ctx context.Context, transactionHistoryCollectio
 	return totalPrice, nil
 }
 
-func fetchPendingTransactionSum(ctx context.Context, transactionHistoryCollection *mongo.Collection, userID string) (float64, error) {
+func fetchPendingTransactionSum(ctx context.Context, transactionHistoryCollection *mongo.Collection, userID string) (money.Paise, error) {
 	cursor, err := transactionHistoryCollection.Find(ctx, bson.M{"userId": userID, "status": "PENDING"})
 	if err != nil {
 		return 0, fmt.Errorf("failed to query transaction histories for user %s: %w", userID, err)
 	}
 	defer cursor.Close(ctx)
 
-	totalPrice := 0.0
+	var totalPrice money.Paise
 	for cursor.Next(ctx) {
 		var transaction models.TransactionHistory
 		if err := cursor.Decode(&transaction); err != nil {
 			log.Printf("Failed to decode transaction history: %v", err)
 			continue
 		}
-		price, err := strconv.ParseFloat(transaction.Price, 64)
+		price, err := money.Parse(transaction.Price)
 		if err != nil {
 			log.Printf("Invalid transaction price for user %s: %v", userID, err)
 			continue
@@ -107,14 +107,14 @@ func fetchPendingTransactionSum(ctx context.Context, transactionHistoryCollectio
 	return totalPrice, nil
 }
 
-func fetchWalletBalance(ctx context.Context, apiWalletCollection *mongo.Collection, userID primitive.ObjectID) (float64, error) {
+func fetchWalletBalance(ctx context.Context, apiWalletCollection *mongo.Collection, userID primitive.ObjectID) (money.Paise, error) {
 	var wallet models.ApiWalletUser
 	err := apiWalletCollection.FindOne(ctx, bson.M{"userId": userID}).Decode(&wallet)
 	if err != nil {
 		return 0, fmt.Errorf("failed to fetch wallet for user %s: %w", userID.Hex(), err)
 	}
 
-	return wallet.Balance, nil
+	return wallet.Amount(), nil
 }
 
 func CheckAndBlockUsers(db *mongo.Database) {
@@ -170,7 +170,8 @@ func CheckAndBlockUsers(db *mongo.Database) {
 		if adjustedTotal == 0 {
 			divider = 1
 		}
-		balanceDifference := (walletBalance - adjustedTotal) / divider * 100
+		// Amounts are exact paise, so a consistent wallet differs by zero.
+		balanceDifference := float64(walletBalance-adjustedTotal) / float64(divider) * 100
 		if balanceDifference < -0.2 || balanceDifference > 0.2 {
 			update := bson.M{
 				"$set": bson.M{
@@ -186,11 +187,11 @@ func CheckAndBlockUsers(db *mongo.Database) {
 			blockDetails := services.BlockUserDetails{
 				Email:          user.Email,
 				Date:           time.Now().Format("02-01-2006 03:04:05pm"),
-				TotalRecharge:  fmt.Sprintf("%0.2f", totalRecharge),
-				UsedBalance:    fmt.Sprintf("%0.2f", totalTransactionPendingPrice+totalTransactionSuccessPrice),
-				CurrentBalance: fmt.Sprintf("%0.2f", walletBalance),
-				ToBeBalance:    fmt.Sprintf("%0.2f", totalRecharge-(totalTransactionPendingPrice+totalTransactionSuccessPrice)),
-				FraudAmount:    fmt.Sprintf("%0.2f", walletBalance-(totalRecharge-(totalTransactionPendingPrice+totalTransactionSuccessPrice))),
+				TotalRecharge:  totalRecharge.String(),
+				UsedBalance:    (totalTransactionPendingPrice + totalTransactionSuccessPrice).String(),
+				CurrentBalance: walletBalance.String(),
+				ToBeBalance:    adjustedTotal.String(),
+				FraudAmount:    (walletBalance - adjustedTotal).String(),
 				Reason:         fmt.Sprintf("Due to Fraud"),
 			}
 			err = services.UserBlockDetails(blockDetails)
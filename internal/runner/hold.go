@@ -0,0 +1,29 @@
+package runner
+
+import (
+	"context"
+	"time"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/ledger"
+	"github.com/ranjankuldeep/fakeNumber/logs"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// StartHoldSweeper periodically releases balance holds whose purchase never
+// captured or released them.
+func StartHoldSweeper(db *mongo.Database) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		released, err := ledger.ReleaseExpiredHolds(ctx, db)
+		cancel()
+		if err != nil {
+			logs.Logger.Error(err)
+			continue
+		}
+		if released > 0 {
+			logs.Logger.Infof("Released %d expired balance holds", released)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// EnsureIndexes creates the indexes the application relies on for
+// correctness, such as the unique keys that stop a payment or a ledger
+// posting being applied twice. It must succeed before any request is served,
+// and runs after the migrations that clean up data violating them.
+func EnsureIndexes(db *mongo.Database) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	indexes := []struct {
+		name   string
+		ensure func(context.Context, *mongo.Collection) error
+		col    *mongo.Collection
+	}{
+		{"ledger", models.EnsureLedgerIndexes, models.InitializeLedgerCollection(db)},
+		{"balance hold", models.EnsureBalanceHoldIndexes, models.InitializeBalanceHoldCollection(db)},
+		{"recharge history", models.EnsureRechargeHistoryIndexes, models.InitializeRechargeHistoryCollection(db)},
+		{"payment intent", models.EnsurePaymentIntentIndexes, models.InitializePaymentIntentCollection(db)},
+		{"payment webhook", models.EnsurePaymentWebhookIndexes, models.InitializePaymentWebhookCollection(db)},
+		{"idempotency", models.EnsureIdempotencyIndexes, models.InitializeIdempotencyCollection(db)},
+		{"api key", models.EnsureAPIKeyIndexes, models.InitializeAPIKeyCollection(db)},
+		{"otp", models.EnsureOTPIndexes, models.InitializeOTPCollection(db)},
+		{"audit", models.EnsureAuditIndexes, models.InitializeAuditCollection(db)},
+		{"mail outbox", models.EnsureMailOutboxIndexes, models.InitializeMailOutboxCollection(db)},
+	}
+	for _, index := range indexes {
+		if err := index.ensure(ctx, index.col); err != nil {
+			return fmt.Errorf("failed to ensure %s indexes: %w", index.name, err)
+		}
+	}
+	return nil
+}
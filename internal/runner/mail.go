@@ -0,0 +1,28 @@
+package runner
+
+import (
+	"context"
+	"time"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/mail"
+	"github.com/ranjankuldeep/fakeNumber/logs"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// StartMailOutbox periodically retries emails whose first send failed.
+func StartMailOutbox(db *mongo.Database) {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+		sent, err := mail.ProcessOutbox(ctx, db)
+		cancel()
+		if err != nil {
+			logs.Logger.Error(err)
+			continue
+		}
+		if sent > 0 {
+			logs.Logger.Infof("Sent %d queued emails", sent)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/internal/money"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const moneyMigration = "money-paise-v1"
+
+// canonicalAmount matches amounts already written as money.Paise.String().
+const canonicalAmount = `^-?[0-9]+\.[0-9]{2}$`
+
+// MigrateMoney converts stored amounts to exact paise once: wallet balances
+// gain balancePaise, ledger amounts become integers and history price strings
+// are rewritten with exactly two decimals.
+func MigrateMoney(db *mongo.Database) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	migrationCol := models.InitializeMigrationCollection(db)
+	count, err := migrationCol.CountDocuments(ctx, bson.M{"_id": moneyMigration})
+	if err != nil {
+		return fmt.Errorf("failed to check migrations: %w", err)
+	}
+	if count > 0 {
+		return nil
+	}
+	log.Printf("Running migration %s", moneyMigration)
+
+	toPaise := func(field string) bson.M {
+		return bson.M{"$toLong": bson.M{"$round": bson.A{bson.M{"$multiply": bson.A{"$" + field, 100}}, 0}}}
+	}
+
+	walletCol := models.InitializeApiWalletuserCollection(db)
+	_, err = walletCol.UpdateMany(ctx, bson.M{"balancePaise": bson.M{"$exists": false}}, mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{"balancePaise": toPaise("balance")}}},
+		{{Key: "$set", Value: bson.M{"balance": bson.M{"$divide": bson.A{"$balancePaise", 100}}}}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to migrate wallets: %w", err)
+	}
+
+	ledgerCol := models.InitializeLedgerCollection(db)
+	_, err = ledgerCol.UpdateMany(ctx, bson.M{"amount": bson.M{"$type": "double"}}, mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{"amount": toPaise("amount")}}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to migrate ledger amounts: %w", err)
+	}
+	_, err = ledgerCol.UpdateMany(ctx, bson.M{"balanceAfter": bson.M{"$type": "double"}}, mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{"balanceAfter": toPaise("balanceAfter")}}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to migrate ledger balances: %w", err)
+	}
+
+	if err := normalizeAmounts(ctx, models.InitializeTransactionHistoryCollection(db), "price"); err != nil {
+		return err
+	}
+	if err := normalizeAmounts(ctx, models.InitializeRechargeHistoryCollection(db), "amount"); err != nil {
+		return err
+	}
+
+	_, err = migrationCol.InsertOne(ctx, models.Migration{Name: moneyMigration, AppliedAt: time.Now()})
+	if err != nil {
+		return fmt.Errorf("failed to record migration: %w", err)
+	}
+	log.Printf("Migration %s applied", moneyMigration)
+	return nil
+}
+
+// normalizeAmounts rewrites a string amount field in the canonical two
+// decimal form. Unparseable values are logged and left alone.
+func normalizeAmounts(ctx context.Context, collection *mongo.Collection, field string) error {
+	filter := bson.M{field: bson.M{"$type": "string", "$not": primitive.Regex{Pattern: canonicalAmount}}}
+	cursor, err := collection.Find(ctx, filter, options.Find().SetProjection(bson.M{field: 1}))
+	if err != nil {
+		return fmt.Errorf("failed to query %s: %w", collection.Name(), err)
+	}
+	defer cursor.Close(ctx)
+
+	var updates []mongo.WriteModel
+	for cursor.Next(ctx) {
+		var doc bson.M
+		if err := cursor.Decode(&doc); err != nil {
+			return fmt.Errorf("failed to decode %s: %w", collection.Name(), err)
+		}
+		value, _ := doc[field].(string)
+		amount, err := money.Parse(value)
+		if err != nil {
+			log.Printf("Skipping %s %v: invalid %s %q", collection.Name(), doc["_id"], field, value)
+			continue
+		}
+		updates = append(updates, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": doc["_id"]}).
+			SetUpdate(bson.M{"$set": bson.M{field: amount.String()}}))
+	}
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("failed to iterate %s: %w", collection.Name(), err)
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+	_, err = collection.BulkWrite(ctx, updates, options.BulkWrite().SetOrdered(false))
+	if err != nil {
+		return fmt.Errorf("failed to normalize %s: %w", collection.Name(), err)
+	}
+	return nil
+}
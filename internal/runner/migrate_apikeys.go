@@ -0,0 +1,100 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/apikeys"
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const apiKeyMigration = "api-keys-hashed-v1"
+
+// MigrateAPIKeys moves the single plaintext api_key of each wallet into the
+// api_keys collection as a hashed key with every scope, so that existing
+// integrations keep working, and then removes the plaintext.
+func MigrateAPIKeys(db *mongo.Database) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	migrationCol := models.InitializeMigrationCollection(db)
+	count, err := migrationCol.CountDocuments(ctx, bson.M{"_id": apiKeyMigration})
+	if err != nil {
+		return fmt.Errorf("failed to check migrations: %w", err)
+	}
+	if count > 0 {
+		return nil
+	}
+	log.Printf("Running migration %s", apiKeyMigration)
+
+	keyCol := models.InitializeAPIKeyCollection(db)
+	if err := models.EnsureAPIKeyIndexes(ctx, keyCol); err != nil {
+		return fmt.Errorf("failed to ensure api key indexes: %w", err)
+	}
+
+	walletCol := models.InitializeApiWalletuserCollection(db)
+	withKey := bson.M{"api_key": bson.M{"$exists": true}}
+	cursor, err := walletCol.Find(ctx, withKey,
+		options.Find().SetProjection(bson.M{"userId": 1, "api_key": 1, "createdAt": 1}))
+	if err != nil {
+		return fmt.Errorf("failed to query wallets: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var inserts []mongo.WriteModel
+	for cursor.Next(ctx) {
+		var wallet struct {
+			UserID    primitive.ObjectID `bson:"userId"`
+			APIKey    string             `bson:"api_key"`
+			CreatedAt time.Time          `bson:"createdAt"`
+		}
+		if err := cursor.Decode(&wallet); err != nil {
+			return fmt.Errorf("failed to decode wallet: %w", err)
+		}
+		if wallet.APIKey == "" || wallet.UserID.IsZero() {
+			continue
+		}
+		createdAt := wallet.CreatedAt
+		if createdAt.IsZero() {
+			createdAt = time.Now()
+		}
+		hash := apikeys.Hash(wallet.APIKey)
+		// Upsert on the hash so that a rerun after a partial failure is safe.
+		inserts = append(inserts, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"hash": hash}).
+			SetUpdate(bson.M{"$setOnInsert": models.APIKey{
+				ID:        primitive.NewObjectID(),
+				UserID:    wallet.UserID,
+				Name:      "Default",
+				Prefix:    apikeys.DisplayPrefix(wallet.APIKey),
+				Hash:      hash,
+				Scopes:    apikeys.Scopes(),
+				CreatedAt: createdAt,
+			}}).
+			SetUpsert(true))
+	}
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("failed to iterate wallets: %w", err)
+	}
+	if len(inserts) > 0 {
+		if _, err := keyCol.BulkWrite(ctx, inserts, options.BulkWrite().SetOrdered(false)); err != nil {
+			return fmt.Errorf("failed to copy api keys: %w", err)
+		}
+	}
+	if _, err := walletCol.UpdateMany(ctx, withKey, bson.M{"$unset": bson.M{"api_key": ""}}); err != nil {
+		return fmt.Errorf("failed to remove plaintext api keys: %w", err)
+	}
+
+	_, err = migrationCol.InsertOne(ctx, models.Migration{Name: apiKeyMigration, AppliedAt: time.Now()})
+	if err != nil {
+		return fmt.Errorf("failed to record migration: %w", err)
+	}
+	log.Printf("Migration %s applied", apiKeyMigration)
+	return nil
+}
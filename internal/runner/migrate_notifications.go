@@ -0,0 +1,130 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/internal/notify"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const notificationMigration = "notification-channels-v1"
+
+// legacyBot is one of the Telegram bots that used to be hard-coded, with the
+// events it was sent and the variable now holding its token.
+type legacyBot struct {
+	name     string
+	tokenEnv string
+	events   []notify.EventType
+}
+
+var legacyBots = []legacyBot{
+	{"Telegram service", "TELEGRAM_SERVICE_BOT_TOKEN", []notify.EventType{notify.EventNumberBought, notify.EventNumberOTP, notify.EventNumberCancelled}},
+	{"Telegram recharge", "TELEGRAM_RECHARGE_BOT_TOKEN", []notify.EventType{notify.EventRechargeUPI, notify.EventRechargeTRX, notify.EventRechargeAdmin}},
+	{"Telegram selling", "TELEGRAM_SELLING_BOT_TOKEN", []notify.EventType{notify.EventSellingReport}},
+	{"Telegram block", "TELEGRAM_BLOCK_BOT_TOKEN", []notify.EventType{notify.EventUserBlocked}},
+}
+
+// legacyChannels returns a Telegram channel for every legacy bot, all posting
+// to chatID. A bot without its own token falls back to fallbackToken, and is
+// left out when neither is set.
+func legacyChannels(chatID, fallbackToken string, getenv func(string) string, now time.Time) []models.NotificationChannel {
+	if chatID == "" {
+		return nil
+	}
+	var channels []models.NotificationChannel
+	for _, bot := range legacyBots {
+		token := getenv(bot.tokenEnv)
+		if token == "" {
+			token = fallbackToken
+		}
+		if token == "" {
+			continue
+		}
+		events := make([]string, len(bot.events))
+		for i, event := range bot.events {
+			events[i] = string(event)
+		}
+		channels = append(channels, models.NotificationChannel{
+			ID:        primitive.NewObjectID(),
+			Name:      bot.name,
+			Kind:      models.ChannelTelegram,
+			Token:     token,
+			ChatID:    chatID,
+			Events:    events,
+			Enabled:   true,
+			CreatedAt: now,
+			UpdatedAt: now,
+		})
+	}
+	return channels
+}
+
+// MigrateNotificationChannels replaces the Telegram bots that used to be
+// hard-coded. When no channel exists yet it creates one per bot, subscribed
+// to the events that bot was sent, from TELEGRAM_CHAT_ID and the bot's own
+// token variable or else TELEGRAM_BOT_TOKEN. Without them the migration is
+// not recorded so that it runs again on the next start. Every start without
+// an enabled channel is warned about, since notifications are then only
+// logged.
+func MigrateNotificationChannels(db *mongo.Database) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	if err := migrateNotificationChannels(ctx, db); err != nil {
+		return err
+	}
+	enabled, err := models.InitializeNotificationChannelCollection(db).CountDocuments(ctx, bson.M{"enabled": true})
+	if err != nil {
+		return fmt.Errorf("failed to count notification channels: %w", err)
+	}
+	if enabled == 0 {
+		log.Printf("WARNING: no notification channel is enabled, staff will not be told about purchases, recharges or blocked users. Set TELEGRAM_CHAT_ID and the TELEGRAM_*_BOT_TOKEN variables or add a channel.")
+	}
+	return nil
+}
+
+func migrateNotificationChannels(ctx context.Context, db *mongo.Database) error {
+	migrationCol := models.InitializeMigrationCollection(db)
+	count, err := migrationCol.CountDocuments(ctx, bson.M{"_id": notificationMigration})
+	if err != nil {
+		return fmt.Errorf("failed to check migrations: %w", err)
+	}
+	if count > 0 {
+		return nil
+	}
+	log.Printf("Running migration %s", notificationMigration)
+
+	channelCol := models.InitializeNotificationChannelCollection(db)
+	existing, err := channelCol.CountDocuments(ctx, bson.M{})
+	if err != nil {
+		return fmt.Errorf("failed to count notification channels: %w", err)
+	}
+	if existing == 0 {
+		channels := legacyChannels(os.Getenv("TELEGRAM_CHAT_ID"), os.Getenv("TELEGRAM_BOT_TOKEN"), os.Getenv, time.Now())
+		if len(channels) == 0 {
+			return nil
+		}
+		docs := make([]interface{}, len(channels))
+		for i, channel := range channels {
+			docs[i] = channel
+		}
+		if _, err := channelCol.InsertMany(ctx, docs); err != nil {
+			return fmt.Errorf("failed to create telegram channels: %w", err)
+		}
+		log.Printf("Created %d Telegram notification channels", len(channels))
+	}
+
+	_, err = migrationCol.InsertOne(ctx, models.Migration{Name: notificationMigration, AppliedAt: time.Now()})
+	if err != nil {
+		return fmt.Errorf("failed to record migration: %w", err)
+	}
+	log.Printf("Migration %s applied", notificationMigration)
+	return nil
+}
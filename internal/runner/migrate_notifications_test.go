@@ -0,0 +1,51 @@
+package runner
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/notify"
+)
+
+func TestLegacyChannels(t *testing.T) {
+	env := map[string]string{"TELEGRAM_RECHARGE_BOT_TOKEN": "recharge-token"}
+	getenv := func(key string) string { return env[key] }
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	if got := legacyChannels("", "fallback", getenv, now); len(got) != 0 {
+		t.Errorf("legacyChannels without a chat = %d channels, want none", len(got))
+	}
+
+	got := legacyChannels("chat", "", getenv, now)
+	if len(got) != 1 || got[0].Name != "Telegram recharge" || got[0].Token != "recharge-token" || got[0].ChatID != "chat" {
+		t.Fatalf("legacyChannels with one bot token = %+v", got)
+	}
+	if want := []string{"recharge.upi", "recharge.trx", "recharge.admin"}; !reflect.DeepEqual(got[0].Events, want) {
+		t.Errorf("recharge events = %v, want %v", got[0].Events, want)
+	}
+
+	got = legacyChannels("chat", "fallback", getenv, now)
+	if len(got) != len(legacyBots) {
+		t.Fatalf("legacyChannels with a fallback = %d channels, want %d", len(got), len(legacyBots))
+	}
+	subscribed := map[string]bool{}
+	for _, channel := range got {
+		want := "fallback"
+		if channel.Name == "Telegram recharge" {
+			want = "recharge-token"
+		}
+		if channel.Token != want || !channel.Enabled || len(channel.Events) == 0 {
+			t.Errorf("channel %+v, want token %s, enabled with events", channel, want)
+		}
+		for _, event := range channel.Events {
+			if subscribed[event] {
+				t.Errorf("event %s routed to two channels", event)
+			}
+			subscribed[event] = true
+		}
+	}
+	if len(subscribed) != len(notify.EventTypes()) {
+		t.Errorf("legacy bots cover %d events, want every event", len(subscribed))
+	}
+}
@@ -0,0 +1,84 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const rechargeMigration = "recharge-transaction-unique-v1"
+
+// MigrateRechargeHistory makes recharge transaction ids unique. Duplicates
+// left by the old check-then-insert code keep the first entry's id and the
+// later ones are renamed with a "-dup-" suffix, so that the unique index can
+// be built; their amounts were already credited and stay in the history.
+func MigrateRechargeHistory(db *mongo.Database) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	migrationCol := models.InitializeMigrationCollection(db)
+	count, err := migrationCol.CountDocuments(ctx, bson.M{"_id": rechargeMigration})
+	if err != nil {
+		return fmt.Errorf("failed to check migrations: %w", err)
+	}
+	if count > 0 {
+		return nil
+	}
+	log.Printf("Running migration %s", rechargeMigration)
+
+	historyCol := models.InitializeRechargeHistoryCollection(db)
+	cursor, err := historyCol.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$sort", Value: bson.M{"_id": 1}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   "$transaction_id",
+			"ids":   bson.M{"$push": "$_id"},
+			"count": bson.M{"$sum": 1},
+		}}},
+		{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to find duplicate recharges: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	renamed := 0
+	for cursor.Next(ctx) {
+		var group struct {
+			TransactionID string               `bson:"_id"`
+			IDs           []primitive.ObjectID `bson:"ids"`
+		}
+		if err := cursor.Decode(&group); err != nil {
+			return fmt.Errorf("failed to decode duplicate recharges: %w", err)
+		}
+		for _, id := range group.IDs[1:] {
+			_, err := historyCol.UpdateOne(ctx, bson.M{"_id": id},
+				bson.M{"$set": bson.M{"transaction_id": group.TransactionID + "-dup-" + id.Hex()}})
+			if err != nil {
+				return fmt.Errorf("failed to rename duplicate recharge %s: %w", id.Hex(), err)
+			}
+			renamed++
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("failed to iterate duplicate recharges: %w", err)
+	}
+	if renamed > 0 {
+		log.Printf("Renamed %d duplicate recharge transaction ids", renamed)
+	}
+
+	if err := models.EnsureRechargeHistoryIndexes(ctx, historyCol); err != nil {
+		return fmt.Errorf("failed to ensure recharge history indexes: %w", err)
+	}
+	_, err = migrationCol.InsertOne(ctx, models.Migration{Name: rechargeMigration, AppliedAt: time.Now()})
+	if err != nil {
+		return fmt.Errorf("failed to record migration: %w", err)
+	}
+	log.Printf("Migration %s applied", rechargeMigration)
+	return nil
+}
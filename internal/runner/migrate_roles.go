@@ -0,0 +1,87 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const roleMigration = "admin-role-super-admin-v1"
+
+// legacyAdminRole is the single staff role that existed before roles had
+// permissions.
+const legacyAdminRole = "admin"
+
+// MigrateAdminRoles gives users who held the old admin role the super-admin
+// role, which carries every permission the admin role had.
+func MigrateAdminRoles(db *mongo.Database) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	migrationCol := models.InitializeMigrationCollection(db)
+	count, err := migrationCol.CountDocuments(ctx, bson.M{"_id": roleMigration})
+	if err != nil {
+		return fmt.Errorf("failed to check migrations: %w", err)
+	}
+	if count > 0 {
+		return nil
+	}
+	log.Printf("Running migration %s", roleMigration)
+
+	result, err := models.InitializeUserCollection(db).UpdateMany(ctx,
+		bson.M{"role": legacyAdminRole},
+		bson.M{"$set": bson.M{"role": models.RoleSuperAdmin, "updatedAt": time.Now()}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to migrate admin roles: %w", err)
+	}
+	log.Printf("Moved %d admins to the %s role", result.ModifiedCount, models.RoleSuperAdmin)
+
+	_, err = migrationCol.InsertOne(ctx, models.Migration{Name: roleMigration, AppliedAt: time.Now()})
+	if err != nil {
+		return fmt.Errorf("failed to record migration: %w", err)
+	}
+	log.Printf("Migration %s applied", roleMigration)
+	return nil
+}
+
+// BootstrapSuperAdmin makes the registered user named by SUPER_ADMIN_EMAIL a
+// super-admin while there is none, so that a new deployment can assign the
+// other roles from the admin UI.
+func BootstrapSuperAdmin(db *mongo.Database) error {
+	email := strings.TrimSpace(os.Getenv("SUPER_ADMIN_EMAIL"))
+	if email == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	userCol := models.InitializeUserCollection(db)
+	count, err := userCol.CountDocuments(ctx, bson.M{"role": models.RoleSuperAdmin})
+	if err != nil {
+		return fmt.Errorf("failed to count super-admins: %w", err)
+	}
+	if count > 0 {
+		return nil
+	}
+	result, err := userCol.UpdateOne(ctx,
+		bson.M{"email": email},
+		bson.M{"$set": bson.M{"role": models.RoleSuperAdmin, "updatedAt": time.Now()}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to bootstrap super-admin: %w", err)
+	}
+	if result.MatchedCount == 0 {
+		log.Printf("SUPER_ADMIN_EMAIL %s is not a registered user; sign up first", email)
+		return nil
+	}
+	log.Printf("Made %s a %s", email, models.RoleSuperAdmin)
+	return nil
+}
@@ -2,83 +2,31 @@ package runner
 
 import (
 	"context"
+	"errors"
 	"log"
-	"math"
-	"strconv"
 	"time"
 
 	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/internal/expiry"
 	"github.com/ranjankuldeep/fakeNumber/internal/handlers"
+	"github.com/ranjankuldeep/fakeNumber/internal/ledger"
+	"github.com/ranjankuldeep/fakeNumber/internal/money"
+	"github.com/ranjankuldeep/fakeNumber/internal/orderstate"
+	"github.com/ranjankuldeep/fakeNumber/internal/providers"
 	"github.com/ranjankuldeep/fakeNumber/logs"
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func MonitorOrders(db *mongo.Database) {
-	orderCollection := models.InitializeOrderCollection(db)
-	ticker := time.NewTicker(1 * time.Second)
-	defer ticker.Stop()
-	for {
-		select {
-		case <-ticker.C:
-			var orders []models.Order
-			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-			defer cancel()
-			cursor, err := orderCollection.Find(ctx, bson.M{})
-			if err != nil {
-				log.Printf("Error finding orders: %v", err)
-				continue
-			}
-			defer cursor.Close(ctx)
-
-			if err := cursor.All(ctx, &orders); err != nil {
-				log.Printf("Error decoding orders: %v", err)
-				continue
-			}
-
-			for _, order := range orders {
-				go handleOrder(order.UserID, db)
-			}
-		}
-	}
-}
-
-func handleOrder(userId primitive.ObjectID, db *mongo.Database) {
-	defer func() {
-		if r := recover(); r != nil {
-			log.Printf("Recovered from panic in OTP handling goroutine: %v", r)
-		}
-	}()
-
-	orderCollection := models.InitializeOrderCollection(db)
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	orderFilter := bson.M{"userId": userId}
-	cursor, err := orderCollection.Find(ctx, orderFilter)
-	if err != nil {
-		return
-	}
-	defer cursor.Close(ctx)
-
-	var orders []models.Order
-	for cursor.Next(ctx) {
-		var order models.Order
-		if err := cursor.Decode(&order); err != nil {
-			log.Printf("Error decoding order: %v", err)
-			return
-		}
-		orders = append(orders, order)
-	}
-
-	if err := cursor.Err(); err != nil {
-		log.Printf("Cursor error: %v", err)
-		return
-	}
-
-	for _, order := range orders {
-		go processOrder(order, db)
+// StartOrderScheduler rebuilds pending order expirations from Mongo and
+// processes each order once it expires.
+func StartOrderScheduler(db *mongo.Database) {
+	scheduler := expiry.NewScheduler(db, func(order models.Order) {
+		processOrder(order, db)
+	})
+	expiry.SetDefault(scheduler)
+	if err := scheduler.Run(context.Background()); err != nil {
+		log.Printf("Order scheduler stopped: %v", err)
 	}
 }
 
@@ -102,17 +50,31 @@ func processOrder(order models.Order, db *mongo.Database) {
 
 	var transactionData models.TransactionHistory
 	err := transactionCollection.FindOne(ctx, transactionFilter).Decode(&transactionData)
-	if err != nil {
+	if err == mongo.ErrNoDocuments {
+		// Without its transaction there is nothing to complete or refund, and
+		// keeping the order would have it reclaimed on every lease.
+		logs.Logger.Errorf("No transaction for expired order %s of user %s, dropping the order", order.NumberID, order.UserID.Hex())
+		_, err = models.InitializeOrderCollection(db).DeleteOne(ctx, bson.M{"numberId": order.NumberID})
+		if err != nil {
+			logs.Logger.Error(err)
+		}
+		return
+	} else if err != nil {
+		logs.Logger.Error(err)
 		return
-	}
-
-	otpArrived := false
-	if len(transactionData.OTP) != 0 {
-		otpArrived = true
 	}
 
 	formattedData := handlers.FormatDateTime()
-	if otpArrived {
+	state := orderstate.Current(transactionData)
+	if len(transactionData.OTP) != 0 || state == orderstate.SMSReceived || state == orderstate.Completed {
+		if state == orderstate.SMSReceived {
+			_, err = orderstate.Transition(ctx, transactionCollection, transactionFilter, orderstate.Completed,
+				orderstate.ActorScheduler, "order expired after sms", nil)
+			if err != nil && !errors.Is(err, orderstate.ErrIllegalTransition) {
+				logs.Logger.Error(err)
+				return
+			}
+		}
 		orderCollection := models.InitializeOrderCollection(db)
 		_, err = orderCollection.DeleteOne(ctx, bson.M{"numberId": order.NumberID})
 		if err != nil {
@@ -122,47 +84,45 @@ func processOrder(order models.Order, db *mongo.Database) {
 		return
 	}
 
-	// Refund the balnce
-	var apiWalletUser models.ApiWalletUser
-	apiWalletColl := models.InitializeApiWalletuserCollection(db)
-	err = apiWalletColl.FindOne(ctx, bson.M{"userId": order.UserID}).Decode(&apiWalletUser)
-	if err != nil || err == mongo.ErrEmptySlice {
-		logs.Logger.Error(err)
-		return
-	}
-
-	var existingCancelledTransaction models.TransactionHistory
-	err = transactionCollection.FindOne(ctx, bson.M{"id": order.NumberID}).Decode(&existingCancelledTransaction)
+	// Refund the balance if no otp arrived. Going through REFUNDED makes the
+	// refund apply at most once and never after an SMS.
+	price, err := money.Parse(transactionData.Price)
 	if err != nil {
 		logs.Logger.Error(err)
 		return
 	}
 
-	transactionUpdateFilter := bson.M{"id": order.NumberID}
-	transactionpdate := bson.M{
-		"$set": bson.M{
-			"status":    "CANCELLED",
-			"date_time": formattedData,
-		},
-	}
-
-	_, err = transactionCollection.UpdateOne(ctx, transactionUpdateFilter, transactionpdate)
+	session, err := db.Client().StartSession()
 	if err != nil {
 		logs.Logger.Error(err)
 		return
 	}
-
-	// Refund the balance if no otp arrived
-	price, err := strconv.ParseFloat(existingCancelledTransaction.Price, 64)
-	newBalance := apiWalletUser.Balance + price
-	newBalance = math.Round(newBalance*100) / 100
-
-	update := bson.M{
-		"$set": bson.M{"balance": newBalance},
-	}
-	balanceFilter := bson.M{"userId": apiWalletUser.UserID}
-
-	_, err = apiWalletColl.UpdateOne(ctx, balanceFilter, update)
+	defer session.EndSession(context.Background())
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		// An order the upstream already cancelled goes straight to REFUNDED.
+		_, err := orderstate.Transition(sc, transactionCollection, transactionFilter, orderstate.Expired,
+			orderstate.ActorScheduler, "no sms before expiry", bson.M{"$set": bson.M{"date_time": formattedData}})
+		if err != nil && !errors.Is(err, orderstate.ErrIllegalTransition) {
+			return nil, err
+		}
+		_, err = orderstate.Transition(sc, transactionCollection, transactionFilter, orderstate.Refunded,
+			orderstate.ActorScheduler, "refund on expiry", nil)
+		if errors.Is(err, orderstate.ErrIllegalTransition) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		_, err = ledger.Post(sc, db, ledger.Posting{
+			UserID:           order.UserID,
+			Kind:             ledger.KindRefund,
+			Amount:           price,
+			SourceCollection: "transactionhistories",
+			SourceID:         transactionData.ID.Hex(),
+			Note:             "refund on expiry",
+		})
+		return nil, err
+	})
 	if err != nil {
 		logs.Logger.Error(err)
 		return
@@ -177,10 +137,9 @@ func processOrder(order models.Order, db *mongo.Database) {
 		return
 	}
 
-	server := strconv.Itoa(serverInfo.ServerNumber)
-	constructedNumberRequest, err := handlers.ConstructNumberUrl(server, serverInfo.APIKey, serverInfo.Token, order.NumberID, order.Number)
+	provider, err := providers.New(serverInfo)
 	if err != nil {
-		log.Printf("Error constructing third-party request: %v", err)
+		log.Printf("Error resolving provider for order %s: %v", order.NumberID, err)
 		return
 	}
 
@@ -191,7 +150,7 @@ func processOrder(order models.Order, db *mongo.Database) {
 		return
 	}
 
-	err = handlers.CancelNumberThirdParty(constructedNumberRequest.URL, server, order.NumberID, db, constructedNumberRequest.Headers)
+	err = provider.Cancel(order.NumberID, order.Number)
 	if err != nil {
 		log.Printf("Error canceling number via third party: %v", err)
 		return
@@ -2,14 +2,10 @@ package services
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"log"
-	"net/http"
-	"net/url"
-	"time"
 
 	"github.com/ranjankuldeep/fakeNumber/internal/database/models"
+	"github.com/ranjankuldeep/fakeNumber/internal/notify"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -68,95 +64,52 @@ func FetchUser(userID string, db *mongo.Database) (*models.ApiWalletUser, error)
 	return &user, nil
 }
 
-// TrxRechargeTeleBot sends TRX recharge details to Telegram bot
+// TrxRechargeTeleBot notifies staff of a TRX recharge
 func TrxRechargeTeleBot(details TrxRechargeDetails) error {
-	location, err := time.LoadLocation("Asia/Kolkata")
-	if err != nil {
-		log.Fatalf("Failed to load location: %v", err)
-	}
-	result := "Trx Recharge\n\n"
-	result += fmt.Sprintf("Date => %s\n\n", time.Now().In(location).Format("02-01-2006 03:04:05 PM"))
-	result += fmt.Sprintf("User Email => %s\n\n", details.Email)
-	result += fmt.Sprintf("Trx => %s\n\n", details.Trx) // amount of trx
-	result += fmt.Sprintf("Trx Exchange Rate => %s\n\n", details.ExchangeRate)
-	result += fmt.Sprintf("Total Amount in Inr => %s₹\n\n", details.Amount)
-	result += fmt.Sprintf("Updated Balance => %s\n\n", details.Balance)
-	result += fmt.Sprintf("User Trx address => %s\n\n", details.Address)
-	result += fmt.Sprintf("Send To => %s\n\n", details.SendTo)
-	result += fmt.Sprintf("Send Status => %s\n\n", details.Status)
-	result += fmt.Sprintf("Hash Id => %s\n\n", details.Hash)
-	result += fmt.Sprintf("IP Details => \n%s\n\n", details.IP)
-
-	err = sendRCMessage(result)
-	if err != nil {
-		return fmt.Errorf("failed to send message: %v", err)
-	}
-	return nil
+	return publish(notify.Event{
+		Type:  notify.EventRechargeTRX,
+		Title: "Trx Recharge",
+		Fields: []notify.Field{
+			{Name: "User Email", Value: details.Email},
+			{Name: "Trx", Value: details.Trx},
+			{Name: "Trx Exchange Rate", Value: details.ExchangeRate},
+			{Name: "Total Amount in Inr", Value: details.Amount + "₹"},
+			{Name: "Updated Balance", Value: details.Balance},
+			{Name: "User Trx address", Value: details.Address},
+			{Name: "Send To", Value: details.SendTo},
+			{Name: "Send Status", Value: details.Status},
+			{Name: "Hash Id", Value: details.Hash},
+			{Name: "IP Details", Value: details.IP},
+		},
+	})
 }
 
+// UpiRechargeTeleBot notifies staff of a UPI recharge
 func UpiRechargeTeleBot(details UpiRechargeDetails) error {
-	location, err := time.LoadLocation("Asia/Kolkata")
-	if err != nil {
-		log.Fatalf("Failed to load location: %v", err)
-	}
-	result := "Upi Recharge\n\n"
-	result += fmt.Sprintf("Date => %s\n\n", time.Now().In(location).Format("02-01-2006 03:04:05 PM"))
-	result += fmt.Sprintf("User Email => %s\n\n", details.Email)
-	result += fmt.Sprintf("Amount => %s₹\n\n", details.Amount)
-	result += fmt.Sprintf("Updated Balance => %s\n\n", details.Balance)
-	result += fmt.Sprintf("Txn Id => %s\n\n", details.TrnID)
-	result += fmt.Sprintf("IP Details => \n%s\n\n", details.IP)
-
-	// Use sendMessage to send the result
-	err = sendRCMessage(result)
-	if err != nil {
-		return fmt.Errorf("failed to send message: %v", err)
-	}
-	return nil
+	return publish(notify.Event{
+		Type:  notify.EventRechargeUPI,
+		Title: "Upi Recharge",
+		Fields: []notify.Field{
+			{Name: "User Email", Value: details.Email},
+			{Name: "Amount", Value: details.Amount + "₹"},
+			{Name: "Updated Balance", Value: details.Balance},
+			{Name: "Txn Id", Value: details.TrnID},
+			{Name: "IP Details", Value: details.IP},
+		},
+	})
 }
 
+// AdminRechargeTeleBot notifies staff of a balance added by an admin
 func AdminRechargeTeleBot(details AdminRechargeDetails) error {
-	location, err := time.LoadLocation("Asia/Kolkata")
-	if err != nil {
-		log.Fatalf("Failed to load location: %v", err)
-	}
-	result := "Recharge By Admin\n\n"
-	result += fmt.Sprintf("Date => %s\n\n", time.Now().In(location).Format("02-01-2006 03:04:05 PM"))
-	result += fmt.Sprintf("User Email => %s\n\n", details.Email)
-	result += fmt.Sprintf("Amount => %s₹\n\n", details.Amount) // Use string Amount directly
-	result += fmt.Sprintf("Updated Balance => %s\n\n", details.UpdatedBalance)
-	result += fmt.Sprintf("Txn Id => %s\n\n", "Admin")
-	result += fmt.Sprintf("IP Details => \n%s\n\n", details.IP)
-
-	// Use sendMessage to send the result
-	err = sendRCMessage(result)
-	if err != nil {
-		return fmt.Errorf("failed to send message: %v", err)
-	}
-	return nil
-}
-
-func sendRCMessage(message string) error {
-	encodedMessage := url.QueryEscape(message)
-	apiURL := fmt.Sprintf(
-		"https://api.telegram.org/bot6740130325:AAEp1cTpT2o6qgIR4Mb3T2j4s6VDjSVV5Jo/sendMessage?chat_id=6769991787&text=%s",
-		encodedMessage,
-	)
-	resp, err := http.Get(apiURL)
-	if err != nil {
-		return fmt.Errorf("failed to send message: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("HTTP error! status: %d in sending message through TeleBot", resp.StatusCode)
-	}
-	var response numberResponse
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return fmt.Errorf("failed to unmarshal response: %w", err)
-	}
-	if response.Ok == false {
-		return fmt.Errorf("Unable to send Message")
-	}
-	return nil
+	return publish(notify.Event{
+		Type:  notify.EventRechargeAdmin,
+		Title: "Recharge By Admin",
+		Fields: []notify.Field{
+			{Name: "User Email", Value: details.Email},
+			{Name: "Amount", Value: details.Amount + "₹"},
+			{Name: "Updated Balance", Value: details.UpdatedBalance},
+			{Name: "Txn Id", Value: "Admin"},
+			{Name: "IP Details", Value: details.IP},
+		},
+	})
 }
@@ -1,12 +1,10 @@
 package services
 
 import (
-	"encoding/json"
 	"fmt"
-	"net/http"
-	"net/url"
 	"sort"
-	"time"
+
+	"github.com/ranjankuldeep/fakeNumber/internal/notify"
 )
 
 // Struct for selling update details
@@ -29,12 +27,10 @@ type RechargeDetailsSelling struct {
 	AdminAdded float64
 }
 
+// SellingTeleBot sends the periodic selling report to staff
 func SellingTeleBot(details SellingUpdateDetails) error {
-	result := fmt.Sprintf("Date => %s\n\n", time.Now().Format("02-01-2006 03:04:05pm"))
-
-	// Total Selling Update
 	// Total Selling Update
-	result += "Total Number Selling Update\n"
+	result := "Total Number Selling Update\n"
 	result += fmt.Sprintf("Total Sold       => %d\n", details.TotalSold)
 	result += fmt.Sprintf("Total Cancelled  => %d\n", details.TotalCancelled)
 	result += fmt.Sprintf("Total Pending    => %d\n\n", details.TotalPending)
@@ -81,34 +77,9 @@ func SellingTeleBot(details SellingUpdateDetails) error {
 	result += fmt.Sprintf("Website Balance  => %.2f\n", details.WebsiteBalance)
 	result += fmt.Sprintf("Total User Count => %d\n", details.TotalUserCount)
 
-	err := sendSellingMessage(result)
-	if err != nil {
-		return fmt.Errorf("failed to send message: %v", err)
-	}
-	return nil
-}
-
-func sendSellingMessage(message string) error {
-	encodedMessage := url.QueryEscape(message)
-	apiURL := fmt.Sprintf(
-		"https://api.telegram.org/bot7311200292:AAF7NYfNP-DUcCRFevOKU4TYg4i-z2X8jtw/sendMessage?chat_id=6769991787&text=%s",
-		encodedMessage,
-	)
-	resp, err := http.Get(apiURL)
-	if err != nil {
-		return fmt.Errorf("failed to send message: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("HTTP error! status: %d in sending message through TeleBot", resp.StatusCode)
-	}
-	var response numberResponse
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return fmt.Errorf("failed to unmarshal response: %w", err)
-	}
-	if response.Ok == false {
-		return fmt.Errorf("Unable to send Message")
-	}
-	return nil
+	return publish(notify.Event{
+		Type:  notify.EventSellingReport,
+		Title: "Selling Update",
+		Body:  result,
+	})
 }
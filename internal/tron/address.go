@@ -0,0 +1,103 @@
+package tron
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"strings"
+)
+
+// addressPrefix is the first byte of every mainnet address.
+const addressPrefix = 0x41
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+var (
+	ErrInvalidAddress = errors.New("invalid TRON address")
+	ErrInvalidKey     = errors.New("invalid TRON private key")
+)
+
+// Address is a TRON account address: the 0x41 prefix and 20 bytes of the
+// account's public key hash.
+type Address [21]byte
+
+// ParseAddress reads an address in base58check form ("T...") or as the 42
+// hex digits nodes return when asked for non-visible output.
+func ParseAddress(s string) (Address, error) {
+	var a Address
+	s = strings.TrimSpace(s)
+	if len(s) == 2*len(a) {
+		if raw, err := hex.DecodeString(s); err == nil && raw[0] == addressPrefix {
+			copy(a[:], raw)
+			return a, nil
+		}
+	}
+	raw, ok := decodeBase58(s)
+	if !ok || len(raw) != len(a)+4 || raw[0] != addressPrefix {
+		return a, ErrInvalidAddress
+	}
+	payload, sum := raw[:len(a)], raw[len(a):]
+	if !bytes.Equal(checksum(payload), sum) {
+		return a, ErrInvalidAddress
+	}
+	copy(a[:], payload)
+	return a, nil
+}
+
+// String is the base58check form of the address.
+func (a Address) String() string {
+	return encodeBase58(append(a[:], checksum(a[:])...))
+}
+
+// Hex is the address as 42 hex digits.
+func (a Address) Hex() string {
+	return hex.EncodeToString(a[:])
+}
+
+func checksum(payload []byte) []byte {
+	first := sha256.Sum256(payload)
+	second := sha256.Sum256(first[:])
+	return second[:4]
+}
+
+func encodeBase58(raw []byte) string {
+	n := new(big.Int).SetBytes(raw)
+	radix, mod := big.NewInt(58), new(big.Int)
+	var out []byte
+	for n.Sign() > 0 {
+		n.DivMod(n, radix, mod)
+		out = append(out, base58Alphabet[mod.Int64()])
+	}
+	for _, b := range raw {
+		if b != 0 {
+			break
+		}
+		out = append(out, base58Alphabet[0])
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
+
+func decodeBase58(s string) ([]byte, bool) {
+	if s == "" {
+		return nil, false
+	}
+	n, radix := new(big.Int), big.NewInt(58)
+	zeros := 0
+	for zeros < len(s) && s[zeros] == base58Alphabet[0] {
+		zeros++
+	}
+	for i := 0; i < len(s); i++ {
+		digit := strings.IndexByte(base58Alphabet, s[i])
+		if digit < 0 {
+			return nil, false
+		}
+		n.Mul(n, radix)
+		n.Add(n, big.NewInt(int64(digit)))
+	}
+	return append(make([]byte, zeros), n.Bytes()...), true
+}
@@ -0,0 +1,80 @@
+package tron
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseAddress(t *testing.T) {
+	const (
+		base58  = "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t"
+		hexForm = "41a614f803b6fd780986a42c78ec9c7f77e6ded13c"
+	)
+	fromBase58, err := ParseAddress(base58)
+	if err != nil {
+		t.Fatalf("ParseAddress(%q): %v", base58, err)
+	}
+	if got := fromBase58.Hex(); got != hexForm {
+		t.Errorf("Hex() = %s, want %s", got, hexForm)
+	}
+	if got := fromBase58.String(); got != base58 {
+		t.Errorf("String() = %s, want %s", got, base58)
+	}
+	fromHex, err := ParseAddress(" " + strings.ToUpper(hexForm) + " ")
+	if err != nil {
+		t.Fatalf("ParseAddress(hex): %v", err)
+	}
+	if fromHex != fromBase58 {
+		t.Errorf("hex and base58 forms parse to different addresses")
+	}
+}
+
+func TestParseAddressRejects(t *testing.T) {
+	for name, input := range map[string]string{
+		"empty":          "",
+		"bad checksum":   "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6u",
+		"bad alphabet":   "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj60",
+		"truncated":      "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj",
+		"wrong prefix":   "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2",
+		"hex wrong head": "42a614f803b6fd780986a42c78ec9c7f77e6ded13c",
+	} {
+		if _, err := ParseAddress(input); err != ErrInvalidAddress {
+			t.Errorf("%s: ParseAddress(%q) error = %v, want ErrInvalidAddress", name, input, err)
+		}
+	}
+}
+
+func TestAddressOfKey(t *testing.T) {
+	// The key 1 has the well known Ethereum address 0x7e5f...5bdf; TRON
+	// uses the same hash behind its own prefix.
+	address, err := AddressOfKey(strings.Repeat("0", 63) + "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := address.Hex(), "417e5f4552091a69125d5dfcb7b8c2659029395bdf"; got != want {
+		t.Errorf("Hex() = %s, want %s", got, want)
+	}
+	if _, err := AddressOfKey("not hex"); err != ErrInvalidKey {
+		t.Errorf("AddressOfKey(not hex) error = %v, want ErrInvalidKey", err)
+	}
+}
+
+func TestNewKey(t *testing.T) {
+	key, address, err := NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(key) != 64 {
+		t.Errorf("private key has %d hex digits, want 64", len(key))
+	}
+	derived, err := AddressOfKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if derived != address {
+		t.Errorf("NewKey address %s does not belong to its key, want %s", address, derived)
+	}
+	if _, err := ParseAddress(address.String()); err != nil {
+		t.Errorf("ParseAddress(%s): %v", address, err)
+	}
+}
@@ -0,0 +1,218 @@
+// Package tron verifies TRX deposits against a TronGrid-compatible HTTP API,
+// so recharges are credited from what the chain says rather than from a
+// third-party summary of it.
+package tron
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultEndpoint is the public TronGrid mainnet API.
+	DefaultEndpoint = "https://api.trongrid.io"
+	// DefaultConfirmations is the depth at which a block is solidified.
+	DefaultConfirmations = 19
+	// SunPerTRX is the number of sun in one TRX.
+	SunPerTRX = 1_000_000
+
+	transferContract = "TransferContract"
+)
+
+var (
+	ErrInvalidHash         = errors.New("invalid transaction hash")
+	ErrNotFound            = errors.New("transaction not found")
+	ErrFailed              = errors.New("transaction failed on chain")
+	ErrUnsupportedContract = errors.New("only plain TRX transfers are accepted")
+	ErrWrongRecipient      = errors.New("transaction was not sent to your deposit address")
+	ErrUnconfirmed         = errors.New("transaction is not confirmed yet")
+	ErrBeforeAddress       = errors.New("transaction is older than your deposit address")
+)
+
+// Sun is an amount of TRX in its smallest unit.
+type Sun int64
+
+// TRX is the amount in whole TRX.
+func (s Sun) TRX() float64 {
+	return float64(s) / SunPerTRX
+}
+
+// Client queries a TronGrid-compatible node.
+type Client struct {
+	Endpoint string
+	// APIKey is sent as TRON-PRO-API-KEY when set.
+	APIKey string
+	// MinConfirmations is the number of blocks that must follow the one
+	// holding a deposit before it is accepted.
+	MinConfirmations int64
+	HTTPClient       *http.Client
+}
+
+// NewClient returns a client for endpoint, or for DefaultEndpoint if it is
+// empty.
+func NewClient(endpoint, apiKey string) *Client {
+	if endpoint == "" {
+		endpoint = DefaultEndpoint
+	}
+	return &Client{
+		Endpoint:         strings.TrimRight(endpoint, "/"),
+		APIKey:           apiKey,
+		MinConfirmations: DefaultConfirmations,
+		HTTPClient:       &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// Deposit is the address a user was given to pay into, and when it was
+// created.
+type Deposit struct {
+	Address   string
+	CreatedAt time.Time
+}
+
+// Transfer is a verified TRX transfer.
+type Transfer struct {
+	TxID          string
+	From          Address
+	To            Address
+	Amount        Sun
+	BlockNumber   int64
+	Confirmations int64
+	Time          time.Time
+}
+
+// VerifyDeposit checks that hash is a successful, confirmed TRX transfer to
+// the deposit address, made after the address was created.
+func (c *Client) VerifyDeposit(ctx context.Context, hash string, deposit Deposit) (Transfer, error) {
+	hash = strings.ToLower(strings.TrimSpace(hash))
+	if raw, err := hex.DecodeString(hash); err != nil || len(raw) != 32 {
+		return Transfer{}, ErrInvalidHash
+	}
+	want, err := ParseAddress(deposit.Address)
+	if err != nil {
+		return Transfer{}, fmt.Errorf("deposit address: %w", err)
+	}
+
+	var tx struct {
+		TxID string `json:"txID"`
+		Ret  []struct {
+			ContractRet string `json:"contractRet"`
+		} `json:"ret"`
+		RawData struct {
+			Contract []struct {
+				Type      string `json:"type"`
+				Parameter struct {
+					Value struct {
+						Amount       int64  `json:"amount"`
+						OwnerAddress string `json:"owner_address"`
+						ToAddress    string `json:"to_address"`
+					} `json:"value"`
+				} `json:"parameter"`
+			} `json:"contract"`
+		} `json:"raw_data"`
+	}
+	if err := c.call(ctx, "/wallet/gettransactionbyid", map[string]interface{}{"value": hash, "visible": true}, &tx); err != nil {
+		return Transfer{}, err
+	}
+	if tx.TxID == "" {
+		return Transfer{}, ErrNotFound
+	}
+	if len(tx.RawData.Contract) != 1 || tx.RawData.Contract[0].Type != transferContract {
+		return Transfer{}, ErrUnsupportedContract
+	}
+	if len(tx.Ret) == 0 || tx.Ret[0].ContractRet != "SUCCESS" {
+		return Transfer{}, ErrFailed
+	}
+	value := tx.RawData.Contract[0].Parameter.Value
+	to, err := ParseAddress(value.ToAddress)
+	if err != nil || to != want {
+		return Transfer{}, ErrWrongRecipient
+	}
+	from, _ := ParseAddress(value.OwnerAddress)
+	if value.Amount <= 0 {
+		return Transfer{}, ErrUnsupportedContract
+	}
+
+	var info struct {
+		BlockNumber    int64  `json:"blockNumber"`
+		BlockTimeStamp int64  `json:"blockTimeStamp"`
+		Result         string `json:"result"`
+	}
+	if err := c.call(ctx, "/wallet/gettransactioninfobyid", map[string]interface{}{"value": hash}, &info); err != nil {
+		return Transfer{}, err
+	}
+	if info.BlockNumber == 0 {
+		return Transfer{}, ErrUnconfirmed
+	}
+	if info.Result == "FAILED" {
+		return Transfer{}, ErrFailed
+	}
+
+	var block struct {
+		BlockHeader struct {
+			RawData struct {
+				Number int64 `json:"number"`
+			} `json:"raw_data"`
+		} `json:"block_header"`
+	}
+	if err := c.call(ctx, "/wallet/getnowblock", nil, &block); err != nil {
+		return Transfer{}, err
+	}
+	confirmations := block.BlockHeader.RawData.Number - info.BlockNumber
+	if confirmations < c.MinConfirmations {
+		return Transfer{}, ErrUnconfirmed
+	}
+
+	paidAt := time.UnixMilli(info.BlockTimeStamp)
+	if paidAt.Before(deposit.CreatedAt) {
+		return Transfer{}, ErrBeforeAddress
+	}
+	return Transfer{
+		TxID:          hash,
+		From:          from,
+		To:            to,
+		Amount:        Sun(value.Amount),
+		BlockNumber:   info.BlockNumber,
+		Confirmations: confirmations,
+		Time:          paidAt,
+	}, nil
+}
+
+// call posts body to the node and decodes its JSON answer into out. Nodes
+// answer unknown transactions with an empty object, which leaves out zero.
+func (c *Client) call(ctx context.Context, path string, body interface{}, out interface{}) error {
+	payload := []byte("{}")
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.Endpoint+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if c.APIKey != "" {
+		req.Header.Set("TRON-PRO-API-KEY", c.APIKey)
+	}
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("tron node %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("tron node %s: status %d", path, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("tron node %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package tron
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	depositAddress = "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t"
+	payerAddress   = "TMVQGm1qAQYVdetCeGRRkTWYYrLXuHK2HC"
+)
+
+var txHash = strings.Repeat("ab", 32)
+
+// stubNode answers the three calls VerifyDeposit makes with the fields set
+// on it.
+type stubNode struct {
+	contractType string
+	contractRet  string
+	to           string
+	amount       int64
+	blockNumber  int64
+	blockTime    time.Time
+	result       string
+	nowBlock     int64
+	apiKey       string
+}
+
+func newStubNode(t *testing.T) (*stubNode, *Client) {
+	node := &stubNode{
+		contractType: transferContract,
+		contractRet:  "SUCCESS",
+		to:           depositAddress,
+		amount:       25 * SunPerTRX,
+		blockNumber:  1000,
+		blockTime:    time.Now().Add(-time.Minute),
+		nowBlock:     1000 + DefaultConfirmations,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		node.apiKey = r.Header.Get("TRON-PRO-API-KEY")
+		var body struct {
+			Value string `json:"value"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		known := body.Value == txHash
+		var out interface{} = map[string]interface{}{}
+		switch r.URL.Path {
+		case "/wallet/gettransactionbyid":
+			if known {
+				out = map[string]interface{}{
+					"txID": txHash,
+					"ret":  []map[string]string{{"contractRet": node.contractRet}},
+					"raw_data": map[string]interface{}{
+						"contract": []map[string]interface{}{{
+							"type": node.contractType,
+							"parameter": map[string]interface{}{"value": map[string]interface{}{
+								"amount":        node.amount,
+								"owner_address": payerAddress,
+								"to_address":    node.to,
+							}},
+						}},
+					},
+				}
+			}
+		case "/wallet/gettransactioninfobyid":
+			if known {
+				info := map[string]interface{}{
+					"blockNumber":    node.blockNumber,
+					"blockTimeStamp": node.blockTime.UnixMilli(),
+				}
+				if node.result != "" {
+					info["result"] = node.result
+				}
+				out = info
+			}
+		case "/wallet/getnowblock":
+			out = map[string]interface{}{"block_header": map[string]interface{}{"raw_data": map[string]int64{"number": node.nowBlock}}}
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(out)
+	}))
+	t.Cleanup(server.Close)
+	return node, NewClient(server.URL, "test-key")
+}
+
+func deposit() Deposit {
+	return Deposit{Address: depositAddress, CreatedAt: time.Now().Add(-time.Hour)}
+}
+
+func TestVerifyDeposit(t *testing.T) {
+	node, client := newStubNode(t)
+	transfer, err := client.VerifyDeposit(context.Background(), strings.ToUpper(txHash), deposit())
+	if err != nil {
+		t.Fatalf("VerifyDeposit: %v", err)
+	}
+	if transfer.TxID != txHash {
+		t.Errorf("TxID = %s, want %s", transfer.TxID, txHash)
+	}
+	if transfer.Amount != 25*SunPerTRX || transfer.Amount.TRX() != 25 {
+		t.Errorf("Amount = %d sun, want 25 TRX", transfer.Amount)
+	}
+	if transfer.From.String() != payerAddress || transfer.To.String() != depositAddress {
+		t.Errorf("transfer is %s -> %s, want %s -> %s", transfer.From, transfer.To, payerAddress, depositAddress)
+	}
+	if transfer.Confirmations != DefaultConfirmations {
+		t.Errorf("Confirmations = %d, want %d", transfer.Confirmations, DefaultConfirmations)
+	}
+	if node.apiKey != "test-key" {
+		t.Errorf("TRON-PRO-API-KEY = %q, want test-key", node.apiKey)
+	}
+}
+
+func TestVerifyDepositRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		hash    string
+		deposit Deposit
+		modify  func(*stubNode)
+		want    error
+	}{
+		{name: "malformed hash", hash: "abc", want: ErrInvalidHash},
+		{name: "unknown transaction", hash: strings.Repeat("cd", 32), want: ErrNotFound},
+		{name: "token transfer", modify: func(n *stubNode) { n.contractType = "TriggerSmartContract" }, want: ErrUnsupportedContract},
+		{name: "zero amount", modify: func(n *stubNode) { n.amount = 0 }, want: ErrUnsupportedContract},
+		{name: "reverted", modify: func(n *stubNode) { n.contractRet = "REVERT" }, want: ErrFailed},
+		{name: "failed on chain", modify: func(n *stubNode) { n.result = "FAILED" }, want: ErrFailed},
+		{name: "other recipient", modify: func(n *stubNode) { n.to = payerAddress }, want: ErrWrongRecipient},
+		{name: "not in a block", modify: func(n *stubNode) { n.blockNumber = 0 }, want: ErrUnconfirmed},
+		{name: "too few confirmations", modify: func(n *stubNode) { n.nowBlock = n.blockNumber + 3 }, want: ErrUnconfirmed},
+		{
+			name:    "paid before the address existed",
+			deposit: Deposit{Address: depositAddress, CreatedAt: time.Now()},
+			want:    ErrBeforeAddress,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node, client := newStubNode(t)
+			if tt.modify != nil {
+				tt.modify(node)
+			}
+			hash := txHash
+			if tt.hash != "" {
+				hash = tt.hash
+			}
+			d := deposit()
+			if !tt.deposit.CreatedAt.IsZero() {
+				d = tt.deposit
+			}
+			if _, err := client.VerifyDeposit(context.Background(), hash, d); !errors.Is(err, tt.want) {
+				t.Errorf("VerifyDeposit error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyDepositNodeDown(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	_, err := NewClient(server.URL, "").VerifyDeposit(context.Background(), txHash, deposit())
+	if err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("VerifyDeposit error = %v, want a node error", err)
+	}
+}
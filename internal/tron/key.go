@@ -0,0 +1,41 @@
+package tron
+
+import (
+	"encoding/hex"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"golang.org/x/crypto/sha3"
+)
+
+// NewKey generates a secp256k1 key pair locally and returns the private key
+// as 64 hex digits together with its address.
+func NewKey() (string, Address, error) {
+	key, err := secp256k1.GeneratePrivateKey()
+	if err != nil {
+		return "", Address{}, err
+	}
+	defer key.Zero()
+	return hex.EncodeToString(key.Serialize()), addressOf(key.PubKey()), nil
+}
+
+// AddressOfKey returns the address of a private key given as hex digits.
+func AddressOfKey(privateKey string) (Address, error) {
+	raw, err := hex.DecodeString(privateKey)
+	if err != nil || len(raw) != secp256k1.PrivKeyBytesLen {
+		return Address{}, ErrInvalidKey
+	}
+	return addressOf(secp256k1.PrivKeyFromBytes(raw).PubKey()), nil
+}
+
+// addressOf is the prefix byte followed by the last 20 bytes of the
+// Keccak-256 hash of the uncompressed public key without its 0x04 tag.
+func addressOf(pub *secp256k1.PublicKey) Address {
+	hash := sha3.NewLegacyKeccak256()
+	hash.Write(pub.SerializeUncompressed()[1:])
+	sum := hash.Sum(nil)
+
+	var a Address
+	a[0] = addressPrefix
+	copy(a[1:], sum[len(sum)-20:])
+	return a
+}
@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"crypto/subtle"
+	"errors"
+	"strings"
+	"unicode"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordCost is the bcrypt cost for stored passwords. Hashes made with a
+// lower cost are upgraded on the next successful login.
+const PasswordCost = 12
+
+const (
+	minPasswordLength = 8
+	// bcrypt ignores everything after 72 bytes.
+	maxPasswordLength = 72
+)
+
+var (
+	ErrPasswordTooShort = errors.New("password must be at least 8 characters")
+	ErrPasswordTooLong  = errors.New("password must be at most 72 characters")
+	ErrPasswordTooWeak  = errors.New("password must contain a letter and a digit")
+	ErrPasswordIsEmail  = errors.New("password must not contain your email")
+)
+
+// HashPassword hashes a password for storage.
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), PasswordCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// CheckPassword reports whether password matches the stored value and
+// whether the stored value should be replaced by a fresh hash. Stored values
+// that are not bcrypt hashes are legacy plaintext passwords.
+func CheckPassword(stored, password string) (ok bool, rehash bool) {
+	if !isBcryptHash(stored) {
+		ok = stored != "" && subtle.ConstantTimeCompare([]byte(stored), []byte(password)) == 1
+		return ok, ok
+	}
+	if bcrypt.CompareHashAndPassword([]byte(stored), []byte(password)) != nil {
+		return false, false
+	}
+	cost, err := bcrypt.Cost([]byte(stored))
+	return true, err == nil && cost < PasswordCost
+}
+
+// ValidatePasswordStrength enforces the password policy for new passwords.
+func ValidatePasswordStrength(password, email string) error {
+	if len(password) < minPasswordLength {
+		return ErrPasswordTooShort
+	}
+	if len(password) > maxPasswordLength {
+		return ErrPasswordTooLong
+	}
+	var letter, digit bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLetter(r):
+			letter = true
+		case unicode.IsDigit(r):
+			digit = true
+		}
+	}
+	if !letter || !digit {
+		return ErrPasswordTooWeak
+	}
+	if local, _, _ := strings.Cut(strings.ToLower(email), "@"); len(local) >= 3 && strings.Contains(strings.ToLower(password), local) {
+		return ErrPasswordIsEmail
+	}
+	return nil
+}
+
+func isBcryptHash(s string) bool {
+	return len(s) == 60 && (strings.HasPrefix(s, "$2a$") || strings.HasPrefix(s, "$2b$") || strings.HasPrefix(s, "$2y$"))
+}